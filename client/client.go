@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -28,7 +29,12 @@ type Found struct {
 }
 
 func (f *Found) String() string {
-	return fmt.Sprintf("%s (%s / %s:%d): %s", f.Name, f.Hostname, f.IP, f.Port, f.Text)
+	return fmt.Sprintf("%s (%s / %s): %s", f.Name, f.Hostname, f.Addr(), f.Text)
+}
+
+// Addr returns the address to pass to Dial, with IPv6 addresses in brackets.
+func (f *Found) Addr() string {
+	return net.JoinHostPort(f.IP.String(), strconv.Itoa(f.Port))
 }
 
 // Search searches for devices on the local network that implements the esphome
@@ -61,11 +67,7 @@ func Search(ctx context.Context, first bool) ([]*Found, error) {
 				Port:     e.Port,
 				Text:     e.Text,
 			}
-			if len(e.AddrIPv4) != 0 {
-				f.IP = e.AddrIPv4[0]
-			} else if len(e.AddrIPv6) != 0 {
-				f.IP = e.AddrIPv6[0]
-			}
+			f.IP = pickIP(e.AddrIPv4, e.AddrIPv6)
 			out = append(out, f)
 			if first {
 				cancel()
@@ -81,3 +83,23 @@ func Search(ctx context.Context, first bool) ([]*Found, error) {
 	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
 	return out, err
 }
+
+// pickIP returns the address to use to connect to a device.
+//
+// IPv4 is preferred when available. On IPv6-only networks, a global address
+// is preferred over a link local one, since the latter requires the interface
+// zone to be usable, which mDNS doesn't provide.
+func pickIP(v4, v6 []net.IP) net.IP {
+	if len(v4) != 0 {
+		return v4[0]
+	}
+	for _, ip := range v6 {
+		if !ip.IsLinkLocalUnicast() {
+			return ip
+		}
+	}
+	if len(v6) != 0 {
+		return v6[0]
+	}
+	return nil
+}
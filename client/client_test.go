@@ -0,0 +1,37 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPickIP(t *testing.T) {
+	v4 := net.ParseIP("192.168.1.2")
+	global := net.ParseIP("2001:db8::2")
+	local := net.ParseIP("fe80::2")
+	data := []struct {
+		v4, v6 []net.IP
+		want   net.IP
+	}{
+		{[]net.IP{v4}, []net.IP{global}, v4},
+		{nil, []net.IP{local, global}, global},
+		{nil, []net.IP{local}, local},
+		{nil, nil, nil},
+	}
+	for i, l := range data {
+		if got := pickIP(l.v4, l.v6); !got.Equal(l.want) {
+			t.Errorf("#%d: %s != %s", i, got, l.want)
+		}
+	}
+}
+
+func TestFound_Addr(t *testing.T) {
+	f := Found{IP: net.ParseIP("2001:db8::2"), Port: 6053}
+	if got := f.Addr(); got != "[2001:db8::2]:6053" {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+const (
+	// handshakeTimeout bounds the time to connect and authenticate.
+	handshakeTimeout = 10 * time.Second
+	// hmacChallenge precedes the hex encoded nonce in HelloResponse.ServerInfo
+	// when the node uses api/auth "hmac".
+	hmacChallenge = " hmac="
+)
+
+// State is a state update of an entity.
+type State struct {
+	// Key is the entity key, as returned by ListEntities.
+	Key uint32
+	// Msg is the state, e.g. *aioesphomeapi.SensorStateResponse.
+	Msg proto.Message
+
+	_ struct{}
+}
+
+// Conn is a native API connection to a node.
+type Conn struct {
+	// ServerInfo is the description of the node sent upon connection.
+	ServerInfo string
+
+	c   net.Conn
+	wmu sync.Mutex
+}
+
+// Dial connects to the node at addr, e.g. "192.168.1.2:6053", and
+// authenticates with the password, if any.
+//
+// When the node challenges the client, the password is not sent but proven
+// with an HMAC of the challenge. When requireHMAC is true, Dial fails instead
+// of sending the password in clear to a node that doesn't challenge it, e.g.
+// an impostor or a node downgraded to api/auth "password".
+func Dial(ctx context.Context, addr, password string, requireHMAC bool) (*Conn, error) {
+	d := net.Dialer{Timeout: handshakeTimeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{c: nc}
+	if err = c.handshake(password, requireHMAC); err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Conn) handshake(password string, requireHMAC bool) error {
+	if err := c.c.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return err
+	}
+	if err := c.send(&aioesphomeapi.HelloRequest{ClientInfo: "periphhome"}); err != nil {
+		return err
+	}
+	msg, err := readMsg(c.c)
+	if err != nil {
+		return err
+	}
+	h, ok := msg.(*aioesphomeapi.HelloResponse)
+	if !ok {
+		return fmt.Errorf("expected HelloResponse, got %T", msg)
+	}
+	c.ServerInfo = h.ServerInfo
+	if i := strings.Index(h.ServerInfo, hmacChallenge); i != -1 {
+		nonce, err := hex.DecodeString(h.ServerInfo[i+len(hmacChallenge):])
+		if err != nil {
+			return fmt.Errorf("invalid hmac challenge: %w", err)
+		}
+		c.ServerInfo = h.ServerInfo[:i]
+		password = hmacPassword(password, nonce)
+	} else if requireHMAC {
+		return errors.New("the node didn't send an hmac challenge, not sending the password")
+	}
+	if err = c.send(&aioesphomeapi.ConnectRequest{Password: password}); err != nil {
+		return err
+	}
+	if msg, err = readMsg(c.c); err != nil {
+		return err
+	}
+	r, ok := msg.(*aioesphomeapi.ConnectResponse)
+	if !ok {
+		return fmt.Errorf("expected ConnectResponse, got %T", msg)
+	}
+	if r.InvalidPassword {
+		return errors.New("invalid password")
+	}
+	return c.c.SetDeadline(time.Time{})
+}
+
+// hmacPassword returns the response to the nonce sent instead of the
+// password.
+func hmacPassword(password string, nonce []byte) string {
+	h := hmac.New(sha256.New, []byte(password))
+	_, _ = h.Write(nonce)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Close disconnects from the node.
+func (c *Conn) Close() error {
+	// Best effort, the node may already be gone.
+	_ = c.c.SetWriteDeadline(time.Now().Add(time.Second))
+	_ = c.send(&aioesphomeapi.DisconnectRequest{})
+	return c.c.Close()
+}
+
+// DeviceInfo returns the description of the node.
+func (c *Conn) DeviceInfo(ctx context.Context) (*aioesphomeapi.DeviceInfoResponse, error) {
+	var out *aioesphomeapi.DeviceInfoResponse
+	err := c.call(ctx, &aioesphomeapi.DeviceInfoRequest{}, func(msg proto.Message) bool {
+		out, _ = msg.(*aioesphomeapi.DeviceInfoResponse)
+		return out != nil
+	})
+	return out, err
+}
+
+// ListEntities returns the description of all the entities exposed by the
+// node, e.g. *aioesphomeapi.ListEntitiesSensorResponse.
+func (c *Conn) ListEntities(ctx context.Context) ([]proto.Message, error) {
+	var out []proto.Message
+	err := c.call(ctx, &aioesphomeapi.ListEntitiesRequest{}, func(msg proto.Message) bool {
+		if _, ok := msg.(*aioesphomeapi.ListEntitiesDoneResponse); ok {
+			return true
+		}
+		if isListEntitiesResponse(msg.ProtoReflect().Descriptor()) {
+			out = append(out, msg)
+		}
+		return false
+	})
+	return out, err
+}
+
+// call sends req and passes the messages received to on until it returns
+// true. The pings are answered meanwhile.
+func (c *Conn) call(ctx context.Context, req proto.Message, on func(msg proto.Message) bool) error {
+	if err := c.send(req); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		// Unblock readMsg() when ctx is canceled.
+		select {
+		case <-ctx.Done():
+			_ = c.c.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	for {
+		msg, err := readMsg(c.c)
+		if err != nil {
+			if err2 := ctx.Err(); err2 != nil {
+				return err2
+			}
+			return err
+		}
+		switch msg.(type) {
+		case *aioesphomeapi.PingRequest:
+			if err = c.send(&aioesphomeapi.PingResponse{}); err != nil {
+				return err
+			}
+		case *aioesphomeapi.DisconnectRequest:
+			_ = c.send(&aioesphomeapi.DisconnectResponse{})
+			return errors.New("disconnected by the node")
+		default:
+			if on(msg) {
+				return nil
+			}
+		}
+	}
+}
+
+// SubscribeStates subscribes to the state updates of all the entities.
+//
+// The channel is closed when ctx is canceled or the connection is lost. No
+// other message can be received on the connection afterward.
+func (c *Conn) SubscribeStates(ctx context.Context) (<-chan State, error) {
+	if err := c.send(&aioesphomeapi.SubscribeStatesRequest{}); err != nil {
+		return nil, err
+	}
+	ch := make(chan State)
+	stop := make(chan struct{})
+	go func() {
+		// Unblock readMsg() when ctx is canceled.
+		select {
+		case <-ctx.Done():
+			_ = c.c.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	go func() {
+		defer close(ch)
+		defer close(stop)
+		done := ctx.Done()
+		for {
+			msg, err := readMsg(c.c)
+			if err != nil {
+				return
+			}
+			switch m := msg.(type) {
+			case *aioesphomeapi.PingRequest:
+				if c.send(&aioesphomeapi.PingResponse{}) != nil {
+					return
+				}
+			case *aioesphomeapi.DisconnectRequest:
+				_ = c.send(&aioesphomeapi.DisconnectResponse{})
+				return
+			default:
+				k, ok := stateKey(m)
+				if !ok {
+					continue
+				}
+				select {
+				case ch <- State{Key: k, Msg: m}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (c *Conn) send(msg proto.Message) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return writeMsg(c.c, msg)
+}
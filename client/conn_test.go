@@ -0,0 +1,257 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestConn_List(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	entities := []proto.Message{
+		&aioesphomeapi.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature"},
+		&aioesphomeapi.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 2, Name: "Relay"},
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- fakeListNode(ln, entities)
+	}()
+
+	ctx := context.Background()
+	c, err := Dial(ctx, ln.Addr().String(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ServerInfo != "fake" {
+		t.Fatalf("unexpected %q", c.ServerInfo)
+	}
+	info, err := c.DeviceInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "pi" || info.Model != "Raspberry Pi 4" {
+		t.Fatalf("unexpected %v", info)
+	}
+	got, err := c.ListEntities(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entities) {
+		t.Fatalf("unexpected %v", got)
+	}
+	for i := range got {
+		if !proto.Equal(got[i], entities[i]) {
+			t.Fatalf("#%d: unexpected %v", i, got[i])
+		}
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConn_SubscribeStates(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- fakeDisconnectNode(ln)
+	}()
+
+	ctx := context.Background()
+	c, err := Dial(ctx, ln.Addr().String(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ch, err := c.SubscribeStates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []State
+	for s := range ch {
+		got = append(got, s)
+	}
+	// The node asked to disconnect, which closed the channel.
+	if len(got) != 2 || got[0].Key != 1 || got[1].Key != 2 {
+		t.Fatalf("unexpected %v", got)
+	}
+	if _, ok := got[1].Msg.(*aioesphomeapi.BinarySensorStateResponse); !ok {
+		t.Fatalf("unexpected %T", got[1].Msg)
+	}
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConn_HMAC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- fakeHMACNode(ln)
+	}()
+	c, err := Dial(context.Background(), ln.Addr().String(), "Foo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ServerInfo != "fake" {
+		t.Fatalf("unexpected %q", c.ServerInfo)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConn_RequireHMAC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	errs := make(chan error, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer c.Close()
+		err = serve(c, []step{
+			{&aioesphomeapi.HelloRequest{}, []proto.Message{&aioesphomeapi.HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3, ServerInfo: "fake"}}},
+		})
+		if err != nil {
+			errs <- err
+			return
+		}
+		// The client hangs up instead of sending the password.
+		if msg, err := readMsg(c); err == nil {
+			errs <- fmt.Errorf("unexpected %T", msg)
+			return
+		}
+		errs <- nil
+	}()
+	if c, err := Dial(context.Background(), ln.Addr().String(), "Foo", true); err == nil {
+		_ = c.Close()
+		t.Fatal("expected error")
+	}
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeHMACNode serves one connection, challenging the client for the
+// password "Foo".
+func fakeHMACNode(ln net.Listener) error {
+	c, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	err = serve(c, []step{
+		{&aioesphomeapi.HelloRequest{}, []proto.Message{&aioesphomeapi.HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3, ServerInfo: "fake hmac=000102030405060708090a0b0c0d0e0f"}}},
+	})
+	if err != nil {
+		return err
+	}
+	msg, err := readMsg(c)
+	if err != nil {
+		return err
+	}
+	r, ok := msg.(*aioesphomeapi.ConnectRequest)
+	if !ok {
+		return fmt.Errorf("expected ConnectRequest, got %T", msg)
+	}
+	if want := "7a8aca48d9cb09894182d6708b20e10b5bd64b9ac7dabb0cba7a453a73d08733"; r.Password != want {
+		return fmt.Errorf("got password %q; want %q", r.Password, want)
+	}
+	if err = writeMsg(c, &aioesphomeapi.ConnectResponse{}); err != nil {
+		return err
+	}
+	return serve(c, []step{
+		{&aioesphomeapi.DisconnectRequest{}, nil},
+	})
+}
+
+// fakeDisconnectNode serves one connection, sending states and a ping, then
+// asks the client to disconnect.
+func fakeDisconnectNode(ln net.Listener) error {
+	c, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return serve(c, []step{
+		{&aioesphomeapi.HelloRequest{}, []proto.Message{&aioesphomeapi.HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3}}},
+		{&aioesphomeapi.ConnectRequest{}, []proto.Message{&aioesphomeapi.ConnectResponse{}}},
+		{&aioesphomeapi.SubscribeStatesRequest{}, []proto.Message{&aioesphomeapi.SensorStateResponse{Key: 1, State: 21}, &aioesphomeapi.PingRequest{}}},
+		{&aioesphomeapi.PingResponse{}, []proto.Message{&aioesphomeapi.BinarySensorStateResponse{Key: 2, State: true}, &aioesphomeapi.DisconnectRequest{}}},
+		{&aioesphomeapi.DisconnectResponse{}, nil},
+	})
+}
+
+// fakeListNode serves one connection, answering DeviceInfo and ListEntities
+// with unrelated messages interleaved.
+func fakeListNode(ln net.Listener, entities []proto.Message) error {
+	c, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return serve(c, []step{
+		{&aioesphomeapi.HelloRequest{}, []proto.Message{&aioesphomeapi.HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3, ServerInfo: "fake"}}},
+		{&aioesphomeapi.ConnectRequest{}, []proto.Message{&aioesphomeapi.ConnectResponse{}}},
+		{&aioesphomeapi.DeviceInfoRequest{}, []proto.Message{&aioesphomeapi.PingRequest{}}},
+		{&aioesphomeapi.PingResponse{}, []proto.Message{&aioesphomeapi.DeviceInfoResponse{Name: "pi", Model: "Raspberry Pi 4"}}},
+		{&aioesphomeapi.ListEntitiesRequest{}, append(append([]proto.Message{entities[0], &aioesphomeapi.SensorStateResponse{Key: 1}}, entities[1:]...), &aioesphomeapi.ListEntitiesDoneResponse{})},
+		{&aioesphomeapi.DisconnectRequest{}, nil},
+	})
+}
+
+// step is a message expected by a fake node and its replies.
+type step struct {
+	want  proto.Message
+	reply []proto.Message
+}
+
+// serve runs the steps on c.
+func serve(c net.Conn, steps []step) error {
+	for _, s := range steps {
+		got, err := readMsg(c)
+		if err != nil {
+			return err
+		}
+		if proto.MessageName(got) != proto.MessageName(s.want) {
+			return fmt.Errorf("expected %s, got %s", proto.MessageName(s.want), proto.MessageName(got))
+		}
+		for _, m := range s.reply {
+			if err = writeMsg(c, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
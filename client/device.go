@@ -0,0 +1,117 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Reconnection backoff, doubling after each failed attempt.
+var (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Device is a connection to a node that reconnects automatically.
+//
+// The states are resubscribed to after each reconnection. Only the state
+// updates with a new value are sent on States(), so the resubscription doesn't
+// repeat the values already seen.
+type Device struct {
+	addr        string
+	password    string
+	requireHMAC bool
+	states      chan State
+
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// NewDevice starts connecting to the node at addr in the background.
+//
+// password and requireHMAC are used like in Dial.
+func NewDevice(ctx context.Context, addr, password string, requireHMAC bool) *Device {
+	d := &Device{addr: addr, password: password, requireHMAC: requireHMAC, states: make(chan State)}
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer close(d.states)
+		d.run(ctx)
+	}()
+	return d
+}
+
+// States returns the deduplicated state updates of all the entities.
+//
+// The channel is closed by Close().
+func (d *Device) States() <-chan State {
+	return d.states
+}
+
+// Close disconnects and stops reconnecting.
+func (d *Device) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	return nil
+}
+
+func (d *Device) run(ctx context.Context) {
+	last := map[uint32]proto.Message{}
+	backoff := minBackoff
+	done := ctx.Done()
+	for {
+		if d.session(ctx, last) {
+			backoff = minBackoff
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// session connects and forwards the states until the connection is lost.
+//
+// Returns true if the connection succeeded.
+func (d *Device) session(ctx context.Context, last map[uint32]proto.Message) bool {
+	c, err := Dial(ctx, d.addr, d.password, d.requireHMAC)
+	if err != nil {
+		log.Printf("%s: %s", d.addr, err)
+		return false
+	}
+	defer c.Close()
+	ch, err := c.SubscribeStates(ctx)
+	if err != nil {
+		log.Printf("%s: %s", d.addr, err)
+		return true
+	}
+	done := ctx.Done()
+	for s := range ch {
+		if prev := last[s.Key]; prev != nil && proto.Equal(prev, s.Msg) {
+			continue
+		}
+		last[s.Key] = s.Msg
+		select {
+		case d.states <- s:
+		case <-done:
+			// Drain so the reader exits.
+			for range ch {
+			}
+			return true
+		}
+	}
+	log.Printf("%s: disconnected", d.addr)
+	return true
+}
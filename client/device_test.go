@@ -0,0 +1,119 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestDevice(t *testing.T) {
+	old := minBackoff
+	minBackoff = 10 * time.Millisecond
+	defer func() {
+		minBackoff = old
+	}()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	sensor := func(key uint32, v float32) proto.Message {
+		return &aioesphomeapi.SensorStateResponse{Key: key, State: v}
+	}
+	// Each session is what the fake node sends after SubscribeStatesRequest.
+	sessions := [][]proto.Message{
+		{sensor(1, 1), sensor(1, 1), &aioesphomeapi.PingRequest{}, sensor(2, 5)},
+		{sensor(1, 1), sensor(1, 2)},
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- fakeNode(ln, sessions)
+	}()
+
+	d := NewDevice(context.Background(), ln.Addr().String(), "secret", false)
+	defer d.Close()
+	want := []proto.Message{sensor(1, 1), sensor(2, 5), sensor(1, 2)}
+	for i, w := range want {
+		select {
+		case s := <-d.States():
+			if !proto.Equal(s.Msg, w) || s.Key != w.(*aioesphomeapi.SensorStateResponse).Key {
+				t.Fatalf("#%d: unexpected %v", i, s.Msg)
+			}
+		case err := <-errs:
+			t.Fatal(err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out")
+		}
+	}
+	if err = d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeNode serves one connection per session, then waits for the client to
+// disconnect.
+func fakeNode(ln net.Listener, sessions [][]proto.Message) error {
+	for i, msgs := range sessions {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		expect := func(want proto.Message) error {
+			got, err := readMsg(c)
+			if err != nil {
+				return err
+			}
+			if proto.MessageName(got) != proto.MessageName(want) {
+				return fmt.Errorf("expected %s, got %s", proto.MessageName(want), proto.MessageName(got))
+			}
+			return nil
+		}
+		if err = expect(&aioesphomeapi.HelloRequest{}); err != nil {
+			return err
+		}
+		if err = writeMsg(c, &aioesphomeapi.HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3}); err != nil {
+			return err
+		}
+		if err = expect(&aioesphomeapi.ConnectRequest{}); err != nil {
+			return err
+		}
+		if err = writeMsg(c, &aioesphomeapi.ConnectResponse{}); err != nil {
+			return err
+		}
+		if err = expect(&aioesphomeapi.SubscribeStatesRequest{}); err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if err = writeMsg(c, m); err != nil {
+				return err
+			}
+			if _, ok := m.(*aioesphomeapi.PingRequest); ok {
+				if err = expect(&aioesphomeapi.PingResponse{}); err != nil {
+					return err
+				}
+			}
+		}
+		if i == len(sessions)-1 {
+			// The client disconnects on Close().
+			if err = expect(&aioesphomeapi.DisconnectRequest{}); err != nil {
+				return err
+			}
+		}
+		if err = c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
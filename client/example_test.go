@@ -0,0 +1,54 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"periph.io/x/home/client"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func ExampleConn_SubscribeStates() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		// Stop on Ctrl-C.
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		cancel()
+	}()
+
+	c, err := client.Dial(ctx, "192.168.1.2:6053", "", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	entities, err := c.ListEntities(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	names := map[uint32]string{}
+	for _, e := range entities {
+		if s, ok := e.(*aioesphomeapi.ListEntitiesSensorResponse); ok {
+			names[s.Key] = s.Name
+		}
+	}
+	states, err := c.SubscribeStates(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The channel is closed when the node disconnects.
+	for s := range states {
+		if m, ok := s.Msg.(*aioesphomeapi.SensorStateResponse); ok && !m.MissingState {
+			fmt.Printf("%s: %g\n", names[s.Key], m.State)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// This is the client half of the framing in node/api.go.
+
+// writeMsg writes one message.
+func writeMsg(w io.Writer, msg proto.Message) error {
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 1, 1+binary.MaxVarintLen32*2+len(raw))
+	var buf [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(buf[:], uint64(len(raw)))
+	b = append(b, buf[:n]...)
+	n = binary.PutUvarint(buf[:], uint64(msgID(msg)))
+	b = append(b, buf[:n]...)
+	b = append(b, raw...)
+	_, err = w.Write(b)
+	return err
+}
+
+// readMsg reads one message and returns it.
+func readMsg(r io.Reader) (proto.Message, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	if b[0] != 0 {
+		return nil, errors.New("expected byte zero")
+	}
+	msgsize, err := readVarUint(r)
+	if err != nil {
+		return nil, err
+	}
+	if msgsize > 1024*1024 {
+		return nil, fmt.Errorf("msg size too large %d", msgsize)
+	}
+	id, err := readVarUint(r)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, msgsize)
+	if _, err = io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+	msg, err := msgByID(int(id))
+	if err != nil {
+		return nil, err
+	}
+	if err = proto.Unmarshal(raw, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// readVarUint is similar to binary.Uvarint() but reads one byte at a time.
+func readVarUint(r io.Reader) (uint64, error) {
+	var buf [1]byte
+	var x uint64
+	var s uint
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return 0, err
+		}
+		b := buf[0]
+		if b < 0x80 {
+			if i >= binary.MaxVarintLen64 || i == binary.MaxVarintLen64-1 && b > 1 {
+				return 0, errors.New("overflow")
+			}
+			return x | uint64(b)<<s, nil
+		}
+		x |= uint64(b&0x7f) << s
+		s += 7
+	}
+}
+
+// msgID returns the message ID as defined in api.proto.
+func msgID(msg proto.Message) int {
+	opts := msg.ProtoReflect().Descriptor().Options()
+	return int(proto.GetExtension(opts, aioesphomeapi.E_Id).(uint32))
+}
+
+// msgByID returns a new message for the message ID as defined in api.proto.
+func msgByID(id int) (proto.Message, error) {
+	msgs := aioesphomeapi.File_api_proto.Messages()
+	for i := 0; i < msgs.Len(); i++ {
+		d := msgs.Get(i)
+		if int(proto.GetExtension(d.Options(), aioesphomeapi.E_Id).(uint32)) != id {
+			continue
+		}
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(d.FullName())
+		if err != nil {
+			return nil, err
+		}
+		return mt.New().Interface(), nil
+	}
+	return nil, fmt.Errorf("unknown message id %d", id)
+}
+
+// stateKey returns the entity key if msg is an entity state update.
+func stateKey(msg proto.Message) (uint32, bool) {
+	m := msg.ProtoReflect()
+	d := m.Descriptor()
+	if !isStateResponse(d) {
+		return 0, false
+	}
+	f := d.Fields().ByName("key")
+	if f == nil {
+		return 0, false
+	}
+	return uint32(m.Get(f).Uint()), true
+}
+
+// isStateResponse returns true for the *StateResponse messages sent after a
+// SubscribeStatesRequest.
+func isStateResponse(d protoreflect.MessageDescriptor) bool {
+	return strings.HasSuffix(string(d.Name()), "StateResponse")
+}
+
+// isListEntitiesResponse returns true for the ListEntities*Response messages
+// describing an entity.
+func isListEntitiesResponse(d protoreflect.MessageDescriptor) bool {
+	n := string(d.Name())
+	return strings.HasPrefix(n, "ListEntities") && strings.HasSuffix(n, "Response") && n != "ListEntitiesDoneResponse"
+}
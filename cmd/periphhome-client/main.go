@@ -3,6 +3,9 @@
 // that can be found in the LICENSE file.
 
 // periphhome-client is a client implementation of the ESPHome protocol.
+//
+// Without argument, it searches for the nodes on the local network. With
+// "list", it connects to a node and prints its device info and entities.
 package main
 
 import (
@@ -11,32 +14,106 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"periph.io/x/home/client"
 )
 
-func mainImpl() error {
-	wait := flag.Duration("wait", time.Second/2, "Time to wait for discovery, increase if not all devices are found")
-	first := flag.Bool("first", false, "Stop waiting after the first device found")
-	flag.Parse()
+func search(wait time.Duration, first bool) ([]*client.Found, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	return client.Search(ctx, first)
+}
 
-	if flag.NArg() != 0 {
-		return errors.New("unexpected arguments")
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), *wait)
+// list connects to the node at addr and prints its device info and entities.
+func list(addr, password string, requireHMAC bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	found, err := client.Search(ctx, *first)
+	c, err := client.Dial(ctx, addr, password, requireHMAC)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	info, err := c.DeviceInfo(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Server:  %s\n", c.ServerInfo)
+	fmt.Printf("Name:    %s\n", info.Name)
+	fmt.Printf("Model:   %s\n", info.Model)
+	fmt.Printf("MAC:     %s\n", info.MacAddress)
+	fmt.Printf("Version: %s\n", info.EsphomeVersion)
+	if info.ProjectName != "" {
+		fmt.Printf("Project: %s %s\n", info.ProjectName, info.ProjectVersion)
+	}
+	entities, err := c.ListEntities(ctx)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Found %d device(s)\n", len(found))
-	for _, d := range found {
-		fmt.Printf("- %s\n", d)
+	fmt.Printf("%d entities:\n", len(entities))
+	for _, e := range entities {
+		fmt.Printf("- %s\n", describe(e))
 	}
 	return nil
 }
 
+// describe returns a one line description of a ListEntities*Response.
+func describe(msg proto.Message) string {
+	m := msg.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	get := func(name string) string {
+		if f := fields.ByName(protoreflect.Name(name)); f != nil {
+			return m.Get(f).String()
+		}
+		return ""
+	}
+	kind := strings.TrimSuffix(strings.TrimPrefix(string(m.Descriptor().Name()), "ListEntities"), "Response")
+	return fmt.Sprintf("%s %q (object_id: %s, unique_id: %s, key: %s)", kind, get("name"), get("object_id"), get("unique_id"), get("key"))
+}
+
+func mainImpl() error {
+	wait := flag.Duration("wait", time.Second/2, "Time to wait for discovery, increase if not all devices are found")
+	first := flag.Bool("first", false, "Stop waiting after the first device found")
+	addr := flag.String("address", "", "Node to connect to with list, e.g. 192.168.1.2:6053; defaults to the first device found")
+	password := flag.String("password", "", "API password of the node")
+	requireHMAC := flag.Bool("require-hmac", false, "Fail instead of sending the password in clear when the node doesn't challenge it, see api/auth")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: periphhome-client [flags] [list]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch {
+	case flag.NArg() == 0:
+		found, err := search(*wait, *first)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Found %d device(s)\n", len(found))
+		for _, d := range found {
+			fmt.Printf("- %s\n", d)
+		}
+		return nil
+	case flag.NArg() == 1 && flag.Arg(0) == "list":
+		if *addr == "" {
+			found, err := search(*wait, true)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 {
+				return errors.New("no device found, use -address")
+			}
+			*addr = found[0].Addr()
+		}
+		return list(*addr, *password, *requireHMAC)
+	default:
+		return errors.New("unexpected arguments")
+	}
+}
+
 func main() {
 	if err := mainImpl(); err != nil {
 		fmt.Fprintf(os.Stderr, "periphhome-client: %s\n", err)
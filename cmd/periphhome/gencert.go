@@ -0,0 +1,46 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"periph.io/x/home/node"
+	"periph.io/x/home/node/config"
+)
+
+// gencert writes a self-signed certificate at the paths specified in the
+// web_server section.
+//
+// Existing files are never overwritten.
+func gencert(cfg *config.Root) error {
+	w := &cfg.WebServer
+	if w.TLSCert == "" {
+		return errors.New("set web_server.tls_cert and web_server.tls_key first")
+	}
+	for _, p := range []string{w.TLSCert, w.TLSKey} {
+		if _, err := os.Stat(p); err == nil {
+			return fmt.Errorf("%s already exists", p)
+		}
+	}
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if cfg.PeriphHome.Name != "" {
+		hosts = append(hosts, cfg.PeriphHome.Name+".local")
+	}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		hosts = append(hosts, h)
+	}
+	c, k, err := node.GenerateSelfSignedCert(hosts)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(w.TLSKey, k, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(w.TLSCert, c, 0644)
+}
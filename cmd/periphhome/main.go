@@ -23,9 +23,22 @@ import (
 	"periph.io/x/host/v3"
 )
 
+// configChange is a modification of the config file.
+//
+// Either cfg is the new config or err is why the new content is invalid.
+type configChange struct {
+	modified time.Time
+	cfg      *config.Root
+	err      error
+}
+
 // autoCancellingContext returns a global context that is canceled if SIGTERM /
 // SIGINT is received or if the executable file is modified.
-func autoCancellingContext(cfg string) (context.Context, func(), error) {
+//
+// When the config file is modified, the new config is sent to changes so the
+// node reloads it without restarting. A malformed new config is logged and
+// ignored; the node keeps running with the previous config.
+func autoCancellingContext(cfg string, changes chan configChange) (context.Context, func(), error) {
 	// Cancel on SIGTERM / SIGINT.
 	ctx, cancel := context.WithCancel(context.Background())
 	chanSignal := make(chan os.Signal, 1)
@@ -75,6 +88,22 @@ func autoCancellingContext(cfg string) (context.Context, func(), error) {
 				if fi2, err2 := os.Stat(e.Name); err2 != nil {
 					log.Printf("file %s doesn't exist anymore, ignoring", e.Name)
 				} else if mod := fi2.ModTime(); !mod.Equal(lookup[e.Name]) {
+					if e.Name == cfg {
+						c, err2 := loadConfig(cfg)
+						if err2 != nil {
+							log.Printf("file %s was modified but is invalid, ignoring: %s", e.Name, err2)
+						} else {
+							log.Printf("file %s was modified, reloading.", e.Name)
+						}
+						lookup[e.Name] = mod
+						// Only the last change matters.
+						select {
+						case <-changes:
+						default:
+						}
+						changes <- configChange{modified: mod, cfg: c, err: err2}
+						continue
+					}
 					log.Printf("file %s was modified, exiting.", e.Name)
 					cancel()
 					return
@@ -87,6 +116,20 @@ func autoCancellingContext(cfg string) (context.Context, func(), error) {
 	return ctx, cancel, nil
 }
 
+// loadConfig loads and validates the config file.
+func loadConfig(path string) (*config.Root, error) {
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &config.Root{}
+	if err = cfg.LoadYaml(b); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
 func mainImpl() error {
 	// Make sure periph can be initialized, otherwise there isn't much to do.
 	if _, err := host.Init(); err != nil {
@@ -98,12 +141,15 @@ func mainImpl() error {
 		o := flag.CommandLine.Output()
 		fmt.Fprintf(o, "usage: %s <config.yaml> <command>\n", os.Args[0])
 		fmt.Fprintf(o, "\nCommands are:\n")
+		fmt.Fprintf(o, "  gencert  Generate a self-signed certificate for web_server\n")
 		fmt.Fprintf(o, "  install  Install the node to run on boot\n")
 		fmt.Fprintf(o, "  run      Run the node\n")
 		fmt.Fprintf(o, "\n")
 		flag.PrintDefaults()
 	}
 	cpuprofile := flag.String("cpuprofile", "", "dump CPU profile in file")
+	safeMode := flag.Bool("safe-mode", false, "when the config fails to load, run with only the native API and a text sensor reporting the error")
+	debugFrames := flag.Bool("debug-frames", false, "log every native API message received and sent, same as api/debug_frames in the config")
 	flag.Parse()
 	if flag.NArg() != 2 {
 		return errors.New("expect 2 arguments. Use -help for more information")
@@ -130,12 +176,17 @@ func mainImpl() error {
 		return err
 	}
 
-	ctx, cancel, err := autoCancellingContext(configFile)
+	changes := make(chan configChange, 1)
+	ctx, cancel, err := autoCancellingContext(configFile, changes)
 	defer cancel()
 	if err != nil {
 		return err
 	}
 
+	fi, err := os.Stat(configFile)
+	if err != nil {
+		return err
+	}
 	/* #nosec G304 */
 	b, err := ioutil.ReadFile(configFile)
 	if err != nil {
@@ -145,14 +196,25 @@ func mainImpl() error {
 	// Load config then run the node.
 	cfg := config.Root{}
 	if err := cfg.LoadYaml(b); err != nil {
-		return err
+		if !*safeMode || cmd != "run" {
+			return err
+		}
+		// The config file is watched so the node starts once it is fixed.
+		log.Printf("failed to load config, starting in safe mode: %s", err)
+		cfg = config.SafeMode(b)
+		return runSafeMode(ctx, &cfg, err, configFile, changes, *debugFrames)
 	}
 
+	if *debugFrames {
+		cfg.API.DebugFrames = true
+	}
 	switch cmd {
+	case "gencert":
+		return gencert(&cfg)
 	case "install":
 		return install(configFile)
 	case "run":
-		return run(ctx, &cfg)
+		return run(ctx, &cfg, configFile, fi.ModTime(), changes, *debugFrames)
 	default:
 		return fmt.Errorf("unknown command %q", cmd)
 	}
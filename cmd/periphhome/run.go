@@ -6,13 +6,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 
 	"periph.io/x/home/node"
 	"periph.io/x/home/node/config"
 )
 
-func run(ctx context.Context, cfg *config.Root) error {
+// run runs the node until ctx is canceled.
+//
+// The valid configs received from changes are reloaded in process. When a
+// config cannot be applied this way, the node is closed and created again
+// with it.
+func run(ctx context.Context, cfg *config.Root, path string, modified time.Time, changes <-chan configChange, debugFrames bool) error {
 	// TODO(maruel): When running as a service, the lines are already annotated,
 	// so no need to set the timestamp.
 	//log.SetFlags(0)
@@ -21,8 +28,71 @@ func run(ctx context.Context, cfg *config.Root) error {
 	if err != nil {
 		return err
 	}
+	n.SetConfigFile(path, modified)
 	log.Printf("node initialized")
-	<-ctx.Done()
-	log.Printf("closing node")
-	return n.Close()
+	for done := ctx.Done(); ; {
+		select {
+		case c := <-changes:
+			if c.err != nil {
+				n.ReloadRejected(c.modified, c.err)
+				continue
+			}
+			if debugFrames {
+				c.cfg.API.DebugFrames = true
+			}
+			if err = n.Reload(ctx, c.cfg); err != nil {
+				if errors.Is(err, node.ErrRestartRequired) {
+					log.Printf("%s, recreating the node", err)
+					if err = n.Close(); err != nil {
+						log.Printf("failed to close node: %s", err)
+					}
+					if n, err = node.New(ctx, c.cfg); err != nil {
+						return err
+					}
+					n.SetConfigFile(path, c.modified)
+					log.Printf("node recreated")
+					continue
+				}
+				log.Printf("failed to reload config, keeping the previous one: %s", err)
+				n.ReloadRejected(c.modified, err)
+				continue
+			}
+			n.SetConfigFile(path, c.modified)
+			log.Printf("node reloaded")
+		case <-done:
+			log.Printf("closing node")
+			return n.Close()
+		}
+	}
+}
+
+// runSafeMode runs a minimal node reporting cfgErr.
+//
+// Once a valid config is received from changes, the minimal node is closed
+// and the node is run with it.
+func runSafeMode(ctx context.Context, cfg *config.Root, cfgErr error, path string, changes <-chan configChange, debugFrames bool) error {
+	n, err := node.NewSafeMode(ctx, cfg, cfgErr)
+	if err != nil {
+		return err
+	}
+	log.Printf("node initialized in safe mode")
+	for done := ctx.Done(); ; {
+		select {
+		case c := <-changes:
+			if c.err != nil {
+				continue
+			}
+			log.Printf("config fixed, closing the safe mode node")
+			if err = n.Close(); err != nil {
+				log.Printf("failed to close node: %s", err)
+			}
+			if debugFrames {
+				c.cfg.API.DebugFrames = true
+			}
+			return run(ctx, c.cfg, path, c.modified, changes, debugFrames)
+		case <-done:
+			log.Printf("closing node")
+			return n.Close()
+		}
+	}
 }
@@ -9,6 +9,7 @@ require (
 	github.com/jonboulle/clockwork v0.3.0 // indirect
 	github.com/maruel/natural v1.1.0
 	github.com/miekg/dns v1.1.49 // indirect
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
 	golang.org/x/image v0.0.0-20220617043117-41969df76e82
 	golang.org/x/net v0.0.0-20220617184016-355a448f1bc9 // indirect
 	golang.org/x/sys v0.0.0-20220615213510-4f61da869c0c // indirect
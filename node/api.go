@@ -10,7 +10,11 @@ package node
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -19,10 +23,14 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"periph.io/x/home/node/config"
 	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
 
@@ -30,12 +38,114 @@ import (
 type conn struct {
 	c net.Conn
 	n *Node
+	// cfg is the configuration when the connection was accepted. The
+	// connections are closed when Node.Reload() changes the api or periphhome
+	// settings.
+	cfg *config.Root
+	// noise is set once the encryption handshake completed.
+	noise *noiseConn
+	// nonce is the challenge sent in the last HelloResponse when api/auth is
+	// "hmac". It is used at most once.
+	nonce []byte
+
+	// connected is set to 1 once the client authenticated.
+	connected int32
+
+	// wmu serializes writes, since the write deadline is per connection.
+	wmu sync.Mutex
+}
+
+// defaultAPITimeout is the default read and write timeout of a single
+// message.
+const defaultAPITimeout = 30 * time.Second
+
+// apiTimeout returns d or the default timeout if d is not set.
+func apiTimeout(d time.Duration) time.Duration {
+	if d == 0 {
+		return defaultAPITimeout
+	}
+	return d
+}
+
+// readMsg reads one message.
+//
+// The connection may be idle for any length of time but once the first byte
+// is received, the rest of the message must arrive within the read timeout.
+func (c *conn) readMsg() (int, []byte, error) {
+	r := deadlineReader{c: c.c, timeout: apiTimeout(c.cfg.API.ReadTimeout)}
+	var id int
+	var raw []byte
+	var err error
+	if c.noise != nil {
+		id, raw, err = c.noise.readMsg(&r)
+	} else {
+		id, raw, err = readMsg(&r)
+	}
+	if err == nil && r.started {
+		err = c.c.SetReadDeadline(time.Time{})
+	}
+	if err == nil && c.cfg.API.DebugFrames {
+		name := "unknown"
+		if t := requests[id]; t != nil {
+			name = t.Name()
+		}
+		c.logFrame("<-", id, name, raw)
+	}
+	return id, raw, err
+}
+
+// logFrame logs a raw frame when api/debug_frames is set.
+//
+// Only the beginning of large frames, like camera images, is dumped.
+func (c *conn) logFrame(dir string, id int, name string, raw []byte) {
+	const max = 64
+	b := raw
+	suffix := ""
+	if len(b) > max {
+		b = b[:max]
+		suffix = "..."
+	}
+	log.Printf("DEBUG: %s %s id=%d %s %d bytes: %x%s", c.c.RemoteAddr(), dir, id, name, len(raw), b, suffix)
+}
+
+// deadlineReader sets a read deadline once the first byte is received.
+type deadlineReader struct {
+	c       net.Conn
+	timeout time.Duration
+	started bool
+}
+
+func (d *deadlineReader) Read(b []byte) (int, error) {
+	n, err := d.c.Read(b)
+	if n != 0 && !d.started {
+		d.started = true
+		if err2 := d.c.SetReadDeadline(time.Now().Add(d.timeout)); err == nil {
+			err = err2
+		}
+	}
+	return n, err
 }
 
 func (c *conn) handleConnection(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	defer c.c.Close()
+	c.n.stats.connStarted(c)
+	defer func() {
+		c.n.stats.connEnded(c)
+		// Save at every disconnection so a crash loses little.
+		if d := c.cfg.PeriphHome.StateDir; d != "" {
+			if err := c.n.stats.save(d); err != nil {
+				log.Printf("failed to save connection stats: %s", err)
+			}
+		}
+	}()
+	if c.n.psk != nil {
+		if err := c.handshake(); err != nil {
+			log.Printf("%s: encryption handshake failed: %s", c.c.RemoteAddr(), err)
+			return
+		}
+	}
 	type msg struct {
 		id  int
 		raw []byte
@@ -45,7 +155,7 @@ func (c *conn) handleConnection(ctx context.Context) {
 	onMsg := make(chan msg, 1)
 	for {
 		go func() {
-			id, raw, err := readMsg(c.c)
+			id, raw, err := c.readMsg()
 			onMsg <- msg{id, raw, err}
 		}()
 		select {
@@ -69,6 +179,7 @@ func (c *conn) handleConnection(ctx context.Context) {
 				}
 				return
 			}
+			c.n.stats.commandReceived()
 			if err := c.handleRPC(ctx, m.id, m.raw); err != nil {
 				if !isErrEOF(err) {
 					log.Printf("handleRPC: %s", err)
@@ -81,6 +192,20 @@ func (c *conn) handleConnection(ctx context.Context) {
 	}
 }
 
+// handshake establishes the encrypted session.
+func (c *conn) handshake() error {
+	// The whole handshake must complete within the read timeout.
+	if err := c.c.SetDeadline(time.Now().Add(apiTimeout(c.cfg.API.ReadTimeout))); err != nil {
+		return err
+	}
+	nc, err := noiseHandshake(c.c, c.n.psk, c.cfg.PeriphHome.Name)
+	if err != nil {
+		return err
+	}
+	c.noise = nc
+	return c.c.SetDeadline(time.Time{})
+}
+
 func (c *conn) handleRPC(ctx context.Context, id int, msg []byte) error {
 	// It'd be nicer to use reflection but it'd be slower. Since it's all
 	// immutable constants, it's not that much a big deal.
@@ -90,15 +215,35 @@ func (c *conn) handleRPC(ctx context.Context, id int, msg []byte) error {
 		return err
 	}
 	logf("handleRPC(%T)", v)
+	if id == 3 {
+		// Connect may wait a while upon an invalid password, so it must not hold
+		// Reload() off.
+		return c.Connect(ctx, v.(*aioesphomeapi.ConnectRequest))
+	}
+	switch id {
+	case 1, 5, 6, 7, 8, 9:
+		// These are needed to connect and don't touch the components.
+	default:
+		if !c.isConnected() {
+			return fmt.Errorf("%T requires authentication", v)
+		}
+	}
+	// Hold Reload() off while the request uses the components.
+	c.n.mu.RLock()
+	defer c.n.mu.RUnlock()
 	switch id {
 	case 1:
 		return c.Hello(v.(*aioesphomeapi.HelloRequest))
-	case 3:
-		return c.Connect(v.(*aioesphomeapi.ConnectRequest))
 	case 5:
 		return c.Disconnect(v.(*aioesphomeapi.DisconnectRequest))
+	case 6:
+		// The client acknowledged our DisconnectRequest.
+		return io.EOF
 	case 7:
 		return c.Ping(v.(*aioesphomeapi.PingRequest))
+	case 8:
+		// We never send PingRequest but it's harmless.
+		return nil
 	case 9:
 		return c.DeviceInfo(v.(*aioesphomeapi.DeviceInfoRequest))
 	case 11:
@@ -106,7 +251,7 @@ func (c *conn) handleRPC(ctx context.Context, id int, msg []byte) error {
 	case 20:
 		return c.SubscribeStates(ctx, v.(*aioesphomeapi.SubscribeStatesRequest))
 	case 28:
-		return c.SubscribeLogs(v.(*aioesphomeapi.SubscribeLogsRequest))
+		return c.SubscribeLogs(ctx, v.(*aioesphomeapi.SubscribeLogsRequest))
 	case 30:
 		return c.CoverCommand(v.(*aioesphomeapi.CoverCommandRequest))
 	case 31:
@@ -119,16 +264,22 @@ func (c *conn) handleRPC(ctx context.Context, id int, msg []byte) error {
 		return c.SubscribeHomeassistantServices(v.(*aioesphomeapi.SubscribeHomeassistantServicesRequest))
 	case 36:
 		return c.GetTime(v.(*aioesphomeapi.GetTimeRequest))
+	case 37:
+		return c.GetTimeResponse(v.(*aioesphomeapi.GetTimeResponse))
 	case 38:
 		return c.SubscribeHomeAssistantStates(v.(*aioesphomeapi.SubscribeHomeAssistantStatesRequest))
 	case 40:
 		return c.OnHomeAssistantState(v.(*aioesphomeapi.HomeAssistantStateResponse))
 	case 42:
-		return c.ExecuteService(v.(*aioesphomeapi.ExecuteServiceRequest))
+		return c.ExecuteService(ctx, v.(*aioesphomeapi.ExecuteServiceRequest))
 	case 45:
 		return c.CameraImage(ctx, v.(*aioesphomeapi.CameraImageRequest))
 	case 48:
 		return c.ClimateCommand(v.(*aioesphomeapi.ClimateCommandRequest))
+	case 51:
+		return c.NumberCommand(v.(*aioesphomeapi.NumberCommandRequest))
+	case 62:
+		return c.ButtonCommand(v.(*aioesphomeapi.ButtonCommandRequest))
 	default:
 		return fmt.Errorf("internal error: implement %d", id)
 	}
@@ -162,6 +313,8 @@ var requests = map[int]reflect.Type{
 	42: reflect.TypeOf(aioesphomeapi.ExecuteServiceRequest{}),
 	45: reflect.TypeOf(aioesphomeapi.CameraImageRequest{}),
 	48: reflect.TypeOf(aioesphomeapi.ClimateCommandRequest{}),
+	51: reflect.TypeOf(aioesphomeapi.NumberCommandRequest{}),
+	62: reflect.TypeOf(aioesphomeapi.ButtonCommandRequest{}),
 }
 
 // getID returns the ID to send a package back to the client.
@@ -234,6 +387,12 @@ func getID(msg interface{}) int {
 		return 46
 	case *aioesphomeapi.ClimateStateResponse:
 		return 47
+	case *aioesphomeapi.ListEntitiesNumberResponse:
+		return 49
+	case *aioesphomeapi.NumberStateResponse:
+		return 50
+	case *aioesphomeapi.ListEntitiesButtonResponse:
+		return 61
 	default:
 		return 0
 	}
@@ -245,22 +404,73 @@ func (c *conn) Hello(in *aioesphomeapi.HelloRequest) error {
 		ApiVersionMinor: 3,
 		ServerInfo:      "periphhome",
 	}
+	if c.cfg.API.Auth == "hmac" {
+		c.nonce = make([]byte, hmacNonceSize)
+		if _, err := rand.Read(c.nonce); err != nil {
+			return err
+		}
+		resp.ServerInfo += hmacChallenge + hex.EncodeToString(c.nonce)
+	}
 	return c.reply(&resp)
 }
 
-func (c *conn) Connect(in *aioesphomeapi.ConnectRequest) error {
-	resp := aioesphomeapi.ConnectResponse{
-		InvalidPassword: c.n.cfg.API.Password != in.Password,
+// Connect authenticates the client.
+//
+// When api/auth is "hmac", the password is the response to the nonce sent in
+// Hello, which must be requested again after each attempt.
+//
+// Invalid passwords are replied to after an exponential delay per remote
+// address to slow down brute forcing, then the connection is closed.
+func (c *conn) Connect(ctx context.Context, in *aioesphomeapi.ConnectRequest) error {
+	password := c.cfg.API.Password
+	// A client that didn't say Hello first can't know the answer.
+	challenged := true
+	if c.cfg.API.Auth == "hmac" {
+		challenged = c.nonce != nil
+		if challenged {
+			password = hmacPassword(password, c.nonce)
+			c.nonce = nil
+		}
 	}
-	if err := c.reply(&resp); err != nil {
+	// Compare the hashes so the comparison leaks neither how much of the
+	// password matched nor its length.
+	want := sha256.Sum256([]byte(password))
+	got := sha256.Sum256([]byte(in.Password))
+	addr := c.c.RemoteAddr()
+	if subtle.ConstantTimeCompare(want[:], got[:]) != 1 || !challenged {
+		d, count := c.n.auth.failed(addr, time.Now())
+		log.Printf("%s: invalid password, replying in %s", addr, d)
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		if err := c.reply(&aioesphomeapi.ConnectResponse{InvalidPassword: true}); err != nil {
+			return err
+		}
+		return fmt.Errorf("invalid password (%d)", count)
+	}
+	c.n.auth.succeeded(addr)
+	if err := c.reply(&aioesphomeapi.ConnectResponse{}); err != nil {
 		return err
 	}
-	if resp.InvalidPassword {
-		return errors.New("invalid password")
+	atomic.StoreInt32(&c.connected, 1)
+	c.n.mu.RLock()
+	_, ok := c.n.clock.(*timeHomeAssistant)
+	c.n.mu.RUnlock()
+	if ok {
+		return c.reply(&aioesphomeapi.GetTimeRequest{})
 	}
 	return nil
 }
 
+// isConnected returns true once the client authenticated.
+func (c *conn) isConnected() bool {
+	return atomic.LoadInt32(&c.connected) != 0
+}
+
 func (c *conn) Disconnect(in *aioesphomeapi.DisconnectRequest) error {
 	if err := c.reply(&aioesphomeapi.DisconnectResponse{}); err != nil {
 		return err
@@ -276,23 +486,46 @@ func (c *conn) Ping(in *aioesphomeapi.PingRequest) error {
 
 func (c *conn) DeviceInfo(in *aioesphomeapi.DeviceInfoRequest) error {
 	resp := aioesphomeapi.DeviceInfoResponse{
-		UsesPassword:   c.n.cfg.API.Password != "",
-		Name:           c.n.cfg.PeriphHome.Name,
+		UsesPassword:   c.cfg.API.Password != "",
+		Name:           c.cfg.PeriphHome.Name,
 		MacAddress:     c.n.mac,
 		EsphomeVersion: "PeriphHome " + version,
 		// TODO(maruel): Use -ldflags?
 		// For now, pass Comment here.
-		CompilationTime: c.n.cfg.PeriphHome.Comment,
-		// We could probably add board name detection in periph.
-		Model:        runtime.GOOS,
-		HasDeepSleep: false,
+		CompilationTime: c.cfg.PeriphHome.Comment,
+		Model:           c.n.model,
+		// A Linux host is always on.
+		HasDeepSleep:   false,
+		ProjectName:    c.cfg.PeriphHome.Project.Name,
+		ProjectVersion: c.cfg.PeriphHome.Project.Version,
+	}
+	if c.cfg.WebServer.IsPresent {
+		resp.WebserverPort = uint32(c.n.webPort())
+	}
+	if a := c.cfg.PeriphHome.SuggestedArea; a != "" {
+		// suggested_area was added in a later version of the protocol.
+		m := resp.ProtoReflect()
+		if f := m.Descriptor().Fields().ByName("suggested_area"); f != nil {
+			m.Set(f, protoreflect.ValueOfString(a))
+		}
 	}
 	return c.reply(&resp)
 }
 
 func (c *conn) ListEntities(in *aioesphomeapi.ListEntitiesRequest) error {
 	for _, e := range c.n.entities {
-		if err := c.reply(e.describe()); err != nil {
+		d := e.describe()
+		// All the ListEntities*Response messages have a name field.
+		m := d.ProtoReflect()
+		if f := m.Descriptor().Fields().ByName("name"); f != nil {
+			m.Set(f, protoreflect.ValueOfString(c.n.friendlyName(e.getName())))
+		}
+		if err := c.reply(d); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.n.serviceList {
+		if err := c.reply(s.describe()); err != nil {
 			return err
 		}
 	}
@@ -310,14 +543,35 @@ func (c *conn) SubscribeStates(ctx context.Context, in *aioesphomeapi.SubscribeS
 		c.n.wg.Add(1)
 		go func(cc component) {
 			defer c.n.wg.Done()
+			if r, ok := cc.(republisher); ok {
+				r.republish()
+			}
 			cc.subscribe(ctx, c)
 		}(item)
 	}
 	return nil
 }
 
-func (c *conn) SubscribeLogs(in *aioesphomeapi.SubscribeLogsRequest) error {
-	return errors.New("SubscribeLogs: not implemented")
+func (c *conn) SubscribeLogs(ctx context.Context, in *aioesphomeapi.SubscribeLogsRequest) error {
+	ch := c.n.logs.add(in.Level)
+	c.n.wg.Add(1)
+	go func() {
+		defer c.n.wg.Done()
+		// ctx is canceled when the connection is closed.
+		defer c.n.logs.remove(ch)
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case msg := <-ch:
+				if err := c.reply(msg); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return nil
 }
 
 func (c *conn) SubscribeHomeassistantServices(in *aioesphomeapi.SubscribeHomeassistantServicesRequest) error {
@@ -326,33 +580,63 @@ func (c *conn) SubscribeHomeassistantServices(in *aioesphomeapi.SubscribeHomeass
 	return nil
 }
 
+// SubscribeHomeAssistantStates asks Home Assistant for the states of the
+// entities consumed by the components. Home Assistant sends the current state
+// right away, then on each change.
 func (c *conn) SubscribeHomeAssistantStates(in *aioesphomeapi.SubscribeHomeAssistantStatesRequest) error {
-	// For now, just ignore.
-	/*
-		if err := c.reply(&aioesphomeapi.SubscribeHomeAssistantStateResponse{
-			EntityId: "yo",
-		}); err != nil {
-			return err
+	seen := map[string]bool{}
+	for _, e := range c.n.entities {
+		for _, id := range e.homeAssistantStates() {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if err := c.reply(&aioesphomeapi.SubscribeHomeAssistantStateResponse{EntityId: id}); err != nil {
+				return err
+			}
 		}
-	*/
+	}
 	return nil
 }
 
+// OnHomeAssistantState routes the state of a Home Assistant entity to the
+// components consuming it.
 func (c *conn) OnHomeAssistantState(in *aioesphomeapi.HomeAssistantStateResponse) error {
-	// I think we would only care if we have scripting.
+	if in.Attribute != "" {
+		// Attributes are never subscribed to.
+		return nil
+	}
+	for _, e := range c.n.entities {
+		for _, id := range e.homeAssistantStates() {
+			if id == in.EntityId {
+				e.onHomeAssistantState(in.EntityId, in.State)
+				break
+			}
+		}
+	}
 	return nil
 }
 
 func (c *conn) GetTime(in *aioesphomeapi.GetTimeRequest) error {
 	// YOLO: https://en.wikipedia.org/wiki/Year_2038_problem
 	return c.reply(&aioesphomeapi.GetTimeResponse{
-		EpochSeconds: uint32(time.Now().Unix()),
+		EpochSeconds: uint32(c.n.now().Unix()),
 	})
 }
 
-func (c *conn) ExecuteService(in *aioesphomeapi.ExecuteServiceRequest) error {
-	// TODO(maruel): Find via in.Key, then send command.
-	return errors.New("ExecuteService: not implemented")
+// GetTimeResponse receives the time requested by the homeassistant time
+// source.
+func (c *conn) GetTimeResponse(in *aioesphomeapi.GetTimeResponse) error {
+	if t, ok := c.n.clock.(*timeHomeAssistant); ok {
+		t.update(time.Unix(int64(in.EpochSeconds), 0))
+	}
+	return nil
+}
+
+// ExecuteService runs a user defined service. The command is killed if the
+// connection is closed.
+func (c *conn) ExecuteService(ctx context.Context, in *aioesphomeapi.ExecuteServiceRequest) error {
+	return c.n.executeService(ctx, in)
 }
 
 func (c *conn) CoverCommand(in *aioesphomeapi.CoverCommandRequest) error {
@@ -368,7 +652,11 @@ func (c *conn) FanCommand(in *aioesphomeapi.FanCommandRequest) error {
 	if e == nil {
 		return fmt.Errorf("unknown item %x", in.Key)
 	}
-	return e.fanCommand(in)
+	if err := e.fanCommand(in); err != nil {
+		e.setError(err)
+		return err
+	}
+	return nil
 }
 
 func (c *conn) LightCommand(in *aioesphomeapi.LightCommandRequest) error {
@@ -376,7 +664,11 @@ func (c *conn) LightCommand(in *aioesphomeapi.LightCommandRequest) error {
 	if e == nil {
 		return fmt.Errorf("unknown item %x", in.Key)
 	}
-	return e.lightCommand(in)
+	if err := e.lightCommand(in); err != nil {
+		e.setError(err)
+		return err
+	}
+	return nil
 }
 
 func (c *conn) SwitchCommand(in *aioesphomeapi.SwitchCommandRequest) error {
@@ -384,7 +676,11 @@ func (c *conn) SwitchCommand(in *aioesphomeapi.SwitchCommandRequest) error {
 	if e == nil {
 		return fmt.Errorf("unknown item %x", in.Key)
 	}
-	return e.switchCommand(in)
+	if err := e.switchCommand(in); err != nil {
+		e.setError(err)
+		return err
+	}
+	return nil
 }
 
 func (c *conn) CameraImage(ctx context.Context, in *aioesphomeapi.CameraImageRequest) error {
@@ -405,6 +701,22 @@ func (c *conn) CameraImage(ctx context.Context, in *aioesphomeapi.CameraImageReq
 	return nil
 }
 
+func (c *conn) ButtonCommand(in *aioesphomeapi.ButtonCommandRequest) error {
+	e := c.n.lookup[in.Key]
+	if e == nil {
+		return fmt.Errorf("unknown item %x", in.Key)
+	}
+	return e.buttonCommand(in)
+}
+
+func (c *conn) NumberCommand(in *aioesphomeapi.NumberCommandRequest) error {
+	e := c.n.lookup[in.Key]
+	if e == nil {
+		return fmt.Errorf("unknown item %x", in.Key)
+	}
+	return e.numberCommand(in)
+}
+
 func (c *conn) ClimateCommand(in *aioesphomeapi.ClimateCommandRequest) error {
 	e := c.n.lookup[in.Key]
 	if e == nil {
@@ -415,6 +727,9 @@ func (c *conn) ClimateCommand(in *aioesphomeapi.ClimateCommandRequest) error {
 
 // reply implements clientConn.
 func (c *conn) reply(msg proto.Message) error {
+	if m, ok := msg.(*aioesphomeapi.CameraImageResponse); ok && c.noise != nil && len(m.Data) > noiseCameraChunk {
+		return c.replyCameraChunks(m)
+	}
 	id := getID(msg)
 	if id == 0 {
 		return fmt.Errorf("internal error: implement ID for type %T", msg)
@@ -423,11 +738,45 @@ func (c *conn) reply(msg proto.Message) error {
 	if err != nil {
 		return err
 	}
-	logf("reply(%T)", msg)
-	if err := writeMsg(c.c, id, raw); err != nil {
+	if _, ok := msg.(*aioesphomeapi.SubscribeLogsResponse); !ok {
+		// Logging the log lines sent would loop forever.
+		logf("reply(%T)", msg)
+		if c.cfg.API.DebugFrames {
+			c.logFrame("->", id, string(msg.ProtoReflect().Descriptor().Name()), raw)
+		}
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.c.SetWriteDeadline(time.Now().Add(apiTimeout(c.cfg.API.WriteTimeout))); err != nil {
+		return err
+	}
+	if c.noise != nil {
+		err = c.noise.writeMsg(c.c, id, raw)
+	} else {
+		err = writeMsg(c.c, id, raw)
+	}
+	if err != nil {
 		logf("failed to write")
 		return err
 	}
+	c.n.stats.frameSent()
+	return c.c.SetWriteDeadline(time.Time{})
+}
+
+// replyCameraChunks sends an image in multiple messages, since encrypted
+// frames are limited to 64KiB. The client concatenates them until Done.
+func (c *conn) replyCameraChunks(m *aioesphomeapi.CameraImageResponse) error {
+	for d := m.Data; len(d) != 0; {
+		n := len(d)
+		if n > noiseCameraChunk {
+			n = noiseCameraChunk
+		}
+		chunk := &aioesphomeapi.CameraImageResponse{Key: m.Key, Data: d[:n], Done: m.Done && n == len(d)}
+		if err := c.reply(chunk); err != nil {
+			return err
+		}
+		d = d[n:]
+	}
 	return nil
 }
 
@@ -435,7 +784,6 @@ func (c *conn) reply(msg proto.Message) error {
 
 // writeMsg writes one message.
 func writeMsg(w io.Writer, id int, msg []byte) error {
-	//logf("writeMsg(%d, %x)", id, msg)
 	b := make([]byte, 1, 1+binary.MaxVarintLen32*2+len(msg))
 	var buf [binary.MaxVarintLen32]byte
 	n := binary.PutUvarint(buf[:], uint64(len(msg)))
@@ -449,15 +797,13 @@ func writeMsg(w io.Writer, id int, msg []byte) error {
 
 // readMsg reads one message and returns it.
 func readMsg(r io.Reader) (int, []byte, error) {
-	//logf("readMsg: zero byte")
 	var b [1]byte
-	if _, err := r.Read(b[:]); err != nil {
+	if _, err := io.ReadFull(r, b[:]); err != nil {
 		return 0, nil, err
 	}
 	if b[0] != 0 {
 		return 0, nil, errors.New("expected byte zero")
 	}
-	//logf("readMsg: msgsize")
 	msgsize, err := readVarUint(r)
 	if err != nil {
 		return 0, nil, err
@@ -465,7 +811,6 @@ func readMsg(r io.Reader) (int, []byte, error) {
 	if msgsize > 1024*1024 {
 		return 0, nil, fmt.Errorf("msg size too large %d", msgsize)
 	}
-	//logf("readMsg: id; msgsize = %d", msgsize)
 	id, err := readVarUint(r)
 	if err != nil {
 		return 0, nil, err
@@ -473,11 +818,12 @@ func readMsg(r io.Reader) (int, []byte, error) {
 	var msg []byte
 	if msgsize != 0 {
 		msg = make([]byte, msgsize)
-		if _, err = r.Read(msg); err != nil {
+		// A single Read() may return less than the whole message, e.g. camera
+		// images over TCP.
+		if _, err = io.ReadFull(r, msg); err != nil {
 			return 0, nil, err
 		}
 	}
-	//logf("readMsg() id = %d, msg = %x", id, msg)
 	return int(id), msg, err
 }
 
@@ -487,7 +833,7 @@ func readVarUint(r io.Reader) (uint64, error) {
 	var x uint64
 	var s uint
 	for i := 0; ; i++ {
-		if _, err := r.Read(buf[:]); err != nil {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
 			return 0, err
 		}
 		b := buf[0]
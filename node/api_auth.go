@@ -0,0 +1,99 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// hmacChallenge precedes the hex encoded nonce in HelloResponse.ServerInfo
+	// when api/auth is "hmac".
+	hmacChallenge = " hmac="
+	// hmacNonceSize is the size in bytes of the nonce.
+	hmacNonceSize = 16
+	// authForget is how long the invalid passwords of an address are
+	// remembered after the last one.
+	authForget = 15 * time.Minute
+)
+
+var (
+	// authDelay is the delay before replying to the first invalid password from
+	// an address. It doubles with each subsequent one, up to authMaxDelay.
+	authDelay    = 500 * time.Millisecond
+	authMaxDelay = 30 * time.Second
+)
+
+// authLimiter slows down brute forcing the native API password by tracking
+// the invalid passwords per remote address.
+//
+// The zero value is ready to use.
+type authLimiter struct {
+	mu       sync.Mutex
+	failures map[string]authFailures
+}
+
+type authFailures struct {
+	count int
+	last  time.Time
+}
+
+// failed records an invalid password from addr and returns how long to wait
+// before replying and the number of invalid passwords from addr so far.
+func (a *authLimiter) failed(addr net.Addr, now time.Time) (time.Duration, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failures == nil {
+		a.failures = map[string]authFailures{}
+	}
+	// Forget about the old ones, so the map doesn't grow forever.
+	for k, f := range a.failures {
+		if now.Sub(f.last) > authForget {
+			delete(a.failures, k)
+		}
+	}
+	k := authKey(addr)
+	f := a.failures[k]
+	f.count++
+	f.last = now
+	a.failures[k] = f
+	d := authMaxDelay
+	if f.count <= 32 {
+		if d2 := authDelay << uint(f.count-1); d2 > 0 && d2 < d {
+			d = d2
+		}
+	}
+	return d, f.count
+}
+
+// succeeded forgets the invalid passwords from addr.
+func (a *authLimiter) succeeded(addr net.Addr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.failures, authKey(addr))
+}
+
+// authKey returns the host of addr, since each connection from a client uses
+// a different port.
+func authKey(addr net.Addr) string {
+	s := addr.String()
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		return h
+	}
+	return s
+}
+
+// hmacPassword returns the response to the nonce expected in
+// ConnectRequest.Password when api/auth is "hmac".
+func hmacPassword(password string, nonce []byte) string {
+	h := hmac.New(sha256.New, []byte(password))
+	_, _ = h.Write(nonce)
+	return hex.EncodeToString(h.Sum(nil))
+}
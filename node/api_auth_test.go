@@ -0,0 +1,321 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestAuthLimiter(t *testing.T) {
+	a := authLimiter{}
+	now := time.Now()
+	c1 := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 1234}
+	c2 := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 1235}
+	other := &net.TCPAddr{IP: net.ParseIP("192.168.1.11"), Port: 1234}
+	for i := 1; i <= 10; i++ {
+		// The port doesn't matter.
+		c := c1
+		if i&1 == 0 {
+			c = c2
+		}
+		d, count := a.failed(c, now)
+		want := authDelay << uint(i-1)
+		if want > authMaxDelay {
+			want = authMaxDelay
+		}
+		if d != want || count != i {
+			t.Fatalf("#%d: got %s, %d; want %s, %d", i, d, count, want, i)
+		}
+	}
+	if d, count := a.failed(other, now); d != authDelay || count != 1 {
+		t.Fatalf("got %s, %d", d, count)
+	}
+	a.succeeded(c1)
+	if d, count := a.failed(c2, now); d != authDelay || count != 1 {
+		t.Fatalf("got %s, %d", d, count)
+	}
+	// The old failures are forgotten.
+	if d, count := a.failed(c1, now.Add(authForget+time.Second)); d != authDelay || count != 1 {
+		t.Fatalf("got %s, %d", d, count)
+	}
+	if len(a.failures) != 1 {
+		t.Fatalf("expected the old failures to be pruned: %v", a.failures)
+	}
+}
+
+func TestConnect_InvalidPassword(t *testing.T) {
+	shouldLog = testing.Verbose()
+	old := authDelay
+	defer func() {
+		authDelay = old
+	}()
+	authDelay = 10 * time.Millisecond
+	cfg := config.Root{}
+	if err := cfg.LoadYaml([]byte(sampleConf)); err != nil {
+		t.Fatal(err)
+	}
+	cfg.API.Port = getFreePort(t)
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	connect := func(tc *testClient, password string) (bool, time.Duration) {
+		start := time.Now()
+		tc.send(&aioesphomeapi.ConnectRequest{Password: password})
+		r, ok := tc.recv().(*aioesphomeapi.ConnectResponse)
+		if !ok {
+			t.Fatal("expected ConnectResponse")
+		}
+		return !r.InvalidPassword, time.Since(start)
+	}
+	dial := func() *testClient {
+		c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.API.Port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		return &testClient{t: t, c: c}
+	}
+
+	// The delay doubles on each invalid password from the same address, and
+	// the connection is closed after each of them.
+	for i := 0; i < 3; i++ {
+		tc := dial()
+		ok, d := connect(tc, "Bar")
+		if ok {
+			t.Fatal("expected invalid password")
+		}
+		if want := authDelay << uint(i); d < want {
+			t.Fatalf("#%d: replied after %s; want at least %s", i, d, want)
+		}
+		if _, _, err = readMsg(tc.c); err == nil {
+			t.Fatalf("#%d: expected the connection to be closed", i)
+		}
+		_ = tc.c.Close()
+	}
+	// The valid password connects right away, before the next delay.
+	tc := dial()
+	if ok, d := connect(tc, cfg.API.Password); !ok || d >= authDelay<<3 {
+		t.Fatalf("got %t after %s", ok, d)
+	}
+	tc.close()
+	// The successful connection reset the delay.
+	tc = dial()
+	defer tc.c.Close()
+	if ok, d := connect(tc, "Bar"); ok || d >= authDelay<<1 {
+		t.Fatalf("got %t after %s", ok, d)
+	}
+}
+
+func TestConnect_HMAC(t *testing.T) {
+	shouldLog = testing.Verbose()
+	old := authDelay
+	defer func() {
+		authDelay = old
+	}()
+	authDelay = time.Millisecond
+	cfg := config.Root{}
+	if err := cfg.LoadYaml([]byte(sampleConf)); err != nil {
+		t.Fatal(err)
+	}
+	cfg.API.Port = getFreePort(t)
+	cfg.API.Auth = "hmac"
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	dial := func() *testClient {
+		c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.API.Port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		return &testClient{t: t, c: c}
+	}
+	hello := func(tc *testClient) []byte {
+		tc.send(&aioesphomeapi.HelloRequest{ClientInfo: "test"})
+		h, ok := tc.recv().(*aioesphomeapi.HelloResponse)
+		if !ok {
+			t.Fatal("expected HelloResponse")
+		}
+		i := strings.Index(h.ServerInfo, hmacChallenge)
+		if i == -1 {
+			t.Fatalf("no challenge in %q", h.ServerInfo)
+		}
+		nonce, err := hex.DecodeString(h.ServerInfo[i+len(hmacChallenge):])
+		if err != nil || len(nonce) != hmacNonceSize {
+			t.Fatalf("invalid challenge in %q", h.ServerInfo)
+		}
+		return nonce
+	}
+	// refused checks that password is refused and the connection closed.
+	refused := func(tc *testClient, password string) {
+		defer tc.c.Close()
+		tc.send(&aioesphomeapi.ConnectRequest{Password: password})
+		if r, ok := tc.recv().(*aioesphomeapi.ConnectResponse); !ok || !r.InvalidPassword {
+			t.Fatalf("expected the password to be refused, got %v", r)
+		}
+		if _, _, err := readMsg(tc.c); err == nil {
+			t.Fatal("expected the connection to be closed")
+		}
+	}
+
+	// The password is not accepted in clear.
+	tc := dial()
+	nonce := hello(tc)
+	refused(tc, cfg.API.Password)
+	// Only the last challenge is accepted.
+	tc = dial()
+	nonce2 := hello(tc)
+	if bytes.Equal(nonce, nonce2) {
+		t.Fatal("expected a new challenge")
+	}
+	hello(tc)
+	refused(tc, hmacPassword(cfg.API.Password, nonce2))
+
+	tc = dial()
+	tc.send(&aioesphomeapi.ConnectRequest{Password: hmacPassword(cfg.API.Password, hello(tc))})
+	if r, ok := tc.recv().(*aioesphomeapi.ConnectResponse); !ok || r.InvalidPassword {
+		t.Fatal("failed to connect")
+	}
+	tc.close()
+}
+
+func TestHandleRPC_Unauthenticated(t *testing.T) {
+	shouldLog = testing.Verbose()
+	cfg := config.Root{}
+	if err := cfg.LoadYaml([]byte(sampleConf)); err != nil {
+		t.Fatal(err)
+	}
+	cfg.API.Port = getFreePort(t)
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.API.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	tc := &testClient{t: t, c: c}
+	tc.send(&aioesphomeapi.HelloRequest{ClientInfo: "test"})
+	if _, ok := tc.recv().(*aioesphomeapi.HelloResponse); !ok {
+		t.Fatal("expected HelloResponse")
+	}
+	// DeviceInfo is needed to know whether a password is needed.
+	tc.send(&aioesphomeapi.DeviceInfoRequest{})
+	if r, ok := tc.recv().(*aioesphomeapi.DeviceInfoResponse); !ok || !r.UsesPassword {
+		t.Fatalf("unexpected %v", r)
+	}
+	tc.send(&aioesphomeapi.ListEntitiesRequest{})
+	if _, _, err = readMsg(c); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestConnect_HMACInvalid(t *testing.T) {
+	shouldLog = testing.Verbose()
+	old := authDelay
+	defer func() {
+		authDelay = old
+	}()
+	authDelay = time.Millisecond
+	cfg := config.Root{}
+	if err := cfg.LoadYaml([]byte(sampleConf)); err != nil {
+		t.Fatal(err)
+	}
+	cfg.API.Port = getFreePort(t)
+	cfg.API.Auth = "hmac"
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	var light component
+	for _, e := range n.entities {
+		if e.getName() == "fake light" {
+			light = e
+		}
+	}
+	if light == nil {
+		t.Fatal("no light")
+	}
+
+	c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.API.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	tc := &testClient{t: t, c: c}
+	tc.send(&aioesphomeapi.HelloRequest{ClientInfo: "test"})
+	if h, ok := tc.recv().(*aioesphomeapi.HelloResponse); !ok || !strings.Contains(h.ServerInfo, hmacChallenge) {
+		t.Fatalf("expected a challenge, got %v", h)
+	}
+	tc.send(&aioesphomeapi.ConnectRequest{Password: hmacPassword("Bar", make([]byte, hmacNonceSize))})
+	if r, ok := tc.recv().(*aioesphomeapi.ConnectResponse); !ok || !r.InvalidPassword {
+		t.Fatalf("expected the response to be refused, got %v", r)
+	}
+	// The writes may or may not fail depending on how fast the connection is
+	// closed, but nothing must come back and the light must not change.
+	for _, m := range []proto.Message{
+		&aioesphomeapi.ListEntitiesRequest{},
+		&aioesphomeapi.LightCommandRequest{Key: light.getHash(), HasState: true, State: true},
+	} {
+		raw, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = writeMsg(c, protoID(m), raw)
+	}
+	if id, _, err := readMsg(c); err == nil {
+		t.Fatalf("expected the connection to be closed, got message %d", id)
+	}
+	if s := light.getState().(*aioesphomeapi.LightStateResponse); s.State {
+		t.Fatal("the light was turned on")
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// The native API encryption is the Noise protocol framework with the
+// NNpsk0 handshake pattern, as documented at
+// https://esphome.io/components/api.html#configuration-variables and
+// http://www.noiseprotocol.org/noise.html.
+//
+// Each frame is the indicator byte 0x01, the big endian 16 bits length, then
+// the payload. The client sends an empty hello frame, the server replies with
+// its name, then the single round trip handshake follows. After it, each
+// payload is an encrypted message: the big endian 16 bits message ID and
+// length, then the protobuf message.
+
+const (
+	noiseProtocolName = "Noise_NNpsk0_25519_ChaChaPoly_SHA256"
+	noisePrologue     = "NoiseAPIInit"
+	// noiseMaxFrame is the largest payload of a frame.
+	noiseMaxFrame = 65535
+	// noiseCameraChunk is the largest image data sent in a single message.
+	noiseCameraChunk = 32 * 1024
+)
+
+// noiseConn is an established encrypted session.
+type noiseConn struct {
+	recv noiseCipher
+	send noiseCipher
+}
+
+// noiseHandshake does the server side of the handshake on rw.
+//
+// name is sent in the server hello. On failure, the client is sent the
+// reason when appropriate.
+func noiseHandshake(rw io.ReadWriter, psk []byte, name string) (*noiseConn, error) {
+	hello, err := readNoiseFrame(rw)
+	if err != nil {
+		if errors.Is(err, errNoiseIndicator) {
+			// Likely a plaintext client. Tell it to use encryption.
+			_ = writeNoiseFrame(rw, append([]byte{1}, "Bad indicator byte"...))
+		}
+		return nil, err
+	}
+	// The client hello content is part of the prologue.
+	prologue := make([]byte, 0, len(noisePrologue)+2+len(hello))
+	prologue = append(prologue, noisePrologue...)
+	prologue = append(prologue, byte(len(hello)>>8), byte(len(hello)))
+	prologue = append(prologue, hello...)
+
+	// Server hello: the chosen protocol then the NUL terminated name.
+	sh := make([]byte, 0, 2+len(name))
+	sh = append(sh, 1)
+	sh = append(sh, name...)
+	sh = append(sh, 0)
+	if err = writeNoiseFrame(rw, sh); err != nil {
+		return nil, err
+	}
+
+	msg, err := readNoiseFrame(rw)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) == 0 || msg[0] != 0 {
+		_ = writeNoiseFrame(rw, append([]byte{1}, "Handshake message invalid"...))
+		return nil, errors.New("noise: invalid handshake message")
+	}
+	var priv [32]byte
+	if _, err = rand.Read(priv[:]); err != nil {
+		return nil, err
+	}
+	reply, nc, err := noiseRespond(psk, prologue, msg[1:], priv[:])
+	if err != nil {
+		_ = writeNoiseFrame(rw, append([]byte{1}, "Handshake MAC failure"...))
+		return nil, err
+	}
+	if err = writeNoiseFrame(rw, append([]byte{0}, reply...)); err != nil {
+		return nil, err
+	}
+	return nc, nil
+}
+
+// noiseRespond processes the initiator's handshake message and returns the
+// reply and the resulting session.
+//
+// priv is the responder's ephemeral private key.
+func noiseRespond(psk, prologue, msg, priv []byte) ([]byte, *noiseConn, error) {
+	if len(msg) < 32+chacha20poly1305.Overhead {
+		return nil, nil, errors.New("noise: handshake message too short")
+	}
+	s := newNoiseSymmetric()
+	s.mixHash(prologue)
+
+	// -> psk, e
+	s.mixKeyAndHash(psk)
+	re := msg[:32]
+	s.mixHash(re)
+	// In psk handshakes, the ephemeral keys are also mixed in the key.
+	s.mixKey(re)
+	if _, err := s.decryptAndHash(msg[32:]); err != nil {
+		return nil, nil, err
+	}
+
+	// <- e, ee
+	e, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := append([]byte{}, e...)
+	s.mixHash(e)
+	s.mixKey(e)
+	dh, err := curve25519.X25519(priv, re)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.mixKey(dh)
+	out = append(out, s.encryptAndHash(nil)...)
+
+	k1, k2, _ := noiseHKDF(s.ck, nil)
+	nc := &noiseConn{}
+	// The first key is used by the initiator to send.
+	if nc.recv.aead, err = chacha20poly1305.New(k1[:]); err != nil {
+		return nil, nil, err
+	}
+	if nc.send.aead, err = chacha20poly1305.New(k2[:]); err != nil {
+		return nil, nil, err
+	}
+	return out, nc, nil
+}
+
+// readMsg reads and decrypts one message.
+func (nc *noiseConn) readMsg(r io.Reader) (int, []byte, error) {
+	b, err := readNoiseFrame(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if b, err = nc.recv.decrypt(nil, b); err != nil {
+		return 0, nil, err
+	}
+	if len(b) < 4 {
+		return 0, nil, errors.New("noise: message too short")
+	}
+	id := int(binary.BigEndian.Uint16(b))
+	l := int(binary.BigEndian.Uint16(b[2:]))
+	if l != len(b)-4 {
+		return 0, nil, fmt.Errorf("noise: invalid message length %d", l)
+	}
+	return id, b[4:], nil
+}
+
+// writeMsg encrypts and writes one message.
+func (nc *noiseConn) writeMsg(w io.Writer, id int, msg []byte) error {
+	if 4+len(msg)+chacha20poly1305.Overhead > noiseMaxFrame {
+		return fmt.Errorf("noise: message too large %d", len(msg))
+	}
+	b := make([]byte, 4, 4+len(msg))
+	binary.BigEndian.PutUint16(b, uint16(id))
+	binary.BigEndian.PutUint16(b[2:], uint16(len(msg)))
+	b = append(b, msg...)
+	return writeNoiseFrame(w, nc.send.encrypt(nil, b))
+}
+
+var errNoiseIndicator = errors.New("noise: invalid indicator byte")
+
+// readNoiseFrame reads one frame and returns its payload.
+func readNoiseFrame(r io.Reader) ([]byte, error) {
+	var hdr [3]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 1 {
+		return nil, errNoiseIndicator
+	}
+	b := make([]byte, int(hdr[1])<<8|int(hdr[2]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeNoiseFrame writes one frame in a single Write call.
+func writeNoiseFrame(w io.Writer, payload []byte) error {
+	if len(payload) > noiseMaxFrame {
+		return fmt.Errorf("noise: frame too large %d", len(payload))
+	}
+	b := make([]byte, 3, 3+len(payload))
+	b[0] = 1
+	b[1] = byte(len(payload) >> 8)
+	b[2] = byte(len(payload))
+	_, err := w.Write(append(b, payload...))
+	return err
+}
+
+// noiseCipher is a CipherState.
+type noiseCipher struct {
+	aead cipher.AEAD
+	n    uint64
+}
+
+func (c *noiseCipher) nonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.n)
+	c.n++
+	return nonce[:]
+}
+
+func (c *noiseCipher) encrypt(ad, plaintext []byte) []byte {
+	return c.aead.Seal(nil, c.nonce(), plaintext, ad)
+}
+
+func (c *noiseCipher) decrypt(ad, ciphertext []byte) ([]byte, error) {
+	return c.aead.Open(nil, c.nonce(), ciphertext, ad)
+}
+
+// noiseSymmetric is a SymmetricState.
+type noiseSymmetric struct {
+	ck [32]byte
+	h  [32]byte
+	c  noiseCipher
+}
+
+func newNoiseSymmetric() *noiseSymmetric {
+	// The protocol name is longer than 32 bytes, so it is hashed.
+	h := sha256.Sum256([]byte(noiseProtocolName))
+	return &noiseSymmetric{ck: h, h: h}
+}
+
+func (s *noiseSymmetric) mixHash(data []byte) {
+	d := sha256.New()
+	_, _ = d.Write(s.h[:])
+	_, _ = d.Write(data)
+	d.Sum(s.h[:0])
+}
+
+func (s *noiseSymmetric) mixKey(ikm []byte) {
+	var k [32]byte
+	s.ck, k, _ = noiseHKDF(s.ck, ikm)
+	s.initializeKey(k)
+}
+
+func (s *noiseSymmetric) mixKeyAndHash(ikm []byte) {
+	var h, k [32]byte
+	s.ck, h, k = noiseHKDF(s.ck, ikm)
+	s.mixHash(h[:])
+	s.initializeKey(k)
+}
+
+func (s *noiseSymmetric) initializeKey(k [32]byte) {
+	// Never fails with a 32 bytes key.
+	s.c.aead, _ = chacha20poly1305.New(k[:])
+	s.c.n = 0
+}
+
+func (s *noiseSymmetric) encryptAndHash(plaintext []byte) []byte {
+	out := s.c.encrypt(s.h[:], plaintext)
+	s.mixHash(out)
+	return out
+}
+
+func (s *noiseSymmetric) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	out, err := s.c.decrypt(s.h[:], ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return out, nil
+}
+
+// noiseHKDF returns the outputs of HKDF as defined by Noise.
+//
+// The first outputs do not depend on the number of outputs requested, so it
+// always returns three.
+func noiseHKDF(ck [32]byte, ikm []byte) ([32]byte, [32]byte, [32]byte) {
+	var out [3][32]byte
+	tmp := hmac.New(sha256.New, ck[:])
+	_, _ = tmp.Write(ikm)
+	key := tmp.Sum(nil)
+	var prev []byte
+	for i := range out {
+		h := hmac.New(sha256.New, key)
+		_, _ = h.Write(prev)
+		_, _ = h.Write([]byte{byte(i + 1)})
+		h.Sum(out[i][:0])
+		prev = out[i][:]
+	}
+	return out[0], out[1], out[2]
+}
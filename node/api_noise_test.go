@@ -0,0 +1,214 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestNoise(t *testing.T) {
+	shouldLog = testing.Verbose()
+	psk := make([]byte, 32)
+	if _, err := rand.Read(psk); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Root{}
+	cfg.PeriphHome.Name = "noisy"
+	cfg.API.IsPresent = true
+	cfg.API.Port = getFreePort(t)
+	cfg.API.Encryption.Key = base64.StdEncoding.EncodeToString(psk)
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Valid key.
+	c, name, nc, err := dialNoise(t, cfg.API.Port, psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "noisy" {
+		t.Fatalf("unexpected server name %q", name)
+	}
+	raw, err := proto.Marshal(&aioesphomeapi.HelloRequest{ClientInfo: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.writeMsg(c, protoID(&aioesphomeapi.HelloRequest{}), raw); err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := nc.readMsg(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != protoID(&aioesphomeapi.HelloResponse{}) {
+		t.Fatalf("unexpected id %d", id)
+	}
+	_ = c.Close()
+
+	// Invalid key.
+	c, _, _, err = dialNoise(t, cfg.API.Port, make([]byte, 32))
+	if err == nil || err.Error() != "Handshake MAC failure" {
+		t.Fatalf("unexpected %v", err)
+	}
+	_ = c.Close()
+
+	// Plaintext client.
+	c, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.API.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeMsg(c, protoID(&aioesphomeapi.HelloRequest{}), nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := readNoiseFrame(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte("\x01Bad indicator byte")) {
+		t.Fatalf("unexpected %q", b)
+	}
+}
+
+// TestNoiseRespond_KnownAnswer checks the handshake and the transport keys
+// against vectors generated with the github.com/flynn/noise implementation of
+// Noise_NNpsk0_25519_ChaChaPoly_SHA256, so a mistake made identically on both
+// sides of TestNoise is caught.
+func TestNoiseRespond_KnownAnswer(t *testing.T) {
+	seq := func(start byte) []byte {
+		b := make([]byte, 32)
+		for i := range b {
+			b[i] = start + byte(i)
+		}
+		return b
+	}
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	psk := seq(0)
+	// The client's ephemeral private key is 0x20, 0x21, ... and the client
+	// hello is empty.
+	m1 := unhex("358072d6365880d1aeea329adf9121383851ed21a28e3b75e965d0d2cd1662548b18e980a5463f4f4ed6a227d01eebb1")
+	reply, nc, err := noiseRespond(psk, []byte(noisePrologue+"\x00\x00"), m1, seq(0x40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := unhex("79a631eede1bf9c98f12032cdeadd0e7a079398fc786b88cc846ec89af85a51a08d629a47626962aacde23c4ab9801ba"); !bytes.Equal(reply, want) {
+		t.Fatalf("got reply %x; want %x", reply, want)
+	}
+	b, err := nc.recv.decrypt(nil, unhex("afbce0af929908ef8bc50a35b078633bdf444713"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 1, 0, 0}; !bytes.Equal(b, want) {
+		t.Fatalf("got %x; want %x", b, want)
+	}
+	if got, want := nc.send.encrypt(nil, []byte{0, 2, 0, 0}), unhex("8500850cc066513a6d478596bbb51a1fc8016333"); !bytes.Equal(got, want) {
+		t.Fatalf("got %x; want %x", got, want)
+	}
+}
+
+// dialNoise connects and does the client side of the handshake.
+//
+// It returns the server name and the session. A rejection from the server is
+// returned as an error with its explanation.
+func dialNoise(t *testing.T, port int, psk []byte) (net.Conn, string, *noiseConn, error) {
+	c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeNoiseFrame(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	sh, err := readNoiseFrame(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.IndexByte(sh, 0)
+	if len(sh) < 2 || sh[0] != 1 || i == -1 {
+		t.Fatalf("invalid server hello %q", sh)
+	}
+	name := string(sh[1:i])
+
+	// -> psk, e
+	s := newNoiseSymmetric()
+	s.mixHash([]byte(noisePrologue + "\x00\x00"))
+	s.mixKeyAndHash(psk)
+	priv := make([]byte, 32)
+	if _, err = rand.Read(priv); err != nil {
+		t.Fatal(err)
+	}
+	e, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mixHash(e)
+	s.mixKey(e)
+	msg := append([]byte{0}, e...)
+	msg = append(msg, s.encryptAndHash(nil)...)
+	if err = writeNoiseFrame(c, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// <- e, ee
+	reply, err := readNoiseFrame(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply) == 0 || reply[0] != 0 {
+		return c, name, nil, fmt.Errorf("%s", reply[1:])
+	}
+	re := reply[1:33]
+	s.mixHash(re)
+	s.mixKey(re)
+	dh, err := curve25519.X25519(priv, re)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mixKey(dh)
+	if _, err = s.decryptAndHash(reply[33:]); err != nil {
+		t.Fatal(err)
+	}
+	k1, k2, _ := noiseHKDF(s.ck, nil)
+	nc := &noiseConn{}
+	// Reversed from the server.
+	if nc.send.aead, err = chacha20poly1305.New(k1[:]); err != nil {
+		t.Fatal(err)
+	}
+	if nc.recv.aead, err = chacha20poly1305.New(k2[:]); err != nil {
+		t.Fatal(err)
+	}
+	return c, name, nc, nil
+}
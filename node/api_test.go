@@ -9,7 +9,10 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"html/template"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
@@ -19,8 +22,12 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/gpio/gpioreg"
 	"periph.io/x/conn/v3/gpio/gpiotest"
@@ -28,6 +35,7 @@ import (
 	"periph.io/x/conn/v3/spi/spireg"
 	"periph.io/x/conn/v3/spi/spitest"
 	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
 
 const sampleConf = `
@@ -59,7 +67,7 @@ sensor:
 `
 
 var wantPython = template.Must(template.New("").Parse(`API version: APIVersion(major=1, minor=3)
-Device info: DeviceInfo(uses_password=True, name='pi', mac_address='{{.Mac}}', compilation_time='pi device', model='{{.GOOS}}', has_deep_sleep=False, esphome_version='PeriphHome {{.Version}}')
+Device info: DeviceInfo(uses_password=True, name='pi', mac_address='{{.Mac}}', compilation_time='pi device', model='{{.Model}}', has_deep_sleep=False, esphome_version='PeriphHome {{.Version}}')
 
 Entities:
 - BinarySensorInfo(object_id='fakebinary_sensor', key=2604849794, name='fake binary_sensor', unique_id='pibinary_sensorfakebinary_sensor', device_class='motion', is_status_binary_sensor=False)
@@ -160,7 +168,7 @@ func TestIntegration(t *testing.T) {
 	want := bytes.Buffer{}
 	_, mac := getMainAddr()
 	if err := wantPython.Execute(&want, map[string]string{
-		"GOOS":    runtime.GOOS,
+		"Model":   boardModel(),
 		"Mac":     mac,
 		"Version": version,
 	}); err != nil {
@@ -171,6 +179,381 @@ func TestIntegration(t *testing.T) {
 	}
 }
 
+func TestSubscribeStates_Reconnect(t *testing.T) {
+	shouldLog = testing.Verbose()
+	cfg := config.Root{}
+	if err := cfg.LoadYaml([]byte(sampleConf)); err != nil {
+		t.Fatal(err)
+	}
+	cfg.API.Port = getFreePort(t)
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Each connection must get a value for every entity, including the camera.
+	for i := 0; i < 2; i++ {
+		c := dialTestClient(t, cfg.API.Port, cfg.API.Password)
+		c.send(&aioesphomeapi.ListEntitiesRequest{})
+		want := map[uint32]bool{}
+		for {
+			m := c.recv()
+			if _, ok := m.(*aioesphomeapi.ListEntitiesDoneResponse); ok {
+				break
+			}
+			want[getKey(t, m)] = true
+		}
+		c.send(&aioesphomeapi.SubscribeStatesRequest{})
+		c.send(&aioesphomeapi.CameraImageRequest{Single: true})
+		got := map[uint32]bool{}
+		for len(got) != len(want) {
+			k := getKey(t, c.recv())
+			if !want[k] {
+				t.Fatalf("unexpected key %d", k)
+			}
+			got[k] = true
+		}
+		c.close()
+	}
+}
+
+func TestNewSafeMode(t *testing.T) {
+	shouldLog = testing.Verbose()
+	cfg := config.SafeMode([]byte("sensor: bad"))
+	cfg.API.Port = getFreePort(t)
+	n, err := NewSafeMode(context.Background(), &cfg, errors.New("bad config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	c := dialTestClient(t, cfg.API.Port, "")
+	defer c.close()
+	c.send(&aioesphomeapi.ListEntitiesRequest{})
+	d, ok := c.recv().(*aioesphomeapi.ListEntitiesTextSensorResponse)
+	if !ok || d.Name != "Config Error" {
+		t.Fatalf("unexpected %#v", d)
+	}
+	if _, ok := c.recv().(*aioesphomeapi.ListEntitiesDoneResponse); !ok {
+		t.Fatal("expected ListEntitiesDoneResponse")
+	}
+	c.send(&aioesphomeapi.SubscribeStatesRequest{})
+	s, ok := c.recv().(*aioesphomeapi.TextSensorStateResponse)
+	if !ok || s.State != "bad config" {
+		t.Fatalf("unexpected %#v", s)
+	}
+}
+
+func TestListEntities_NamePrefix(t *testing.T) {
+	shouldLog = testing.Verbose()
+	cfg := config.Root{
+		PeriphHome: config.PeriphHome{Name: "node", NamePrefix: "Living Room"},
+		API:        config.API{Port: getFreePort(t), IsPresent: true},
+		Sensors: []config.Sensor{
+			{Platform: "fake", Name: "Temperature", UpdateInterval: time.Minute},
+		},
+	}
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	c := dialTestClient(t, cfg.API.Port, "")
+	defer c.close()
+	c.send(&aioesphomeapi.ListEntitiesRequest{})
+	d, ok := c.recv().(*aioesphomeapi.ListEntitiesSensorResponse)
+	if !ok {
+		t.Fatal("expected ListEntitiesSensorResponse")
+	}
+	// The IDs are not affected by the prefix.
+	if d.Name != "Living Room Temperature" || d.ObjectId != "temperature" || d.UniqueId != "nodesensortemperature" {
+		t.Fatalf("unexpected %#v", d)
+	}
+}
+
+// Messages defined in api.proto that are not implemented yet.
+//
+// When updating api.proto with thirdparty/update.go, new messages will show up
+// as failures in the tests below until they are either implemented or listed
+// here.
+var (
+	unsupportedServer = map[string]bool{
+		"ListEntitiesSelectResponse":      true,
+		"SelectStateResponse":             true,
+		"ListEntitiesSirenResponse":       true,
+		"SirenStateResponse":              true,
+		"ListEntitiesLockResponse":        true,
+		"LockStateResponse":               true,
+		"ListEntitiesMediaPlayerResponse": true,
+		"MediaPlayerStateResponse":        true,
+	}
+	unsupportedClient = map[string]bool{
+		"SelectCommandRequest":      true,
+		"SirenCommandRequest":       true,
+		"LockCommandRequest":        true,
+		"MediaPlayerCommandRequest": true,
+	}
+)
+
+func TestGetID(t *testing.T) {
+	msgs := aioesphomeapi.File_api_proto.Messages()
+	for i := 0; i < msgs.Len(); i++ {
+		d := msgs.Get(i)
+		id := int(proto.GetExtension(d.Options(), aioesphomeapi.E_Id).(uint32))
+		src := proto.GetExtension(d.Options(), aioesphomeapi.E_Source).(aioesphomeapi.APISourceType)
+		if id == 0 || src == aioesphomeapi.APISourceType_SOURCE_CLIENT {
+			continue
+		}
+		name := string(d.Name())
+		got := getID(protoByID(t, id))
+		if unsupportedServer[name] {
+			if got != 0 {
+				t.Errorf("%s is implemented, remove from unsupportedServer", name)
+			}
+			continue
+		}
+		if got != id {
+			t.Errorf("getID(%s) = %d; want %d", name, got, id)
+		}
+	}
+}
+
+func TestRequests(t *testing.T) {
+	msgs := aioesphomeapi.File_api_proto.Messages()
+	seen := map[int]bool{}
+	for i := 0; i < msgs.Len(); i++ {
+		d := msgs.Get(i)
+		id := int(proto.GetExtension(d.Options(), aioesphomeapi.E_Id).(uint32))
+		src := proto.GetExtension(d.Options(), aioesphomeapi.E_Source).(aioesphomeapi.APISourceType)
+		if id == 0 || src == aioesphomeapi.APISourceType_SOURCE_SERVER {
+			continue
+		}
+		name := string(d.Name())
+		typ, ok := requests[id]
+		if unsupportedClient[name] {
+			if ok {
+				t.Errorf("%s is implemented, remove from unsupportedClient", name)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("requests[%d] is missing for %s", id, name)
+			continue
+		}
+		if typ.Name() != name {
+			t.Errorf("requests[%d] = %s; want %s", id, typ.Name(), name)
+		}
+		seen[id] = true
+	}
+	for id := range requests {
+		if !seen[id] {
+			t.Errorf("requests[%d] is not a message sent by the client", id)
+		}
+	}
+}
+
+func TestHandleRPC(t *testing.T) {
+	shouldLog = testing.Verbose()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, client)
+	}()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}, logs: newLogSink(ioutil.Discard)}
+	c := &conn{c: server, n: n, cfg: n.cfg}
+	for id := range requests {
+		// Empty messages are fine, it's only to confirm that every message that
+		// can be deserialized is handled.
+		if err := c.handleRPC(ctx, id, nil); err != nil && strings.HasPrefix(err.Error(), "internal error") {
+			t.Errorf("handleRPC(%d): %s", id, err)
+		}
+	}
+	cancel()
+	n.wg.Wait()
+	if err := server.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConn_ReadTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	n := &Node{cfg: &config.Root{API: config.API{ReadTimeout: 10 * time.Millisecond}}}
+	c := &conn{c: server, n: n, cfg: n.cfg}
+	go func() {
+		// Stay idle for longer than the timeout, then stall after the first
+		// byte.
+		time.Sleep(50 * time.Millisecond)
+		_, _ = client.Write([]byte{0})
+	}()
+	_, _, err := c.readMsg()
+	var e net.Error
+	if !errors.As(err, &e) || !e.Timeout() {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestConn_DebugFrames(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	n := &Node{cfg: &config.Root{API: config.API{DebugFrames: true}}}
+	c := &conn{c: server, n: n, cfg: n.cfg}
+	buf := bytes.Buffer{}
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(prev)
+	go func() {
+		b := bytes.Buffer{}
+		_ = writeMsg(&b, protoID(&aioesphomeapi.PingRequest{}), nil)
+		_, _ = client.Write(b.Bytes())
+		_, _ = io.Copy(ioutil.Discard, client)
+	}()
+	if _, _, err := c.readMsg(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reply(&aioesphomeapi.PingResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(prev)
+	got := buf.String()
+	for _, want := range []string{"DEBUG: ", "<- id=7 PingRequest 0 bytes", "-> id=8 PingResponse 0 bytes"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+}
+
+func TestReadMsg_ShortReads(t *testing.T) {
+	want := bytes.Repeat([]byte("camera"), 10000)
+	b := bytes.Buffer{}
+	if err := writeMsg(&b, 44, want); err != nil {
+		t.Fatal(err)
+	}
+	id, got, err := readMsg(iotest.OneByteReader(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 44 {
+		t.Fatalf("unexpected id %d", id)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %d bytes, expected %d", len(got), len(want))
+	}
+}
+
+// testClient is a minimal native API client.
+type testClient struct {
+	t *testing.T
+	c net.Conn
+}
+
+// dialTestClient connects and authenticates to the node.
+func dialTestClient(t *testing.T, port int, password string) *testClient {
+	c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the test doesn't hang forever.
+	if err = c.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	tc := &testClient{t: t, c: c}
+	tc.send(&aioesphomeapi.HelloRequest{ClientInfo: "test"})
+	if _, ok := tc.recv().(*aioesphomeapi.HelloResponse); !ok {
+		t.Fatal("expected HelloResponse")
+	}
+	tc.send(&aioesphomeapi.ConnectRequest{Password: password})
+	if r, ok := tc.recv().(*aioesphomeapi.ConnectResponse); !ok || r.InvalidPassword {
+		t.Fatal("failed to connect")
+	}
+	return tc
+}
+
+func (tc *testClient) send(msg proto.Message) {
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	if err = writeMsg(tc.c, protoID(msg), raw); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+func (tc *testClient) recv() proto.Message {
+	id, raw, err := readMsg(tc.c)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	m := protoByID(tc.t, id)
+	if err = proto.Unmarshal(raw, m); err != nil {
+		tc.t.Fatal(err)
+	}
+	return m
+}
+
+// close gracefully disconnects.
+func (tc *testClient) close() {
+	tc.send(&aioesphomeapi.DisconnectRequest{})
+	for {
+		if _, ok := tc.recv().(*aioesphomeapi.DisconnectResponse); ok {
+			break
+		}
+	}
+	if err := tc.c.Close(); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+// protoID returns the message ID as defined in api.proto.
+func protoID(msg proto.Message) int {
+	opts := msg.ProtoReflect().Descriptor().Options()
+	return int(proto.GetExtension(opts, aioesphomeapi.E_Id).(uint32))
+}
+
+// protoByID returns a new message for the message ID as defined in api.proto.
+func protoByID(t *testing.T, id int) proto.Message {
+	msgs := aioesphomeapi.File_api_proto.Messages()
+	for i := 0; i < msgs.Len(); i++ {
+		d := msgs.Get(i)
+		if int(proto.GetExtension(d.Options(), aioesphomeapi.E_Id).(uint32)) != id {
+			continue
+		}
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(d.FullName())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mt.New().Interface()
+	}
+	t.Fatalf("unknown message id %d", id)
+	return nil
+}
+
+// getKey returns the entity key of a message.
+func getKey(t *testing.T, msg proto.Message) uint32 {
+	m := msg.ProtoReflect()
+	f := m.Descriptor().Fields().ByName("key")
+	if f == nil {
+		t.Fatalf("%T has no key", msg)
+	}
+	return uint32(m.Get(f).Uint())
+}
+
 func getFreePort(t *testing.T) int {
 	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -192,3 +575,33 @@ func init() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
 	networkBind = "127.0.0.1"
 }
+
+func TestIsAllowed(t *testing.T) {
+	n := Node{}
+	for _, c := range []string{"192.168.1.10", "10.0.0.0/8", "fd00::/8"} {
+		subnet, err := config.ParseSubnet(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.allowed = append(n.allowed, subnet)
+	}
+	data := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.1.10", true},
+		{"192.168.1.11", false},
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"fd12::1", true},
+		{"fe80::1", false},
+	}
+	for i, line := range data {
+		if got := n.isAllowed(&net.TCPAddr{IP: net.ParseIP(line.ip), Port: 1234}); got != line.want {
+			t.Errorf("#%d: isAllowed(%s) = %t", i, line.ip, got)
+		}
+	}
+	if !(&Node{}).isAllowed(&net.TCPAddr{IP: net.ParseIP("1.2.3.4")}) {
+		t.Fatal("expected allowed when no list")
+	}
+}
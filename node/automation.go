@@ -0,0 +1,196 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// startActions runs the actions in the background. It must be called once the
+// entities and outputs referenced by the actions are loaded.
+//
+// The actions are canceled by stopActions().
+func (n *Node) startActions(ctx context.Context, trigger string, actions []config.Action) {
+	if len(actions) == 0 {
+		return
+	}
+	if n.cancelActions == nil {
+		ctx, n.cancelActions = context.WithCancel(ctx)
+	}
+	n.actionsWG.Add(1)
+	go func() {
+		defer n.actionsWG.Done()
+		if err := n.runActions(ctx, actions); err != nil {
+			log.Printf("%s: %s", trigger, err)
+		}
+	}()
+}
+
+// stopActions cancels the running actions and waits for them to complete.
+func (n *Node) stopActions() {
+	if n.cancelActions != nil {
+		n.cancelActions()
+		n.cancelActions = nil
+	}
+	n.actionsWG.Wait()
+}
+
+// shutdownTimeout bounds the time to run all the on_shutdown actions. It is a
+// variable to be overridden in tests.
+var shutdownTimeout = 5 * time.Second
+
+// runShutdownActions runs the on_shutdown actions of the actuators loaded by
+// entries so they are left in a safe state. It must be called before the
+// entities and outputs are closed.
+//
+// An action still running after shutdownTimeout is abandoned so it cannot hang
+// the shutdown.
+func (n *Node) runShutdownActions(entries []*entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, e := range entries {
+		var actions []config.Action
+		switch c := e.cfg.(type) {
+		case *config.Light:
+			actions = c.OnShutdown
+		case *config.Switch:
+			actions = c.OnShutdown
+		case *config.Cover:
+			actions = c.OnShutdown
+		}
+		if len(actions) == 0 {
+			continue
+		}
+		log.Printf("%s: running on_shutdown", e.name)
+		done := make(chan error, 1)
+		go func() {
+			done <- n.runActions(ctx, actions)
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("%s: on_shutdown: %s", e.name, err)
+			}
+		case <-ctx.Done():
+			log.Printf("%s: on_shutdown: timed out after %s", e.name, shutdownTimeout)
+			return
+		}
+	}
+}
+
+// runActions runs the actions sequentially. It stops at the first error.
+func (n *Node) runActions(ctx context.Context, actions []config.Action) error {
+	for i := range actions {
+		if err := n.runAction(ctx, &actions[i]); err != nil {
+			return fmt.Errorf("action #%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (n *Node) runAction(ctx context.Context, a *config.Action) error {
+	switch {
+	case a.LightTurnOn != nil:
+		in := &aioesphomeapi.LightCommandRequest{HasState: true, State: true}
+		if b := a.LightTurnOn.Brightness; b != nil {
+			in.HasBrightness = true
+			in.Brightness = float32(*b)
+		}
+		return n.lightAction(a.LightTurnOn.Name, in)
+	case a.LightTurnOff != nil:
+		return n.lightAction(a.LightTurnOff.Name, &aioesphomeapi.LightCommandRequest{HasState: true})
+	case a.OutputTurnOn != nil:
+		o, err := n.findOutput(a.OutputTurnOn.ID)
+		if err != nil {
+			return err
+		}
+		level := float32(1)
+		if l := a.OutputTurnOn.Level; l != nil {
+			level = float32(*l)
+		}
+		return o.set(level)
+	case a.OutputTurnOff != nil:
+		o, err := n.findOutput(a.OutputTurnOff.ID)
+		if err != nil {
+			return err
+		}
+		return o.set(0)
+	case a.OutputPulse != nil:
+		o, err := n.findOutput(a.OutputPulse.ID)
+		if err != nil {
+			return err
+		}
+		level := float32(1)
+		if l := a.OutputPulse.Level; l != nil {
+			level = float32(*l)
+		}
+		if err = o.set(level); err != nil {
+			return err
+		}
+		// Always turn the output back off, even when canceled.
+		sleepContext(ctx, a.OutputPulse.Duration)
+		return o.set(0)
+	case a.SwitchTurnOn != nil:
+		return n.switchAction(a.SwitchTurnOn.Name, true)
+	case a.SwitchTurnOff != nil:
+		return n.switchAction(a.SwitchTurnOff.Name, false)
+	case a.CoverOpen != nil:
+		return n.coverAction(a.CoverOpen.Name, &aioesphomeapi.CoverCommandRequest{HasPosition: true, Position: 1})
+	case a.CoverClose != nil:
+		return n.coverAction(a.CoverClose.Name, &aioesphomeapi.CoverCommandRequest{HasPosition: true})
+	case a.CoverStop != nil:
+		return n.coverAction(a.CoverStop.Name, &aioesphomeapi.CoverCommandRequest{Stop: true})
+	case a.Delay != 0:
+		sleepContext(ctx, a.Delay)
+		return ctx.Err()
+	default:
+		return fmt.Errorf("internal error: unknown action %#v", a)
+	}
+}
+
+// lightAction sends a command to a light as if it came from a client.
+func (n *Node) lightAction(name string, in *aioesphomeapi.LightCommandRequest) error {
+	e, err := n.findEntities([]string{name})
+	if err != nil {
+		return err
+	}
+	in.Key = e[0].getHash()
+	return e[0].lightCommand(in)
+}
+
+// switchAction sends a command to a switch as if it came from a client.
+func (n *Node) switchAction(name string, on bool) error {
+	e, err := n.findEntities([]string{name})
+	if err != nil {
+		return err
+	}
+	return e[0].switchCommand(&aioesphomeapi.SwitchCommandRequest{Key: e[0].getHash(), State: on})
+}
+
+// coverAction sends a command to a cover as if it came from a client.
+func (n *Node) coverAction(name string, in *aioesphomeapi.CoverCommandRequest) error {
+	e, err := n.findEntities([]string{name})
+	if err != nil {
+		return err
+	}
+	in.Key = e[0].getHash()
+	return e[0].coverCommand(in)
+}
+
+// sleepContext sleeps for d or until the context is canceled.
+func sleepContext(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestRunActions(t *testing.T) {
+	o := &outputRecord{float: true}
+	n := &Node{
+		cfg:     &config.Root{},
+		lookup:  map[uint32]component{},
+		outputs: map[string]output{"pwm": o, "gpio": &outputRecord{}},
+	}
+	cfg := config.Light{Platform: "monochromatic", Name: "Lamp", Output: "pwm"}
+	if err := n.loadLight(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	half := 0.5
+	actions := []config.Action{
+		{LightTurnOn: &config.LightAction{Name: "Lamp", Brightness: &half}},
+		{Delay: time.Millisecond},
+		{LightTurnOff: &config.LightAction{Name: "Lamp"}},
+		{OutputPulse: &config.OutputAction{ID: "pwm", Level: &half, Duration: time.Millisecond}},
+		{OutputTurnOn: &config.OutputAction{ID: "pwm"}},
+	}
+	if err := n.runActions(context.Background(), actions); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]float32{0.5, 0, 0.5, 0, 1}, o.levels); diff != "" {
+		t.Fatalf("levels mismatch (-want +got):\n%s", diff)
+	}
+	if s := n.entities[0].getState().(*aioesphomeapi.LightStateResponse); s.State {
+		t.Fatal("expected light off")
+	}
+	if err := n.runActions(context.Background(), []config.Action{{OutputTurnOff: &config.OutputAction{ID: "unknown"}}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRunShutdownActions(t *testing.T) {
+	o := &outputRecord{float: true}
+	quarter := 0.25
+	n := &Node{
+		cfg: &config.Root{
+			Lights: []config.Light{
+				{
+					Platform:   "monochromatic",
+					Name:       "Lamp",
+					Output:     "pwm",
+					OnShutdown: []config.Action{{OutputTurnOn: &config.OutputAction{ID: "pwm", Level: &quarter}}},
+				},
+				{
+					Platform: "monochromatic",
+					Name:     "Stuck",
+					Output:   "pwm",
+					// Never completes in time.
+					OnShutdown: []config.Action{{Delay: time.Hour}, {OutputTurnOff: &config.OutputAction{ID: "pwm"}}},
+				},
+			},
+		},
+		lookup:  map[uint32]component{},
+		outputs: map[string]output{"pwm": o},
+	}
+	old := shutdownTimeout
+	defer func() {
+		shutdownTimeout = old
+	}()
+	shutdownTimeout = 10 * time.Millisecond
+	start := time.Now()
+	n.runShutdownActions(n.entries(n.cfg, nil))
+	if d := time.Since(start); d > time.Minute {
+		t.Fatalf("took %s", d)
+	}
+	if diff := cmp.Diff([]float32{0.25}, o.levels); diff != "" {
+		t.Fatalf("levels mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -15,6 +15,11 @@ import (
 func (n *Node) loadBinarySensor(ctx context.Context, cfg *config.BinarySensor) error {
 	log.Printf("loading binary_sensor %s", cfg.Platform)
 	switch cfg.Platform {
+	case "combine":
+		if err := n.loadBinarySensorCombine(ctx, cfg); err != nil {
+			return fmt.Errorf("binary_sensor(%s): %w", cfg.Name, err)
+		}
+		return nil
 	case "fake":
 		if err := n.loadBinarySensorFake(ctx, cfg); err != nil {
 			return fmt.Errorf("binary_sensor(%s): %w", cfg.Name, err)
@@ -0,0 +1,141 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadBinarySensorCombine loads a binary sensor combining other binary
+// sensors, e.g. two door contacts into one "any door open".
+func (n *Node) loadBinarySensorCombine(ctx context.Context, cfg *config.BinarySensor) error {
+	if len(cfg.Sensors) < 2 {
+		return errors.New("at least two sensors are required")
+	}
+	if cfg.Pin.Number != "" || cfg.HoldTime != 0 {
+		return errors.New("do not use pin / hold_time")
+	}
+	sources, err := n.findEntities(cfg.Sensors)
+	if err != nil {
+		return err
+	}
+	for _, s := range sources {
+		if s.getType() != binarySensorComponent {
+			return fmt.Errorf("%s is not a binary_sensor", s.getName())
+		}
+	}
+	return n.addEntity(ctx, &binarySensorCombine{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: binarySensorComponent,
+		},
+		deviceClass: cfg.DeviceClass,
+		and:         cfg.Operator == "and",
+		sources:     sources,
+	})
+}
+
+type binarySensorCombine struct {
+	componentBase
+	deviceClass string
+	and         bool
+	sources     []component
+
+	wg     sync.WaitGroup
+	cancel func()
+
+	stateMu sync.Mutex
+	// states is the state of each source; nil until known.
+	states []*bool
+}
+
+func (b *binarySensorCombine) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	return nil
+}
+
+func (b *binarySensorCombine) init(ctx context.Context, n *Node) error {
+	if err := b.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	b.states = make([]*bool, len(b.sources))
+	ctx, b.cancel = context.WithCancel(ctx)
+	for i, s := range b.sources {
+		b.wg.Add(1)
+		go func(i int, s component) {
+			defer b.wg.Done()
+			// The current state, if any, is sent right away.
+			s.subscribe(ctx, &combineInput{b: b, i: i})
+		}(i, s)
+	}
+	return nil
+}
+
+// update processes a new state from source i.
+func (b *binarySensorCombine) update(i int, msg *aioesphomeapi.BinarySensorStateResponse) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	if msg.MissingState {
+		b.states[i] = nil
+	} else {
+		v := msg.State
+		b.states[i] = &v
+	}
+	state, missing := combine(b.states, b.and)
+	b.onNewState(&aioesphomeapi.BinarySensorStateResponse{
+		Key:          b.key,
+		State:        state,
+		MissingState: missing,
+	})
+}
+
+// combine returns the combined state. The result is missing only when it
+// depends on unknown states.
+func combine(states []*bool, and bool) (bool, bool) {
+	missing := false
+	for _, s := range states {
+		if s == nil {
+			missing = true
+		} else if *s != and {
+			// A false input for "and", a true input for "or".
+			return !and, false
+		}
+	}
+	if missing {
+		return false, true
+	}
+	return and, false
+}
+
+func (b *binarySensorCombine) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesBinarySensorResponse{
+		ObjectId:    b.objectID,
+		Key:         b.key,
+		Name:        b.name,
+		UniqueId:    b.uniqueID,
+		DeviceClass: b.deviceClass,
+	}
+}
+
+// combineInput implements clientConn to receive the state updates of a source.
+type combineInput struct {
+	b *binarySensorCombine
+	i int
+}
+
+func (c *combineInput) reply(msg proto.Message) error {
+	if s, ok := msg.(*aioesphomeapi.BinarySensorStateResponse); ok {
+		c.b.update(c.i, s)
+	}
+	return nil
+}
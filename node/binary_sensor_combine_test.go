@@ -0,0 +1,92 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestCombine(t *testing.T) {
+	on, off := true, false
+	data := []struct {
+		states      []*bool
+		and         bool
+		wantState   bool
+		wantMissing bool
+	}{
+		{[]*bool{&on, &off}, false, true, false},
+		{[]*bool{&off, &off}, false, false, false},
+		{[]*bool{nil, &on}, false, true, false},
+		{[]*bool{nil, &off}, false, false, true},
+		{[]*bool{&on, &on}, true, true, false},
+		{[]*bool{&on, &off}, true, false, false},
+		{[]*bool{nil, &off}, true, false, false},
+		{[]*bool{nil, &on}, true, false, true},
+	}
+	for i, line := range data {
+		state, missing := combine(line.states, line.and)
+		if state != line.wantState || missing != line.wantMissing {
+			t.Errorf("#%d: got %t, %t", i, state, missing)
+		}
+	}
+}
+
+func TestBinarySensorCombine(t *testing.T) {
+	n := &Node{cfg: &config.Root{}}
+	var doors []component
+	for _, name := range []string{"Front door", "Back door"} {
+		d := &binarySensorGPIO{componentBase: componentBase{name: name, componentType: binarySensorComponent}}
+		if err := d.componentBase.init(context.Background(), n); err != nil {
+			t.Fatal(err)
+		}
+		doors = append(doors, d)
+	}
+	// The front door state is known before the combined sensor starts.
+	doors[0].(*binarySensorGPIO).update(true)
+
+	b := &binarySensorCombine{
+		componentBase: componentBase{name: "Any door", componentType: binarySensorComponent},
+		sources:       doors,
+	}
+	if err := b.init(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	_, ch, cur := b.register()
+	get := func() *aioesphomeapi.BinarySensorStateResponse {
+		if cur != nil {
+			msg := cur
+			cur = nil
+			return msg.(*aioesphomeapi.BinarySensorStateResponse)
+		}
+		select {
+		case msg := <-ch:
+			return msg.(*aioesphomeapi.BinarySensorStateResponse)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+			return nil
+		}
+	}
+	if s := get(); !s.State || s.MissingState {
+		t.Fatalf("unexpected %v", s)
+	}
+	doors[1].(*binarySensorGPIO).update(true)
+	if s := get(); !s.State {
+		t.Fatalf("unexpected %v", s)
+	}
+	doors[0].(*binarySensorGPIO).update(false)
+	if s := get(); !s.State {
+		t.Fatalf("unexpected %v", s)
+	}
+	doors[1].(*binarySensorGPIO).update(false)
+	if s := get(); s.State || s.MissingState {
+		t.Fatalf("unexpected %v", s)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -37,48 +38,177 @@ func (n *Node) loadBinarySensorGPIO(ctx context.Context, cfg *config.BinarySenso
 	default:
 		return errors.New("unknown pin mode")
 	}
-	if err := p.In(pull, gpio.BothEdges); err != nil {
-		return err
-	}
-	return n.addEntity(ctx, &binarySensorGPIO{
+	b := &binarySensorGPIO{
 		componentBase: componentBase{
 			name:          cfg.Name,
 			componentType: binarySensorComponent,
 		},
 		deviceClass: cfg.DeviceClass,
 		p:           p,
+		pull:        pull,
 		inverted:    cfg.Pin.Inverted,
-	})
+		hold:        cfg.HoldTime,
+	}
+	switch cfg.Backend {
+	case "", "periph":
+	case "cdev":
+		b.chip = cfg.GPIOChip
+		if b.chip == "" {
+			b.chip = "/dev/gpiochip0"
+		}
+	default:
+		return fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+	if err := b.open(); err != nil && b.chip != "" {
+		log.Printf("%s: gpio character device not available, falling back to periph: %s", cfg.Name, err)
+		b.chip = ""
+		if err = b.open(); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return n.addEntity(ctx, b)
 }
 
 type binarySensorGPIO struct {
 	componentBase
 	deviceClass string
 	p           gpio.PinIO
-	inverted    bool
-	wg          sync.WaitGroup
-	cancel      func()
+	pull        gpio.Pull
+	// chip is set when the gpio character device is used instead of p.
+	chip     string
+	inverted bool
+	hold     time.Duration
+	wg       sync.WaitGroup
+	cancel   func()
+
+	// stateMu protects state, off, paused and line.
+	stateMu sync.Mutex
+	state   bool
+	off     *time.Timer
+	paused  bool
+	line    *cdevLine
 }
 
 func (b *binarySensorGPIO) Close() error {
+	b.stateMu.Lock()
+	paused := b.paused
+	b.stateMu.Unlock()
+	var err error
+	if !paused {
+		err = b.stop()
+	}
+	b.stateMu.Lock()
+	if b.off != nil {
+		b.off.Stop()
+		b.off = nil
+	}
+	b.stateMu.Unlock()
+	return err
+}
+
+// open configures the input.
+func (b *binarySensorGPIO) open() error {
+	if b.chip == "" {
+		return b.p.In(b.pull, gpio.BothEdges)
+	}
+	l, err := openCdevLine(b.chip, b.p.Number(), b.pull, "periphhome")
+	if err != nil {
+		return err
+	}
+	b.stateMu.Lock()
+	b.line = l
+	b.stateMu.Unlock()
+	return nil
+}
+
+// stop stops the goroutines and releases the input.
+func (b *binarySensorGPIO) stop() error {
 	b.cancel()
-	err := b.p.Halt()
+	// The line is closed by the goroutine waiting for the context.
+	var err error
+	if b.line == nil {
+		err = b.p.Halt()
+	}
 	b.wg.Wait()
 	return err
 }
 
+// pause implements pauser.
+func (b *binarySensorGPIO) pause() error {
+	b.stateMu.Lock()
+	// A failed resume leaves it paused.
+	paused := b.paused
+	b.paused = true
+	b.stateMu.Unlock()
+	if paused {
+		return nil
+	}
+	return b.stop()
+}
+
+// resume implements pauser.
+func (b *binarySensorGPIO) resume(ctx context.Context) error {
+	if err := b.open(); err != nil {
+		return err
+	}
+	b.stateMu.Lock()
+	b.paused = false
+	b.stateMu.Unlock()
+	// The input may have changed while paused.
+	l := b.level()
+	b.update(l)
+	b.start(ctx, l)
+	return nil
+}
+
 func (b *binarySensorGPIO) init(ctx context.Context, n *Node) error {
 	if err := b.componentBase.init(ctx, n); err != nil {
 		return err
 	}
 
-	l := bool(b.p.Read()) != b.inverted
+	l := b.level()
+	b.state = l
 	b.onNewState(&aioesphomeapi.BinarySensorStateResponse{
 		Key:   b.key,
 		State: l,
 	})
+	b.start(ctx, l)
+	return nil
+}
 
+// start starts the goroutines tracking the input, which is currently l.
+func (b *binarySensorGPIO) start(ctx context.Context, l bool) {
 	ctx, b.cancel = context.WithCancel(ctx)
+	if b.line != nil {
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			<-ctx.Done()
+			_ = b.line.Close()
+		}()
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			for {
+				// Returns an error once the line is closed.
+				v, err := b.line.waitEdge()
+				if err != nil {
+					if ctx.Err() == nil {
+						b.setError(err)
+					}
+					break
+				}
+				if l2 := v != b.inverted; l2 != l {
+					l = l2
+					b.update(l)
+				}
+			}
+			b.cancel()
+		}()
+		return
+	}
 	b.wg.Add(1)
 	go func() {
 		defer b.wg.Done()
@@ -100,15 +230,81 @@ func (b *binarySensorGPIO) init(ctx context.Context, n *Node) error {
 			}
 			if l2 := bool(b.p.Read()) != b.inverted; l2 != l {
 				l = l2
-				b.onNewState(&aioesphomeapi.BinarySensorStateResponse{
-					Key:   b.key,
-					State: bool(l) != b.inverted,
-				})
+				b.update(l)
 			}
 		}
 		b.cancel()
 	}()
-	return nil
+}
+
+// level returns the current input level, with inverted applied.
+//
+// b.line must not change concurrently.
+func (b *binarySensorGPIO) level() bool {
+	if b.line != nil {
+		v, err := b.line.read()
+		if err != nil {
+			b.setError(err)
+		}
+		return v != b.inverted
+	}
+	return bool(b.p.Read()) != b.inverted
+}
+
+// update processes a new input level, applying hold.
+func (b *binarySensorGPIO) update(l bool) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	if l || b.hold == 0 {
+		if b.off != nil {
+			b.off.Stop()
+			b.off = nil
+		}
+		if b.state != l {
+			b.state = l
+			b.publishLocked()
+		}
+		return
+	}
+	if !b.state {
+		return
+	}
+	// Restart the delay on each edge.
+	if b.off != nil {
+		b.off.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(b.hold, func() {
+		b.stateMu.Lock()
+		defer b.stateMu.Unlock()
+		// Ignore if it was superseded by a newer edge.
+		if b.off == t {
+			b.off = nil
+			b.state = false
+			b.publishLocked()
+		}
+	})
+	b.off = t
+}
+
+// publishLocked publishes b.state. b.stateMu must be held.
+func (b *binarySensorGPIO) publishLocked() {
+	b.onNewState(&aioesphomeapi.BinarySensorStateResponse{
+		Key:   b.key,
+		State: b.state,
+	})
+}
+
+// republish implements republisher.
+func (b *binarySensorGPIO) republish() {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	// While held, the input level is not the state. While paused, the input
+	// must not be touched.
+	if b.hold == 0 && !b.paused {
+		b.state = b.level()
+	}
+	b.publishLocked()
 }
 
 func (b *binarySensorGPIO) describe() proto.Message {
@@ -0,0 +1,89 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestBinarySensorGPIO_Hold(t *testing.T) {
+	b := &binarySensorGPIO{
+		componentBase: componentBase{name: "Motion", componentType: binarySensorComponent},
+		hold:          100 * time.Millisecond,
+	}
+	if err := b.componentBase.init(context.Background(), &Node{cfg: &config.Root{}}); err != nil {
+		t.Fatal(err)
+	}
+	_, ch, _ := b.register()
+	get := func() bool {
+		select {
+		case msg := <-ch:
+			return msg.(*aioesphomeapi.BinarySensorStateResponse).State
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+			return false
+		}
+	}
+
+	b.update(true)
+	if !get() {
+		t.Fatal("expected on")
+	}
+	// Motion stops then resumes within the hold time: no change.
+	b.update(false)
+	b.update(true)
+	b.update(false)
+	start := time.Now()
+	if get() {
+		t.Fatal("expected off")
+	}
+	if d := time.Since(start); d < b.hold {
+		t.Fatalf("turned off after %s", d)
+	}
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected %v", msg)
+	default:
+	}
+}
+
+func TestBinarySensorGPIO_CdevFallback(t *testing.T) {
+	p := gpiotest.Pin{N: "FAKE_GPIO_CDEV", L: gpio.High, EdgesChan: make(chan gpio.Level)}
+	if err := gpioreg.Register(&p); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := gpioreg.Unregister(p.N); err != nil {
+			t.Error(err)
+		}
+	}()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.BinarySensor{
+		Platform: "gpio",
+		Name:     "Door",
+		Pin:      config.Pin{Number: p.N, Mode: config.Input},
+		Backend:  "cdev",
+		GPIOChip: "/dev/does-not-exist",
+	}
+	if err := n.loadBinarySensorGPIO(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	b := n.entities[0].(*binarySensorGPIO)
+	defer b.Close()
+	if b.line != nil {
+		t.Fatal("expected fallback to periph")
+	}
+	if s := b.getState().(*aioesphomeapi.BinarySensorStateResponse); !s.State {
+		t.Fatal("expected on")
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+
+	"periph.io/x/host/v3/distro"
+)
+
+// boardModel returns the name of the board, e.g. "Raspberry Pi 4 Model B Rev
+// 1.4", as reported to Home Assistant.
+//
+// It is read from the device tree on ARM boards and from the DMI tables on
+// PCs. Falls back to the OS name.
+func boardModel() string {
+	if m := strings.TrimSpace(distro.DTModel()); m != "" && m != "<unknown>" {
+		return m
+	}
+	if runtime.GOOS == "linux" {
+		/* #nosec G304 */
+		if b, err := ioutil.ReadFile(dmiProductName); err == nil {
+			if m := strings.TrimSpace(string(b)); m != "" {
+				return m
+			}
+		}
+	}
+	return runtime.GOOS
+}
+
+// dmiProductName is the product name of a PC.
+var dmiProductName = "/sys/class/dmi/id/product_name"
@@ -0,0 +1,44 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"periph.io/x/host/v3/distro"
+)
+
+func TestBoardModel(t *testing.T) {
+	if distro.DTModel() != "<unknown>" {
+		t.Skip("the device tree takes precedence")
+	}
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	old := dmiProductName
+	defer func() {
+		dmiProductName = old
+	}()
+	dmiProductName = filepath.Join(dir, "product_name")
+	if m := boardModel(); m != runtime.GOOS {
+		t.Fatalf("unexpected %q", m)
+	}
+	if err = ioutil.WriteFile(dmiProductName, []byte("NUC8i5BEH\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := "NUC8i5BEH"
+	if runtime.GOOS != "linux" {
+		want = runtime.GOOS
+	}
+	if m := boardModel(); m != want {
+		t.Fatalf("unexpected %q", m)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+const (
+	// bootCountFile is the file in state_dir containing the number of times
+	// the node started.
+	bootCountFile = "boot_count"
+	// runningFile is the file in state_dir present while the node is running.
+	// If it is present at startup, the node did not shut down cleanly.
+	runningFile = "running"
+)
+
+// Boot reasons.
+const (
+	bootFirst   = "first boot"
+	bootRestart = "restart"
+	bootCrash   = "crash"
+)
+
+// recordBoot increments the boot counter in dir and determines the boot
+// reason.
+func (n *Node) recordBoot(dir string) error {
+	p := filepath.Join(dir, bootCountFile)
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(b) != 0 {
+		// A corrupted counter must not prevent the node from starting.
+		if n.bootCount, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil {
+			log.Printf("invalid %s, resetting it: %s", p, err)
+			n.bootCount = 0
+		}
+	}
+	n.bootCount++
+	if err = writeFileAtomic(p, []byte(strconv.Itoa(n.bootCount)+"\n")); err != nil {
+		return err
+	}
+
+	r := filepath.Join(dir, runningFile)
+	if _, err = os.Stat(r); err == nil {
+		n.bootReason = bootCrash
+	} else if n.bootCount == 1 {
+		n.bootReason = bootFirst
+	} else {
+		n.bootReason = bootRestart
+	}
+	logf("boot #%d: %s", n.bootCount, n.bootReason)
+	return writeFileAtomic(r, nil)
+}
+
+// recordCleanShutdown removes the marker written by recordBoot.
+func recordCleanShutdown(dir string) error {
+	return os.Remove(filepath.Join(dir, runningFile))
+}
+
+func (n *Node) loadSensorBootCount(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" || cfg.Address != 0 || cfg.UpdateInterval != 0 {
+		return errors.New("do not use temperature / pressure / humidity / address / update_interval")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	if n.bootCount == 0 {
+		return errors.New("periphhome: state_dir is required")
+	}
+	s := &sensorDiagnostic{
+		sensorBase: sensorBase{
+			componentBase: componentBase{name: cfg.Name},
+			icon:          "mdi:restart",
+			stateClass:    aioesphomeapi.SensorStateClass_STATE_CLASS_TOTAL_INCREASING,
+		},
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	if err := n.addEntity(ctx, s); err != nil {
+		return err
+	}
+	s.setValue(float32(n.bootCount))
+	return nil
+}
+
+func (n *Node) loadTextSensorBootReason(ctx context.Context, cfg *config.TextSensor) error {
+	if n.bootReason == "" {
+		return errors.New("periphhome: state_dir is required")
+	}
+	t := &textSensorDiagnostic{
+		componentBase: componentBase{name: cfg.Name},
+		icon:          "mdi:information-outline",
+	}
+	if err := n.addEntity(ctx, t); err != nil {
+		return err
+	}
+	t.setValue(n.bootReason)
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordBoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []struct {
+		clean      bool
+		wantCount  int
+		wantReason string
+	}{
+		{true, 1, bootFirst},
+		{false, 2, bootRestart},
+		{true, 3, bootCrash},
+		{true, 4, bootRestart},
+	}
+	for i, line := range data {
+		n := Node{}
+		if err = n.recordBoot(dir); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if n.bootCount != line.wantCount || n.bootReason != line.wantReason {
+			t.Errorf("#%d: got %d %q; want %d %q", i, n.bootCount, n.bootReason, line.wantCount, line.wantReason)
+		}
+		if line.clean {
+			if err = recordCleanShutdown(dir); err != nil {
+				t.Fatalf("#%d: %s", i, err)
+			}
+		}
+	}
+}
+
+func TestRecordBoot_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// As left by a power loss while writing.
+	if err = ioutil.WriteFile(filepath.Join(dir, bootCountFile), []byte("1\x00\x00"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	n := Node{}
+	if err = n.recordBoot(dir); err != nil {
+		t.Fatal(err)
+	}
+	if n.bootCount != 1 {
+		t.Fatalf("got %d", n.bootCount)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, bootCountFile))
+	if err != nil || string(b) != "1\n" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadButtonTemplate loads a button running a shell command when pressed,
+// e.g. to restart a service.
+func (n *Node) loadButtonTemplate(ctx context.Context, cfg *config.Button) error {
+	if cfg.Command == "" {
+		return errors.New("command is required")
+	}
+	b := &buttonTemplate{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: buttonComponent,
+		},
+		icon:        cfg.Icon,
+		deviceClass: cfg.DeviceClass,
+		command:     cfg.Command,
+	}
+	return n.addEntity(ctx, b)
+}
+
+type buttonTemplate struct {
+	componentBase
+	icon        string
+	deviceClass string
+	command     string
+
+	ctx    context.Context
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+// Close kills the commands still running.
+func (b *buttonTemplate) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	return nil
+}
+
+func (b *buttonTemplate) init(ctx context.Context, n *Node) error {
+	if err := b.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	b.ctx, b.cancel = context.WithCancel(ctx)
+	return nil
+}
+
+// buttonCommand runs the command in the background, so a long command doesn't
+// block the connection.
+func (b *buttonTemplate) buttonCommand(in *aioesphomeapi.ButtonCommandRequest) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	log.Printf("%s: pressed", b.name)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		if err := b.run(); err != nil {
+			b.setError(err)
+		}
+	}()
+	return nil
+}
+
+// run runs the command.
+func (b *buttonTemplate) run() error {
+	/* #nosec G204 */
+	out, err := exec.CommandContext(b.ctx, "/bin/sh", "-c", b.command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, out)
+	}
+	return nil
+}
+
+func (b *buttonTemplate) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesButtonResponse{
+		ObjectId:    b.objectID,
+		Key:         b.key,
+		Name:        b.name,
+		UniqueId:    b.uniqueID,
+		Icon:        b.icon,
+		DeviceClass: b.deviceClass,
+	}
+}
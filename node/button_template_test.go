@@ -0,0 +1,75 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestButtonTemplate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /bin/sh")
+	}
+	f := filepath.Join(t.TempDir(), "pressed")
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	ctx := context.Background()
+	if err := n.loadButton(ctx, &config.Button{Platform: "template", Name: "Restart", DeviceClass: "restart", Command: "printf 1 >> " + f}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.loadButton(ctx, &config.Button{Platform: "template", Name: "Fail", Command: "echo oops; exit 1"}); err != nil {
+		t.Fatal(err)
+	}
+	b := n.entities[0]
+	d := b.describe().(*aioesphomeapi.ListEntitiesButtonResponse)
+	if d.Name != "Restart" || d.DeviceClass != "restart" {
+		t.Fatalf("unexpected %v", d)
+	}
+	for i := 0; i < 2; i++ {
+		if err := b.buttonCommand(&aioesphomeapi.ButtonCommandRequest{Key: b.getHash()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fail := n.entities[1]
+	if err := fail.buttonCommand(&aioesphomeapi.ButtonCommandRequest{Key: fail.getHash()}); err != nil {
+		t.Fatal(err)
+	}
+	b.(*buttonTemplate).wg.Wait()
+	fail.(*buttonTemplate).wg.Wait()
+	for _, e := range n.entities {
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b, err := ioutil.ReadFile(f); err != nil || string(b) != "11" {
+		t.Fatalf("unexpected %q, %v", b, err)
+	}
+	if msg, _ := fail.getLastError(); !strings.Contains(msg, "oops") {
+		t.Fatalf("unexpected %q", msg)
+	}
+	if b.buttonCommand(&aioesphomeapi.ButtonCommandRequest{Key: b.getHash()}) == nil {
+		t.Fatal("expected error once closed")
+	}
+}
+
+func TestLoadButton_Err(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	data := []config.Button{
+		{Platform: "template", Name: "Restart"},
+		{Platform: "unknown", Name: "Restart", Command: "true"},
+	}
+	for i := range data {
+		if err := n.loadButton(context.Background(), &data[i]); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
@@ -10,15 +10,15 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
 	"image/jpeg"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
+	"google.golang.org/protobuf/proto"
 	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
 
 func (n *Node) loadCamera(ctx context.Context, cfg *config.Camera) error {
@@ -34,11 +34,317 @@ func (n *Node) loadCamera(ctx context.Context, cfg *config.Camera) error {
 			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
 		}
 		return nil
+	case "v4l2":
+		if err := n.loadCameraV4L2(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
 	default:
 		return fmt.Errorf("unknown platform %q", cfg.Platform)
 	}
 }
 
+// cameraBase is the common code for all cameras.
+type cameraBase struct {
+	componentBase
+	fps int
+
+	// refresh, if set, synchronously generates a new frame.
+	refresh func() error
+
+	// rtspPort is the RTSP port, if enabled.
+	rtspPort   int
+	cancelRTSP func()
+
+	// alwaysOn disables pausing the capture when there is no subscriber.
+	alwaysOn bool
+	// startCapture and stopCapture resume and pause the capture. If not set,
+	// the capture is never paused.
+	startCapture func() error
+	stopCapture  func()
+
+	captureMu sync.Mutex
+	capturing bool
+	idle      *time.Timer
+
+	// delivered is the number of frames sent to API clients. It is accessed
+	// atomically.
+	delivered uint32
+
+	// webToken, if set, is required to stream the camera over the web server.
+	webToken string
+
+	// raw distributes the frames before JPEG encoding to local consumers.
+	raw frameBus
+
+	// timestamp, if set, is the time overlaid on each frame.
+	timestamp *timestampOverlay
+}
+
+// cameraIdleDelay is how long a camera keeps capturing after the last
+// subscriber left, so that periodic single frame requests do not restart the
+// capture each time. It is a variable to be overridden in tests.
+var cameraIdleDelay = 30 * time.Second
+
+// initCapture must be called from init() once the capture is started.
+func (c *cameraBase) initCapture() {
+	c.captureMu.Lock()
+	c.capturing = true
+	c.captureMu.Unlock()
+	if c.alwaysOn || c.stopCapture == nil {
+		return
+	}
+	c.mu.Lock()
+	c.onSubscribers = c.subscribersChanged
+	c.mu.Unlock()
+	c.subscribersChanged(c.subscribers())
+}
+
+// closeCapture stops the capture. It must be called from Close().
+func (c *cameraBase) closeCapture() {
+	c.mu.Lock()
+	c.onSubscribers = nil
+	c.mu.Unlock()
+	c.captureMu.Lock()
+	defer c.captureMu.Unlock()
+	if c.idle != nil {
+		c.idle.Stop()
+		c.idle = nil
+	}
+	if c.capturing && c.stopCapture != nil {
+		c.stopCapture()
+	}
+	c.capturing = false
+}
+
+// isCapturing returns true if the capture is not paused.
+func (c *cameraBase) isCapturing() bool {
+	c.captureMu.Lock()
+	defer c.captureMu.Unlock()
+	return c.capturing
+}
+
+// subscribersChanged resumes the capture when there is a subscriber and pauses
+// it cameraIdleDelay after the last one left.
+func (c *cameraBase) subscribersChanged(n int) {
+	c.captureMu.Lock()
+	defer c.captureMu.Unlock()
+	if n != 0 {
+		if c.idle != nil {
+			c.idle.Stop()
+			c.idle = nil
+		}
+		if !c.capturing {
+			log.Printf("%s: resuming capture", c.name)
+			if err := c.startCapture(); err != nil {
+				log.Printf("%s: failed to resume capture: %s", c.name, err)
+				return
+			}
+			c.capturing = true
+		}
+		return
+	}
+	if !c.capturing || c.idle != nil {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(cameraIdleDelay, func() {
+		c.captureMu.Lock()
+		defer c.captureMu.Unlock()
+		// Ignore if a subscriber came in the meantime.
+		if c.idle != t {
+			return
+		}
+		c.idle = nil
+		if c.capturing && c.subscribers() == 0 {
+			log.Printf("%s: no subscriber, pausing capture", c.name)
+			c.stopCapture()
+			c.capturing = false
+		}
+	})
+	c.idle = t
+}
+
+// startRTSP starts the RTSP server if enabled. It must be called from init()
+// after componentBase.init().
+func (c *cameraBase) startRTSP(ctx context.Context, n *Node) error {
+	if c.rtspPort == 0 {
+		return nil
+	}
+	ctx, c.cancelRTSP = context.WithCancel(ctx)
+	r := &rtspServer{c: c, host: n.bind, port: c.rtspPort}
+	if err := r.start(ctx, &n.wg); err != nil {
+		c.cancelRTSP()
+		c.cancelRTSP = nil
+		return err
+	}
+	return nil
+}
+
+// stopRTSP stops the RTSP server, if it was started.
+func (c *cameraBase) stopRTSP() {
+	if c.cancelRTSP != nil {
+		c.cancelRTSP()
+	}
+}
+
+// camera returns the common camera code. It is used to find cameras among
+// the entities.
+func (c *cameraBase) camera() *cameraBase {
+	return c
+}
+
+// latestFrames subscribes to the frames until ctx is canceled.
+//
+// The subscription is always drained so a slow consumer never blocks the
+// camera. Only the latest frame is kept.
+func (c *cameraBase) latestFrames(ctx context.Context, wg *sync.WaitGroup) <-chan []byte {
+	frames := make(chan []byte, 1)
+	k, ch, _ := c.register()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer c.unregister(k)
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case msg := <-ch:
+				select {
+				case <-frames:
+				default:
+				}
+				frames <- msg.(*aioesphomeapi.CameraImageResponse).Data
+			}
+		}
+	}()
+	return frames
+}
+
+func (c *cameraBase) subscribe(ctx context.Context, cc clientConn) {
+	log.Printf("camera cannot be subscribed to")
+}
+
+func (c *cameraBase) cameraStream(ctx context.Context, cc clientConn, in *aioesphomeapi.CameraImageRequest) {
+	// Reuse the componentBase fields that are used for subscribe(). It's fine
+	// because "camera" doesn't support subscribe().
+	log.Printf("%s(single=%t, stream=%t)", c.name, in.Single, in.Stream)
+
+	// If there was a previous Stream = true message, a Single should cancel the stream. :/
+
+	k, ch, _ := c.register()
+	defer c.unregister(k)
+
+	// Send a fresh frame as the initial message, so a client reconnecting
+	// doesn't get a stale picture. Fallback to the last frame if the camera
+	// is too slow.
+	if c.refresh != nil {
+		if err := c.refresh(); err != nil {
+			log.Printf("%s: failed to refresh: %s", c.name, err)
+		}
+	}
+	wait := time.NewTimer(2 * time.Second / time.Duration(c.fps))
+	var msg proto.Message
+	select {
+	case msg = <-ch:
+	case <-wait.C:
+		msg = c.getState()
+	case <-ctx.Done():
+	}
+	wait.Stop()
+	if msg == nil {
+		log.Printf("%s: no frame available", c.name)
+		return
+	}
+	// Duplicate it, since we need to set Done:true if a stream is not requested.
+	first := proto.Clone(msg).(*aioesphomeapi.CameraImageResponse)
+	first.Done = !in.Stream
+	if err := cc.reply(first); err != nil {
+		return
+	}
+	atomic.AddUint32(&c.delivered, 1)
+	if !in.Stream {
+		return
+	}
+
+	// In ESPHome, it stops after 5 seconds. Not sure why.
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	done := ctx.Done()
+
+	// Drain the subscription in the background so a client on a congested
+	// network never blocks the capture, and thus the recording. Only the
+	// latest frame is kept.
+	latest := make(chan proto.Message, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case msg := <-ch:
+				select {
+				case <-latest:
+				default:
+				}
+				latest <- msg
+			}
+		}
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	// avg is the smoothed time it takes to write a frame to the client. Frames
+	// coming faster than that are skipped, to match the rate the client can
+	// actually absorb.
+	avg := time.Duration(0)
+	last := time.Time{}
+	for stop := false; !stop; {
+		select {
+		case msg := <-latest:
+			if ctx.Err() != nil {
+				// Stop promptly on shutdown even if frames keep coming.
+				stop = true
+				continue
+			}
+			start := time.Now()
+			if start.Sub(last) < avg {
+				continue
+			}
+			if err := cc.reply(msg); err != nil {
+				stop = true
+				continue
+			}
+			avg = (7*avg + time.Since(start)) / 8
+			last = start
+			atomic.AddUint32(&c.delivered, 1)
+		case <-done:
+			stop = true
+		}
+	}
+}
+
+func (c *cameraBase) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesCameraResponse{
+		ObjectId: c.objectID,
+		Key:      c.key,
+		Name:     c.name,
+		UniqueId: c.uniqueID,
+	}
+}
+
+// snapshotExt returns the file extension for a snapshot_format value.
+func snapshotExt(format string) string {
+	if format == "png" {
+		return "png"
+	}
+	return "jpg"
+}
+
 // rawRGB24JpegEncoder takes a raw RGB24 stream and encodes it to JPEG.
 type rawRGB24JpegEncoder struct {
 	onNewImage func(b []byte)
@@ -46,19 +352,31 @@ type rawRGB24JpegEncoder struct {
 	width      int
 	height     int
 	quality    int
+	// timestamp, if set, is added to each frame.
+	timestamp *timestampOverlay
+
+	// onNewRaw, if set, is called with each frame before the timestamp is
+	// added. img is only valid for the duration of the call.
+	onNewRaw func(img *imageRGB24)
+	// onNewFrame, if set, is called with each frame after the timestamp is
+	// added, e.g. to record it. img is only valid for the duration of the call.
+	onNewFrame func(img *imageRGB24)
 }
 
 func (r *rawRGB24JpegEncoder) Write(b []byte) (int, error) {
-	// TODO(maruel): send the data into ffmpeg for it to split into mpegts with a
-	// index.m3u8. This enables serving the directory as-is for visioning history
-	// via a web browser.
 	_, _ = r.buf.Write(b)
 	f := r.width * r.height * 3
 	for r.buf.Len() >= f {
 		// Warning: this goes in the slow code path for Encode(). Do a benchmark to
 		// compare with image.RGBA which is more optimized.
 		img := imageRGB24{w: r.width, h: r.height, pix: r.buf.Bytes()[:f]}
-		addTimestamp(&img, color.RGBA{200, 100, 0, 255}, time.Now())
+		if r.onNewRaw != nil {
+			r.onNewRaw(&img)
+		}
+		addTimestamp(&img, r.timestamp, time.Now())
+		if r.onNewFrame != nil {
+			r.onNewFrame(&img)
+		}
 		buf := bytes.Buffer{}
 		if err := jpeg.Encode(&buf, &img, &jpeg.Options{Quality: r.quality}); err != nil {
 			log.Printf("jpeg failure: %s", err)
@@ -109,9 +427,6 @@ type rawYUV420JpegEncoder struct {
 }
 
 func (r *rawYUV420JpegEncoder) Write(b []byte) (int, error) {
-	// TODO(maruel): send the data into ffmpeg for it to split into mpegts with a
-	// index.m3u8. This enables serving the directory as-is for visioning history
-	// via a web browser.
 	_, _ = r.buf.Write(b)
 	f := (r.width*r.height*3 + 1) / 2
 	for r.buf.Len() >= f {
@@ -146,22 +461,3 @@ func rawYUV420ToImage(w, h int, raw []byte) *image.YCbCr {
 	}
 }
 */
-
-// addTimestamp adds the time `now` to an image.
-func addTimestamp(img draw.Image, c color.RGBA, now time.Time) {
-	// TODO(maruel): Make the text size proportional to the image width.
-	// TODO(maruel): Align top right.
-	b := img.Bounds()
-	x := b.Max.X
-	y := b.Max.Y
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(c),
-		Face: basicfont.Face7x13,
-		Dot: fixed.Point26_6{
-			X: fixed.Int26_6(x / 3 * 64),
-			Y: fixed.Int26_6(y / 3 * 64),
-		},
-	}
-	d.DrawString(now.Format("2006-01-02 15:04:05"))
-}
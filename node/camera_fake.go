@@ -7,57 +7,97 @@ package node
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
+	"image/png"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
-	"google.golang.org/protobuf/proto"
 	"periph.io/x/home/node/config"
 	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
 
 func (n *Node) loadCameraFake(ctx context.Context, cfg *config.Camera) error {
-	// It is recommended to use 720p or lower as it improves low light recording.
-	return n.addEntity(ctx, &cameraFake{
-		componentBase: componentBase{
-			name:          cfg.Name,
-			componentType: cameraComponent,
+	if cfg.Exposure != "" || cfg.AWB != "" || cfg.Flicker != "" || cfg.ISO != 0 || cfg.Shutter != 0 {
+		return errors.New("do not use exposure / awb / flicker / iso / shutter")
+	}
+	c := &cameraFake{
+		cameraBase: cameraBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: cameraComponent,
+			},
+			fps:       1,
+			rtspPort:  cfg.RTSPPort,
+			webToken:  cfg.WebToken,
+			alwaysOn:  cfg.AlwaysOn || cfg.Directory != "",
+			timestamp: newTimestampOverlay(&cfg.Timestamp, color.RGBA{255, 255, 255, 255}),
 		},
 		directory: cfg.Directory,
+		format:    cfg.SnapshotFormat,
 		rotation:  cfg.Rotation,
 		width:     320,
 		height:    240,
 		quality:   90,
-		fps:       1,
-	})
+	}
+	if cfg.Width != 0 {
+		c.width, c.height = cfg.Width, cfg.Height
+	}
+	if cfg.FPS != 0 {
+		c.fps = cfg.FPS
+	}
+	if cfg.Quality != 0 {
+		c.quality = cfg.Quality
+	}
+	c.refresh = func() error {
+		return c.genImage(time.Now())
+	}
+	// The generating loop checks isCapturing().
+	c.startCapture = func() error { return nil }
+	c.stopCapture = func() {}
+	c.pruner = newDiskPruner(cfg)
+	if err := n.addEntity(ctx, c); err != nil {
+		return err
+	}
+	return c.addDeliveredFPS(ctx, n, &cfg.DeliveredFPS)
 }
 
 type cameraFake struct {
-	componentBase
+	cameraBase
 	directory string
+	format    string
 	rotation  int
 	width     int
 	height    int
 	quality   int
-	fps       int
+	pruner    *diskPruner
 
+	// genMu serializes genImage() between the generating loop and refresh.
+	genMu  sync.Mutex
 	index  int
 	cancel func()
 }
 
 func (c *cameraFake) Close() error {
+	c.stopRTSP()
+	c.closeCapture()
 	c.cancel()
 	return nil
 }
 
+func (c *cameraFake) recordDir() string {
+	return c.directory
+}
+
 func (c *cameraFake) init(ctx context.Context, n *Node) error {
 	if err := c.componentBase.init(ctx, n); err != nil {
 		return err
@@ -72,7 +112,7 @@ func (c *cameraFake) init(ctx context.Context, n *Node) error {
 		} else if !fi.IsDir() {
 			return fmt.Errorf("exists but is not a directory: %s", c.directory)
 		} else {
-			names, err := filepath.Glob(filepath.Join(c.directory, "i*.jpg"))
+			names, err := filepath.Glob(filepath.Join(c.directory, "i*."+snapshotExt(c.format)))
 			if err != nil {
 				return nil
 			}
@@ -80,7 +120,7 @@ func (c *cameraFake) init(ctx context.Context, n *Node) error {
 				sort.Strings(names)
 				for i := range names {
 					n := filepath.Base(names[len(names)-1-i])
-					if len(n) != 15 {
+					if len(n) != 12+len(snapshotExt(c.format)) {
 						continue
 					}
 					v, err := strconv.Atoi(n[1:11])
@@ -101,6 +141,9 @@ func (c *cameraFake) init(ctx context.Context, n *Node) error {
 	}
 
 	ctx, c.cancel = context.WithCancel(ctx)
+	if c.pruner != nil {
+		c.pruner.run(ctx, &n.wg)
+	}
 	n.wg.Add(1)
 	go func() {
 		defer n.wg.Done()
@@ -112,88 +155,63 @@ func (c *cameraFake) init(ctx context.Context, n *Node) error {
 			case <-done:
 				return
 			case now := <-t.C:
+				if !c.isCapturing() {
+					continue
+				}
 				if err := c.genImage(now); err != nil {
 					log.Printf("internal failure: %s", err)
 				}
 			}
 		}
 	}()
+	if err := c.startRTSP(ctx, n); err != nil {
+		c.cancel()
+		return err
+	}
+	c.initCapture()
 	return nil
 }
 
 func (c *cameraFake) genImage(now time.Time) error {
-	img := genRGBATimeImg(c.width, c.height, now)
+	c.genMu.Lock()
+	defer c.genMu.Unlock()
+	img := genRGBATimeImg(c.width, c.height, c.rotation, c.timestamp, now)
+	c.raw.publishImage(img)
 	buf := bytes.Buffer{}
 	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: c.quality}); err != nil {
 		return err
 	}
-	if err := c.onNewPicture(buf.Bytes()); err != nil {
+	if err := c.onNewPicture(img, buf.Bytes()); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *cameraFake) subscribe(ctx context.Context, cc clientConn) {
-	log.Printf("camera cannot be subscribed to")
-}
-
-func (c *cameraFake) cameraStream(ctx context.Context, cc clientConn, in *aioesphomeapi.CameraImageRequest) {
-	// Reuse the componentBase fields that are used for subscribe(). It's fine
-	// because "camera" doesn't support subscribe().
-	log.Printf("cameraFake(single=%t, stream=%t)", in.Single, in.Stream)
-
-	// If there was a previous Stream = true message, a Single should cancel the stream. :/
-
-	// Send initial message.
-	c.mu.Lock()
-	// Duplicate it, since we need to set Done:true if a stream is not requested.
-	msg := proto.Clone(c.currentMsg).(*aioesphomeapi.CameraImageResponse)
-	c.mu.Unlock()
-	msg.Done = !in.Stream
-	if err := cc.reply(msg); err != nil {
-		return
-	}
-	if !in.Stream {
-		return
-	}
-
-	k, ch, _ := c.register()
-	defer c.unregister(k)
-	// In ESPHome, it stops after 5 seconds. Not sure why.
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	done := ctx.Done()
-	for stop := false; !stop; {
-		select {
-		case msg := <-ch:
-			if err := cc.reply(msg); err != nil {
-				stop = true
-			}
-		case <-done:
-			stop = true
-		}
-	}
-}
-
-func (c *cameraFake) describe() proto.Message {
-	return &aioesphomeapi.ListEntitiesCameraResponse{
-		ObjectId: c.objectID,
-		Key:      c.key,
-		Name:     c.name,
-		UniqueId: c.uniqueID,
-	}
-}
-
-func (c *cameraFake) onNewPicture(b []byte) error {
+// onNewPicture publishes the JPEG encoded frame b and saves img if recording.
+func (c *cameraFake) onNewPicture(img image.Image, b []byte) error {
 	c.onNewState(&aioesphomeapi.CameraImageResponse{
 		Key:  c.key,
 		Data: b,
 	})
-	n := fmt.Sprintf("i%010d.jpg", c.index)
+	n := fmt.Sprintf("i%010d.%s", c.index, snapshotExt(c.format))
 	//log.Printf("saving %s %d bytes", n, len(b))
 	if c.directory != "" {
+		if c.format == "png" {
+			buf := bytes.Buffer{}
+			if err := png.Encode(&buf, img); err != nil {
+				return err
+			}
+			b = buf.Bytes()
+		}
+		if c.pruner != nil {
+			c.pruner.mu.Lock()
+		}
 		/* #nosec G306 */
-		if err := ioutil.WriteFile(filepath.Join(c.directory, n), b, 0o644); err != nil {
+		err := ioutil.WriteFile(filepath.Join(c.directory, n), b, 0o644)
+		if c.pruner != nil {
+			c.pruner.mu.Unlock()
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -231,9 +249,43 @@ func linearGradient(img *image.RGBA, a, b color.RGBA) {
 }
 
 // genRGBATimeImg generates a simple image with time.
-func genRGBATimeImg(w, h int, now time.Time) *image.RGBA {
+//
+// Like a real camera, the image is rotated before the timestamp is added so
+// the timestamp is upright.
+func genRGBATimeImg(w, h, rotation int, ts *timestampOverlay, now time.Time) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
 	linearGradient(img, color.RGBA{0, 0, 128, 255}, color.RGBA{72, 0, 0, 255})
-	addTimestamp(img, color.RGBA{255, 255, 255, 255}, now)
+	img = rotateRGBA(img, rotation)
+	addTimestamp(img, ts, now)
 	return img
 }
+
+// rotateRGBA returns img rotated clockwise by rotation degrees, which must be
+// 0, 90, 180 or 270.
+func rotateRGBA(img *image.RGBA, rotation int) *image.RGBA {
+	w := img.Bounds().Dx()
+	h := img.Bounds().Dy()
+	var dst *image.RGBA
+	switch rotation {
+	case 90, 270:
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	case 180:
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	default:
+		return img
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.RGBAAt(x, y)
+			switch rotation {
+			case 90:
+				dst.SetRGBA(h-1-y, x, c)
+			case 180:
+				dst.SetRGBA(w-1-x, h-1-y, c)
+			case 270:
+				dst.SetRGBA(y, w-1-x, c)
+			}
+		}
+	}
+	return dst
+}
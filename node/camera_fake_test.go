@@ -0,0 +1,131 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestCameraFake_Rotation(t *testing.T) {
+	shouldLog = testing.Verbose()
+	data := []struct {
+		rotation int
+		want     image.Point
+	}{
+		{0, image.Pt(320, 240)},
+		{90, image.Pt(240, 320)},
+		{180, image.Pt(320, 240)},
+		{270, image.Pt(240, 320)},
+	}
+	for i, l := range data {
+		n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+		cfg := config.Camera{Platform: "fake", Name: "Cam", Rotation: l.rotation, Quality: 50}
+		if err := n.loadCamera(context.Background(), &cfg); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		c := n.entities[0].(*cameraFake)
+		if c.quality != 50 {
+			t.Fatalf("#%d: quality %d", i, c.quality)
+		}
+		if err := c.genImage(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		msg := c.getState().(*aioesphomeapi.CameraImageResponse)
+		img, err := jpeg.Decode(bytes.NewReader(msg.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := img.Bounds().Size(); got != l.want {
+			t.Fatalf("#%d: got %s; want %s", i, got, l.want)
+		}
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCameraFake_PNG(t *testing.T) {
+	shouldLog = testing.Verbose()
+	d, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Camera{Platform: "fake", Name: "Cam", Rotation: 90, Directory: d, SnapshotFormat: "png"}
+	if err = n.loadCamera(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	c := n.entities[0].(*cameraFake)
+	defer func() {
+		if err := c.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err = c.genImage(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	names, err := filepath.Glob(filepath.Join(d, "i*.png"))
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no snapshot: %v", err)
+	}
+	f, err := os.Open(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img.Bounds().Size(), image.Pt(240, 320); got != want {
+		t.Fatalf("got %s; want %s", got, want)
+	}
+}
+
+func TestRotateRGBA(t *testing.T) {
+	// 3x2 image, each pixel red channel is its index:
+	//   0 1 2
+	//   3 4 5
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		img.SetRGBA(i%3, i/3, color.RGBA{R: uint8(i), A: 255})
+	}
+	data := []struct {
+		rotation int
+		want     [][]uint8
+	}{
+		{0, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{90, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{180, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{270, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for i, l := range data {
+		got := rotateRGBA(img, l.rotation)
+		if got.Bounds().Dy() != len(l.want) || got.Bounds().Dx() != len(l.want[0]) {
+			t.Fatalf("#%d: unexpected size %s", i, got.Bounds())
+		}
+		for y, row := range l.want {
+			for x, v := range row {
+				if r := got.RGBAAt(x, y).R; r != v {
+					t.Fatalf("#%d: (%d,%d) = %d; want %d", i, x, y, r, v)
+				}
+			}
+		}
+	}
+}
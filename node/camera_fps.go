@@ -0,0 +1,69 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// deliveredFPSInterval is the interval at which the delivered frame rate is
+// computed.
+const deliveredFPSInterval = 10 * time.Second
+
+// addDeliveredFPS loads the diagnostic sensor reporting the rate of frames
+// sent to API clients, if configured. It must be called after the camera was
+// added.
+func (c *cameraBase) addDeliveredFPS(ctx context.Context, n *Node, p *config.SensorParams) error {
+	if p.Name == "" {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	s := &sensorDiagnostic{
+		sensorBase: sensorBase{
+			componentBase: componentBase{name: p.Name},
+			calibration:   p.CalibrateLinear,
+			icon:          "mdi:speedometer",
+			unit:          "fps",
+			accuracy:      1,
+			stateClass:    aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+		},
+		stop: func() {
+			cancel()
+			wg.Wait()
+		},
+	}
+	s.override(p.UnitOfMeasurement, p.AccuracyDecimals, p.DeviceClass, p.StateClass)
+	if err := n.addEntity(ctx, s); err != nil {
+		cancel()
+		return err
+	}
+	s.setValue(0)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(deliveredFPSInterval)
+		defer t.Stop()
+		done := ctx.Done()
+		prev := atomic.LoadUint32(&c.delivered)
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				cur := atomic.LoadUint32(&c.delivered)
+				s.setValue(float32(cur-prev) / float32(deliveredFPSInterval/time.Second))
+				prev = cur
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"sync"
+)
+
+// frameBus distributes the raw frames of a camera to local consumers, before
+// they are JPEG encoded for the native API.
+//
+// It saves the consumers from decoding the JPEG back to pixels. The frames are
+// shared by all the consumers and must not be modified.
+type frameBus struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]chan *imageRGB24
+}
+
+// active returns true if there is at least one consumer, so a camera can skip
+// preparing raw frames nobody uses.
+func (f *frameBus) active() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs) != 0
+}
+
+// publish sends a copy of img to all the consumers.
+//
+// It never blocks: a consumer lagging behind only gets the latest frame.
+func (f *frameBus) publish(img *imageRGB24) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.subs) == 0 {
+		return
+	}
+	// The caller usually reuses its buffer.
+	c := &imageRGB24{w: img.w, h: img.h, pix: append([]byte(nil), img.pix...)}
+	for _, ch := range f.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- c
+	}
+}
+
+// publishImage converts img to RGB24 and publishes it, if there is any
+// consumer.
+func (f *frameBus) publishImage(img image.Image) {
+	if !f.active() {
+		return
+	}
+	b := img.Bounds()
+	c := &imageRGB24{w: b.Dx(), h: b.Dy(), pix: make([]byte, b.Dx()*b.Dy()*3)}
+	draw.Draw(c, c.Bounds(), img, b.Min, draw.Src)
+	f.publish(c)
+}
+
+// subscribe returns the frames until ctx is canceled.
+//
+// Only the latest frame is kept, so a slow consumer never blocks the camera.
+func (f *frameBus) subscribe(ctx context.Context, wg *sync.WaitGroup) <-chan *imageRGB24 {
+	ch := make(chan *imageRGB24, 1)
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = map[int]chan *imageRGB24{}
+	}
+	k := f.next
+	f.next++
+	f.subs[k] = ch
+	f.mu.Unlock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		f.mu.Lock()
+		delete(f.subs, k)
+		f.mu.Unlock()
+	}()
+	return ch
+}
@@ -0,0 +1,158 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+)
+
+// diskPruner deletes the oldest files in a directory when their total size
+// exceeds a quota, when there are too many or when they are too old.
+type diskPruner struct {
+	dir   string
+	quota config.DiskUsage
+	// maxFiles is the number of files to keep, 0 for no limit.
+	maxFiles int
+	// maxAge is the age of the files to keep, 0 for no limit.
+	maxAge time.Duration
+	// playlist is an HLS playlist in dir maintained by ffmpeg. Neither it nor
+	// the segments it lists are deleted, so it never refers to missing files.
+	playlist string
+
+	// mu must be held while writing a file in dir, so that a file is never
+	// deleted while being written.
+	mu sync.Mutex
+}
+
+// newDiskPruner returns a pruner for the camera's recordings, nil if no
+// retention is configured.
+func newDiskPruner(cfg *config.Camera) *diskPruner {
+	if !cfg.MaxDiskUsage.IsSet() && cfg.MaxFiles == 0 && cfg.MaxAge == 0 {
+		return nil
+	}
+	return &diskPruner{dir: cfg.Directory, quota: cfg.MaxDiskUsage, maxFiles: cfg.MaxFiles, maxAge: cfg.MaxAge}
+}
+
+// run prunes the directory right away, then once a minute until ctx is
+// canceled.
+func (d *diskPruner) run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			if err := d.prune(); err != nil {
+				log.Printf("%s: failed to prune: %s", d.dir, err)
+			}
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// prune deletes the oldest files until the quota, the number of files and
+// the age are respected.
+//
+// The most recent file is never deleted.
+func (d *diskPruner) prune() error {
+	limit := int64(-1)
+	if d.quota.IsSet() {
+		limit = d.quota.Bytes
+		if d.quota.Percent != 0 {
+			size, err := fsSize(d.dir)
+			if err != nil {
+				return err
+			}
+			limit = int64(float64(size) * d.quota.Percent / 100.)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// ReadDir returns the files sorted by name, which is used as the tie
+	// breaker when the modification time is the same.
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	listed, err := d.listed()
+	if err != nil {
+		return err
+	}
+	// The listed segments count toward the quota even though they are kept.
+	files := make([]os.FileInfo, 0, len(entries))
+	var total int64
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || e.Name() == d.playlist {
+			continue
+		}
+		total += e.Size()
+		if !listed[e.Name()] {
+			files = append(files, e)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	now := time.Now()
+	removed := 0
+	var freed int64
+	for i := 0; i < len(files)-1; i++ {
+		tooBig := limit >= 0 && total > limit
+		tooMany := d.maxFiles != 0 && len(files)-i > d.maxFiles
+		tooOld := d.maxAge != 0 && now.Sub(files[i].ModTime()) > d.maxAge
+		if !tooBig && !tooMany && !tooOld {
+			break
+		}
+		if err := os.Remove(filepath.Join(d.dir, files[i].Name())); err != nil {
+			return err
+		}
+		total -= files[i].Size()
+		freed += files[i].Size()
+		removed++
+	}
+	if removed != 0 {
+		log.Printf("%s: pruned %d files (%d bytes), %d files (%d bytes) left", d.dir, removed, freed, len(files)-removed, total)
+	}
+	return nil
+}
+
+// listed returns the segments listed in the playlist, if any.
+func (d *diskPruner) listed() (map[string]bool, error) {
+	if d.playlist == "" {
+		return nil, nil
+	}
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(filepath.Join(d.dir, d.playlist))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := map[string]bool{}
+	for _, l := range strings.Split(string(b), "\n") {
+		// The other lines are tags starting with '#'.
+		if l = strings.TrimSpace(l); l != "" && l[0] != '#' {
+			out[filepath.Base(l)] = true
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"periph.io/x/home/node/config"
+)
+
+func TestDiskPruner(t *testing.T) {
+	shouldLog = testing.Verbose()
+	data := []struct {
+		cfg      config.Camera
+		playlist string
+		want     []string
+	}{
+		{config.Camera{MaxDiskUsage: config.DiskUsage{Bytes: 25}}, "", []string{"i0000000003.jpg", "i0000000004.jpg"}},
+		{config.Camera{MaxFiles: 3}, "", []string{"i0000000002.jpg", "i0000000003.jpg", "i0000000004.jpg"}},
+		{config.Camera{MaxAge: 150 * time.Minute}, "", []string{"i0000000002.jpg", "i0000000003.jpg", "i0000000004.jpg"}},
+		// The most recent file is kept.
+		{config.Camera{MaxAge: time.Minute}, "", []string{"i0000000004.jpg"}},
+		// The strictest limit wins.
+		{config.Camera{MaxFiles: 4, MaxAge: 90 * time.Minute}, "", []string{"i0000000003.jpg", "i0000000004.jpg"}},
+		// The playlist is neither deleted nor counted.
+		{config.Camera{MaxFiles: 3}, "#EXTM3U\n", []string{"i0000000002.jpg", "i0000000003.jpg", "i0000000004.jpg", "index.m3u8"}},
+		// The listed segments are kept but count toward the quota.
+		{config.Camera{MaxDiskUsage: config.DiskUsage{Bytes: 25}}, "#EXTM3U\n#EXTINF:10.0,\ni0000000001.jpg\n", []string{"i0000000001.jpg", "i0000000004.jpg", "index.m3u8"}},
+	}
+	for i, l := range data {
+		dir, err := ioutil.TempDir("", "periphhome")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		// One file of 10 bytes per hour.
+		now := time.Now()
+		for j := 0; j < 5; j++ {
+			p := filepath.Join(dir, fmt.Sprintf("i%010d.jpg", j))
+			if err = ioutil.WriteFile(p, []byte(strings.Repeat("x", 10)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			mod := now.Add(time.Duration(j-4) * time.Hour)
+			if err = os.Chtimes(p, mod, mod); err != nil {
+				t.Fatal(err)
+			}
+		}
+		l.cfg.Directory = dir
+		d := newDiskPruner(&l.cfg)
+		if l.playlist != "" {
+			d.playlist = hlsPlaylist
+			if err = ioutil.WriteFile(filepath.Join(dir, hlsPlaylist), []byte(l.playlist), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = d.prune(); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		if diff := cmp.Diff(l.want, got); diff != "" {
+			t.Errorf("#%d: (-want +got):\n%s", i, diff)
+		}
+	}
+	if newDiskPruner(&config.Camera{Directory: "/var/cam"}) != nil {
+		t.Fatal("expected no pruner")
+	}
+}
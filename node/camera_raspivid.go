@@ -9,56 +9,117 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"image/color"
 	"log"
 	"os"
 	"os/exec"
 	"strconv"
+	"sync"
 	"time"
 
-	"google.golang.org/protobuf/proto"
 	"periph.io/x/home/node/config"
 	"periph.io/x/home/thirdparty/aioesphomeapi"
 	"periph.io/x/host/v3/rpi"
 )
 
 func (n *Node) loadCameraRaspivid(ctx context.Context, cfg *config.Camera) error {
-	if cfg.Directory != "" {
-		return errors.New("recording in a directory is not yet supported")
-	}
-	// It is recommended to use 720p or lower as it improves low light recording.
-	return n.addEntity(ctx, &cameraRaspivid{
-		componentBase: componentBase{
-			name:          cfg.Name,
-			componentType: cameraComponent,
+	c := &cameraRaspivid{
+		cameraBase: cameraBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: cameraComponent,
+			},
+			fps:       1,
+			rtspPort:  cfg.RTSPPort,
+			webToken:  cfg.WebToken,
+			alwaysOn:  cfg.AlwaysOn || cfg.Directory != "",
+			timestamp: newTimestampOverlay(&cfg.Timestamp, color.RGBA{200, 100, 0, 255}),
 		},
 		directory: cfg.Directory,
 		rotation:  cfg.Rotation,
 		width:     1280,
 		height:    720,
 		quality:   60,
-		fps:       1,
-	})
+		exposure:  cfg.Exposure,
+		awb:       cfg.AWB,
+		flicker:   cfg.Flicker,
+		iso:       cfg.ISO,
+		shutter:   cfg.Shutter,
+	}
+	if cfg.Width != 0 {
+		c.width, c.height = cfg.Width, cfg.Height
+	}
+	if cfg.FPS != 0 {
+		c.fps = cfg.FPS
+	}
+	if cfg.Quality != 0 {
+		c.quality = cfg.Quality
+	}
+	if c.exposure == "" {
+		c.exposure = "auto"
+	}
+	if c.awb == "" {
+		c.awb = "auto"
+	}
+	if c.flicker == "" {
+		c.flicker = "off"
+	}
+	c.listSize, c.deleteSegments = hlsListSize(cfg)
+	// ffmpeg deletes the segments past max_files and max_age, so only the
+	// quota is left to the pruner.
+	quota := *cfg
+	quota.MaxFiles, quota.MaxAge = 0, 0
+	if c.pruner = newDiskPruner(&quota); c.pruner != nil {
+		c.pruner.playlist = hlsPlaylist
+	}
+	if err := n.addEntity(ctx, c); err != nil {
+		return err
+	}
+	return c.addDeliveredFPS(ctx, n, &cfg.DeliveredFPS)
 }
 
 type cameraRaspivid struct {
-	componentBase
+	cameraBase
 	directory string
 	rotation  int
 	width     int
 	height    int
 	quality   int
-	fps       int
-
+	exposure  string
+	awb       string
+	flicker   string
+	iso       int
+	shutter   time.Duration
+	pruner    *diskPruner
+	// listSize and deleteSegments are passed to the recorder.
+	listSize       int
+	deleteSegments bool
+
+	// recorder is set when recording in directory.
+	recorder *hlsRecorder
+	// stopRecord stops the recorder and waits for ffmpeg to exit.
+	stopRecord func()
+
+	// ctx is the context used to start raspivid.
+	ctx context.Context
+	// Set while raspivid is running.
 	cancel func()
 	cmd    *exec.Cmd
 }
 
 func (c *cameraRaspivid) Close() error {
-	c.cancel()
-	_ = c.cmd.Wait()
+	c.stopRTSP()
+	c.closeCapture()
+	if c.stopRecord != nil {
+		c.stopRecord()
+	}
 	return nil
 }
 
+func (c *cameraRaspivid) recordDir() string {
+	return c.directory
+}
+
 func (c *cameraRaspivid) init(ctx context.Context, n *Node) error {
 	if err := c.componentBase.init(ctx, n); err != nil {
 		return err
@@ -87,15 +148,49 @@ func (c *cameraRaspivid) init(ctx context.Context, n *Node) error {
 		} else if !fi.IsDir() {
 			return fmt.Errorf("exists but is not a directory: %s", c.directory)
 		}
+
+		codec := "libx264"
+		if rpi.Present() {
+			codec = "h264_omx"
+		}
+		c.recorder = newHLSRecorder(c.name, c.directory, c.width, c.height, c.fps, codec)
+		c.recorder.listSize, c.recorder.deleteSegments = c.listSize, c.deleteSegments
+	}
+
+	c.ctx = ctx
+	c.startCapture = c.start
+	c.stopCapture = c.stop
+	if err := c.start(); err != nil {
+		return err
+	}
+	if err := c.startRTSP(ctx, n); err != nil {
+		c.stop()
+		return err
+	}
+	if c.recorder != nil {
+		// ffmpeg is stopped by Close() so the current segment is flushed before
+		// returning, or killed when ctx is canceled.
+		rctx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		c.recorder.start(rctx, &wg)
+		if c.pruner != nil {
+			c.pruner.run(rctx, &wg)
+		}
+		c.stopRecord = func() {
+			cancel()
+			wg.Wait()
+		}
 	}
+	c.initCapture()
+	return nil
+}
 
-	ctx, c.cancel = context.WithCancel(ctx)
+// start starts raspivid.
+func (c *cameraRaspivid) start() error {
+	ctx, cancel := context.WithCancel(c.ctx)
 	// We use raw format so we can embed a timestamp and compress to JPEG, since
 	// it's what the ESPHome protocol expects.
-	/* #nosec G204 */
-	c.cmd = exec.CommandContext(
-		ctx,
-		"raspivid",
+	args := []string{
 		"--nopreview",
 		"--width", strconv.Itoa(c.width),
 		"--height", strconv.Itoa(c.height),
@@ -103,17 +198,25 @@ func (c *cameraRaspivid) init(ctx context.Context, n *Node) error {
 		"--rotation", strconv.Itoa(c.rotation),
 		// Run until canceled.
 		"--timeout", "0",
-		"--exposure", "auto",
-		"--flicker", "off",
-		"--awb", "auto",
+		"--exposure", c.exposure,
+		"--flicker", c.flicker,
+		"--awb", c.awb,
 		// Raw format.
 		"--raw", "-",
 		// While working in YUV420 saves bandwidth, it makes other things like
 		// adding a timestamp much harder.
 		//"--raw-format", "yuv",
 		"--raw-format", "rgb",
-	)
-	c.cmd.Stdout = &rawRGB24JpegEncoder{
+	}
+	if c.iso != 0 {
+		args = append(args, "--ISO", strconv.Itoa(c.iso))
+	}
+	if c.shutter != 0 {
+		args = append(args, "--shutter", strconv.FormatInt(int64(c.shutter/time.Microsecond), 10))
+	}
+	/* #nosec G204 */
+	cmd := exec.CommandContext(ctx, "raspivid", args...)
+	enc := &rawRGB24JpegEncoder{
 		onNewImage: func(b []byte) {
 			log.Printf("next frame %d bytes", len(b))
 			c.onNewState(&aioesphomeapi.CameraImageResponse{
@@ -121,60 +224,27 @@ func (c *cameraRaspivid) init(ctx context.Context, n *Node) error {
 				Data: b,
 			})
 		},
-		width:   c.width,
-		height:  c.height,
-		quality: c.quality,
+		onNewRaw:  c.raw.publish,
+		width:     c.width,
+		height:    c.height,
+		quality:   c.quality,
+		timestamp: c.timestamp,
 	}
-	return c.cmd.Start()
-}
-
-func (c *cameraRaspivid) subscribe(ctx context.Context, cc clientConn) {
-	log.Printf("camera cannot be subscribed to")
-}
-
-func (c *cameraRaspivid) cameraStream(ctx context.Context, cc clientConn, in *aioesphomeapi.CameraImageRequest) {
-	// Reuse the componentBase fields that are used for subscribe(). It's fine
-	// because "camera" doesn't support subscribe().
-	log.Printf("cameraRaspivid(single=%t, stream=%t)", in.Single, in.Stream)
-
-	// If there was a previous Stream = true message, a Single should cancel the stream. :/
-
-	// Send initial message.
-	c.mu.Lock()
-	// Duplicate it, since we need to set Done:true if a stream is not requested.
-	msg := proto.Clone(c.currentMsg).(*aioesphomeapi.CameraImageResponse)
-	c.mu.Unlock()
-	msg.Done = !in.Stream
-	if err := cc.reply(msg); err != nil {
-		return
-	}
-	if !in.Stream {
-		return
-	}
-
-	k, ch, _ := c.register()
-	defer c.unregister(k)
-	// In ESPHome, it stops after 5 seconds. Not sure why.
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	done := ctx.Done()
-	for stop := false; !stop; {
-		select {
-		case msg := <-ch:
-			if err := cc.reply(msg); err != nil {
-				stop = true
-			}
-		case <-done:
-			stop = true
-		}
+	if c.recorder != nil {
+		enc.onNewFrame = c.recorder.record
 	}
+	cmd.Stdout = enc
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+	c.cancel = cancel
+	c.cmd = cmd
+	return nil
 }
 
-func (c *cameraRaspivid) describe() proto.Message {
-	return &aioesphomeapi.ListEntitiesCameraResponse{
-		ObjectId: c.objectID,
-		Key:      c.key,
-		Name:     c.name,
-		UniqueId: c.uniqueID,
-	}
+// stop stops raspivid, which also turns off the camera LED.
+func (c *cameraRaspivid) stop() {
+	c.cancel()
+	_ = c.cmd.Wait()
 }
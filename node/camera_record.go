@@ -0,0 +1,193 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+)
+
+const (
+	// hlsSegment is the duration of each recorded mpegts file.
+	hlsSegment = 10 * time.Second
+	// hlsPlaylist is the HLS playlist listing the recorded segments.
+	hlsPlaylist = "index.m3u8"
+	// hlsMaxListSize is the number of segments listed in the playlist when no
+	// retention is configured, one day. The older segments are left on disk.
+	hlsMaxListSize = int(24 * time.Hour / hlsSegment)
+)
+
+// hlsRecorder records the frames of a camera in a directory as H.264 mpegts
+// segments listed in an index.m3u8 HLS playlist via ffmpeg. This enables
+// serving the directory as-is to browse the history with a web browser.
+type hlsRecorder struct {
+	name   string
+	dir    string
+	width  int
+	height int
+	fps    int
+	// codec is the H.264 encoder, e.g. "h264_omx" for the Raspberry Pi
+	// hardware encoder.
+	codec string
+	// listSize is the number of segments listed in the playlist.
+	listSize int
+	// deleteSegments has ffmpeg delete the segments dropped from the playlist.
+	deleteSegments bool
+
+	// frames holds the latest frame not yet sent to ffmpeg.
+	frames chan []byte
+}
+
+func newHLSRecorder(name, dir string, width, height, fps int, codec string) *hlsRecorder {
+	return &hlsRecorder{
+		name:     name,
+		dir:      dir,
+		width:    width,
+		height:   height,
+		fps:      fps,
+		codec:    codec,
+		listSize: hlsMaxListSize,
+		frames:   make(chan []byte, 1),
+	}
+}
+
+// hlsListSize returns the number of segments to list in the playlist for the
+// retention in cfg, and whether ffmpeg deletes the segments dropped from it.
+//
+// ffmpeg owns the retention by max_files and max_age, since it rewrites the
+// whole playlist after each segment; deleting the segments behind its back
+// would leave them listed.
+func hlsListSize(cfg *config.Camera) (int, bool) {
+	n := cfg.MaxFiles
+	if cfg.MaxAge != 0 {
+		if a := int((cfg.MaxAge + hlsSegment - 1) / hlsSegment); n == 0 || a < n {
+			n = a
+		}
+	}
+	if n == 0 {
+		return hlsMaxListSize, false
+	}
+	return n, true
+}
+
+// record queues a frame to be recorded.
+//
+// It never blocks: when ffmpeg is lagging behind, only the latest frame is
+// kept.
+func (r *hlsRecorder) record(img *imageRGB24) {
+	b := append([]byte(nil), img.pix...)
+	select {
+	case <-r.frames:
+	default:
+	}
+	select {
+	case r.frames <- b:
+	default:
+	}
+}
+
+// start runs ffmpeg until ctx is canceled, restarting it if it exits.
+func (r *hlsRecorder) start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		done := ctx.Done()
+		for {
+			if err := r.run(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("%s: recording: %s", r.name, err)
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+}
+
+// run runs ffmpeg once. When ctx is canceled, ffmpeg is given a few seconds
+// to finish the current segment and is then killed.
+func (r *hlsRecorder) run(ctx context.Context) error {
+	/* #nosec G204 */
+	cmd := exec.Command("ffmpeg", r.args()...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	done := ctx.Done()
+	for {
+		select {
+		case err = <-exited:
+			return err
+		case <-done:
+			return stopFFmpeg(cmd, stdin, exited)
+		case b := <-r.frames:
+			if _, err = stdin.Write(b); err != nil {
+				return <-exited
+			}
+		}
+	}
+}
+
+// stopFFmpeg closes the input of ffmpeg so it flushes its output, and kills it
+// if it doesn't exit in time.
+func stopFFmpeg(cmd *exec.Cmd, stdin io.Closer, exited <-chan error) error {
+	_ = stdin.Close()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+// args returns the ffmpeg arguments.
+//
+// The segments are named after the time they start at, so they survive
+// restarts.
+func (r *hlsRecorder) args() []string {
+	flags := "append_list"
+	if r.deleteSegments {
+		flags += "+delete_segments"
+	}
+	return []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-f", "rawvideo",
+		"-pix_fmt", "rgb24",
+		"-s", fmt.Sprintf("%dx%d", r.width, r.height),
+		"-framerate", strconv.Itoa(r.fps),
+		"-i", "-",
+		"-c:v", r.codec,
+		"-pix_fmt", "yuv420p",
+		"-g", strconv.Itoa(r.fps * int(hlsSegment/time.Second)),
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(int(hlsSegment / time.Second)),
+		"-hls_list_size", strconv.Itoa(r.listSize),
+		"-hls_flags", flags,
+		"-strftime", "1",
+		"-hls_segment_filename", filepath.Join(r.dir, "%Y%m%d-%H%M%S.ts"),
+		filepath.Join(r.dir, hlsPlaylist),
+	}
+}
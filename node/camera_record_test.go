@@ -0,0 +1,68 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+)
+
+func TestHLSRecorder_Args(t *testing.T) {
+	r := newHLSRecorder("Cam", "/var/cam", 1280, 720, 2, "h264_omx")
+	got := strings.Join(r.args(), " ")
+	want := "-hide_banner -loglevel error -f rawvideo -pix_fmt rgb24 -s 1280x720 -framerate 2 -i - " +
+		"-c:v h264_omx -pix_fmt yuv420p -g 20 -f hls -hls_time 10 -hls_list_size 8640 -hls_flags append_list " +
+		"-strftime 1 -hls_segment_filename /var/cam/%Y%m%d-%H%M%S.ts /var/cam/index.m3u8"
+	if got != want {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+	r.listSize, r.deleteSegments = 60, true
+	if got = strings.Join(r.args(), " "); !strings.Contains(got, " -hls_list_size 60 -hls_flags append_list+delete_segments ") {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestHLSListSize(t *testing.T) {
+	data := []struct {
+		cfg    config.Camera
+		size   int
+		delete bool
+	}{
+		{config.Camera{}, 8640, false},
+		{config.Camera{MaxDiskUsage: config.DiskUsage{Bytes: 1000}}, 8640, false},
+		{config.Camera{MaxFiles: 100}, 100, true},
+		{config.Camera{MaxAge: 95 * time.Second}, 10, true},
+		// The strictest limit wins.
+		{config.Camera{MaxFiles: 100, MaxAge: time.Hour}, 100, true},
+		{config.Camera{MaxFiles: 100, MaxAge: time.Minute}, 6, true},
+	}
+	for i, l := range data {
+		if size, del := hlsListSize(&l.cfg); size != l.size || del != l.delete {
+			t.Fatalf("#%d: got %d, %t; want %d, %t", i, size, del, l.size, l.delete)
+		}
+	}
+}
+
+func TestHLSRecorder_Record(t *testing.T) {
+	r := newHLSRecorder("Cam", "/var/cam", 1, 1, 1, "libx264")
+	img := imageRGB24{w: 1, h: 1, pix: []byte{1, 2, 3}}
+	r.record(&img)
+	img.pix[0] = 4
+	// Recording never blocks, the older frame is dropped.
+	r.record(&img)
+	if b := <-r.frames; string(b) != "\x04\x02\x03" {
+		t.Fatalf("unexpected %v", b)
+	}
+	// The frame was copied.
+	img.pix[0] = 5
+	r.record(&img)
+	img.pix[0] = 6
+	if b := <-r.frames; b[0] != 5 {
+		t.Fatalf("unexpected %v", b)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rtspServer re-streams the frames of a camera as H.264 over RTSP via ffmpeg.
+//
+// ffmpeg is run in listen mode, so it is itself the RTSP server for a single
+// client. It exits when the client disconnects, so it is restarted in a loop.
+type rtspServer struct {
+	c    *cameraBase
+	host string
+	port int
+}
+
+// start starts the server until ctx is canceled.
+func (r *rtspServer) start(ctx context.Context, wg *sync.WaitGroup) error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return errors.New("rtsp_port requires ffmpeg: sudo apt install ffmpeg")
+	}
+	// The camera is never blocked by ffmpeg.
+	frames := r.c.latestFrames(ctx, wg)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		done := ctx.Done()
+		for {
+			if err := r.serve(ctx, frames); err != nil && ctx.Err() == nil {
+				log.Printf("%s: rtsp: %s", r.c.name, err)
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	return nil
+}
+
+// serve runs ffmpeg for one RTSP client.
+func (r *rtspServer) serve(ctx context.Context, frames <-chan []byte) error {
+	host := r.host
+	if host == "" {
+		// Also accepts IPv4 clients unless the host is configured with
+		// bindv6only.
+		host = "::"
+	}
+	/* #nosec G204 */
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		"-hide_banner",
+		"-loglevel", "error",
+		"-f", "image2pipe",
+		"-c:v", "mjpeg",
+		"-framerate", strconv.Itoa(r.c.fps),
+		"-i", "-",
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-tune", "zerolatency",
+		"-pix_fmt", "yuv420p",
+		"-f", "rtsp",
+		"-rtsp_flags", "listen",
+		"rtsp://"+net.JoinHostPort(host, strconv.Itoa(r.port))+"/stream",
+	)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	for {
+		select {
+		case err = <-exited:
+			return err
+		case b := <-frames:
+			// This blocks while ffmpeg waits for a client, frames are dropped in
+			// the meantime.
+			if _, err = stdin.Write(b); err != nil {
+				return <-exited
+			}
+		}
+	}
+}
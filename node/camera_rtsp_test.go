@@ -0,0 +1,111 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestRTSPServer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /bin/sh")
+	}
+	shouldLog = testing.Verbose()
+	d, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	// The fake ffmpeg waits for a client, like the real one does, then saves
+	// the frames it receives.
+	release := filepath.Join(d, "client")
+	out := filepath.Join(d, "out")
+	script := "#!/bin/sh\nwhile [ ! -e '" + release + "' ]; do sleep 0.01; done\nexec cat > '" + out + "'\n"
+	/* #nosec G306 */
+	if err = ioutil.WriteFile(filepath.Join(d, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	if err = os.Setenv("PATH", d+string(os.PathListSeparator)+oldPath); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &cameraBase{componentBase: componentBase{name: "cam", ch: map[int]chan proto.Message{}}, fps: 1}
+	r := &rtspServer{c: c, port: 8554}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	if err = r.start(ctx, &wg); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); c.subscribers() == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out")
+		}
+	}
+	// The frames are larger than a pipe buffer, so writing the first one blocks
+	// until the client connects.
+	frames := [][]byte{
+		bytes.Repeat([]byte{'a'}, 100000),
+		bytes.Repeat([]byte{'b'}, 100000),
+		bytes.Repeat([]byte{'c'}, 100000),
+	}
+	for _, f := range frames {
+		c.onNewState(&aioesphomeapi.CameraImageResponse{Data: f, Done: true})
+	}
+	// Let the frames reach the server.
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		pending := 0
+		for _, ch := range c.ch {
+			pending += len(ch)
+		}
+		c.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out")
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err = ioutil.WriteFile(release, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client gets the frame being sent when it connected, if any, then the
+	// latest one; the frames in between were dropped.
+	var b []byte
+	for start := time.Now(); !bytes.HasSuffix(b, frames[2]); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("timed out with %d bytes", len(b))
+		}
+		/* #nosec G304 */
+		b, _ = ioutil.ReadFile(out)
+	}
+	if !bytes.Equal(b, append(frames[0], frames[2]...)) && !bytes.Equal(b, frames[2]) {
+		t.Fatalf("unexpected %d bytes, %d of b", len(b), bytes.Count(b, []byte{'b'}))
+	}
+
+	cancel()
+	if !waitUntil(&wg, time.Now().Add(5*time.Second)) {
+		t.Fatal("expected the server to exit")
+	}
+	if c.subscribers() != 0 {
+		t.Fatal("expected the frames to be unsubscribed")
+	}
+}
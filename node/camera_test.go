@@ -0,0 +1,195 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestCameraBase_Pause(t *testing.T) {
+	old := cameraIdleDelay
+	cameraIdleDelay = 10 * time.Millisecond
+	defer func() {
+		cameraIdleDelay = old
+	}()
+
+	events := make(chan bool, 10)
+	c := &cameraBase{
+		componentBase: componentBase{name: "Cam", componentType: cameraComponent},
+		fps:           1,
+		startCapture: func() error {
+			events <- true
+			return nil
+		},
+		stopCapture: func() {
+			events <- false
+		},
+	}
+	if err := c.componentBase.init(context.Background(), &Node{cfg: &config.Root{}}); err != nil {
+		t.Fatal(err)
+	}
+	get := func() bool {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+			return false
+		}
+	}
+
+	// No subscriber: paused after the delay.
+	c.initCapture()
+	if get() || c.isCapturing() {
+		t.Fatal("expected pause")
+	}
+	// A subscriber resumes right away.
+	k, _, _ := c.register()
+	if !get() || !c.isCapturing() {
+		t.Fatal("expected resume")
+	}
+	c.unregister(k)
+	if get() {
+		t.Fatal("expected pause")
+	}
+	// Closing while paused doesn't stop again.
+	c.closeCapture()
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected %t", e)
+	default:
+	}
+}
+
+func TestCameraBase_AlwaysOn(t *testing.T) {
+	c := &cameraBase{
+		componentBase: componentBase{name: "Cam", componentType: cameraComponent},
+		fps:           1,
+		alwaysOn:      true,
+		startCapture:  func() error { return nil },
+		stopCapture:   func() {},
+	}
+	if err := c.componentBase.init(context.Background(), &Node{cfg: &config.Root{}}); err != nil {
+		t.Fatal(err)
+	}
+	c.initCapture()
+	k, _, _ := c.register()
+	c.unregister(k)
+	if !c.isCapturing() {
+		t.Fatal("expected capturing")
+	}
+	c.closeCapture()
+	if c.isCapturing() {
+		t.Fatal("expected stopped")
+	}
+}
+
+func TestCameraBase_StreamSlowClient(t *testing.T) {
+	c := &cameraBase{
+		componentBase: componentBase{name: "Cam", componentType: cameraComponent},
+		fps:           1,
+	}
+	if err := c.componentBase.init(context.Background(), &Node{cfg: &config.Root{}}); err != nil {
+		t.Fatal(err)
+	}
+	cc := &slowConn{delay: 20 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.cameraStream(ctx, cc, &aioesphomeapi.CameraImageRequest{Stream: true})
+	}()
+	for c.subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The capture must never be blocked by the client.
+	start := time.Now()
+	const frames = 100
+	for i := 0; i < frames; i++ {
+		c.onNewState(&aioesphomeapi.CameraImageResponse{Key: c.key, Data: []byte{byte(i)}})
+		time.Sleep(time.Millisecond)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("capture was blocked for %s", d)
+	}
+	cancel()
+	wg.Wait()
+	d := atomic.LoadUint32(&c.delivered)
+	if d == 0 || d >= frames/2 {
+		t.Fatalf("expected frames to be skipped; delivered %d", d)
+	}
+	if n := cc.count(); n != int(d) {
+		t.Fatalf("got %d replies, delivered %d", n, d)
+	}
+}
+
+// slowConn is a clientConn on a congested network.
+type slowConn struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	replies int
+}
+
+func (s *slowConn) reply(msg proto.Message) error {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	s.replies++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *slowConn) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replies
+}
+
+func TestFrameBus(t *testing.T) {
+	var f frameBus
+	if f.active() {
+		t.Fatal("expected inactive")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	ch := f.subscribe(ctx, &wg)
+	if !f.active() {
+		t.Fatal("expected active")
+	}
+	pix := []byte{1, 2, 3}
+	f.publish(&imageRGB24{w: 1, h: 1, pix: pix})
+	// The frame is copied, the camera can reuse its buffer.
+	pix[0] = 4
+	f.publish(&imageRGB24{w: 1, h: 1, pix: pix})
+	// Only the latest frame is kept.
+	if img := <-ch; img.pix[0] != 4 {
+		t.Fatalf("unexpected %v", img.pix)
+	}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(1, 0, color.RGBA{10, 20, 30, 255})
+	f.publishImage(src)
+	if img := <-ch; img.w != 2 || img.h != 1 || !bytes.Equal(img.pix, []byte{0, 0, 0, 10, 20, 30}) {
+		t.Fatalf("unexpected %+v", img)
+	}
+	cancel()
+	wg.Wait()
+	if f.active() {
+		t.Fatal("expected inactive")
+	}
+}
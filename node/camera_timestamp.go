@@ -0,0 +1,164 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"periph.io/x/home/node/config"
+)
+
+// timestampOverlay burns the time in the frames.
+type timestampOverlay struct {
+	position string
+	format   string
+	// scale is the font size multiplier. 0 means proportional to the frame
+	// width.
+	scale int
+	color color.RGBA
+}
+
+// newTimestampOverlay returns the overlay as configured, or nil if disabled.
+//
+// c is the platform's default color.
+func newTimestampOverlay(cfg *config.CameraTimestamp, c color.RGBA) *timestampOverlay {
+	if cfg.Enabled != nil && !*cfg.Enabled {
+		return nil
+	}
+	t := &timestampOverlay{
+		position: cfg.Position,
+		format:   cfg.Format,
+		scale:    cfg.FontScale,
+		color:    c,
+	}
+	if t.position == "" {
+		t.position = "top_right"
+	}
+	if t.format == "" {
+		t.format = "%Y-%m-%d %H:%M:%S"
+	}
+	if cfg.Color != "" {
+		// Validated by config.
+		v, _ := strconv.ParseUint(cfg.Color[1:], 16, 32)
+		t.color = color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}
+	}
+	return t
+}
+
+// addTimestamp adds the time `now` to an image.
+//
+// It is a no-op when t is nil.
+func addTimestamp(img draw.Image, t *timestampOverlay, now time.Time) {
+	if t == nil {
+		return
+	}
+	b := img.Bounds()
+	scale := t.scale
+	if scale == 0 {
+		scale = (b.Dx() + 320) / 640
+		if scale == 0 {
+			scale = 1
+		}
+	}
+	// Render the text at the font's native size in a mask, then scale it up.
+	face := basicfont.Face7x13
+	s := strftime(t.format, now)
+	mask := image.NewAlpha(image.Rect(0, 0, font.MeasureString(face, s).Ceil(), face.Height))
+	d := &font.Drawer{
+		Dst:  mask,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	d.DrawString(s)
+
+	margin := 2 * scale
+	w := mask.Rect.Dx() * scale
+	h := mask.Rect.Dy() * scale
+	x := b.Min.X + margin
+	if strings.HasSuffix(t.position, "_right") {
+		x = b.Max.X - margin - w
+	}
+	y := b.Min.Y + margin
+	if strings.HasPrefix(t.position, "bottom_") {
+		y = b.Max.Y - margin - h
+	}
+	for my := 0; my < mask.Rect.Dy(); my++ {
+		for mx := 0; mx < mask.Rect.Dx(); mx++ {
+			if mask.AlphaAt(mx, my).A < 0x80 {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					if p := image.Pt(x+mx*scale+dx, y+my*scale+dy); p.In(b) {
+						img.Set(p.X, p.Y, t.color)
+					}
+				}
+			}
+		}
+	}
+}
+
+// strftime formats the time with the subset of strftime conversions accepted
+// by config.CameraTimestamp.
+func strftime(format string, t time.Time) string {
+	out := strings.Builder{}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			out.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			out.WriteString(t.Format("2006"))
+		case 'y':
+			out.WriteString(t.Format("06"))
+		case 'm':
+			out.WriteString(t.Format("01"))
+		case 'd':
+			out.WriteString(t.Format("02"))
+		case 'e':
+			out.WriteString(t.Format("_2"))
+		case 'H':
+			out.WriteString(t.Format("15"))
+		case 'I':
+			out.WriteString(t.Format("03"))
+		case 'M':
+			out.WriteString(t.Format("04"))
+		case 'S':
+			out.WriteString(t.Format("05"))
+		case 'p':
+			out.WriteString(t.Format("PM"))
+		case 'b':
+			out.WriteString(t.Format("Jan"))
+		case 'B':
+			out.WriteString(t.Format("January"))
+		case 'a':
+			out.WriteString(t.Format("Mon"))
+		case 'A':
+			out.WriteString(t.Format("Monday"))
+		case 'j':
+			out.WriteString(fmt.Sprintf("%03d", t.YearDay()))
+		case 'Z':
+			out.WriteString(t.Format("MST"))
+		case 'z':
+			out.WriteString(t.Format("-0700"))
+		default:
+			// Includes %%.
+			out.WriteByte(format[i])
+		}
+	}
+	return out.String()
+}
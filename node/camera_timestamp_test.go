@@ -0,0 +1,90 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+)
+
+func TestStrftime(t *testing.T) {
+	now := time.Date(2021, 3, 4, 17, 6, 7, 0, time.UTC)
+	data := []struct {
+		in   string
+		want string
+	}{
+		{"%Y-%m-%d %H:%M:%S", "2021-03-04 17:06:07"},
+		{"%y%e %I%p", "21 4 05PM"},
+		{"%a %A %b %B", "Thu Thursday Mar March"},
+		{"day %j %Z %z 100%%", "day 063 UTC +0000 100%"},
+		{"Cam 1", "Cam 1"},
+	}
+	for i, l := range data {
+		if got := strftime(l.in, now); got != l.want {
+			t.Errorf("#%d: %q != %q", i, got, l.want)
+		}
+	}
+}
+
+func TestNewTimestampOverlay(t *testing.T) {
+	def := color.RGBA{255, 255, 255, 255}
+	off := false
+	if o := newTimestampOverlay(&config.CameraTimestamp{Enabled: &off}, def); o != nil {
+		t.Fatal("expected disabled")
+	}
+	o := newTimestampOverlay(&config.CameraTimestamp{Color: "#ff8000"}, def)
+	if o.position != "top_right" || o.format != "%Y-%m-%d %H:%M:%S" {
+		t.Fatalf("unexpected defaults %#v", o)
+	}
+	if want := (color.RGBA{255, 128, 0, 255}); o.color != want {
+		t.Fatalf("%v != %v", o.color, want)
+	}
+}
+
+func TestAddTimestamp(t *testing.T) {
+	now := time.Date(2021, 3, 4, 17, 6, 7, 0, time.UTC)
+	data := []struct {
+		position string
+		scale    int
+		// Expected bounds of the text.
+		want image.Rectangle
+	}{
+		{"top_left", 1, image.Rect(2, 2, 135, 15)},
+		{"top_right", 1, image.Rect(185, 2, 318, 15)},
+		{"bottom_left", 2, image.Rect(4, 210, 270, 236)},
+		{"bottom_right", 0, image.Rect(185, 225, 318, 238)},
+	}
+	for i, l := range data {
+		img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+		o := &timestampOverlay{position: l.position, format: "%Y-%m-%d %H:%M:%S", scale: l.scale, color: color.RGBA{255, 255, 255, 255}}
+		addTimestamp(img, o, now)
+		if got := litBounds(img); !got.In(l.want) || got.Empty() {
+			t.Errorf("#%d: %s not in %s", i, got, l.want)
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	addTimestamp(img, nil, now)
+	if got := litBounds(img); !got.Empty() {
+		t.Fatalf("expected no overlay, got %s", got)
+	}
+}
+
+// litBounds returns the bounds of the non-black pixels.
+func litBounds(img *image.RGBA) image.Rectangle {
+	r := image.Rectangle{}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.RGBAAt(x, y).R != 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
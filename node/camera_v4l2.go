@@ -0,0 +1,179 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadCameraV4L2 loads a Video4Linux2 capture device, like a USB webcam.
+//
+// ffmpeg does the capture and the rotation, and outputs raw RGB24 frames so
+// the timestamp can be added before the JPEG encoding, like raspivid.
+func (n *Node) loadCameraV4L2(ctx context.Context, cfg *config.Camera) error {
+	if cfg.Directory != "" {
+		return errors.New("recording in a directory is not yet supported")
+	}
+	if cfg.Exposure != "" || cfg.AWB != "" || cfg.Flicker != "" || cfg.ISO != 0 || cfg.Shutter != 0 {
+		return errors.New("do not use exposure / awb / flicker / iso / shutter")
+	}
+	c := &cameraV4L2{
+		cameraBase: cameraBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: cameraComponent,
+			},
+			fps:       1,
+			rtspPort:  cfg.RTSPPort,
+			webToken:  cfg.WebToken,
+			alwaysOn:  cfg.AlwaysOn,
+			timestamp: newTimestampOverlay(&cfg.Timestamp, color.RGBA{200, 100, 0, 255}),
+		},
+		device:   cfg.Device,
+		rotation: cfg.Rotation,
+		// 640x480 is supported by virtually all webcams.
+		width:   640,
+		height:  480,
+		quality: 60,
+	}
+	if cfg.Width != 0 {
+		c.width, c.height = cfg.Width, cfg.Height
+	}
+	if cfg.FPS != 0 {
+		c.fps = cfg.FPS
+	}
+	if cfg.Quality != 0 {
+		c.quality = cfg.Quality
+	}
+	if c.device == "" {
+		c.device = "/dev/video0"
+	}
+	if err := n.addEntity(ctx, c); err != nil {
+		return err
+	}
+	return c.addDeliveredFPS(ctx, n, &cfg.DeliveredFPS)
+}
+
+type cameraV4L2 struct {
+	cameraBase
+	device   string
+	rotation int
+	// width and height are the capture size, before the rotation.
+	width   int
+	height  int
+	quality int
+
+	// ctx is the context used to start ffmpeg.
+	ctx context.Context
+	// Set while ffmpeg is running.
+	cancel func()
+	cmd    *exec.Cmd
+}
+
+func (c *cameraV4L2) Close() error {
+	c.stopRTSP()
+	c.closeCapture()
+	return nil
+}
+
+func (c *cameraV4L2) init(ctx context.Context, n *Node) error {
+	if err := c.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return errors.New("please install ffmpeg: sudo apt install ffmpeg")
+	}
+	if _, err := os.Stat(c.device); err != nil {
+		return err
+	}
+	c.ctx = ctx
+	c.startCapture = c.start
+	c.stopCapture = c.stop
+	if err := c.start(); err != nil {
+		return err
+	}
+	if err := c.startRTSP(ctx, n); err != nil {
+		c.stop()
+		return err
+	}
+	c.initCapture()
+	return nil
+}
+
+// start starts ffmpeg.
+func (c *cameraV4L2) start() error {
+	ctx, cancel := context.WithCancel(c.ctx)
+	w, h := c.width, c.height
+	if c.rotation == 90 || c.rotation == 270 {
+		w, h = h, w
+	}
+	/* #nosec G204 */
+	cmd := exec.CommandContext(ctx, "ffmpeg", c.args()...)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = &rawRGB24JpegEncoder{
+		onNewImage: func(b []byte) {
+			log.Printf("next frame %d bytes", len(b))
+			c.onNewState(&aioesphomeapi.CameraImageResponse{
+				Key:  c.key,
+				Data: b,
+			})
+		},
+		onNewRaw:  c.raw.publish,
+		width:     w,
+		height:    h,
+		quality:   c.quality,
+		timestamp: c.timestamp,
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+	c.cancel = cancel
+	c.cmd = cmd
+	return nil
+}
+
+// stop stops ffmpeg, which releases the device.
+func (c *cameraV4L2) stop() {
+	c.cancel()
+	_ = c.cmd.Wait()
+}
+
+// args returns the ffmpeg arguments to capture raw RGB24 frames on stdout.
+//
+// The device is left at its native frame rate and size, which are converted
+// by ffmpeg, since webcams only support a few modes.
+func (c *cameraV4L2) args() []string {
+	vf := fmt.Sprintf("scale=%d:%d", c.width, c.height)
+	switch c.rotation {
+	case 90:
+		vf += ",transpose=clock"
+	case 180:
+		vf += ",hflip,vflip"
+	case 270:
+		vf += ",transpose=cclock"
+	}
+	return []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-f", "v4l2",
+		"-i", c.device,
+		"-vf", vf,
+		"-r", strconv.Itoa(c.fps),
+		"-f", "rawvideo",
+		"-pix_fmt", "rgb24",
+		"-",
+	}
+}
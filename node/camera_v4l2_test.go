@@ -0,0 +1,49 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"periph.io/x/home/node/config"
+)
+
+func TestCameraV4L2_Args(t *testing.T) {
+	data := []struct {
+		rotation int
+		want     string
+	}{
+		{0, "scale=640:480"},
+		{90, "scale=640:480,transpose=clock"},
+		{180, "scale=640:480,hflip,vflip"},
+		{270, "scale=640:480,transpose=cclock"},
+	}
+	for i, line := range data {
+		c := cameraV4L2{cameraBase: cameraBase{fps: 1}, device: "/dev/video1", rotation: line.rotation, width: 640, height: 480}
+		got := strings.Join(c.args(), " ")
+		want := "-hide_banner -loglevel error -f v4l2 -i /dev/video1 -vf " + line.want + " -r 1 -f rawvideo -pix_fmt rgb24 -"
+		if got != want {
+			t.Fatalf("#%d: got %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestLoadCameraV4L2_Err(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	data := []config.Camera{
+		{Directory: "/tmp/camera"},
+		{AWB: "sun"},
+		{Device: "/dev/nonexistent"},
+	}
+	for i := range data {
+		data[i].Platform = "v4l2"
+		data[i].Name = "Webcam"
+		if err := n.loadCamera(context.Background(), &data[i]); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
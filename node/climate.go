@@ -0,0 +1,26 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"periph.io/x/home/node/config"
+)
+
+func (n *Node) loadClimate(ctx context.Context, cfg *config.Climate) error {
+	log.Printf("loading climate %s", cfg.Platform)
+	switch cfg.Platform {
+	case "thermostat":
+		if err := n.loadClimateThermostat(ctx, cfg); err != nil {
+			return fmt.Errorf("climate(%s): %w", cfg.Name, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown platform %q", cfg.Platform)
+	}
+}
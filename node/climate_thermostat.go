@@ -0,0 +1,257 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadClimateThermostat loads a software thermostat turning a heater switch
+// on and off to keep the temperature reported by a sensor, or by a Home
+// Assistant entity, at the target.
+//
+// The thermostat starts off. The heater is turned off when the temperature is
+// unknown.
+func (n *Node) loadClimateThermostat(ctx context.Context, cfg *config.Climate) error {
+	if (cfg.Sensor == "") == (cfg.EntityID == "") {
+		return errors.New("one of sensor or entity_id is required")
+	}
+	if cfg.Heater == "" {
+		return errors.New("heater is required")
+	}
+	names := []string{cfg.Heater}
+	if cfg.Sensor != "" {
+		names = append(names, cfg.Sensor)
+	}
+	e, err := n.findEntities(names)
+	if err != nil {
+		return err
+	}
+	if e[0].getType() != switchComponent {
+		return fmt.Errorf("%s is not a switch", cfg.Heater)
+	}
+	var sensor component
+	if cfg.Sensor != "" {
+		if sensor = e[1]; sensor.getType() != sensorComponent {
+			return fmt.Errorf("%s is not a sensor", cfg.Sensor)
+		}
+	}
+	c := &climateThermostat{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: climateComponent,
+		},
+		sensor:     sensor,
+		entityID:   cfg.EntityID,
+		heater:     e[0],
+		hysteresis: float32(cfg.Hysteresis),
+		min:        float32(cfg.MinTemperature),
+		max:        float32(cfg.MaxTemperature),
+		target:     float32(cfg.TargetTemperature),
+		current:    float32(math.NaN()),
+	}
+	if c.hysteresis == 0 {
+		c.hysteresis = 0.5
+	}
+	if c.min == 0 {
+		c.min = 10
+	}
+	if c.max == 0 {
+		c.max = 30
+	}
+	if c.target == 0 {
+		c.target = 20
+	}
+	if c.min >= c.max {
+		return errors.New("min_temperature must be lower than max_temperature")
+	}
+	if c.target < c.min || c.target > c.max {
+		return fmt.Errorf("target_temperature must be between %g and %g", c.min, c.max)
+	}
+	return n.addEntity(ctx, c)
+}
+
+type climateThermostat struct {
+	componentBase
+	// Either sensor or entityID provides the temperature.
+	sensor     component
+	entityID   string
+	heater     component
+	hysteresis float32
+	min        float32
+	max        float32
+
+	wg     sync.WaitGroup
+	cancel func()
+
+	// mu protects the fields below.
+	mu     sync.Mutex
+	heat   bool
+	target float32
+	// current is the last temperature, NaN when unknown.
+	current float32
+	heating bool
+}
+
+// Close stops regulating. The heater is turned off when the switch is closed.
+func (c *climateThermostat) Close() error {
+	c.cancel()
+	c.wg.Wait()
+	return nil
+}
+
+func (c *climateThermostat) init(ctx context.Context, n *Node) error {
+	if err := c.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.publishLocked()
+	c.mu.Unlock()
+	ctx, c.cancel = context.WithCancel(ctx)
+	if c.sensor != nil {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			// The current temperature, if any, is sent right away.
+			c.sensor.subscribe(ctx, &thermostatInput{c: c})
+		}()
+	}
+	return nil
+}
+
+func (c *climateThermostat) climateCommand(in *aioesphomeapi.ClimateCommandRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if in.HasMode {
+		switch in.Mode {
+		case aioesphomeapi.ClimateMode_CLIMATE_MODE_OFF:
+			c.heat = false
+		case aioesphomeapi.ClimateMode_CLIMATE_MODE_HEAT:
+			c.heat = true
+		default:
+			return fmt.Errorf("unsupported mode %s", in.Mode)
+		}
+	}
+	if in.HasTargetTemperature {
+		if in.TargetTemperature < c.min || in.TargetTemperature > c.max {
+			return fmt.Errorf("target temperature must be between %g and %g", c.min, c.max)
+		}
+		c.target = in.TargetTemperature
+	}
+	err := c.regulateLocked()
+	c.publishLocked()
+	return err
+}
+
+func (c *climateThermostat) homeAssistantStates() []string {
+	if c.entityID == "" {
+		return nil
+	}
+	return []string{c.entityID}
+}
+
+// onHomeAssistantState processes a new temperature from Home Assistant.
+func (c *climateThermostat) onHomeAssistantState(entityID, state string) {
+	v, err := strconv.ParseFloat(state, 32)
+	if err != nil {
+		// "unavailable" or "unknown".
+		v = math.NaN()
+	}
+	c.update(float32(v))
+}
+
+// update processes a new temperature, NaN when unknown.
+func (c *climateThermostat) update(v float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current = v
+	if err := c.regulateLocked(); err != nil {
+		c.setError(err)
+	}
+	c.publishLocked()
+}
+
+// regulateLocked turns the heater on or off as needed. c.mu must be held.
+func (c *climateThermostat) regulateLocked() error {
+	on := c.heating
+	switch {
+	case !c.heat || math.IsNaN(float64(c.current)):
+		on = false
+	case c.current < c.target-c.hysteresis:
+		on = true
+	case c.current > c.target+c.hysteresis:
+		on = false
+	}
+	if on == c.heating {
+		return nil
+	}
+	if err := c.heater.switchCommand(&aioesphomeapi.SwitchCommandRequest{Key: c.heater.getHash(), State: on}); err != nil {
+		return err
+	}
+	c.heating = on
+	return nil
+}
+
+// publishLocked publishes the current state. c.mu must be held.
+func (c *climateThermostat) publishLocked() {
+	msg := &aioesphomeapi.ClimateStateResponse{
+		Key:                c.key,
+		Mode:               aioesphomeapi.ClimateMode_CLIMATE_MODE_OFF,
+		CurrentTemperature: c.current,
+		TargetTemperature:  c.target,
+		Action:             aioesphomeapi.ClimateAction_CLIMATE_ACTION_OFF,
+	}
+	if c.heat {
+		msg.Mode = aioesphomeapi.ClimateMode_CLIMATE_MODE_HEAT
+		msg.Action = aioesphomeapi.ClimateAction_CLIMATE_ACTION_IDLE
+	}
+	if c.heating {
+		msg.Action = aioesphomeapi.ClimateAction_CLIMATE_ACTION_HEATING
+	}
+	c.onNewState(msg)
+}
+
+func (c *climateThermostat) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesClimateResponse{
+		ObjectId:                   c.objectID,
+		Key:                        c.key,
+		Name:                       c.name,
+		UniqueId:                   c.uniqueID,
+		SupportsCurrentTemperature: true,
+		SupportedModes: []aioesphomeapi.ClimateMode{
+			aioesphomeapi.ClimateMode_CLIMATE_MODE_OFF,
+			aioesphomeapi.ClimateMode_CLIMATE_MODE_HEAT,
+		},
+		VisualMinTemperature:  c.min,
+		VisualMaxTemperature:  c.max,
+		VisualTemperatureStep: 0.5,
+		SupportsAction:        true,
+	}
+}
+
+// thermostatInput implements clientConn to receive the temperature updates.
+type thermostatInput struct {
+	c *climateThermostat
+}
+
+func (t *thermostatInput) reply(msg proto.Message) error {
+	if s, ok := msg.(*aioesphomeapi.SensorStateResponse); ok {
+		v := s.State
+		if s.MissingState {
+			v = float32(math.NaN())
+		}
+		t.c.update(v)
+	}
+	return nil
+}
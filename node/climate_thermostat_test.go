@@ -0,0 +1,242 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestClimateThermostat(t *testing.T) {
+	p := gpiotest.Pin{N: "FAKE_GPIO_HEATER"}
+	if err := gpioreg.Register(&p); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := gpioreg.Unregister(p.N); err != nil {
+			t.Error(err)
+		}
+	}()
+	ctx := context.Background()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	defer func() {
+		for i := len(n.entities) - 1; i >= 0; i-- {
+			if err := n.entities[i].Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	one := 1
+	if err := n.loadSensor(ctx, &config.Sensor{Platform: "fake", Name: "Temperature", UpdateInterval: time.Hour, AccuracyDecimals: &one}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.loadSwitch(ctx, &config.Switch{Platform: "gpio", Name: "Heater", Pin: config.Pin{Number: p.N}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.loadClimate(ctx, &config.Climate{Platform: "thermostat", Name: "Thermostat", Sensor: "Temperature", Heater: "Heater"}); err != nil {
+		t.Fatal(err)
+	}
+	temp := n.entities[0].(*sensorFake)
+	c := n.entities[2]
+	d := c.describe().(*aioesphomeapi.ListEntitiesClimateResponse)
+	if len(d.SupportedModes) != 2 || d.VisualMinTemperature != 10 || d.VisualMaxTemperature != 30 {
+		t.Fatalf("unexpected %v", d)
+	}
+	if s := c.getState().(*aioesphomeapi.ClimateStateResponse); s.Mode != aioesphomeapi.ClimateMode_CLIMATE_MODE_OFF || s.TargetTemperature != 20 {
+		t.Fatalf("unexpected %v", s)
+	}
+
+	_, ch, _ := c.(*climateThermostat).register()
+	// wait returns the state once the thermostat processed the temperature v.
+	wait := func(v float32) *aioesphomeapi.ClimateStateResponse {
+		for {
+			select {
+			case msg := <-ch:
+				s := msg.(*aioesphomeapi.ClimateStateResponse)
+				if s.CurrentTemperature == v || math.IsNaN(float64(s.CurrentTemperature)) && math.IsNaN(float64(v)) {
+					return s
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out")
+				return nil
+			}
+		}
+	}
+	temp.publish(18)
+	if s := wait(18); s.Action != aioesphomeapi.ClimateAction_CLIMATE_ACTION_OFF || p.Read() != gpio.Low {
+		t.Fatalf("expected off; %v", s)
+	}
+	if err := c.climateCommand(&aioesphomeapi.ClimateCommandRequest{HasMode: true, Mode: aioesphomeapi.ClimateMode_CLIMATE_MODE_HEAT}); err != nil {
+		t.Fatal(err)
+	}
+	if s := wait(18); s.Action != aioesphomeapi.ClimateAction_CLIMATE_ACTION_HEATING || p.Read() != gpio.High {
+		t.Fatalf("expected heating; %v", s)
+	}
+
+	data := []struct {
+		temp    float32
+		heating bool
+	}{
+		// Within the hysteresis, the heater is left as is.
+		{20.3, true},
+		{20.6, false},
+		{19.7, false},
+		{19.4, true},
+	}
+	for i, line := range data {
+		temp.publish(line.temp)
+		s := wait(line.temp)
+		if heating := s.Action == aioesphomeapi.ClimateAction_CLIMATE_ACTION_HEATING; heating != line.heating {
+			t.Fatalf("#%d: unexpected %v", i, s)
+		}
+		if l := p.Read(); l != gpio.Level(line.heating) {
+			t.Fatalf("#%d: unexpected heater %s", i, l)
+		}
+	}
+
+	// The heater is turned off when the temperature is unknown.
+	temp.publishMissing()
+	if s := wait(float32(math.NaN())); s.Action != aioesphomeapi.ClimateAction_CLIMATE_ACTION_IDLE || p.Read() != gpio.Low {
+		t.Fatalf("expected idle; %v", s)
+	}
+	temp.publish(19)
+	if s := wait(19); s.Action != aioesphomeapi.ClimateAction_CLIMATE_ACTION_HEATING {
+		t.Fatalf("expected heating; %v", s)
+	}
+
+	// Raising the target above the temperature keeps heating; turning off
+	// stops it.
+	if err := c.climateCommand(&aioesphomeapi.ClimateCommandRequest{HasTargetTemperature: true, TargetTemperature: 22}); err != nil {
+		t.Fatal(err)
+	}
+	if p.Read() != gpio.High {
+		t.Fatal("expected heating")
+	}
+	if err := c.climateCommand(&aioesphomeapi.ClimateCommandRequest{HasMode: true, Mode: aioesphomeapi.ClimateMode_CLIMATE_MODE_OFF}); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.getState().(*aioesphomeapi.ClimateStateResponse); s.Action != aioesphomeapi.ClimateAction_CLIMATE_ACTION_OFF || s.TargetTemperature != 22 || p.Read() != gpio.Low {
+		t.Fatalf("unexpected %v", s)
+	}
+
+	if c.climateCommand(&aioesphomeapi.ClimateCommandRequest{HasMode: true, Mode: aioesphomeapi.ClimateMode_CLIMATE_MODE_COOL}) == nil {
+		t.Fatal("expected unsupported mode")
+	}
+	if c.climateCommand(&aioesphomeapi.ClimateCommandRequest{HasTargetTemperature: true, TargetTemperature: 40}) == nil {
+		t.Fatal("expected out of range")
+	}
+}
+
+func TestClimateThermostat_HomeAssistant(t *testing.T) {
+	shouldLog = testing.Verbose()
+	p := gpiotest.Pin{N: "FAKE_GPIO_HEATER"}
+	if err := gpioreg.Register(&p); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := gpioreg.Unregister(p.N); err != nil {
+			t.Error(err)
+		}
+	}()
+	port := getFreePort(t)
+	y := fmt.Sprintf("periphhome:\n  name: pi\napi:\n  port: %d\n"+
+		"switch:\n  - platform: gpio\n    name: Heater\n    pin:\n      number: FAKE_GPIO_HEATER\n"+
+		"climate:\n  - platform: thermostat\n    name: Thermostat\n    heater: Heater\n    entity_id: sensor.living_room\n", port)
+	cfg := &config.Root{}
+	if err := cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	n, err := New(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	c := n.entities[1]
+	if err = c.climateCommand(&aioesphomeapi.ClimateCommandRequest{HasMode: true, Mode: aioesphomeapi.ClimateMode_CLIMATE_MODE_HEAT}); err != nil {
+		t.Fatal(err)
+	}
+	_, ch, _ := c.(*climateThermostat).register()
+
+	tc := dialTestClient(t, port, "")
+	defer tc.close()
+	tc.send(&aioesphomeapi.SubscribeHomeAssistantStatesRequest{})
+	if r, ok := tc.recv().(*aioesphomeapi.SubscribeHomeAssistantStateResponse); !ok || r.EntityId != "sensor.living_room" {
+		t.Fatalf("unexpected %v", r)
+	}
+	tc.send(&aioesphomeapi.HomeAssistantStateResponse{EntityId: "sensor.other", State: "10"})
+	tc.send(&aioesphomeapi.HomeAssistantStateResponse{EntityId: "sensor.living_room", State: "18.5"})
+	select {
+	case msg := <-ch:
+		if s := msg.(*aioesphomeapi.ClimateStateResponse); s.CurrentTemperature != 18.5 || s.Action != aioesphomeapi.ClimateAction_CLIMATE_ACTION_HEATING {
+			t.Fatalf("unexpected %v", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	if p.Read() != gpio.High {
+		t.Fatal("expected heating")
+	}
+	tc.send(&aioesphomeapi.HomeAssistantStateResponse{EntityId: "sensor.living_room", State: "unavailable"})
+	select {
+	case msg := <-ch:
+		if s := msg.(*aioesphomeapi.ClimateStateResponse); !math.IsNaN(float64(s.CurrentTemperature)) || s.Action != aioesphomeapi.ClimateAction_CLIMATE_ACTION_IDLE {
+			t.Fatalf("unexpected %v", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func TestLoadClimateThermostat_Err(t *testing.T) {
+	p := gpiotest.Pin{N: "FAKE_GPIO_HEATER"}
+	if err := gpioreg.Register(&p); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := gpioreg.Unregister(p.N); err != nil {
+			t.Error(err)
+		}
+	}()
+	ctx := context.Background()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	if err := n.loadSensor(ctx, &config.Sensor{Platform: "fake", Name: "Temperature", UpdateInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	defer n.entities[0].Close()
+	if err := n.loadSwitch(ctx, &config.Switch{Platform: "gpio", Name: "Heater", Pin: config.Pin{Number: p.N}}); err != nil {
+		t.Fatal(err)
+	}
+	data := []config.Climate{
+		{Sensor: "Temperature"},
+		{Heater: "Heater"},
+		{Sensor: "Unknown", Heater: "Heater"},
+		{Sensor: "Heater", Heater: "Heater"},
+		{Sensor: "Temperature", Heater: "Temperature"},
+		{Sensor: "Temperature", Heater: "Heater", TargetTemperature: 35},
+		{Sensor: "Temperature", Heater: "Heater", MinTemperature: 30},
+		{Sensor: "Temperature", EntityID: "sensor.temperature", Heater: "Heater"},
+	}
+	for i := range data {
+		data[i].Platform = "thermostat"
+		data[i].Name = "Thermostat"
+		if err := n.loadClimate(ctx, &data[i]); err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
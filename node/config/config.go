@@ -40,9 +40,15 @@ package config
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"math"
+	"net"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -84,10 +90,22 @@ const (
 type Root struct {
 	PeriphHome    PeriphHome     `yaml:"periphhome"`
 	API           API            `yaml:"api"`
+	WebServer     WebServer      `yaml:"web_server"`
+	Outputs       []OutputPin    `yaml:"output"`
+	I2CMuxes      []I2CMux       `yaml:"i2c_mux"`
 	BinarySensors []BinarySensor `yaml:"binary_sensor"`
 	Sensors       []Sensor       `yaml:"sensor"`
+	TextSensors   []TextSensor   `yaml:"text_sensor"`
 	Lights        []Light        `yaml:"light"`
+	Switches      []Switch       `yaml:"switch"`
+	Covers        []Cover        `yaml:"cover"`
+	Fans          []Fan          `yaml:"fan"`
+	Climates      []Climate      `yaml:"climate"`
+	Buttons       []Button       `yaml:"button"`
+	Numbers       []Number       `yaml:"number"`
 	Cameras       []Camera       `yaml:"camera"`
+	Displays      []Display      `yaml:"display"`
+	Times         []Time         `yaml:"time"`
 
 	_ struct{}
 }
@@ -109,6 +127,33 @@ func (r *Root) LoadYaml(b []byte) error {
 	return r.validate()
 }
 
+// SafeMode returns a minimal configuration that only enables the native API.
+//
+// It is meant to be used when LoadYaml() failed, so the node can still be
+// reached to report the error. The name and the api section are salvaged from
+// b on a best effort basis so the password is kept when possible.
+func SafeMode(b []byte) Root {
+	t := struct {
+		PeriphHome PeriphHome `yaml:"periphhome"`
+		API        API        `yaml:"api"`
+	}{}
+	// Not strict on purpose and errors are ignored; what could be decoded is
+	// used.
+	_ = yaml.Unmarshal(b, &t)
+	r := Root{}
+	if t.PeriphHome.validate() == nil {
+		r.PeriphHome.Name = t.PeriphHome.Name
+	}
+	if r.PeriphHome.Name == "" {
+		r.PeriphHome.Name, _ = os.Hostname()
+	}
+	if t.API.validate() == nil {
+		r.API = t.API
+	}
+	r.API.IsPresent = true
+	return r
+}
+
 // validate validates the configuration.
 func (r *Root) validate() error {
 	if err := r.PeriphHome.validate(); err != nil {
@@ -117,20 +162,132 @@ func (r *Root) validate() error {
 	if err := r.API.validate(); err != nil {
 		return err
 	}
+	if err := r.WebServer.validate(); err != nil {
+		return err
+	}
+	outputs := map[string]bool{}
+	for i := range r.Outputs {
+		if err := r.Outputs[i].validate(); err != nil {
+			return err
+		}
+		if outputs[r.Outputs[i].ID] {
+			return fmt.Errorf("output: duplicate id %q", r.Outputs[i].ID)
+		}
+		outputs[r.Outputs[i].ID] = true
+	}
+	muxes := map[string]bool{}
+	for i := range r.I2CMuxes {
+		if err := r.I2CMuxes[i].validate(); err != nil {
+			return err
+		}
+		if muxes[r.I2CMuxes[i].ID] {
+			return fmt.Errorf("i2c_mux: duplicate id %q", r.I2CMuxes[i].ID)
+		}
+		muxes[r.I2CMuxes[i].ID] = true
+	}
 	for i := range r.BinarySensors {
 		if err := r.BinarySensors[i].validate(); err != nil {
 			return err
 		}
 	}
+	bme280s := map[string]bool{}
 	for i := range r.Sensors {
 		if err := r.Sensors[i].validate(); err != nil {
 			return err
 		}
+		if m := r.Sensors[i].I2CMux; m != "" && !muxes[m] {
+			return fmt.Errorf("sensor: unknown i2c_mux %q", m)
+		}
+		if r.Sensors[i].Platform == "bme280" {
+			// Multiple chips are supported as long as each has its own address or
+			// port.
+			k := r.Sensors[i].bme280Location()
+			if bme280s[k] {
+				return fmt.Errorf("sensor: bme280 %s is defined twice", k)
+			}
+			bme280s[k] = true
+		}
+	}
+	for i := range r.TextSensors {
+		if err := r.TextSensors[i].validate(); err != nil {
+			return err
+		}
 	}
+	lights := map[string]bool{}
 	for i := range r.Lights {
 		if err := r.Lights[i].validate(); err != nil {
 			return err
 		}
+		if o := r.Lights[i].Output; o != "" && !outputs[o] {
+			return fmt.Errorf("light: unknown output %q", o)
+		}
+		lights[r.Lights[i].Name] = true
+	}
+	switches := map[string]bool{}
+	for i := range r.Switches {
+		if err := r.Switches[i].validate(); err != nil {
+			return err
+		}
+		switches[r.Switches[i].Name] = true
+	}
+	covers := map[string]bool{}
+	for i := range r.Covers {
+		if err := r.Covers[i].validate(); err != nil {
+			return err
+		}
+		covers[r.Covers[i].Name] = true
+	}
+	for i := range r.Fans {
+		if err := r.Fans[i].validate(); err != nil {
+			return err
+		}
+		if o := r.Fans[i].Output; !outputs[o] {
+			return fmt.Errorf("fan: unknown output %q", o)
+		}
+	}
+	for i := range r.Buttons {
+		if err := r.Buttons[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range r.Numbers {
+		if err := r.Numbers[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range r.Climates {
+		if err := r.Climates[i].validate(); err != nil {
+			return err
+		}
+		if h := r.Climates[i].Heater; h != "" && !switches[h] {
+			return fmt.Errorf("climate: unknown heater %q", h)
+		}
+	}
+	for i := range r.PeriphHome.OnBoot {
+		if err := r.PeriphHome.OnBoot[i].validate(lights, outputs, switches, covers); err != nil {
+			return fmt.Errorf("periphhome: on_boot: %w", err)
+		}
+	}
+	for i := range r.Lights {
+		for j := range r.Lights[i].OnShutdown {
+			if err := r.Lights[i].OnShutdown[j].validate(lights, outputs, switches, covers); err != nil {
+				return fmt.Errorf("light: on_shutdown: %w", err)
+			}
+		}
+	}
+	for i := range r.Switches {
+		for j := range r.Switches[i].OnShutdown {
+			if err := r.Switches[i].OnShutdown[j].validate(lights, outputs, switches, covers); err != nil {
+				return fmt.Errorf("switch: on_shutdown: %w", err)
+			}
+		}
+	}
+	for i := range r.Covers {
+		for j := range r.Covers[i].OnShutdown {
+			if err := r.Covers[i].OnShutdown[j].validate(lights, outputs, switches, covers); err != nil {
+				return fmt.Errorf("cover: on_shutdown: %w", err)
+			}
+		}
 	}
 	if len(r.Cameras) > 1 {
 		return errors.New("the ESPHome protocol currently only support one camera per node; please contribute upstream to add support for multiple cameras")
@@ -139,6 +296,71 @@ func (r *Root) validate() error {
 		if err := r.Cameras[i].validate(); err != nil {
 			return err
 		}
+		if r.Cameras[i].WebToken != "" && !r.WebServer.IsPresent {
+			return errors.New("camera: web_token requires web_server")
+		}
+	}
+	for i := range r.Displays {
+		if err := r.Displays[i].validate(); err != nil {
+			return err
+		}
+	}
+	if len(r.Times) > 1 {
+		return errors.New("time: only one time source is supported")
+	}
+	for i := range r.Times {
+		if err := r.Times[i].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidatePins verifies that every GPIO pin referenced by the configuration
+// exists, as reported by exists, e.g. gpioreg.ByName() once the host drivers
+// are initialized.
+//
+// It is not done by LoadYaml() since the pins can only be known on the
+// target host. All the unknown pins are reported at once.
+func (r *Root) ValidatePins(exists func(name string) bool) error {
+	var unknown []string
+	check := func(section, name, pin string) {
+		if pin != "" && !exists(pin) {
+			unknown = append(unknown, fmt.Sprintf("%q (%s %q)", pin, section, name))
+		}
+	}
+	for _, o := range r.Outputs {
+		check("output", o.ID, o.Pin.Number)
+	}
+	for _, b := range r.BinarySensors {
+		check("binary_sensor", b.Name, b.Pin.Number)
+	}
+	for _, s := range r.Sensors {
+		// The analog inputs are not GPIOs.
+		if s.Platform != "adc" {
+			check("sensor", s.Name, s.Pin.Number)
+		}
+		for _, p := range s.Pins {
+			check("sensor", s.Name, p.Number)
+		}
+		check("sensor", s.Name, s.TriggerPin.Number)
+		check("sensor", s.Name, s.EchoPin.Number)
+	}
+	for _, l := range r.Lights {
+		check("light", l.Name, l.Pin)
+	}
+	for _, s := range r.Switches {
+		check("switch", s.Name, s.Pin.Number)
+	}
+	for _, c := range r.Covers {
+		check("cover", c.Name, c.OpenPin.Number)
+		check("cover", c.Name, c.ClosePin.Number)
+	}
+	for _, d := range r.Displays {
+		check("display", d.Platform, d.DCPin)
+	}
+	if len(unknown) != 0 {
+		return fmt.Errorf("unknown pins: %s", strings.Join(unknown, ", "))
 	}
 	return nil
 }
@@ -149,15 +371,145 @@ type PeriphHome struct {
 	// Defaults to the hostname.
 	Name    string
 	Comment string
+	// StateDir is the directory where the node keeps state across restarts.
+	//
+	// Defaults to none, in which case nothing is persisted.
+	StateDir string `yaml:"state_dir"`
+	// AvailabilityGrace enables saving the entities states in StateDir on
+	// clean shutdown and replaying them on the next startup, so clients get
+	// values right away instead of seeing the entities unavailable until the
+	// hardware is ready.
+	//
+	// It is the maximum age of the saved states to be replayed. Defaults to
+	// disabled.
+	AvailabilityGrace time.Duration `yaml:"availability_grace"`
+	// StateStore is the directory where the switches, lights and numbers
+	// save their state on every change, to be restored on the next startup.
+	// Writes are delayed by a few seconds to spare the SD card. It can be the
+	// same directory as StateDir.
+	//
+	// Defaults to none, in which case the components start off.
+	StateStore string `yaml:"state_store"`
+	// NamePrefix is prepended to the name of every entity as shown in Home
+	// Assistant, e.g. "Living Room" shows "Temperature" as "Living Room
+	// Temperature". The object IDs and unique IDs are not affected, so
+	// changing it doesn't break the history.
+	NamePrefix string `yaml:"name_prefix"`
+	// OnBoot is run once after all the components are initialized.
+	OnBoot []Action `yaml:"on_boot"`
+	// ContinueOnError skips the components failing to initialize instead of
+	// refusing to start, e.g. when a sensor is disconnected or a pin is
+	// unknown. Each failure is reported by a diagnostic text sensor.
+	ContinueOnError bool `yaml:"continue_on_error"`
+	// SuggestedArea is the Home Assistant area the device is placed in when
+	// added, e.g. "Living Room".
+	//
+	// Defaults to no suggestion.
+	SuggestedArea string `yaml:"suggested_area"`
+	// MaintenanceSwitch adds a "Maintenance" switch that pauses the components
+	// accessing hardware and releases their bus handles while on, so sensors
+	// can be reseated without restarting the node. They are reinitialized when
+	// turned off.
+	MaintenanceSwitch bool `yaml:"maintenance_switch"`
+	// IDScheme selects how the entities' keys and unique IDs are derived.
+	//
+	// "objectid_fnv" derives the unique ID from the node name and the key from
+	// the FNV hash of the object ID. Entities of different types with the same
+	// name get the same key.
+	//
+	// "mac_crc" derives both from the mac address, the component type and the
+	// object ID, the key being the CRC32 of the unique ID.
+	//
+	// Switching is a one-time migration: Home Assistant sees new entities and
+	// the old ones must be deleted by hand, losing their history.
+	//
+	// Defaults to "objectid_fnv".
+	IDScheme string `yaml:"id_scheme"`
+	// ShutdownTimeout bounds the time to stop the node. The API clients still
+	// connected and the components still stopping are then abandoned.
+	//
+	// Defaults to 10s.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// BindAddress is the IP address the API server, the web server and the
+	// RTSP servers listen on, e.g. to not be reachable over a VPN.
+	//
+	// Defaults to all addresses.
+	BindAddress string `yaml:"bind_address"`
+	// Project identifies the firmware the node runs, as shown in the device
+	// info in Home Assistant.
+	Project Project
+	// Interface is the network interface advertised via zeroconf, whose mac
+	// address identifies the node, e.g. "eth0". Set it when the wrong one is
+	// picked on a host with docker or tailscale.
+	//
+	// Defaults to the interface of BindAddress if set, otherwise the first
+	// interface that is up and supports multicast.
+	Interface string
+
+	_ struct{}
+}
+
+// Project is the "periphhome/project" section.
+type Project struct {
+	// Name is the project name in the form "author.project", e.g.
+	// "maruel.greenhouse".
+	Name string
+	// Version is the project version, e.g. "1.0".
+	Version string
 
 	_ struct{}
 }
 
+// validate validates the configuration.
+func (p *Project) validate() error {
+	if p.Name == "" && p.Version == "" {
+		return nil
+	}
+	if p.Name == "" || p.Version == "" {
+		return errors.New("project: name and version must be set together")
+	}
+	if !strings.Contains(p.Name, ".") {
+		return fmt.Errorf("project: name must be in the form author.project, got %q", p.Name)
+	}
+	return nil
+}
+
 // validate validates the configuration.
 func (p *PeriphHome) validate() error {
 	if len(p.Name) > 63 {
 		return errors.New("periphhome: name is too long")
 	}
+	if len(p.SuggestedArea) > 63 {
+		return errors.New("periphhome: suggested_area is too long")
+	}
+	if p.StateDir != "" && !filepath.IsAbs(p.StateDir) {
+		// Save the user trouble since when started via systemd the working
+		// directory will not match.
+		return errors.New("periphhome: state_dir must be absolute path")
+	}
+	if p.StateStore != "" && !filepath.IsAbs(p.StateStore) {
+		return errors.New("periphhome: state_store must be absolute path")
+	}
+	if p.AvailabilityGrace < 0 {
+		return errors.New("periphhome: invalid availability_grace")
+	}
+	if p.AvailabilityGrace != 0 && p.StateDir == "" {
+		return errors.New("periphhome: availability_grace requires state_dir")
+	}
+	if p.ShutdownTimeout < 0 {
+		return errors.New("periphhome: invalid shutdown_timeout")
+	}
+	if err := p.Project.validate(); err != nil {
+		return fmt.Errorf("periphhome: %w", err)
+	}
+	if p.BindAddress != "" && net.ParseIP(p.BindAddress) == nil {
+		return fmt.Errorf("periphhome: bind_address must be an IP address, got %q", p.BindAddress)
+	}
+	switch p.IDScheme {
+	case "", "objectid_fnv", "mac_crc":
+	default:
+		return fmt.Errorf("periphhome: invalid id_scheme %q", p.IDScheme)
+	}
 	return nil
 }
 
@@ -167,9 +519,47 @@ type API struct {
 	//
 	// Defaults to 6053.
 	Port int
-	// Password provides a very weak protection, since no encryption and no
-	// hashing is used.
+	// Password provides a very weak protection, since it is sent in clear
+	// unless Encryption is used. Invalid passwords are replied to after a
+	// delay doubling with each attempt from the same address.
 	Password string
+	// Auth is how the client proves it knows Password:
+	//   - "" or "password": the password is sent in clear, as Home Assistant
+	//     does.
+	//   - "hmac": the node sends a nonce in HelloResponse.ServerInfo after
+	//     " hmac=" as hex, and the client sends the hex encoded HMAC-SHA256 of
+	//     the nonce keyed with the password instead of the password. Only
+	//     supported by the periphhome client.
+	//
+	// Defaults to "password".
+	Auth string
+	// Encryption encrypts the connections. Current Home Assistant versions
+	// expect it.
+	Encryption APIEncryption
+	// AllowedClients is a list of IP addresses or CIDR subnets allowed to
+	// connect, e.g. "192.168.1.10" or "192.168.1.0/24". Other clients are
+	// disconnected right away.
+	//
+	// Defaults to allow all clients.
+	AllowedClients []string `yaml:"allowed_clients"`
+	// ReadTimeout bounds the time to receive the rest of a message once its
+	// first byte arrived. Waiting for the next message is not bounded by it.
+	//
+	// Defaults to 30s.
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// WriteTimeout bounds the time to send one message.
+	//
+	// Defaults to 30s.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// DebugFrames logs every message received and sent with its ID, type,
+	// size and the beginning of its content, at the DEBUG level. It is meant to
+	// diagnose protocol mismatches with new clients.
+	//
+	// Defaults to false.
+	DebugFrames bool `yaml:"debug_frames"`
+	// Services are user defined services that Home Assistant can call, e.g.
+	// from an automation.
+	Services []Service
 
 	// IsPresent is set to true if the field was present when the configuration
 	// is deserialized from yaml.
@@ -177,19 +567,15 @@ type API struct {
 	_         struct{}
 }
 
-type api struct {
-	Port     int
-	Password string
-}
+// api has the same fields as API without its methods, so it can be decoded
+// as a whole without recursing into UnmarshalYAML.
+type api API
 
 // UnmarshalYAML implements yaml.Unmarshaler.
 func (a *API) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	t := api{}
-	if err := unmarshal(&t); err != nil {
+	if err := unmarshal((*api)(a)); err != nil {
 		return err
 	}
-	a.Port = t.Port
-	a.Password = t.Password
 	a.IsPresent = true
 	return nil
 }
@@ -199,135 +585,1580 @@ func (a *API) validate() error {
 	if a.Port < 0 || a.Port >= 65536 {
 		return errors.New("api: port is invalid")
 	}
+	for _, c := range a.AllowedClients {
+		if _, err := ParseSubnet(c); err != nil {
+			return fmt.Errorf("api: allowed_clients: %w", err)
+		}
+	}
+	if a.ReadTimeout < 0 {
+		return errors.New("api: read_timeout is invalid")
+	}
+	if a.WriteTimeout < 0 {
+		return errors.New("api: write_timeout is invalid")
+	}
+	switch a.Auth {
+	case "", "password":
+	case "hmac":
+		if a.Password == "" {
+			return errors.New("api: auth hmac requires a password")
+		}
+	default:
+		return fmt.Errorf("api: invalid auth %q", a.Auth)
+	}
+	if err := a.Encryption.validate(); err != nil {
+		return fmt.Errorf("api: encryption: %w", err)
+	}
+	names := map[string]bool{}
+	for i := range a.Services {
+		if err := a.Services[i].validate(); err != nil {
+			return fmt.Errorf("api: services: %w", err)
+		}
+		if names[a.Services[i].Service] {
+			return fmt.Errorf("api: services: duplicate service %q", a.Services[i].Service)
+		}
+		names[a.Services[i].Service] = true
+	}
 	return nil
 }
 
-// BinarySensor is an element in the "binary_sensor" section.
-type BinarySensor struct {
-	Platform    string
-	Name        string
-	DeviceClass string `yaml:"device_class"`
-	Pin         Pin
+// APIEncryption is the "encryption" section of "api".
+type APIEncryption struct {
+	// Key is the base64 encoded 32 bytes pre-shared key, the same as ESPHome's.
+	// Generate one with "head -c 32 /dev/urandom | base64".
+	//
+	// Defaults to no encryption. When set, plaintext clients are refused.
+	Key string
 
 	_ struct{}
 }
 
-// validate validates the configuration.
-func (b *BinarySensor) validate() error {
-	if b.Name == "" {
-		return errors.New("binary_sensor: name is required")
+// PSK returns the decoded key, or nil if encryption is not enabled.
+func (a *APIEncryption) PSK() ([]byte, error) {
+	if a.Key == "" {
+		return nil, nil
 	}
-	return b.Pin.validate()
+	b, err := base64.StdEncoding.DecodeString(a.Key)
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(b))
+	}
+	return b, nil
 }
 
-// Pin is a "pin" section.
-type Pin struct {
-	Number   string
-	Inverted bool
-	Mode     PinMode
+// validate validates the configuration.
+func (a *APIEncryption) validate() error {
+	_, err := a.PSK()
+	return err
+}
+
+// Service is an element in the "services" section of "api".
+type Service struct {
+	// Service is the name of the service, as called from Home Assistant as
+	// "esphome.<node>_<service>".
+	Service string
+	// Args are the arguments of the service, in order.
+	Args []ServiceArg
+	// Command is run by /bin/sh with each argument in an environment variable
+	// of the same name.
+	Command string
 
 	_ struct{}
 }
 
 // validate validates the configuration.
-func (p *Pin) validate() error {
-	return p.Mode.validate()
+func (s *Service) validate() error {
+	if s.Service == "" {
+		return errors.New("service is required")
+	}
+	if s.Command == "" {
+		return fmt.Errorf("%s: command is required", s.Service)
+	}
+	names := map[string]bool{}
+	for i := range s.Args {
+		if err := s.Args[i].validate(); err != nil {
+			return fmt.Errorf("%s: %w", s.Service, err)
+		}
+		if names[s.Args[i].Name] {
+			return fmt.Errorf("%s: duplicate arg %q", s.Service, s.Args[i].Name)
+		}
+		names[s.Args[i].Name] = true
+	}
+	return nil
 }
 
-// Sensor is an element in the "sensor" section.
-type Sensor struct {
-	Platform       string
-	Name           string
-	Temperature    SensorParams
-	Pressure       SensorParams
-	Humidity       SensorParams
-	Address        int
-	UpdateInterval time.Duration `yaml:"update_interval"`
+// ServiceArg is an argument of a Service.
+type ServiceArg struct {
+	// Name must be a valid environment variable name, e.g. "relay".
+	Name string
+	// Type is one of "bool", "int", "float" or "string".
+	Type string
 
 	_ struct{}
 }
 
 // validate validates the configuration.
-func (s *Sensor) validate() error {
-	if s.Platform == "" {
-		return errors.New("sensor: platform is required")
+func (s *ServiceArg) validate() error {
+	if s.Name == "" {
+		return errors.New("arg name is required")
 	}
-	if err := s.Temperature.validate(); err != nil {
-		return fmt.Errorf("sensor / temperature: %w", err)
+	for i, r := range s.Name {
+		if r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && (i == 0 || !('0' <= r && r <= '9')) {
+			return fmt.Errorf("invalid arg name %q; use letters, digits and underscores", s.Name)
+		}
 	}
-	if err := s.Pressure.validate(); err != nil {
-		return fmt.Errorf("sensor / pressure: %w", err)
+	switch s.Type {
+	case "bool", "int", "float", "string":
+		return nil
+	default:
+		return fmt.Errorf("arg %s: invalid type %q; use bool, int, float or string", s.Name, s.Type)
 	}
-	if err := s.Humidity.validate(); err != nil {
-		return fmt.Errorf("sensor / humidity: %w", err)
+}
+
+// ParseSubnet parses an IP address or a CIDR subnet. An IP address is
+// returned as a subnet containing only this address.
+func ParseSubnet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// WebServer is the "web_server" section.
+type WebServer struct {
+	// Port is the TCP port for the HTTP server.
+	//
+	// Defaults to 80.
+	Port int
+	// TLSCert and TLSKey are paths to a PEM encoded certificate and its private
+	// key. When set, the web server is served over HTTPS instead of HTTP.
+	//
+	// Use "periphhome <config.yaml> gencert" to generate a self-signed pair.
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+	// History serves the recordings of the cameras with a directory at
+	// /history/, including the index.m3u8 HLS playlists, to watch them in a
+	// browser. The camera's web_token, if set, is required, including for the
+	// camera to be listed.
+	History bool
+
+	// IsPresent is set to true if the field was present when the configuration
+	// is deserialized from yaml.
+	IsPresent bool `yaml:"-"`
+	_         struct{}
+}
+
+type webServer struct {
+	Port    int
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+	History bool
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (w *WebServer) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	t := webServer{}
+	if err := unmarshal(&t); err != nil {
+		return err
 	}
+	w.Port = t.Port
+	w.TLSCert = t.TLSCert
+	w.TLSKey = t.TLSKey
+	w.History = t.History
+	w.IsPresent = true
 	return nil
 }
 
-// SensorParams defines a sensor parameter.
-type SensorParams struct {
-	Name string
+// validate validates the configuration.
+func (w *WebServer) validate() error {
+	if w.Port < 0 || w.Port >= 65536 {
+		return errors.New("web_server: port is invalid")
+	}
+	if (w.TLSCert == "") != (w.TLSKey == "") {
+		return errors.New("web_server: tls_cert and tls_key must be specified together")
+	}
+	return nil
+}
+
+// I2CMux is an element in the "i2c_mux" section.
+//
+// It is a TCA9548A I²C multiplexer. Sensors behind it reference it by ID
+// along their channel, so that multiple devices with the same address can
+// coexist.
+type I2CMux struct {
+	// ID is the identifier used by sensors to reference this multiplexer.
+	ID string
+	// Address is the multiplexer I²C address, between 0x70 and 0x77.
+	//
+	// Defaults to 0x70.
+	Address int
+	// I2CID is the I²C bus the multiplexer is on, as accepted by
+	// i2creg.Open(). Defaults to the first bus.
+	I2CID string `yaml:"i2c_id"`
 
 	_ struct{}
 }
 
 // validate validates the configuration.
-func (s *SensorParams) validate() error {
+func (m *I2CMux) validate() error {
+	if m.ID == "" {
+		return errors.New("i2c_mux: id is required")
+	}
+	if m.Address != 0 && (m.Address < 0x70 || m.Address > 0x77) {
+		return fmt.Errorf("i2c_mux: invalid address 0x%x; use 0x70 to 0x77", m.Address)
+	}
 	return nil
 }
 
-// Light is an element in the "light" section.
-type Light struct {
+// OutputPin is an element in the "output" section.
+//
+// An output is not an entity by itself, it is referenced by ID by entities
+// controlling an actuator.
+type OutputPin struct {
+	// Platform is "gpio" for a binary output or "pwm" for a float output.
 	Platform string
-	Name     string
-	NumLEDs  int `yaml:"num_leds"`
+	// ID is the identifier used by entities to reference this output.
+	ID  string
+	Pin Pin
+	// Frequency is the PWM frequency in Hz. Only used by "pwm".
+	//
+	// Defaults to 1000.
+	Frequency int
 
 	_ struct{}
 }
 
 // validate validates the configuration.
-func (l *Light) validate() error {
-	if l.Platform == "" {
-		return errors.New("light: platform is required")
+func (o *OutputPin) validate() error {
+	if o.Platform == "" {
+		return errors.New("output: platform is required")
 	}
-	if l.Name == "" {
-		return errors.New("light: name is required")
+	if o.ID == "" {
+		return errors.New("output: id is required")
 	}
-	if l.NumLEDs < 0 || l.NumLEDs > 1000000 {
-		return errors.New("light: num_leds is required")
+	if o.Pin.Number == "" {
+		return errors.New("output: pin number is required")
 	}
-	return nil
+	switch o.Pin.Mode {
+	case "", Output, OutputOpenDrain:
+	default:
+		return errors.New("output: pin mode must be an output")
+	}
+	if o.Frequency < 0 {
+		return errors.New("output: invalid frequency")
+	}
+	return o.Pin.validate()
 }
 
-// Camera is an element in the "camera" section.
-type Camera struct {
-	Platform  string
-	Name      string
-	Directory string
-	Rotation  int
+// Action is an element in an automation, like "on_boot". Exactly one field
+// must be set.
+type Action struct {
+	// LightTurnOn turns on a light, optionally to a specific brightness.
+	LightTurnOn *LightAction `yaml:"light.turn_on"`
+	// LightTurnOff turns off a light.
+	LightTurnOff *LightAction `yaml:"light.turn_off"`
+	// OutputTurnOn sets an output to Level, or fully on if not set.
+	OutputTurnOn *OutputAction `yaml:"output.turn_on"`
+	// OutputTurnOff turns off an output.
+	OutputTurnOff *OutputAction `yaml:"output.turn_off"`
+	// OutputPulse turns on an output for Duration then turns it off.
+	OutputPulse *OutputAction `yaml:"output.pulse"`
+	// SwitchTurnOn and SwitchTurnOff turn a switch on or off.
+	SwitchTurnOn  *SwitchAction `yaml:"switch.turn_on"`
+	SwitchTurnOff *SwitchAction `yaml:"switch.turn_off"`
+	// CoverOpen, CoverClose and CoverStop move or stop a cover.
+	CoverOpen  *CoverAction `yaml:"cover.open"`
+	CoverClose *CoverAction `yaml:"cover.close"`
+	CoverStop  *CoverAction `yaml:"cover.stop"`
+	// Delay waits before running the next action.
+	Delay time.Duration
 
 	_ struct{}
 }
 
 // validate validates the configuration.
-func (c *Camera) validate() error {
-	if c.Platform == "" {
-		return errors.New("camera: platform is required")
+func (a *Action) validate(lights, outputs, switches, covers map[string]bool) error {
+	n := 0
+	if a.LightTurnOn != nil {
+		n++
+		if err := a.LightTurnOn.validate(lights); err != nil {
+			return fmt.Errorf("light.turn_on: %w", err)
+		}
 	}
-	if c.Name == "" {
-		return errors.New("camera: name is required")
+	if a.LightTurnOff != nil {
+		n++
+		if err := a.LightTurnOff.validate(lights); err != nil {
+			return fmt.Errorf("light.turn_off: %w", err)
+		}
+		if a.LightTurnOff.Brightness != nil {
+			return errors.New("light.turn_off: brightness is not supported")
+		}
 	}
-	if c.Directory != "" {
-		if !filepath.IsAbs(c.Directory) {
-			// Save the user trouble since when started via systemd the working
-			// directory will not match.
-			return errors.New("camera: directory must be absolute path")
+	if a.OutputTurnOn != nil {
+		n++
+		if err := a.OutputTurnOn.validate(outputs); err != nil {
+			return fmt.Errorf("output.turn_on: %w", err)
+		}
+		if a.OutputTurnOn.Duration != 0 {
+			return errors.New("output.turn_on: duration is not supported")
 		}
 	}
-	switch c.Rotation {
-	case 0, 90, 180, 270:
-	default:
-		return errors.New("camera: invalid rotation")
+	if a.OutputTurnOff != nil {
+		n++
+		if err := a.OutputTurnOff.validate(outputs); err != nil {
+			return fmt.Errorf("output.turn_off: %w", err)
+		}
+		if a.OutputTurnOff.Level != nil || a.OutputTurnOff.Duration != 0 {
+			return errors.New("output.turn_off: level and duration are not supported")
+		}
+	}
+	if a.OutputPulse != nil {
+		n++
+		if err := a.OutputPulse.validate(outputs); err != nil {
+			return fmt.Errorf("output.pulse: %w", err)
+		}
+		if a.OutputPulse.Duration <= 0 {
+			return errors.New("output.pulse: duration is required")
+		}
+	}
+	for _, s := range []struct {
+		name string
+		a    *SwitchAction
+	}{{"switch.turn_on", a.SwitchTurnOn}, {"switch.turn_off", a.SwitchTurnOff}} {
+		if s.a != nil {
+			n++
+			if !switches[s.a.Name] {
+				return fmt.Errorf("%s: unknown switch %q", s.name, s.a.Name)
+			}
+		}
+	}
+	for _, c := range []struct {
+		name string
+		a    *CoverAction
+	}{{"cover.open", a.CoverOpen}, {"cover.close", a.CoverClose}, {"cover.stop", a.CoverStop}} {
+		if c.a != nil {
+			n++
+			if !covers[c.a.Name] {
+				return fmt.Errorf("%s: unknown cover %q", c.name, c.a.Name)
+			}
+		}
+	}
+	if a.Delay != 0 {
+		n++
+		if a.Delay < 0 {
+			return errors.New("invalid delay")
+		}
+	}
+	if n != 1 {
+		return errors.New("exactly one action must be specified")
+	}
+	return nil
+}
+
+// LightAction is the parameter of the light actions.
+type LightAction struct {
+	// Name is the name of the light.
+	Name string
+	// Brightness is between 0 and 1. Defaults to the last brightness.
+	Brightness *float64
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (l *LightAction) validate(lights map[string]bool) error {
+	if !lights[l.Name] {
+		return fmt.Errorf("unknown light %q", l.Name)
+	}
+	if l.Brightness != nil && (*l.Brightness < 0 || *l.Brightness > 1) {
+		return errors.New("brightness must be between 0 and 1")
+	}
+	return nil
+}
+
+// SwitchAction is the parameter of the switch actions.
+type SwitchAction struct {
+	// Name is the name of the switch.
+	Name string
+
+	_ struct{}
+}
+
+// CoverAction is the parameter of the cover actions.
+type CoverAction struct {
+	// Name is the name of the cover.
+	Name string
+
+	_ struct{}
+}
+
+// OutputAction is the parameter of the output actions.
+type OutputAction struct {
+	// ID is the ID of the output.
+	ID string
+	// Level is between 0 and 1.
+	Level *float64
+	// Duration is how long the output is kept on. Only used by
+	// "output.pulse".
+	Duration time.Duration
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (o *OutputAction) validate(outputs map[string]bool) error {
+	if !outputs[o.ID] {
+		return fmt.Errorf("unknown output %q", o.ID)
+	}
+	if o.Level != nil && (*o.Level < 0 || *o.Level > 1) {
+		return errors.New("level must be between 0 and 1")
+	}
+	return nil
+}
+
+// BinarySensor is an element in the "binary_sensor" section.
+type BinarySensor struct {
+	Platform    string
+	Name        string
+	DeviceClass string `yaml:"device_class"`
+	Pin         Pin
+	// HoldTime keeps the state on until the input has been off for this
+	// duration. Each new edge restarts the delay. This is useful for presence
+	// detection with PIR or radar sensors. This is called off_delay in ESPHome.
+	//
+	// Defaults to 0, which reports the input as-is.
+	HoldTime time.Duration `yaml:"hold_time"`
+	// Sensors are the names of the binary sensors combined into this one.
+	// They must be defined before. Used by "combine".
+	Sensors []string
+	// Operator is how Sensors are combined, either "and" or "or". Used by
+	// "combine". Defaults to "or".
+	Operator string
+	// Backend is how "gpio" detects edges. "periph" uses periph's WaitForEdge.
+	// "cdev" uses the Linux gpio character device, which delivers edges as
+	// events, and falls back to "periph" when it is not available.
+	//
+	// Defaults to "periph".
+	Backend string
+	// GPIOChip is the gpio character device used by the "cdev" backend. The pin
+	// number is used as the line offset on this chip.
+	//
+	// Defaults to "/dev/gpiochip0".
+	GPIOChip string `yaml:"gpio_chip"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (b *BinarySensor) validate() error {
+	if b.Name == "" {
+		return errors.New("binary_sensor: name is required")
+	}
+	if b.HoldTime < 0 {
+		return errors.New("binary_sensor: invalid hold_time")
+	}
+	switch b.Operator {
+	case "", "and", "or":
+	default:
+		return fmt.Errorf("binary_sensor: invalid operator %q", b.Operator)
+	}
+	switch b.Backend {
+	case "", "periph", "cdev":
+	default:
+		return fmt.Errorf("binary_sensor: invalid backend %q", b.Backend)
+	}
+	return b.Pin.validate()
+}
+
+// Pin is a "pin" section.
+type Pin struct {
+	Number   string
+	Inverted bool
+	Mode     PinMode
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (p *Pin) validate() error {
+	return p.Mode.validate()
+}
+
+// Sensor is an element in the "sensor" section.
+type Sensor struct {
+	Platform    string
+	Name        string
+	Temperature SensorParams
+	Pressure    SensorParams
+	Humidity    SensorParams
+	// Address is the I²C address. For "ds18b20", it is the 64-bit ROM code of
+	// the probe, e.g. 0x1c0000031edd2a28, and defaults to the first probe
+	// found.
+	Address        uint64
+	UpdateInterval time.Duration `yaml:"update_interval"`
+	// Goroutines, HeapAlloc and GCPause are used by "go_runtime".
+	Goroutines SensorParams
+	HeapAlloc  SensorParams `yaml:"heap_alloc"`
+	GCPause    SensorParams `yaml:"gc_pause"`
+	// I2CID is the I²C bus to use, as accepted by i2creg.Open(), e.g. "1" or
+	// "/dev/i2c-1". Defaults to the first bus.
+	I2CID string `yaml:"i2c_id"`
+	// SPIID is the SPI port to use, as accepted by spireg.Open(), e.g.
+	// "/dev/spidev0.1". Defaults to the first port. Used by "bme280" when
+	// Address is not set.
+	SPIID string `yaml:"spi_id"`
+	// Resolution is the measurement resolution. Used by "bh1750", where it is
+	// 0.5, 1 or 4 lx.
+	Resolution float64
+	// CalibrateLinear maps the measured values to the actual values. Not
+	// supported by sensors with multiple values like bme280, set it in each
+	// SensorParams instead.
+	CalibrateLinear []CalibrationPoint `yaml:"calibrate_linear"`
+	// UnitOfMeasurement, AccuracyDecimals, DeviceClass and StateClass override
+	// the platform's defaults. Not supported by sensors with multiple values
+	// like bme280, set them in each SensorParams instead.
+	UnitOfMeasurement string `yaml:"unit_of_measurement"`
+	AccuracyDecimals  *int   `yaml:"accuracy_decimals"`
+	DeviceClass       string `yaml:"device_class"`
+	// StateClass is one of "measurement", "total_increasing" or "none".
+	//
+	// The defaults are "measurement" for the physical quantities reported by
+	// adc, ads1115, aht10, aht20, bh1750, bme280, dht, ds18b20, tsl2561,
+	// tsl2591, ultrasonic, vcgencmd, wifi_signal, cpu_temperature,
+	// system_load, go_runtime and camera_fps, and for longest_connection. It
+	// is "total_increasing" for the counters boot_count, frames_sent and
+	// commands_received, and for the uptime reported by uptime and fake. Other
+	// platforms, like gpio_bus, default to "none".
+	StateClass string `yaml:"state_class"`
+	// Pin is the data pin. Used by "dht". Used by "adc" as the analog input,
+	// where the mode must be unset or ANALOG.
+	Pin Pin
+	// Pins are the input pins read as a binary number, least significant bit
+	// first, up to 16. Used by "gpio_bus", where the pins are read on each
+	// edge unless UpdateInterval is set.
+	Pins []Pin
+	// Model is the sensor model. Used by "dht", where it is "dht11", "dht22"
+	// or "am2302". Defaults to "dht22".
+	Model string
+	// Retry is the number of additional reads attempted when a read fails,
+	// before reporting the state as missing. Used by "dht".
+	Retry int
+	// Channels are the ADC channels to expose, each as its own sensor. Used by
+	// "ads1115".
+	Channels []ADCChannel
+	// Gain is the default full scale range in volts of Channels. Used by
+	// "ads1115", where it is one of 6.144, 4.096, 2.048, 1.024, 0.512 or
+	// 0.256. Defaults to 2.048.
+	//
+	// Used by "tsl2561" and "tsl2591" as the amplification, where it is 1 or
+	// 16, respectively 1, 25, 428 or 9876. Defaults to automatic, where the
+	// gain is lowered when the sensor saturates and raised in the dark.
+	Gain float64
+	// IntegrationTime is the duration of a measurement. Longer is more
+	// sensitive. Used by "tsl2561", where it is 13.7ms, 101ms or 402ms and
+	// defaults to 402ms, and by "tsl2591", where it is 100ms to 600ms by steps
+	// of 100ms and defaults to 100ms.
+	IntegrationTime time.Duration `yaml:"integration_time"`
+	// Multiply scales the measured voltage, e.g. 2 behind a voltage divider
+	// halving it. Used by "adc". Defaults to 1.
+	Multiply float64
+	// DataRate is the number of samples per second. Used by "ads1115", where
+	// it is one of 8, 16, 32, 64, 128, 250, 475 or 860. Defaults to 128.
+	DataRate int `yaml:"data_rate"`
+	// ArmClock and CoreVolts are the ARM core frequency and the core voltage.
+	// Used by "vcgencmd", along with Temperature for the SoC temperature.
+	ArmClock  SensorParams `yaml:"arm_clock"`
+	CoreVolts SensorParams `yaml:"core_volts"`
+	// TriggerPin and EchoPin are the pins of an HC-SR04 compatible ultrasonic
+	// distance sensor. Used by "ultrasonic".
+	TriggerPin Pin `yaml:"trigger_pin"`
+	EchoPin    Pin `yaml:"echo_pin"`
+	// Timeout is the maximum duration of the echo pulse, after which the
+	// distance is reported as missing. Used by "ultrasonic". Defaults to 25ms,
+	// about 4m.
+	Timeout time.Duration
+	// FramesSent, CommandsReceived and LongestConnection are the native API
+	// statistics. Used by "connection_stats".
+	FramesSent        SensorParams `yaml:"frames_sent"`
+	CommandsReceived  SensorParams `yaml:"commands_received"`
+	LongestConnection SensorParams `yaml:"longest_connection"`
+	// Samples is the number of readings averaged for each published value, up
+	// to 16. Used by "adc", "ads1115", "bh1750" and "ultrasonic". Used by
+	// "bme280" as the chip's oversampling, where it is 1, 2, 4, 8 or 16 and
+	// defaults to 16.
+	//
+	// Defaults to 1.
+	Samples int `yaml:"samples"`
+	// I2CMux is the ID of the I²C multiplexer the sensor is behind, in which
+	// case I2CID is not used. I2CMuxChannel is the channel on it, between 0 and
+	// 7.
+	I2CMux        string `yaml:"i2c_mux"`
+	I2CMuxChannel int    `yaml:"i2c_mux_channel"`
+	// Interface is the wifi interface, e.g. wlan0. Used by "wifi_signal".
+	// Defaults to the first one listed on linux and the default one on macOS.
+	Interface string
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (s *Sensor) validate() error {
+	if s.Platform == "" {
+		return errors.New("sensor: platform is required")
+	}
+	if err := s.Temperature.validate(); err != nil {
+		return fmt.Errorf("sensor / temperature: %w", err)
+	}
+	if err := s.Pressure.validate(); err != nil {
+		return fmt.Errorf("sensor / pressure: %w", err)
+	}
+	if err := s.Humidity.validate(); err != nil {
+		return fmt.Errorf("sensor / humidity: %w", err)
+	}
+	if err := s.Goroutines.validate(); err != nil {
+		return fmt.Errorf("sensor / goroutines: %w", err)
+	}
+	if err := s.HeapAlloc.validate(); err != nil {
+		return fmt.Errorf("sensor / heap_alloc: %w", err)
+	}
+	if err := s.GCPause.validate(); err != nil {
+		return fmt.Errorf("sensor / gc_pause: %w", err)
+	}
+	if err := s.ArmClock.validate(); err != nil {
+		return fmt.Errorf("sensor / arm_clock: %w", err)
+	}
+	if err := s.CoreVolts.validate(); err != nil {
+		return fmt.Errorf("sensor / core_volts: %w", err)
+	}
+	if err := s.FramesSent.validate(); err != nil {
+		return fmt.Errorf("sensor / frames_sent: %w", err)
+	}
+	if err := s.CommandsReceived.validate(); err != nil {
+		return fmt.Errorf("sensor / commands_received: %w", err)
+	}
+	if err := s.LongestConnection.validate(); err != nil {
+		return fmt.Errorf("sensor / longest_connection: %w", err)
+	}
+	if err := validateCalibration(s.CalibrateLinear); err != nil {
+		return fmt.Errorf("sensor: %w", err)
+	}
+	if err := validateAccuracy(s.AccuracyDecimals); err != nil {
+		return fmt.Errorf("sensor: %w", err)
+	}
+	if err := validateStateClass(s.StateClass); err != nil {
+		return fmt.Errorf("sensor: %w", err)
+	}
+	if s.Resolution < 0 {
+		return errors.New("sensor: invalid resolution")
+	}
+	switch s.Model {
+	case "", "dht11", "dht22", "am2302":
+	default:
+		return fmt.Errorf("sensor: unknown model %q", s.Model)
+	}
+	if s.Retry < 0 {
+		return errors.New("sensor: invalid retry")
+	}
+	for i := range s.Channels {
+		if err := s.Channels[i].validate(); err != nil {
+			return fmt.Errorf("sensor / channels: %w", err)
+		}
+	}
+	switch s.Platform {
+	case "tsl2561":
+		if s.Gain != 0 && s.Gain != 1 && s.Gain != 16 {
+			return fmt.Errorf("sensor: invalid gain %g; use 1 or 16", s.Gain)
+		}
+	case "tsl2591":
+		if s.Gain != 0 && s.Gain != 1 && s.Gain != 25 && s.Gain != 428 && s.Gain != 9876 {
+			return fmt.Errorf("sensor: invalid gain %g; use 1, 25, 428 or 9876", s.Gain)
+		}
+	default:
+		if s.Gain != 0 && !validADCGain(s.Gain) {
+			return fmt.Errorf("sensor: invalid gain %g", s.Gain)
+		}
+	}
+	if s.IntegrationTime < 0 {
+		return errors.New("sensor: invalid integration_time")
+	}
+	switch s.DataRate {
+	case 0, 8, 16, 32, 64, 128, 250, 475, 860:
+	default:
+		return fmt.Errorf("sensor: invalid data_rate %d", s.DataRate)
+	}
+	if err := s.TriggerPin.validate(); err != nil {
+		return fmt.Errorf("sensor / trigger_pin: %w", err)
+	}
+	if err := s.EchoPin.validate(); err != nil {
+		return fmt.Errorf("sensor / echo_pin: %w", err)
+	}
+	if s.Timeout < 0 {
+		return errors.New("sensor: invalid timeout")
+	}
+	if s.Multiply < 0 {
+		return errors.New("sensor: invalid multiply")
+	}
+	if s.Samples < 0 || s.Samples > 16 {
+		return errors.New("sensor: samples must be between 1 and 16")
+	}
+	if s.I2CMuxChannel < 0 || s.I2CMuxChannel > 7 {
+		return fmt.Errorf("sensor: invalid i2c_mux_channel %d; use 0 to 7", s.I2CMuxChannel)
+	}
+	if s.I2CMux != "" && s.I2CID != "" {
+		return errors.New("sensor: use either i2c_id or i2c_mux")
+	}
+	if s.SPIID != "" && (s.I2CID != "" || s.I2CMux != "") {
+		return errors.New("sensor: use either spi_id or i2c_id / i2c_mux")
+	}
+	if len(s.Pins) > 16 {
+		return errors.New("sensor: use up to 16 pins")
+	}
+	for i := range s.Pins {
+		if err := s.Pins[i].validate(); err != nil {
+			return fmt.Errorf("sensor / pins: %w", err)
+		}
+	}
+	return s.Pin.validate()
+}
+
+// bme280Location describes where the bme280 chip is connected.
+func (s *Sensor) bme280Location() string {
+	if s.Address == 0 {
+		return fmt.Sprintf("on spi_id %q", s.SPIID)
+	}
+	if s.I2CMux != "" {
+		return fmt.Sprintf("at 0x%02x on i2c_mux %q channel %d", s.Address, s.I2CMux, s.I2CMuxChannel)
+	}
+	return fmt.Sprintf("at 0x%02x on i2c_id %q", s.Address, s.I2CID)
+}
+
+// SensorParams defines a sensor parameter.
+type SensorParams struct {
+	Name string
+	// CalibrateLinear maps the measured values to the actual values.
+	CalibrateLinear []CalibrationPoint `yaml:"calibrate_linear"`
+	// UnitOfMeasurement, AccuracyDecimals, DeviceClass and StateClass override
+	// the platform's defaults. See Sensor.StateClass for the default state
+	// classes.
+	UnitOfMeasurement string `yaml:"unit_of_measurement"`
+	AccuracyDecimals  *int   `yaml:"accuracy_decimals"`
+	DeviceClass       string `yaml:"device_class"`
+	StateClass        string `yaml:"state_class"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (s *SensorParams) validate() error {
+	if err := validateCalibration(s.CalibrateLinear); err != nil {
+		return err
+	}
+	if err := validateAccuracy(s.AccuracyDecimals); err != nil {
+		return err
+	}
+	return validateStateClass(s.StateClass)
+}
+
+// validateStateClass validates "state_class".
+//
+// "total" is not supported by the ESPHome API version implemented here.
+func validateStateClass(c string) error {
+	switch c {
+	case "", "measurement", "total_increasing", "none":
+		return nil
+	default:
+		return fmt.Errorf("invalid state_class %q; use measurement, total_increasing or none", c)
+	}
+}
+
+// validateAccuracy validates "accuracy_decimals".
+func validateAccuracy(a *int) error {
+	if a != nil && (*a < 0 || *a > 9) {
+		return errors.New("accuracy_decimals must be between 0 and 9")
+	}
+	return nil
+}
+
+// ADCChannel is an element of "channels".
+type ADCChannel struct {
+	SensorParams `yaml:",inline"`
+	// Multiplexer selects the input, either single ended like "A0_GND" or
+	// differential like "A0_A1". The supported differential pairs are A0_A1,
+	// A0_A3, A1_A3 and A2_A3.
+	Multiplexer string
+	// Gain overrides the sensor's gain for this channel.
+	Gain float64
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (a *ADCChannel) validate() error {
+	if a.Name == "" {
+		return errors.New("name is required")
+	}
+	switch a.Multiplexer {
+	case "A0_GND", "A1_GND", "A2_GND", "A3_GND", "A0_A1", "A0_A3", "A1_A3", "A2_A3":
+	default:
+		return fmt.Errorf("invalid multiplexer %q", a.Multiplexer)
+	}
+	if a.Gain != 0 && !validADCGain(a.Gain) {
+		return fmt.Errorf("invalid gain %g", a.Gain)
+	}
+	return a.SensorParams.validate()
+}
+
+// validADCGain returns true if g is a full scale range supported by the
+// ADS1115.
+func validADCGain(g float64) bool {
+	switch g {
+	case 6.144, 4.096, 2.048, 1.024, 0.512, 0.256:
+		return true
+	default:
+		return false
+	}
+}
+
+// CalibrationPoint is an element of "calibrate_linear".
+//
+// In yaml, it is written as "<measured> -> <actual>", like ESPHome.
+type CalibrationPoint struct {
+	Measured float64
+	Actual   float64
+
+	_ struct{}
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *CalibrationPoint) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	i := strings.Index(s, "->")
+	if i == -1 {
+		return fmt.Errorf("invalid calibration point %q; use \"<measured> -> <actual>\"", s)
+	}
+	var err error
+	if c.Measured, err = strconv.ParseFloat(strings.TrimSpace(s[:i]), 64); err != nil {
+		return fmt.Errorf("invalid calibration point %q: %w", s, err)
+	}
+	if c.Actual, err = strconv.ParseFloat(strings.TrimSpace(s[i+2:]), 64); err != nil {
+		return fmt.Errorf("invalid calibration point %q: %w", s, err)
+	}
+	return nil
+}
+
+// validateCalibration validates a "calibrate_linear" list.
+func validateCalibration(p []CalibrationPoint) error {
+	if len(p) == 1 {
+		return errors.New("calibrate_linear requires at least two points")
+	}
+	for i := 1; i < len(p); i++ {
+		if p[i].Measured <= p[i-1].Measured {
+			return errors.New("calibrate_linear measured values must be strictly increasing")
+		}
+	}
+	return nil
+}
+
+// Switch is an element in the "switch" section.
+type Switch struct {
+	Platform string
+	Name     string
+	// Pin is the output pin. Used by "gpio".
+	Pin Pin
+	// Pulse makes the switch momentary: turning it on drives the pin for this
+	// duration, then turns it back off, e.g. to trigger a gate or a doorbell.
+	// Used by "gpio".
+	Pulse time.Duration
+	// OnShutdown is run when the node is shutting down, before the pin is
+	// released, e.g. to close a valve.
+	OnShutdown []Action `yaml:"on_shutdown"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (s *Switch) validate() error {
+	if s.Platform == "" {
+		return errors.New("switch: platform is required")
+	}
+	if s.Name == "" {
+		return errors.New("switch: name is required")
+	}
+	if err := s.Pin.validate(); err != nil {
+		return fmt.Errorf("switch: %w", err)
+	}
+	switch s.Pin.Mode {
+	case "", Output, OutputOpenDrain:
+	default:
+		return fmt.Errorf("switch: pin mode must be %s or %s, got %s", Output, OutputOpenDrain, s.Pin.Mode)
+	}
+	if s.Pulse < 0 {
+		return errors.New("switch: invalid pulse")
+	}
+	return nil
+}
+
+// Fan is an element in the "fan" section.
+type Fan struct {
+	Platform string
+	Name     string
+	// Output is the ID of the output driving the fan. Used by "pwm", where it
+	// must be a "pwm" output.
+	Output string
+	// SpeedCount is the number of speed levels exposed to Home Assistant, up to
+	// 100. The duty cycle is proportional to the level.
+	//
+	// Defaults to 100.
+	SpeedCount int `yaml:"speed_count"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (f *Fan) validate() error {
+	if f.Platform == "" {
+		return errors.New("fan: platform is required")
+	}
+	if f.Name == "" {
+		return errors.New("fan: name is required")
+	}
+	if f.Output == "" {
+		return errors.New("fan: output is required")
+	}
+	if f.SpeedCount < 0 || f.SpeedCount > 100 {
+		return errors.New("fan: speed_count must be between 1 and 100")
+	}
+	return nil
+}
+
+// Button is an element in the "button" section.
+type Button struct {
+	Platform string
+	Name     string
+	Icon     string
+	// DeviceClass is one of "identify", "restart" or "update".
+	//
+	// Defaults to none.
+	DeviceClass string `yaml:"device_class"`
+	// Command is run by /bin/sh when the button is pressed. Used by
+	// "template".
+	Command string
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (b *Button) validate() error {
+	if b.Platform == "" {
+		return errors.New("button: platform is required")
+	}
+	if b.Name == "" {
+		return errors.New("button: name is required")
+	}
+	switch b.DeviceClass {
+	case "", "identify", "restart", "update":
+	default:
+		return fmt.Errorf("button: invalid device_class %q", b.DeviceClass)
+	}
+	return nil
+}
+
+// Number is an element in the "number" section.
+type Number struct {
+	Platform          string
+	Name              string
+	Icon              string
+	UnitOfMeasurement string `yaml:"unit_of_measurement"`
+	// MinValue, MaxValue and Step define the values that can be set.
+	//
+	// Step defaults to 1.
+	MinValue float64 `yaml:"min_value"`
+	MaxValue float64 `yaml:"max_value"`
+	Step     float64
+	// InitialValue is the value on startup.
+	//
+	// Defaults to MinValue.
+	InitialValue *float64 `yaml:"initial_value"`
+	// Mode is how Home Assistant shows it, one of "auto", "box" or "slider".
+	//
+	// Defaults to "auto".
+	Mode string
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (n *Number) validate() error {
+	if n.Platform == "" {
+		return errors.New("number: platform is required")
+	}
+	if n.Name == "" {
+		return errors.New("number: name is required")
+	}
+	if n.MinValue >= n.MaxValue {
+		return errors.New("number: min_value must be lower than max_value")
+	}
+	if n.Step < 0 {
+		return errors.New("number: invalid step")
+	}
+	if v := n.InitialValue; v != nil && (*v < n.MinValue || *v > n.MaxValue) {
+		return errors.New("number: initial_value must be between min_value and max_value")
+	}
+	switch n.Mode {
+	case "", "auto", "box", "slider":
+	default:
+		return fmt.Errorf("number: invalid mode %q", n.Mode)
+	}
+	return nil
+}
+
+// Climate is an element in the "climate" section.
+type Climate struct {
+	Platform string
+	Name     string
+	// Sensor is the name of the sensor entity reporting the current
+	// temperature in °C. Used by "thermostat".
+	Sensor string
+	// EntityID is the Home Assistant entity reporting the current temperature
+	// in °C, e.g. "sensor.living_room_temperature", instead of Sensor. Used by
+	// "thermostat".
+	EntityID string `yaml:"entity_id"`
+	// Heater is the name of the switch entity driving the heater. Used by
+	// "thermostat".
+	Heater string
+	// TargetTemperature is the initial target temperature in °C.
+	//
+	// Defaults to 20.
+	TargetTemperature float64 `yaml:"target_temperature"`
+	// Hysteresis is how far the temperature may drift from the target before
+	// the heater is toggled, to avoid relay chatter. The heater is turned on
+	// below the target minus hysteresis and off above the target plus
+	// hysteresis.
+	//
+	// Defaults to 0.5.
+	Hysteresis float64
+	// MinTemperature and MaxTemperature bound the target temperature.
+	//
+	// Default to 10 and 30.
+	MinTemperature float64 `yaml:"min_temperature"`
+	MaxTemperature float64 `yaml:"max_temperature"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (c *Climate) validate() error {
+	if c.Platform == "" {
+		return errors.New("climate: platform is required")
+	}
+	if c.Name == "" {
+		return errors.New("climate: name is required")
+	}
+	if c.Sensor != "" && c.EntityID != "" {
+		return errors.New("climate: use either sensor or entity_id")
+	}
+	if c.Hysteresis < 0 {
+		return errors.New("climate: invalid hysteresis")
+	}
+	if c.MinTemperature != 0 && c.MaxTemperature != 0 && c.MinTemperature >= c.MaxTemperature {
+		return errors.New("climate: min_temperature must be lower than max_temperature")
+	}
+	return nil
+}
+
+// Cover is an element in the "cover" section.
+type Cover struct {
+	Platform    string
+	Name        string
+	DeviceClass string `yaml:"device_class"`
+	// OpenPin and ClosePin drive the motor, e.g. via two relays. Used by
+	// "gpio".
+	OpenPin  Pin `yaml:"open_pin"`
+	ClosePin Pin `yaml:"close_pin"`
+	// OpenDuration is the time to go from fully closed to fully open. It is
+	// used to estimate the position. Used by "gpio", where it is required.
+	OpenDuration time.Duration `yaml:"open_duration"`
+	// CloseDuration is the time to go from fully open to fully closed.
+	//
+	// Defaults to OpenDuration.
+	CloseDuration time.Duration `yaml:"close_duration"`
+	// OnShutdown is run when the node is shutting down, before the pins are
+	// released.
+	OnShutdown []Action `yaml:"on_shutdown"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (c *Cover) validate() error {
+	if c.Platform == "" {
+		return errors.New("cover: platform is required")
+	}
+	if c.Name == "" {
+		return errors.New("cover: name is required")
+	}
+	if err := c.OpenPin.validate(); err != nil {
+		return fmt.Errorf("cover / open_pin: %w", err)
+	}
+	if err := c.ClosePin.validate(); err != nil {
+		return fmt.Errorf("cover / close_pin: %w", err)
+	}
+	if c.OpenDuration < 0 {
+		return errors.New("cover: invalid open_duration")
+	}
+	if c.CloseDuration < 0 {
+		return errors.New("cover: invalid close_duration")
+	}
+	return nil
+}
+
+// TextSensor is an element in the "text_sensor" section.
+type TextSensor struct {
+	Platform string
+	Name     string
+	Icon     string
+	// Command is run by /bin/sh and its trimmed output is the state. Used by
+	// "template". Exclusive with File.
+	Command string
+	// File is read and its trimmed content is the state. Used by "template".
+	// Exclusive with Command.
+	File string
+	// UpdateInterval defaults to 60s. Used by "template".
+	UpdateInterval time.Duration `yaml:"update_interval"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (t *TextSensor) validate() error {
+	if t.Platform == "" {
+		return errors.New("text_sensor: platform is required")
+	}
+	if t.Name == "" {
+		return errors.New("text_sensor: name is required")
+	}
+	if t.Command != "" && t.File != "" {
+		return errors.New("text_sensor: use only one of command / file")
+	}
+	if t.UpdateInterval < 0 {
+		return errors.New("text_sensor: invalid update_interval")
+	}
+	return nil
+}
+
+// Light is an element in the "light" section.
+type Light struct {
+	Platform string
+	Name     string
+	// NumLEDs is the number of LEDs of the strip. Used by "apa102" and
+	// "neopixel", where it is required.
+	NumLEDs int `yaml:"num_leds"`
+	// Output is the ID of the output driving the light. Used by
+	// "monochromatic".
+	Output string
+	// Pin is the data pin. Used by "neopixel" and its alias "ws2812" on a
+	// Raspberry Pi, where only GPIO21 can be clocked by DMA fast enough. When
+	// unset, the SPI port is used.
+	Pin string
+	// Lights are the names of the lights controlled together. They must be
+	// defined before. Used by "group".
+	Lights []string
+	// OnShutdown is run when the node is shutting down, before the light is
+	// released, e.g. to turn it off.
+	OnShutdown []Action `yaml:"on_shutdown"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (l *Light) validate() error {
+	if l.Platform == "" {
+		return errors.New("light: platform is required")
+	}
+	if l.Name == "" {
+		return errors.New("light: name is required")
+	}
+	if l.NumLEDs < 0 || l.NumLEDs > 1000000 {
+		return errors.New("light: num_leds is required")
+	}
+	return nil
+}
+
+// Camera is an element in the "camera" section.
+type Camera struct {
+	Platform string
+	Name     string
+	// Directory is where the frames are recorded. "fake" saves a snapshot per
+	// frame. "raspivid" records H.264 mpegts segments listed in an index.m3u8
+	// HLS playlist via ffmpeg, so the directory can be served as-is to browse
+	// the history. The playlist lists the segments kept by max_files and
+	// max_age, or the last day when neither is set. Not supported by "v4l2".
+	Directory string
+	Rotation  int
+	// Width and Height are the size of the frames, before the rotation. Both
+	// must be set, up to 1920x1080.
+	//
+	// Defaults to 320x240 for "fake", 1280x720 for "raspivid" and 640x480 for
+	// "v4l2". It is recommended to use 720p or lower as it improves low light
+	// recording.
+	Width  int
+	Height int
+	// FPS is the number of frames per second, up to 30.
+	//
+	// Defaults to 1.
+	FPS int `yaml:"fps"`
+	// Quality is the JPEG quality, between 1 and 100.
+	//
+	// Defaults to 90 for "fake" and 60 otherwise.
+	Quality int
+	// MaxDiskUsage is the quota for Directory. When exceeded, the oldest
+	// recordings are deleted.
+	//
+	// Defaults to no limit.
+	MaxDiskUsage DiskUsage `yaml:"max_disk_usage"`
+	// MaxFiles is the number of recordings to keep in Directory. When
+	// exceeded, the oldest recordings are deleted.
+	//
+	// Defaults to no limit.
+	MaxFiles int `yaml:"max_files"`
+	// MaxAge is the age of the recordings to keep in Directory. Older
+	// recordings are deleted.
+	//
+	// Defaults to no limit.
+	MaxAge time.Duration `yaml:"max_age"`
+	// SnapshotFormat is the image format used to save frames in Directory,
+	// either "jpeg" or "png". Streamed frames are always JPEG as it is what
+	// the ESPHome protocol expects.
+	//
+	// Defaults to "jpeg".
+	SnapshotFormat string `yaml:"snapshot_format"`
+	// RTSPPort enables serving the camera frames as an H.264 RTSP stream at
+	// rtsp://<host>:<port>/stream, for NVRs like Frigate or Blue Iris. It
+	// requires ffmpeg to be installed: sudo apt install ffmpeg
+	//
+	// Only one RTSP client can be connected at a time. Defaults to disabled.
+	RTSPPort int `yaml:"rtsp_port"`
+	// AlwaysOn keeps capturing frames even when no client is viewing the
+	// camera. Otherwise the capture is paused after a while without client and
+	// resumed on the next request.
+	//
+	// It is implied when Directory is set, to record continuously.
+	AlwaysOn bool `yaml:"always_on"`
+	// DeliveredFPS adds a diagnostic sensor reporting the rate of frames
+	// actually sent to the API clients. Frames are skipped when a client
+	// cannot keep up, e.g. on a congested WiFi.
+	DeliveredFPS SensorParams `yaml:"delivered_fps"`
+	// WebToken, if set, is required to stream the camera from the web server
+	// at /api/camera/<object_id>/stream, either as a "Authorization: Bearer"
+	// header or as the "token" query parameter. It is also required to browse
+	// the recordings at /history/<object_id>/ when web_server.history is set.
+	WebToken string `yaml:"web_token"`
+	// Exposure, AWB and Flicker are the raspivid exposure mode, automatic white
+	// balance mode and flicker avoidance mode. Used by "raspivid".
+	//
+	// Default to "auto", "auto" and "off".
+	Exposure string
+	AWB      string `yaml:"awb"`
+	Flicker  string
+	// ISO is the sensor sensitivity, between 100 and 800. Used by "raspivid".
+	//
+	// Defaults to automatic.
+	ISO int `yaml:"iso"`
+	// Shutter is the exposure time, up to 6s. Used by "raspivid".
+	//
+	// Defaults to automatic.
+	Shutter time.Duration
+	// Timestamp is the time burned in each frame.
+	Timestamp CameraTimestamp
+	// Device is the video capture device, e.g. a USB webcam. Used by "v4l2",
+	// which requires ffmpeg.
+	//
+	// Defaults to "/dev/video0".
+	Device string
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (c *Camera) validate() error {
+	if c.Platform == "" {
+		return errors.New("camera: platform is required")
+	}
+	if c.Name == "" {
+		return errors.New("camera: name is required")
+	}
+	if c.Directory != "" {
+		if !filepath.IsAbs(c.Directory) {
+			// Save the user trouble since when started via systemd the working
+			// directory will not match.
+			return errors.New("camera: directory must be absolute path")
+		}
+	}
+	switch c.Rotation {
+	case 0, 90, 180, 270:
+	default:
+		return errors.New("camera: invalid rotation")
+	}
+	if (c.Width == 0) != (c.Height == 0) {
+		return errors.New("camera: width and height must be set together")
+	}
+	if c.Width < 0 || c.Width > 1920 || c.Height < 0 || c.Height > 1080 {
+		return errors.New("camera: width and height must be up to 1920x1080")
+	}
+	if c.FPS < 0 || c.FPS > 30 {
+		return errors.New("camera: fps must be between 1 and 30")
+	}
+	if c.Quality < 0 || c.Quality > 100 {
+		return errors.New("camera: quality must be between 1 and 100")
+	}
+	if c.MaxDiskUsage.IsSet() && c.Directory == "" {
+		return errors.New("camera: max_disk_usage requires directory")
+	}
+	if c.MaxFiles < 0 {
+		return errors.New("camera: invalid max_files")
+	}
+	if c.MaxAge < 0 {
+		return errors.New("camera: invalid max_age")
+	}
+	if (c.MaxFiles != 0 || c.MaxAge != 0) && c.Directory == "" {
+		return errors.New("camera: max_files and max_age require directory")
+	}
+	switch c.SnapshotFormat {
+	case "", "jpeg", "png":
+	default:
+		return errors.New("camera: snapshot_format must be jpeg or png")
+	}
+	if c.SnapshotFormat != "" && c.Directory == "" {
+		return errors.New("camera: snapshot_format requires directory")
+	}
+	if c.RTSPPort < 0 || c.RTSPPort >= 65536 {
+		return errors.New("camera: rtsp_port is invalid")
+	}
+	if err := c.DeliveredFPS.validate(); err != nil {
+		return fmt.Errorf("camera: delivered_fps: %w", err)
+	}
+	switch c.Exposure {
+	case "", "off", "auto", "night", "nightpreview", "backlight", "spotlight", "sports", "snow", "beach", "verylong", "fixedfps", "antishake", "fireworks":
+	default:
+		return fmt.Errorf("camera: invalid exposure %q", c.Exposure)
+	}
+	switch c.AWB {
+	case "", "off", "auto", "sun", "cloud", "shade", "tungsten", "fluorescent", "incandescent", "flash", "horizon", "greyworld":
+	default:
+		return fmt.Errorf("camera: invalid awb %q", c.AWB)
+	}
+	switch c.Flicker {
+	case "", "off", "auto", "50hz", "60hz":
+	default:
+		return fmt.Errorf("camera: invalid flicker %q", c.Flicker)
+	}
+	if c.ISO != 0 && (c.ISO < 100 || c.ISO > 800) {
+		return errors.New("camera: iso must be between 100 and 800")
+	}
+	if c.Shutter < 0 || c.Shutter > 6*time.Second {
+		return errors.New("camera: shutter must be up to 6s")
+	}
+	if err := c.Timestamp.validate(); err != nil {
+		return fmt.Errorf("camera / timestamp: %w", err)
+	}
+	if c.Device != "" && !filepath.IsAbs(c.Device) {
+		return errors.New("camera: device must be absolute path")
+	}
+	return nil
+}
+
+// CameraTimestamp is the "timestamp" section of a camera.
+type CameraTimestamp struct {
+	// Enabled can be set to false to not add the time to the frames.
+	//
+	// Defaults to true.
+	Enabled *bool
+	// Position is one of "top_left", "top_right", "bottom_left" or
+	// "bottom_right".
+	//
+	// Defaults to "top_right".
+	Position string
+	// Format is a strftime-like format. The supported conversions are %Y, %y,
+	// %m, %d, %e, %H, %I, %M, %S, %p, %b, %B, %a, %A, %j, %Z, %z and %%.
+	//
+	// Defaults to "%Y-%m-%d %H:%M:%S".
+	Format string
+	// FontScale is the size multiplier of the 7x13 pixels font, up to 16.
+	//
+	// Defaults to 1 per 640 pixels of frame width.
+	FontScale int `yaml:"font_scale"`
+	// Color is the text color as "#rrggbb".
+	//
+	// Defaults to the platform's color.
+	Color string
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (c *CameraTimestamp) validate() error {
+	switch c.Position {
+	case "", "top_left", "top_right", "bottom_left", "bottom_right":
+	default:
+		return fmt.Errorf("invalid position %q", c.Position)
+	}
+	for i := 0; i < len(c.Format); i++ {
+		if c.Format[i] != '%' {
+			continue
+		}
+		i++
+		if i == len(c.Format) {
+			return errors.New("format ends with %")
+		}
+		if !strings.ContainsRune("YymdeHIMSpbBaAjZz%", rune(c.Format[i])) {
+			return fmt.Errorf("unsupported %%%c in format", c.Format[i])
+		}
+	}
+	if c.FontScale < 0 || c.FontScale > 16 {
+		return errors.New("font_scale must be between 1 and 16")
+	}
+	if c.Color != "" {
+		if len(c.Color) != 7 || c.Color[0] != '#' {
+			return fmt.Errorf("invalid color %q; use #rrggbb", c.Color)
+		}
+		if _, err := strconv.ParseUint(c.Color[1:], 16, 32); err != nil {
+			return fmt.Errorf("invalid color %q; use #rrggbb", c.Color)
+		}
+	}
+	return nil
+}
+
+// DiskUsage is a disk quota, either in bytes or as a percentage of the size of
+// the file system.
+//
+// In yaml, it is either a number of bytes with an optional "KiB", "MiB",
+// "GiB" or "TiB" suffix, or a percentage like "80%".
+type DiskUsage struct {
+	Bytes   int64
+	Percent float64
+
+	_ struct{}
+}
+
+// IsSet returns true if a quota is specified.
+func (d *DiskUsage) IsSet() bool {
+	return d.Bytes != 0 || d.Percent != 0
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *DiskUsage) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s[:len(s)-1]), 64)
+		if err != nil || v <= 0 || v > 100 {
+			return fmt.Errorf("invalid disk usage %q", s)
+		}
+		d.Percent = v
+		return nil
+	}
+	mul := int64(1)
+	for i, suffix := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		if strings.HasSuffix(s, suffix) {
+			mul = 1 << (10 * uint(i+1))
+			s = strings.TrimSpace(s[:len(s)-len(suffix)])
+			break
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v <= 0 || v > math.MaxInt64/mul {
+		return fmt.Errorf("invalid disk usage %q", s)
+	}
+	d.Bytes = v * mul
+	return nil
+}
+
+// Display is an element in the "display" section.
+type Display struct {
+	Platform string
+	// Model is the exact controller model, e.g. "ssd1306" or "ssd1309".
+	Model string
+	// Address is the I²C address. When 0, the display is connected via SPI.
+	Address int
+	// DCPin is the data/command pin, only used when connected via SPI.
+	DCPin          string `yaml:"dc_pin"`
+	Width          int
+	Height         int
+	UpdateInterval time.Duration `yaml:"update_interval"`
+	// Entities is the list of entity names to show on the display, one per
+	// line.
+	Entities []string
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (d *Display) validate() error {
+	if d.Platform == "" {
+		return errors.New("display: platform is required")
+	}
+	if d.Width < 0 || d.Height < 0 {
+		return errors.New("display: invalid size")
+	}
+	if d.UpdateInterval < 0 {
+		return errors.New("display: invalid update_interval")
+	}
+	if len(d.Entities) == 0 {
+		return errors.New("display: specify at least one entity")
+	}
+	for _, e := range d.Entities {
+		if e == "" {
+			return errors.New("display: entity name is empty")
+		}
+	}
+	return nil
+}
+
+// Time is an element in the "time" section.
+//
+// It is the source of time returned to clients, instead of the system clock.
+type Time struct {
+	Platform string
+	// Address is the I²C address. Defaults to the device's default address.
+	Address int
+	// SetSystemTime sets the system clock from the time source at startup,
+	// or upon each synchronization with "homeassistant". This requires the
+	// process to run as root.
+	SetSystemTime bool `yaml:"set_system_time"`
+	// UpdateInterval is the interval to request the time from the clients.
+	// Used by "homeassistant".
+	//
+	// Defaults to 15 minutes.
+	UpdateInterval time.Duration `yaml:"update_interval"`
+
+	_ struct{}
+}
+
+// validate validates the configuration.
+func (t *Time) validate() error {
+	if t.Platform == "" {
+		return errors.New("time: platform is required")
+	}
+	if t.Address < 0 || t.Address > 0x7F {
+		return errors.New("time: invalid address")
+	}
+	if t.UpdateInterval < 0 {
+		return errors.New("time: invalid update_interval")
 	}
 	return nil
 }
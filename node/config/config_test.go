@@ -10,25 +10,63 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v2"
 )
 
 const sampleConf = `
 periphhome:
   name: pi
   comment: pi device
+  state_dir: /var/lib/periphhome
+  availability_grace: 5m
+  name_prefix: Living Room
+  continue_on_error: true
+  suggested_area: Living Room
+  on_boot:
+    - light.turn_on:
+        name: "Desk lamp"
+        brightness: 0.5
+    - delay: 1s
+    - output.pulse:
+        id: desk_pwm
+        duration: 500ms
 
 api:
   port: 6053
   password: "Foo"
+  allowed_clients:
+    - 192.168.1.10
+    - 10.0.0.0/8
+  read_timeout: 10s
+  write_timeout: 20s
+
+web_server:
+  port: 8080
+  history: true
+
+output:
+  - platform: pwm
+    id: desk_pwm
+    frequency: 500
+    pin:
+      number: GPIO18
 
 binary_sensor:
   - platform: gpio
     name: "Motion sensor"
     device_class: motion
+    hold_time: 30s
     pin:
       number: GPIO17
       inverted: true
       mode: INPUT_PULLUP
+  - platform: combine
+    name: "Any motion"
+    device_class: motion
+    operator: or
+    sensors:
+      - "Motion sensor"
+      - "Motion sensor"
 
 sensor:
   - platform: bme280
@@ -36,6 +74,9 @@ sensor:
     update_interval: 60s
     temperature:
       name: "Temperature"
+      calibrate_linear:
+        - 0.0 -> 0.5
+        - 30 -> 28.5
     pressure:
       name: "Pressure"
     humidity:
@@ -43,57 +84,213 @@ sensor:
   - platform: wifi_signal
     name: "Foo Wifi Signal"
     update_interval: 60s
+    unit_of_measurement: dBm
+    accuracy_decimals: 0
+    device_class: signal_strength
+  - platform: boot_count
+    name: "Boot count"
+  - platform: bh1750
+    name: "Illuminance"
+    i2c_id: "1"
+    address: 0x5c
+    resolution: 0.5
+    update_interval: 30s
+  - platform: ads1115
+    address: 0x49
+    update_interval: 10s
+    data_rate: 250
+    channels:
+      - name: "Battery"
+        multiplexer: A0_GND
+        gain: 6.144
+      - name: "Shunt"
+        multiplexer: A2_A3
+        gain: 0.256
+  - platform: dht
+    model: dht11
+    retry: 3
+    update_interval: 60s
+    pin:
+      number: GPIO4
+      mode: INPUT_PULLUP
+    temperature:
+      name: "Garage Temperature"
+    humidity:
+      name: "Garage Humidity"
+  - platform: go_runtime
+    update_interval: 5m
+    goroutines:
+      name: "Goroutines"
+    heap_alloc:
+      name: "Heap"
+
+text_sensor:
+  - platform: boot_reason
+    name: "Boot reason"
+  - platform: config_status
+    name: "Config status"
 
 light:
   - platform: apa102
     name: "Bright lights"
     num_leds: 150
+  - platform: monochromatic
+    name: "Desk lamp"
+    output: desk_pwm
 
 camera:
   - platform: fake
     name: "Fake Camera"
+    directory: /var/lib/periphhome/camera
+    max_disk_usage: 2GiB
+    snapshot_format: png
+    rtsp_port: 8554
+    always_on: true
+
+display:
+  - platform: ssd1306
+    address: 0x3c
+    update_interval: 10s
+    entities:
+      - "Temperature"
+      - "Motion sensor"
+
+time:
+  - platform: ds3231
+    set_system_time: true
 `
 
 func TestRootLoadYaml(t *testing.T) {
+	half := 0.5
 	got := Root{}
 	if err := got.LoadYaml([]byte(sampleConf)); err != nil {
 		t.Fatal(err)
 	}
 	want := Root{
 		PeriphHome: PeriphHome{
-			Name:    "pi",
-			Comment: "pi device",
+			Name:              "pi",
+			Comment:           "pi device",
+			StateDir:          "/var/lib/periphhome",
+			AvailabilityGrace: 5 * time.Minute,
+			NamePrefix:        "Living Room",
+			OnBoot: []Action{
+				{LightTurnOn: &LightAction{Name: "Desk lamp", Brightness: &half}},
+				{Delay: time.Second},
+				{OutputPulse: &OutputAction{ID: "desk_pwm", Duration: 500 * time.Millisecond}},
+			},
+			ContinueOnError: true,
+			SuggestedArea:   "Living Room",
 		},
 		API: API{
-			Port:      6053,
+			Port:           6053,
+			IsPresent:      true,
+			Password:       "Foo",
+			AllowedClients: []string{"192.168.1.10", "10.0.0.0/8"},
+			ReadTimeout:    10 * time.Second,
+			WriteTimeout:   20 * time.Second,
+		},
+		WebServer: WebServer{
+			Port:      8080,
+			History:   true,
 			IsPresent: true,
-			Password:  "Foo",
+		},
+		Outputs: []OutputPin{
+			{
+				Platform:  "pwm",
+				ID:        "desk_pwm",
+				Pin:       Pin{Number: "GPIO18"},
+				Frequency: 500,
+			},
 		},
 		BinarySensors: []BinarySensor{
 			{
 				Platform:    "gpio",
 				Name:        "Motion sensor",
 				DeviceClass: "motion",
+				HoldTime:    30 * time.Second,
 				Pin: Pin{
 					Number:   "GPIO17",
 					Inverted: true,
 					Mode:     "INPUT_PULLUP",
 				},
 			},
+			{
+				Platform:    "combine",
+				Name:        "Any motion",
+				DeviceClass: "motion",
+				Operator:    "or",
+				Sensors:     []string{"Motion sensor", "Motion sensor"},
+			},
 		},
 		Sensors: []Sensor{
 			{
-				Platform:       "bme280",
-				Temperature:    SensorParams{Name: "Temperature"},
+				Platform: "bme280",
+				Temperature: SensorParams{
+					Name: "Temperature",
+					CalibrateLinear: []CalibrationPoint{
+						{Measured: 0, Actual: 0.5},
+						{Measured: 30, Actual: 28.5},
+					},
+				},
 				Pressure:       SensorParams{Name: "Pressure"},
 				Humidity:       SensorParams{Name: "Humidity"},
 				Address:        0x76,
 				UpdateInterval: time.Minute,
 			},
 			{
-				Platform:       "wifi_signal",
-				Name:           "Foo Wifi Signal",
-				UpdateInterval: time.Minute,
+				Platform:          "wifi_signal",
+				Name:              "Foo Wifi Signal",
+				UpdateInterval:    time.Minute,
+				UnitOfMeasurement: "dBm",
+				AccuracyDecimals:  new(int),
+				DeviceClass:       "signal_strength",
+			},
+			{
+				Platform: "boot_count",
+				Name:     "Boot count",
+			},
+			{
+				Platform:       "bh1750",
+				Name:           "Illuminance",
+				I2CID:          "1",
+				Address:        0x5c,
+				Resolution:     0.5,
+				UpdateInterval: 30 * time.Second,
+			},
+			{
+				Platform:       "ads1115",
+				Address:        0x49,
+				UpdateInterval: 10 * time.Second,
+				DataRate:       250,
+				Channels: []ADCChannel{
+					{SensorParams: SensorParams{Name: "Battery"}, Multiplexer: "A0_GND", Gain: 6.144},
+					{SensorParams: SensorParams{Name: "Shunt"}, Multiplexer: "A2_A3", Gain: 0.256},
+				},
+			},
+			{
+				Platform:       "dht",
+				Temperature:    SensorParams{Name: "Garage Temperature"},
+				Humidity:       SensorParams{Name: "Garage Humidity"},
+				UpdateInterval: 60 * time.Second,
+				Pin:            Pin{Number: "GPIO4", Mode: InputPullup},
+				Model:          "dht11",
+				Retry:          3,
+			},
+			{
+				Platform:       "go_runtime",
+				Goroutines:     SensorParams{Name: "Goroutines"},
+				HeapAlloc:      SensorParams{Name: "Heap"},
+				UpdateInterval: 5 * time.Minute,
+			},
+		},
+		TextSensors: []TextSensor{
+			{
+				Platform: "boot_reason",
+				Name:     "Boot reason",
+			},
+			{
+				Platform: "config_status",
+				Name:     "Config status",
 			},
 		},
 		Lights: []Light{
@@ -102,15 +299,39 @@ func TestRootLoadYaml(t *testing.T) {
 				Name:     "Bright lights",
 				NumLEDs:  150,
 			},
+			{
+				Platform: "monochromatic",
+				Name:     "Desk lamp",
+				Output:   "desk_pwm",
+			},
 		},
 		Cameras: []Camera{
 			{
-				Platform: "fake",
-				Name:     "Fake Camera",
+				Platform:       "fake",
+				Name:           "Fake Camera",
+				Directory:      "/var/lib/periphhome/camera",
+				MaxDiskUsage:   DiskUsage{Bytes: 2 << 30},
+				SnapshotFormat: "png",
+				RTSPPort:       8554,
+				AlwaysOn:       true,
+			},
+		},
+		Displays: []Display{
+			{
+				Platform:       "ssd1306",
+				Address:        0x3c,
+				UpdateInterval: 10 * time.Second,
+				Entities:       []string{"Temperature", "Motion sensor"},
+			},
+		},
+		Times: []Time{
+			{
+				Platform:      "ds3231",
+				SetSystemTime: true,
 			},
 		},
 	}
-	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(API{})); diff != "" {
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(API{}, WebServer{})); diff != "" {
 		t.Errorf("Root mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -132,7 +353,7 @@ func TestRootLoadYaml_Minimal(t *testing.T) {
 		t.Fatal(err)
 	}
 	want := Root{}
-	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(API{})); diff != "" {
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(API{}, WebServer{})); diff != "" {
 		t.Errorf("Root mismatch (-want +got):\n%s", diff)
 	}
 	if got.API.IsPresent {
@@ -140,6 +361,451 @@ func TestRootLoadYaml_Minimal(t *testing.T) {
 	}
 }
 
+func TestRootValidatePins(t *testing.T) {
+	y := "periphhome:\n  name: pi\n" +
+		"binary_sensor:\n  - platform: gpio\n    name: Door\n    pin:\n      number: GPI017\n" +
+		"sensor:\n  - platform: adc\n    name: Level\n    pin:\n      number: A0\n" +
+		"  - platform: ultrasonic\n    name: Distance\n    trigger_pin:\n      number: GPIO5\n    echo_pin:\n      number: GPIO6\n" +
+		"switch:\n  - platform: gpio\n    name: Relay\n    pin:\n      number: GPIO18\n"
+	r := Root{}
+	if err := r.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	known := map[string]bool{"GPIO5": true, "GPIO17": true}
+	err := r.ValidatePins(func(name string) bool { return known[name] })
+	want := `unknown pins: "GPI017" (binary_sensor "Door"), "GPIO6" (sensor "Distance"), "GPIO18" (switch "Relay")`
+	if err == nil || err.Error() != want {
+		t.Fatalf("got %v; want %s", err, want)
+	}
+	known["GPI017"], known["GPIO6"], known["GPIO18"] = true, true, true
+	if err = r.ValidatePins(func(name string) bool { return known[name] }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSafeMode(t *testing.T) {
+	// The sensor is invalid but the name and api section are kept.
+	in := "periphhome:\n  name: node\napi:\n  port: 1234\n  password: secret\nsensor:\n- platform: 1\n  unexpected: true\n"
+	got := Root{}
+	if err := got.LoadYaml([]byte(in)); err == nil {
+		t.Fatal("expected error")
+	}
+	got = SafeMode([]byte(in))
+	want := Root{
+		PeriphHome: PeriphHome{Name: "node"},
+		API:        API{Port: 1234, Password: "secret", IsPresent: true},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(API{}, WebServer{})); diff != "" {
+		t.Errorf("Root mismatch (-want +got):\n%s", diff)
+	}
+
+	// Not even yaml.
+	if got = SafeMode([]byte("\t:")); !got.API.IsPresent || got.API.Port != 0 {
+		t.Fatalf("%#v", got.API)
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	data := []struct {
+		in   string
+		want DiskUsage
+	}{
+		{"1000", DiskUsage{Bytes: 1000}},
+		{"10 MiB", DiskUsage{Bytes: 10 << 20}},
+		{"1TiB", DiskUsage{Bytes: 1 << 40}},
+		{"80%", DiskUsage{Percent: 80}},
+		{"\"12.5%\"", DiskUsage{Percent: 12.5}},
+	}
+	for i, line := range data {
+		c := Camera{}
+		if err := yaml.UnmarshalStrict([]byte("max_disk_usage: "+line.in), &c); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if diff := cmp.Diff(line.want, c.MaxDiskUsage); diff != "" {
+			t.Errorf("#%d: mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+	for i, in := range []string{"0", "-1", "1KB", "101%", "0%", "abc"} {
+		c := Camera{}
+		if err := yaml.UnmarshalStrict([]byte("max_disk_usage: "+in), &c); err == nil {
+			t.Errorf("#%d: expected error for %q", i, in)
+		}
+	}
+}
+
+func TestAction_Err(t *testing.T) {
+	data := []string{
+		"on_boot: [{}]",
+		"on_boot: [{delay: 1s, light.turn_off: {name: Lamp}}]",
+		"on_boot: [{light.turn_on: {name: Unknown}}]",
+		"on_boot: [{light.turn_on: {name: Lamp, brightness: 2}}]",
+		"on_boot: [{output.pulse: {id: out}}]",
+		"on_boot: [{output.turn_off: {id: out, level: 1}}]",
+		"on_boot: [{output.turn_on: {id: unknown}}]",
+		"on_boot: [{switch.turn_off: {name: Unknown}}]",
+		"on_boot: [{cover.close: {name: Unknown}}]",
+		"on_boot: [{switch.turn_off: {name: Valve}, cover.stop: {name: Blind}}]",
+	}
+	for i, line := range data {
+		r := Root{
+			Outputs:  []OutputPin{{Platform: "gpio", ID: "out", Pin: Pin{Number: "GPIO1"}}},
+			Lights:   []Light{{Platform: "fake", Name: "Lamp"}},
+			Switches: []Switch{{Platform: "gpio", Name: "Valve"}},
+			Covers:   []Cover{{Platform: "gpio", Name: "Blind"}},
+		}
+		err := yaml.UnmarshalStrict([]byte(line), &r.PeriphHome)
+		if err == nil {
+			err = r.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestCamera_Raspivid(t *testing.T) {
+	c := Camera{}
+	if err := yaml.UnmarshalStrict([]byte("{platform: raspivid, name: Cam, exposure: night, awb: greyworld, flicker: 50hz, iso: 800, shutter: 100ms, width: 640, height: 480, fps: 5, quality: 80}"), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := Camera{Platform: "raspivid", Name: "Cam", Exposure: "night", AWB: "greyworld", Flicker: "50hz", ISO: 800, Shutter: 100 * time.Millisecond, Width: 640, Height: 480, FPS: 5, Quality: 80}
+	if diff := cmp.Diff(want, c, cmpopts.IgnoreUnexported(Camera{}, SensorParams{})); diff != "" {
+		t.Fatal(diff)
+	}
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"{exposure: bright}", "{awb: blue}", "{flicker: 40hz}", "{iso: 50}", "{shutter: 7s}", "{width: 640}", "{width: 3840, height: 2160}", "{fps: 60}", "{quality: 101}", "{max_files: 10}", "{directory: /var/cam, max_files: -1}", "{directory: /var/cam, max_age: -1h}"} {
+		c := Camera{Platform: "raspivid", Name: "Cam"}
+		if err := yaml.UnmarshalStrict([]byte(line), &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.validate() == nil {
+			t.Errorf("%s: expected error", line)
+		}
+	}
+}
+
+func TestPeriphHome_Err(t *testing.T) {
+	data := []string{
+		"{shutdown_timeout: -1s}",
+		"{bind_address: localhost}",
+		"{bind_address: \"10.0.0.1:6053\"}",
+		"{state_store: var/lib/periphhome}",
+		"{project: {name: maruel.greenhouse}}",
+		"{project: {version: \"1.0\"}}",
+		"{project: {name: greenhouse, version: \"1.0\"}}",
+	}
+	for i, line := range data {
+		p := PeriphHome{}
+		if err := yaml.UnmarshalStrict([]byte(line), &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.validate() == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+	p := PeriphHome{BindAddress: "fd00::1", Interface: "eth0", Project: Project{Name: "maruel.greenhouse", Version: "1.0"}}
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestI2CMux_Err(t *testing.T) {
+	data := []string{
+		"i2c_mux: [{address: 0x70}]",
+		"i2c_mux: [{id: mux, address: 0x20}]",
+		"i2c_mux: [{id: mux}, {id: mux}]",
+		"sensor: [{platform: bh1750, name: Lux, i2c_mux: unknown}]",
+		"{i2c_mux: [{id: mux}], sensor: [{platform: bh1750, name: Lux, i2c_mux: mux, i2c_mux_channel: 8}]}",
+		"{i2c_mux: [{id: mux}], sensor: [{platform: bh1750, name: Lux, i2c_mux: mux, i2c_id: \"1\"}]}",
+		"{i2c_mux: [{id: mux}], sensor: [{platform: bme280, i2c_mux: mux, spi_id: /dev/spidev0.1}]}",
+		"sensor: [{platform: bme280, i2c_id: \"1\", spi_id: /dev/spidev0.1}]",
+	}
+	for i, line := range data {
+		r := Root{}
+		err := yaml.UnmarshalStrict([]byte(line), &r)
+		if err == nil {
+			err = r.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestAPIEncryption(t *testing.T) {
+	got := Root{}
+	if err := got.LoadYaml([]byte("api:\n  encryption:\n    key: \"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got.API.Encryption.Key != "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=" {
+		t.Fatalf("unexpected %v", got.API.Encryption)
+	}
+}
+
+func TestAPIDebugFrames(t *testing.T) {
+	got := Root{}
+	if err := got.LoadYaml([]byte("api:\n  debug_frames: true\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !got.API.DebugFrames || !got.API.IsPresent {
+		t.Fatalf("unexpected %+v", got.API)
+	}
+}
+
+func TestAPIAuth(t *testing.T) {
+	got := Root{}
+	if err := got.LoadYaml([]byte("api:\n  password: \"Foo\"\n  auth: hmac\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got.API.Auth != "hmac" || got.API.Password != "Foo" {
+		t.Fatalf("unexpected %+v", got.API)
+	}
+}
+
+func TestAPIAuth_Err(t *testing.T) {
+	data := []string{
+		"auth: hmac",
+		"{password: Foo, auth: md5}",
+	}
+	for i, line := range data {
+		a := API{}
+		err := yaml.UnmarshalStrict([]byte(line), &a)
+		if err == nil {
+			err = a.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestAPIServices_Err(t *testing.T) {
+	data := []string{
+		"services: [{command: reboot}]",
+		"services: [{service: reboot}]",
+		"services: [{service: reboot, command: reboot}, {service: reboot, command: reboot}]",
+		"services: [{service: relay, command: x, args: [{name: on, type: boolean}]}]",
+		"services: [{service: relay, command: x, args: [{name: 1on, type: bool}]}]",
+		"services: [{service: relay, command: x, args: [{name: on-off, type: bool}]}]",
+		"services: [{service: relay, command: x, args: [{type: bool}]}]",
+		"services: [{service: relay, command: x, args: [{name: on, type: bool}, {name: on, type: int}]}]",
+	}
+	for i, line := range data {
+		a := API{}
+		err := yaml.UnmarshalStrict([]byte(line), &a)
+		if err == nil {
+			err = a.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestAPIEncryption_Err(t *testing.T) {
+	data := []string{
+		"encryption: {key: \"not base64\"}",
+		// 16 bytes.
+		"encryption: {key: \"AAAAAAAAAAAAAAAAAAAAAA==\"}",
+	}
+	for i, line := range data {
+		a := API{}
+		err := yaml.UnmarshalStrict([]byte(line), &a)
+		if err == nil {
+			err = a.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestCameraTimestamp_Err(t *testing.T) {
+	data := []string{
+		"timestamp: {position: middle}",
+		"timestamp: {format: \"%Y %Q\"}",
+		"timestamp: {format: \"100%\"}",
+		"timestamp: {font_scale: 17}",
+		"timestamp: {color: red}",
+		"timestamp: {color: \"#12345g\"}",
+	}
+	for i, line := range data {
+		c := Camera{Platform: "fake", Name: "cam"}
+		err := yaml.UnmarshalStrict([]byte(line), &c)
+		if err == nil {
+			err = c.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestSensorCalibrateLinear_Err(t *testing.T) {
+	data := []string{
+		"calibrate_linear: [\"1 -> 2\"]",
+		"calibrate_linear: [\"1 -> 2\", \"1 -> 3\"]",
+		"calibrate_linear: [\"2 -> 2\", \"1 -> 3\"]",
+		"calibrate_linear: [\"1\", \"2 -> 3\"]",
+		"calibrate_linear: [\"a -> 1\", \"2 -> 3\"]",
+	}
+	for i, line := range data {
+		s := Sensor{Platform: "fake"}
+		err := yaml.UnmarshalStrict([]byte(line), &s)
+		if err == nil {
+			err = s.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestSensorStateClass_Err(t *testing.T) {
+	data := []string{
+		"state_class: total",
+		"state_class: Measurement",
+		"temperature: {state_class: foo}",
+	}
+	for i, line := range data {
+		s := Sensor{Platform: "fake"}
+		err := yaml.UnmarshalStrict([]byte(line), &s)
+		if err == nil {
+			err = s.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestSensorBME280(t *testing.T) {
+	bme := func(extra string) string {
+		return "  - platform: bme280\n    update_interval: 1m\n    temperature:\n      name: T\n" + extra
+	}
+	data := []struct {
+		sensors string
+		err     string
+	}{
+		{bme("    address: 0x76\n") + bme("    address: 0x77\n"), ""},
+		{bme("    address: 0x76\n") + bme("    address: 0x76\n    i2c_id: \"2\"\n"), ""},
+		{bme("") + bme("    address: 0x76\n"), ""},
+		{bme("    address: 0x76\n") + bme("    address: 0x76\n"), `sensor: bme280 at 0x76 on i2c_id "" is defined twice`},
+		{bme("") + bme(""), `sensor: bme280 on spi_id "" is defined twice`},
+	}
+	for i, l := range data {
+		r := Root{}
+		err := r.LoadYaml([]byte("periphhome:\n  name: pi\nsensor:\n" + l.sensors))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != l.err {
+			t.Errorf("#%d: got %q; want %q", i, got, l.err)
+		}
+	}
+}
+
+func TestTextSensor_Err(t *testing.T) {
+	data := []string{
+		"name: \"\"",
+		"{command: uname -r, file: /etc/hostname}",
+		"update_interval: -1s",
+	}
+	for i, line := range data {
+		s := TextSensor{Platform: "template", Name: "Kernel"}
+		err := yaml.UnmarshalStrict([]byte(line), &s)
+		if err == nil {
+			err = s.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestButton_Err(t *testing.T) {
+	data := []string{
+		"name: \"\"",
+		"platform: \"\"",
+		"device_class: shutdown",
+	}
+	for i, line := range data {
+		b := Button{Platform: "template", Name: "Restart"}
+		err := yaml.UnmarshalStrict([]byte(line), &b)
+		if err == nil {
+			err = b.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestSwitch_Err(t *testing.T) {
+	data := []string{
+		"name: \"\"",
+		"pulse: -1s",
+		"pin: {number: GPIO4, mode: INPUT}",
+		"pin: {number: GPIO4, mode: INPUT_PULLUP}",
+		"pin: {number: GPIO4, mode: ANALOG}",
+	}
+	for i, line := range data {
+		s := Switch{Platform: "gpio", Name: "Relay"}
+		err := yaml.UnmarshalStrict([]byte(line), &s)
+		if err == nil {
+			err = s.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+	s := Switch{Platform: "gpio", Name: "Relay", Pin: Pin{Number: "GPIO4", Mode: OutputOpenDrain, Inverted: true}}
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTime_Err(t *testing.T) {
+	data := []string{
+		"platform: \"\"",
+		"address: 0x80",
+		"update_interval: -1s",
+	}
+	for i, line := range data {
+		v := Time{Platform: "homeassistant"}
+		err := yaml.UnmarshalStrict([]byte(line), &v)
+		if err == nil {
+			err = v.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestNumber_Err(t *testing.T) {
+	data := []string{
+		"name: \"\"",
+		"max_value: 0",
+		"step: -1",
+		"initial_value: 11",
+		"mode: knob",
+	}
+	for i, line := range data {
+		n := Number{Platform: "template", Name: "Setpoint", MaxValue: 10}
+		err := yaml.UnmarshalStrict([]byte(line), &n)
+		if err == nil {
+			err = n.validate()
+		}
+		if err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
+
 /*
 func TestRootLoadYaml_ExampleFile(t *testing.T) {
 	got := Root{}
@@ -196,7 +862,7 @@ func TestRootLoadYaml_ExampleFile(t *testing.T) {
 			},
 		},
 	}
-	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(API{})); diff != "" {
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(API{}, WebServer{})); diff != "" {
 		t.Errorf("Root mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -0,0 +1,75 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+)
+
+// configStatus tracks the configuration file and the last reload attempt.
+type configStatus struct {
+	mu       sync.Mutex
+	path     string
+	modified time.Time
+	err      error
+	t        *textSensorDiagnostic
+}
+
+// SetConfigFile reports the path and modification time of the configuration
+// file the node was loaded from.
+func (n *Node) SetConfigFile(path string, modified time.Time) {
+	n.cfgStatus.mu.Lock()
+	n.cfgStatus.path = path
+	n.cfgStatus.modified = modified
+	n.cfgStatus.err = nil
+	n.cfgStatus.mu.Unlock()
+	n.cfgStatus.publish()
+}
+
+// ReloadRejected reports that the configuration file was modified but was not
+// reloaded because it is invalid or failed to load. The node keeps running
+// with the previous configuration.
+func (n *Node) ReloadRejected(modified time.Time, err error) {
+	n.cfgStatus.mu.Lock()
+	n.cfgStatus.modified = modified
+	n.cfgStatus.err = err
+	n.cfgStatus.mu.Unlock()
+	n.cfgStatus.publish()
+}
+
+func (c *configStatus) publish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.t == nil || c.path == "" {
+		return
+	}
+	v := "loaded " + c.path + " (" + c.modified.Format("2006-01-02 15:04:05") + ")"
+	if c.err != nil {
+		v = "rejected " + c.path + " (" + c.modified.Format("2006-01-02 15:04:05") + "): " + c.err.Error()
+	}
+	c.t.setValue(v)
+}
+
+func (n *Node) loadTextSensorConfigStatus(ctx context.Context, cfg *config.TextSensor) error {
+	if n.cfgStatus.t != nil {
+		return errors.New("only one config_status is supported")
+	}
+	t := &textSensorDiagnostic{
+		componentBase: componentBase{name: cfg.Name},
+		icon:          "mdi:file-cog-outline",
+	}
+	if err := n.addEntity(ctx, t); err != nil {
+		return err
+	}
+	n.cfgStatus.mu.Lock()
+	n.cfgStatus.t = t
+	n.cfgStatus.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,30 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+)
+
+func TestConfigStatus(t *testing.T) {
+	n := Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	if err := n.loadTextSensor(context.Background(), &config.TextSensor{Platform: "config_status", Name: "Config"}); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	n.SetConfigFile("/etc/periphhome.yaml", mod)
+	if s := stateString(n.entities[0]); s != "loaded /etc/periphhome.yaml (2021-03-04 05:06:07)" {
+		t.Fatal(s)
+	}
+	n.ReloadRejected(mod.Add(time.Minute), errors.New("bad"))
+	if s := stateString(n.entities[0]); s != "rejected /etc/periphhome.yaml (2021-03-04 05:07:07): bad" {
+		t.Fatal(s)
+	}
+}
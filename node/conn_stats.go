@@ -0,0 +1,202 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// connStatsFile is the file in state_dir where the native API statistics are
+// saved.
+const connStatsFile = "connection_stats.json"
+
+// connStatsData is the serialized form of connStats.
+type connStatsData struct {
+	// SinceBoot is the boot count when the statistics started to be recorded.
+	SinceBoot         int           `json:"since_boot"`
+	FramesSent        uint64        `json:"frames_sent"`
+	CommandsReceived  uint64        `json:"commands_received"`
+	LongestConnection time.Duration `json:"longest_connection"`
+}
+
+// connStats are the cumulative native API statistics over the node's
+// lifetime.
+type connStats struct {
+	mu   sync.Mutex
+	d    connStatsData
+	open map[*conn]time.Time
+}
+
+func (s *connStats) frameSent() {
+	s.mu.Lock()
+	s.d.FramesSent++
+	s.mu.Unlock()
+}
+
+func (s *connStats) commandReceived() {
+	s.mu.Lock()
+	s.d.CommandsReceived++
+	s.mu.Unlock()
+}
+
+func (s *connStats) connStarted(c *conn) {
+	s.mu.Lock()
+	if s.open == nil {
+		s.open = map[*conn]time.Time{}
+	}
+	s.open[c] = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *connStats) connEnded(c *conn) {
+	s.mu.Lock()
+	if d := time.Since(s.open[c]); d > s.d.LongestConnection {
+		s.d.LongestConnection = d
+	}
+	delete(s.open, c)
+	s.mu.Unlock()
+}
+
+// get returns the current statistics, including the connections still open.
+func (s *connStats) get() connStatsData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.d
+	for _, start := range s.open {
+		if l := time.Since(start); l > d.LongestConnection {
+			d.LongestConnection = l
+		}
+	}
+	return d
+}
+
+// load loads the statistics saved in dir.
+//
+// bootCount is recorded as the start of the statistics when none were saved.
+func (s *connStats) load(dir string, bootCount int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.d = connStatsData{SinceBoot: bootCount}
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(filepath.Join(dir, connStatsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	d := connStatsData{}
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	s.d = d
+	logf("connection stats since boot #%d", s.d.SinceBoot)
+	return nil
+}
+
+// save saves the statistics in dir.
+func (s *connStats) save(dir string) error {
+	d := s.get()
+	b, err := json.Marshal(&d)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, connStatsFile), b)
+}
+
+// loadSensorConnectionStats loads diagnostic sensors about the native API
+// connections since the statistics started to be recorded, which is the first
+// boot when state_dir is set.
+func (n *Node) loadSensorConnectionStats(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.FramesSent.Name == "" && cfg.CommandsReceived.Name == "" && cfg.LongestConnection.Name == "" {
+		return errors.New("specify a name for at least one of frames_sent / commands_received / longest_connection")
+	}
+	if cfg.Name != "" || cfg.Address != 0 || cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" {
+		return errors.New("do not use name / address / temperature / pressure / humidity")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	var frames, commands, longest *sensorDiagnostic
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(ctx)
+	stop := func() {
+		cancel()
+		wg.Wait()
+	}
+	add := func(p *config.SensorParams, icon, unit, deviceClass string, stateClass aioesphomeapi.SensorStateClass) (*sensorDiagnostic, error) {
+		if p.Name == "" {
+			return nil, nil
+		}
+		s := &sensorDiagnostic{
+			sensorBase: sensorBase{
+				componentBase: componentBase{name: p.Name},
+				calibration:   p.CalibrateLinear,
+				icon:          icon,
+				unit:          unit,
+				deviceClass:   deviceClass,
+				stateClass:    stateClass,
+			},
+		}
+		s.override(p.UnitOfMeasurement, p.AccuracyDecimals, p.DeviceClass, p.StateClass)
+		if frames == nil && commands == nil && longest == nil {
+			// The first sensor stops the sampling.
+			s.stop = stop
+		}
+		return s, n.addEntity(ctx, s)
+	}
+	var err error
+	if frames, err = add(&cfg.FramesSent, "mdi:upload-network", "", "", aioesphomeapi.SensorStateClass_STATE_CLASS_TOTAL_INCREASING); err != nil {
+		cancel()
+		return err
+	}
+	if commands, err = add(&cfg.CommandsReceived, "mdi:download-network", "", "", aioesphomeapi.SensorStateClass_STATE_CLASS_TOTAL_INCREASING); err != nil {
+		stop()
+		return err
+	}
+	if longest, err = add(&cfg.LongestConnection, "mdi:timer-outline", "s", "duration", aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT); err != nil {
+		stop()
+		return err
+	}
+	sample := func() {
+		d := n.stats.get()
+		if frames != nil {
+			frames.setValue(float32(d.FramesSent))
+		}
+		if commands != nil {
+			commands.setValue(float32(d.CommandsReceived))
+		}
+		if longest != nil {
+			longest.setValue(float32(d.LongestConnection.Seconds()))
+		}
+	}
+	sample()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(cfg.UpdateInterval)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				sample()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConnStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := connStats{}
+	if err = s.load(dir, 3); err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := &conn{}, &conn{}
+	s.connStarted(c1)
+	s.connStarted(c2)
+	s.commandReceived()
+	s.frameSent()
+	s.frameSent()
+	time.Sleep(time.Millisecond)
+	s.connEnded(c1)
+	longest := s.get().LongestConnection
+	if longest < time.Millisecond {
+		t.Fatalf("unexpected %s", longest)
+	}
+	// The connection still open is accounted for.
+	time.Sleep(time.Millisecond)
+	if got := s.get().LongestConnection; got <= longest {
+		t.Fatalf("%s <= %s", got, longest)
+	}
+	if err = s.save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The statistics survive a restart.
+	s2 := connStats{}
+	if err = s2.load(dir, 4); err != nil {
+		t.Fatal(err)
+	}
+	got := s2.get()
+	if got.SinceBoot != 3 || got.FramesSent != 2 || got.CommandsReceived != 1 || got.LongestConnection <= longest {
+		t.Fatalf("unexpected %+v", got)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadCoverGPIO loads a cover driven by two pins, one to open and one to
+// close, e.g. a blind motor via relays.
+//
+// There is no position feedback; the position is estimated from the travel
+// time. It is assumed to be closed on startup.
+func (n *Node) loadCoverGPIO(ctx context.Context, cfg *config.Cover) error {
+	if cfg.OpenDuration == 0 {
+		return errors.New("open_duration is required")
+	}
+	c := &coverGPIO{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: coverComponent,
+		},
+		deviceClass:   cfg.DeviceClass,
+		openDuration:  cfg.OpenDuration,
+		closeDuration: cfg.CloseDuration,
+	}
+	if c.closeDuration == 0 {
+		c.closeDuration = c.openDuration
+	}
+	var err error
+	if c.open, err = openCoverPin(&cfg.OpenPin); err != nil {
+		return fmt.Errorf("open_pin: %w", err)
+	}
+	if c.close, err = openCoverPin(&cfg.ClosePin); err != nil {
+		_ = c.open.Halt()
+		return fmt.Errorf("close_pin: %w", err)
+	}
+	c.openInverted = cfg.OpenPin.Inverted
+	c.closeInverted = cfg.ClosePin.Inverted
+	if err = c.drive(aioesphomeapi.CoverOperation_COVER_OPERATION_IDLE); err != nil {
+		return err
+	}
+	return n.addEntity(ctx, c)
+}
+
+// openCoverPin returns the output pin.
+func openCoverPin(cfg *config.Pin) (gpio.PinOut, error) {
+	switch cfg.Mode {
+	case "", config.Output:
+	default:
+		return nil, errors.New("mode must be OUTPUT")
+	}
+	p := gpioreg.ByName(cfg.Number)
+	if p == nil {
+		return nil, fmt.Errorf("unknown pin %q", cfg.Number)
+	}
+	return p, nil
+}
+
+type coverGPIO struct {
+	componentBase
+	deviceClass   string
+	open          gpio.PinOut
+	close         gpio.PinOut
+	openInverted  bool
+	closeInverted bool
+	openDuration  time.Duration
+	closeDuration time.Duration
+
+	// mu protects the fields below.
+	mu sync.Mutex
+	// position is the position when the current operation started, between 0
+	// (closed) and 1 (open).
+	position float32
+	op       aioesphomeapi.CoverOperation
+	started  time.Time
+	// timer stops the current operation once the target is reached.
+	timer *time.Timer
+}
+
+// Close stops the motor.
+func (c *coverGPIO) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	return c.drive(aioesphomeapi.CoverOperation_COVER_OPERATION_IDLE)
+}
+
+func (c *coverGPIO) init(ctx context.Context, n *Node) error {
+	if err := c.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.publishLocked()
+	return nil
+}
+
+func (c *coverGPIO) coverCommand(in *aioesphomeapi.CoverCommandRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	switch {
+	case in.Stop:
+		err = c.stopLocked()
+	case in.HasPosition:
+		if in.Position < 0 || in.Position > 1 {
+			return fmt.Errorf("invalid position %g", in.Position)
+		}
+		err = c.moveLocked(in.Position)
+	case in.HasLegacyCommand:
+		switch in.LegacyCommand {
+		case aioesphomeapi.LegacyCoverCommand_LEGACY_COVER_COMMAND_OPEN:
+			err = c.moveLocked(1)
+		case aioesphomeapi.LegacyCoverCommand_LEGACY_COVER_COMMAND_CLOSE:
+			err = c.moveLocked(0)
+		default:
+			err = c.stopLocked()
+		}
+	default:
+		return nil
+	}
+	c.publishLocked()
+	return err
+}
+
+// moveLocked starts moving toward target.
+func (c *coverGPIO) moveLocked(target float32) error {
+	if err := c.stopLocked(); err != nil {
+		return err
+	}
+	var d time.Duration
+	op := aioesphomeapi.CoverOperation_COVER_OPERATION_IS_OPENING
+	if target > c.position {
+		d = time.Duration(float64(target-c.position) * float64(c.openDuration))
+	} else if target < c.position {
+		op = aioesphomeapi.CoverOperation_COVER_OPERATION_IS_CLOSING
+		d = time.Duration(float64(c.position-target) * float64(c.closeDuration))
+	} else {
+		return nil
+	}
+	if err := c.drive(op); err != nil {
+		_ = c.drive(aioesphomeapi.CoverOperation_COVER_OPERATION_IDLE)
+		return err
+	}
+	c.op = op
+	c.started = time.Now()
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// Ignore if it was superseded by a newer command.
+		if c.timer != t {
+			return
+		}
+		if err := c.stopLocked(); err != nil {
+			c.setError(err)
+		}
+		// Do not accumulate the timing errors.
+		c.position = target
+		c.publishLocked()
+	})
+	c.timer = t
+	return nil
+}
+
+// stopLocked stops the motor and updates the position.
+func (c *coverGPIO) stopLocked() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.position = c.positionLocked()
+	c.op = aioesphomeapi.CoverOperation_COVER_OPERATION_IDLE
+	return c.drive(c.op)
+}
+
+// positionLocked returns the current estimated position.
+func (c *coverGPIO) positionLocked() float32 {
+	p := c.position
+	switch c.op {
+	case aioesphomeapi.CoverOperation_COVER_OPERATION_IS_OPENING:
+		p += float32(float64(time.Since(c.started)) / float64(c.openDuration))
+	case aioesphomeapi.CoverOperation_COVER_OPERATION_IS_CLOSING:
+		p -= float32(float64(time.Since(c.started)) / float64(c.closeDuration))
+	}
+	if p < 0 {
+		return 0
+	}
+	if p > 1 {
+		return 1
+	}
+	return p
+}
+
+// drive sets the pins for the operation, with inverted applied.
+//
+// The opposite pin is always released first so both are never on at the same
+// time.
+func (c *coverGPIO) drive(op aioesphomeapi.CoverOperation) error {
+	opening := op == aioesphomeapi.CoverOperation_COVER_OPERATION_IS_OPENING
+	closing := op == aioesphomeapi.CoverOperation_COVER_OPERATION_IS_CLOSING
+	if opening {
+		if err := c.close.Out(gpio.Level(c.closeInverted)); err != nil {
+			return err
+		}
+		return c.open.Out(gpio.Level(!c.openInverted))
+	}
+	if err := c.open.Out(gpio.Level(c.openInverted)); err != nil {
+		return err
+	}
+	return c.close.Out(gpio.Level(closing != c.closeInverted))
+}
+
+// publishLocked publishes the current state. c.mu must be held.
+func (c *coverGPIO) publishLocked() {
+	p := c.positionLocked()
+	legacy := aioesphomeapi.LegacyCoverState_LEGACY_COVER_STATE_OPEN
+	if p == 0 {
+		legacy = aioesphomeapi.LegacyCoverState_LEGACY_COVER_STATE_CLOSED
+	}
+	c.onNewState(&aioesphomeapi.CoverStateResponse{
+		Key:              c.key,
+		LegacyState:      legacy,
+		Position:         p,
+		CurrentOperation: c.op,
+	})
+}
+
+func (c *coverGPIO) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesCoverResponse{
+		ObjectId:         c.objectID,
+		Key:              c.key,
+		Name:             c.name,
+		UniqueId:         c.uniqueID,
+		AssumedState:     true,
+		SupportsPosition: true,
+		DeviceClass:      c.deviceClass,
+	}
+}
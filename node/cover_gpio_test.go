@@ -0,0 +1,98 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestCoverGPIO(t *testing.T) {
+	open := gpiotest.Pin{N: "FAKE_GPIO_OPEN", L: gpio.High}
+	close := gpiotest.Pin{N: "FAKE_GPIO_CLOSE", L: gpio.High}
+	for _, p := range []*gpiotest.Pin{&open, &close} {
+		if err := gpioreg.Register(p); err != nil {
+			t.Fatal(err)
+		}
+		defer func(n string) {
+			if err := gpioreg.Unregister(n); err != nil {
+				t.Error(err)
+			}
+		}(p.N)
+	}
+	level := func(p *gpiotest.Pin) gpio.Level {
+		p.Lock()
+		defer p.Unlock()
+		return p.L
+	}
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Cover{
+		Platform:     "gpio",
+		Name:         "Blind",
+		OpenPin:      config.Pin{Number: open.N},
+		ClosePin:     config.Pin{Number: close.N},
+		OpenDuration: 100 * time.Millisecond,
+	}
+	if err := n.loadCover(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	c := n.entities[0]
+	defer c.Close()
+	if level(&open) || level(&close) {
+		t.Fatal("expected both pins off at start")
+	}
+	if d := c.describe().(*aioesphomeapi.ListEntitiesCoverResponse); !d.SupportsPosition {
+		t.Fatal("expected position support")
+	}
+	if err := c.coverCommand(&aioesphomeapi.CoverCommandRequest{HasPosition: true, Position: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.getState().(*aioesphomeapi.CoverStateResponse); s.CurrentOperation != aioesphomeapi.CoverOperation_COVER_OPERATION_IS_OPENING {
+		t.Fatalf("unexpected %v", s)
+	}
+	if !level(&open) || level(&close) {
+		t.Fatal("expected opening")
+	}
+	for start := time.Now(); ; {
+		s := c.getState().(*aioesphomeapi.CoverStateResponse)
+		if s.CurrentOperation == aioesphomeapi.CoverOperation_COVER_OPERATION_IDLE {
+			if s.Position != 0.5 {
+				t.Fatalf("unexpected %v", s)
+			}
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("cover never stopped")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if level(&open) || level(&close) {
+		t.Fatal("expected both pins off once stopped")
+	}
+	err := c.coverCommand(&aioesphomeapi.CoverCommandRequest{HasLegacyCommand: true, LegacyCommand: aioesphomeapi.LegacyCoverCommand_LEGACY_COVER_COMMAND_CLOSE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level(&open) || !level(&close) {
+		t.Fatal("expected closing")
+	}
+	if err = c.coverCommand(&aioesphomeapi.CoverCommandRequest{Stop: true}); err != nil {
+		t.Fatal(err)
+	}
+	s := c.getState().(*aioesphomeapi.CoverStateResponse)
+	if s.CurrentOperation != aioesphomeapi.CoverOperation_COVER_OPERATION_IDLE || s.Position <= 0 || s.Position > 0.5 {
+		t.Fatalf("unexpected %v", s)
+	}
+	if level(&open) || level(&close) {
+		t.Fatal("expected both pins off once stopped")
+	}
+}
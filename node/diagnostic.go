@@ -0,0 +1,83 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// sensorDiagnostic is a sensor reporting a value about the node itself.
+//
+// The value is set via setValue().
+type sensorDiagnostic struct {
+	sensorBase
+	// stop, if set, is called on Close().
+	stop func()
+}
+
+func (s *sensorDiagnostic) Close() error {
+	if s.stop != nil {
+		s.stop()
+	}
+	return nil
+}
+
+func (s *sensorDiagnostic) init(ctx context.Context, n *Node) error {
+	s.componentType = sensorComponent
+	return s.componentBase.init(ctx, n)
+}
+
+func (s *sensorDiagnostic) setValue(v float32) {
+	s.publish(v)
+}
+
+func (s *sensorDiagnostic) describe() proto.Message {
+	d := s.sensorBase.describe().(*aioesphomeapi.ListEntitiesSensorResponse)
+	d.EntityCategory = aioesphomeapi.EntityCategory_ENTITY_CATEGORY_DIAGNOSTIC
+	return d
+}
+
+// textSensorDiagnostic is a text sensor reporting a value about the node
+// itself.
+//
+// The value is set via setValue().
+type textSensorDiagnostic struct {
+	componentBase
+	icon string
+}
+
+func (t *textSensorDiagnostic) Close() error {
+	return nil
+}
+
+func (t *textSensorDiagnostic) init(ctx context.Context, n *Node) error {
+	t.componentType = textSensorComponent
+	return t.componentBase.init(ctx, n)
+}
+
+func (t *textSensorDiagnostic) setValue(v string) {
+	// Home Assistant truncates states to 255 characters.
+	if len(v) > 255 {
+		v = v[:252] + "..."
+	}
+	t.onNewState(&aioesphomeapi.TextSensorStateResponse{
+		Key:   t.key,
+		State: v,
+	})
+}
+
+func (t *textSensorDiagnostic) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesTextSensorResponse{
+		ObjectId:       t.objectID,
+		Key:            t.key,
+		Name:           t.name,
+		UniqueId:       t.uniqueID,
+		Icon:           t.icon,
+		EntityCategory: aioesphomeapi.EntityCategory_ENTITY_CATEGORY_DIAGNOSTIC,
+	}
+}
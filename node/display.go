@@ -0,0 +1,120 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// display is a local screen attached to the node.
+//
+// It is not an entity as the ESPHome protocol has no concept of displays; it
+// only renders the state of other entities.
+type display interface {
+	Close() error
+}
+
+func (n *Node) loadDisplay(ctx context.Context, cfg *config.Display) error {
+	log.Printf("loading display %s", cfg.Platform)
+	switch cfg.Platform {
+	case "ssd1306":
+		if err := n.loadDisplaySSD1306(ctx, cfg); err != nil {
+			return fmt.Errorf("display(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown platform %q", cfg.Platform)
+	}
+}
+
+// findEntities returns the entities by their name.
+func (n *Node) findEntities(names []string) ([]component, error) {
+	out := make([]component, 0, len(names))
+	for _, name := range names {
+		var found component
+		for _, e := range n.entities {
+			if e.getName() == name {
+				found = e
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("unknown entity %q", name)
+		}
+		out = append(out, found)
+	}
+	return out, nil
+}
+
+// stateString returns a short human readable representation of the current
+// state of an entity.
+func stateString(c component) string {
+	switch s := c.getState().(type) {
+	case nil:
+		return "N/A"
+	case *aioesphomeapi.BinarySensorStateResponse:
+		if s.MissingState {
+			return "N/A"
+		}
+		return onOff(s.State)
+	case *aioesphomeapi.LightStateResponse:
+		return onOff(s.State)
+	case *aioesphomeapi.SwitchStateResponse:
+		return onOff(s.State)
+	case *aioesphomeapi.FanStateResponse:
+		return onOff(s.State)
+	case *aioesphomeapi.ClimateStateResponse:
+		if s.Mode == aioesphomeapi.ClimateMode_CLIMATE_MODE_OFF {
+			return onOff(false)
+		}
+		return "HEAT " + strconv.FormatFloat(float64(s.TargetTemperature), 'f', 1, 32) + " °C"
+	case *aioesphomeapi.NumberStateResponse:
+		if s.MissingState {
+			return "N/A"
+		}
+		v := strconv.FormatFloat(float64(s.State), 'f', -1, 32)
+		if d, ok := c.describe().(*aioesphomeapi.ListEntitiesNumberResponse); ok && d.UnitOfMeasurement != "" {
+			v += " " + d.UnitOfMeasurement
+		}
+		return v
+	case *aioesphomeapi.CoverStateResponse:
+		return strconv.Itoa(int(s.Position*100+0.5)) + "%"
+	case *aioesphomeapi.SensorStateResponse:
+		if s.MissingState {
+			return "N/A"
+		}
+		d, ok := c.describe().(*aioesphomeapi.ListEntitiesSensorResponse)
+		if !ok {
+			return strconv.FormatFloat(float64(s.State), 'f', -1, 32)
+		}
+		v := strconv.FormatFloat(float64(s.State), 'f', int(d.AccuracyDecimals), 32)
+		if d.UnitOfMeasurement != "" {
+			v += " " + d.UnitOfMeasurement
+		}
+		return v
+	case *aioesphomeapi.TextSensorStateResponse:
+		if s.MissingState {
+			return "N/A"
+		}
+		return s.State
+	case *aioesphomeapi.CameraImageResponse:
+		return fmt.Sprintf("%d bytes", len(s.Data))
+	default:
+		return "?"
+	}
+}
+
+func onOff(b bool) string {
+	if b {
+		return "ON"
+	}
+	return "OFF"
+}
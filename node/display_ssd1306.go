@@ -0,0 +1,172 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/spi/spireg"
+	"periph.io/x/devices/v3/ssd1306"
+	"periph.io/x/devices/v3/ssd1306/image1bit"
+	"periph.io/x/home/node/config"
+)
+
+// loadDisplaySSD1306 loads a SSD1306 or SSD1309 OLED display.
+//
+// Both controllers share the same command set for what is used here.
+func (n *Node) loadDisplaySSD1306(ctx context.Context, cfg *config.Display) error {
+	opts := ssd1306.DefaultOpts
+	switch cfg.Model {
+	case "", "ssd1306":
+	case "ssd1309":
+		// The SSD1309 is only sold as 128x64.
+		if (cfg.Width != 0 && cfg.Width != 128) || (cfg.Height != 0 && cfg.Height != 64) {
+			return errors.New("ssd1309 only supports 128x64")
+		}
+	default:
+		return fmt.Errorf("unknown model %q", cfg.Model)
+	}
+	if cfg.Width != 0 {
+		opts.W = cfg.Width
+	}
+	if cfg.Height != 0 {
+		opts.H = cfg.Height
+	}
+	entities, err := n.findEntities(cfg.Entities)
+	if err != nil {
+		return err
+	}
+	update := cfg.UpdateInterval
+	if update == 0 {
+		update = 5 * time.Second
+	}
+
+	d := &displaySSD1306{entities: entities, update: update}
+	if cfg.Address != 0 {
+		if cfg.DCPin != "" {
+			return errors.New("dc_pin is only supported with SPI")
+		}
+		if cfg.Address != 0x3C {
+			// TODO(maruel): Update when ssd1306.NewI2C supports other addresses.
+			return errors.New("only address 0x3c is supported")
+		}
+		p, err := i2creg.Open("")
+		if err != nil {
+			return err
+		}
+		dev, err := ssd1306.NewI2C(p, &opts)
+		if err != nil {
+			_ = p.Close()
+			return err
+		}
+		d.bus = p
+		d.d = dev
+	} else {
+		dc := gpioreg.ByName(cfg.DCPin)
+		if dc == nil {
+			return fmt.Errorf("unknown dc_pin %q", cfg.DCPin)
+		}
+		p, err := spireg.Open("")
+		if err != nil {
+			return err
+		}
+		dev, err := ssd1306.NewSPI(p, dc, &opts)
+		if err != nil {
+			_ = p.Close()
+			return err
+		}
+		d.bus = p
+		d.d = dev
+	}
+	d.init(ctx)
+	n.displays = append(n.displays, d)
+	return nil
+}
+
+type displaySSD1306 struct {
+	bus      io.Closer
+	d        *ssd1306.Dev
+	entities []component
+	update   time.Duration
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (d *displaySSD1306) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	err := d.d.Halt()
+	if err2 := d.bus.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (d *displaySSD1306) init(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		t := time.NewTicker(d.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for page := 0; ; page++ {
+			if err := d.render(page); err != nil {
+				log.Printf("display: %s", err)
+			}
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// render draws one page of entities.
+func (d *displaySSD1306) render(page int) error {
+	b := d.d.Bounds()
+	img := image1bit.NewVerticalLSB(b)
+	if err := drawPage(img, image1bit.On, d.entities, page); err != nil {
+		return err
+	}
+	return d.d.Draw(b, img, image.Point{})
+}
+
+// drawPage draws one page of entities on dst in the color on, one per line.
+//
+// When there are more entities than lines available on the screen, each
+// update shows the next page.
+func drawPage(dst draw.Image, on color.Color, entities []component, page int) error {
+	face := basicfont.Face7x13
+	perPage := dst.Bounds().Dy() / face.Height
+	if perPage == 0 {
+		return errors.New("display is too small")
+	}
+	pages := (len(entities) + perPage - 1) / perPage
+	start := (page % pages) * perPage
+	dr := font.Drawer{Dst: dst, Src: image.NewUniform(on), Face: face}
+	for i := 0; i < perPage && start+i < len(entities); i++ {
+		e := entities[start+i]
+		dr.Dot = fixed.P(dst.Bounds().Min.X, dst.Bounds().Min.Y+i*face.Height+face.Ascent)
+		dr.DrawString(e.getName() + ": " + stateString(e))
+	}
+	return nil
+}
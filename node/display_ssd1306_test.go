@@ -0,0 +1,79 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"periph.io/x/home/node/config"
+)
+
+func TestDrawPage(t *testing.T) {
+	shouldLog = testing.Verbose()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	ctx := context.Background()
+	one := 1
+	s := config.Sensor{Platform: "fake", Name: "Temp", UpdateInterval: time.Hour, UnitOfMeasurement: "°C", AccuracyDecimals: &one}
+	if err := n.loadSensor(ctx, &s); err != nil {
+		t.Fatal(err)
+	}
+	b := config.BinarySensor{Platform: "fake", Name: "Door"}
+	if err := n.loadBinarySensor(ctx, &b); err != nil {
+		t.Fatal(err)
+	}
+	s2 := config.Sensor{Platform: "fake", Name: "Count", UpdateInterval: time.Hour}
+	if err := n.loadSensor(ctx, &s2); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := n.closeComponents(time.Time{}); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// want draws the lines like a 128x32 display would show them.
+	want := func(lines ...string) *image.Gray {
+		img := image.NewGray(image.Rect(0, 0, 128, 32))
+		dr := font.Drawer{Dst: img, Src: image.NewUniform(color.White), Face: basicfont.Face7x13}
+		for i, l := range lines {
+			dr.Dot = fixed.P(0, i*13+basicfont.Face7x13.Ascent)
+			dr.DrawString(l)
+		}
+		return img
+	}
+	data := []struct {
+		page  int
+		lines []string
+	}{
+		// Two lines fit, so the entities are shown two at a time.
+		{0, []string{"Temp: 1.0 °C", "Door: OFF"}},
+		{1, []string{"Count: 1"}},
+		{2, []string{"Temp: 1.0 °C", "Door: OFF"}},
+	}
+	blank := image.NewGray(image.Rect(0, 0, 128, 32))
+	for i, l := range data {
+		img := image.NewGray(image.Rect(0, 0, 128, 32))
+		if err := drawPage(img, color.White, n.entities, l.page); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if bytes.Equal(img.Pix, blank.Pix) {
+			t.Fatalf("#%d: nothing was drawn", i)
+		}
+		if !bytes.Equal(img.Pix, want(l.lines...).Pix) {
+			t.Fatalf("#%d: expected %q", i, l.lines)
+		}
+	}
+	if err := drawPage(image.NewGray(image.Rect(0, 0, 128, 8)), color.White, n.entities, 0); err == nil {
+		t.Fatal("expected error")
+	}
+}
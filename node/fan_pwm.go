@@ -0,0 +1,143 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadFanPWM loads a fan whose speed is set by the duty cycle of a PWM
+// output.
+//
+// The fan starts off at full speed.
+func (n *Node) loadFanPWM(ctx context.Context, cfg *config.Fan) error {
+	o, err := n.findOutput(cfg.Output)
+	if err != nil {
+		return err
+	}
+	if !o.isFloat() {
+		return errors.New("output must be a pwm output")
+	}
+	f := &fanPWM{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: fanComponent,
+		},
+		o:     o,
+		count: int32(cfg.SpeedCount),
+	}
+	if f.count == 0 {
+		f.count = 100
+	}
+	f.level = f.count
+	return n.addEntity(ctx, f)
+}
+
+// fanPWM is a variable speed fan driven by an output.
+//
+// Oscillation and direction are not supported and ignored.
+type fanPWM struct {
+	componentBase
+	o output
+	// count is the number of speed levels.
+	count int32
+
+	// Protected by componentBase.mu.
+	on    bool
+	level int32
+}
+
+func (f *fanPWM) Close() error {
+	return nil
+}
+
+func (f *fanPWM) init(ctx context.Context, n *Node) error {
+	if err := f.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	f.onNewState(f.stateLocked())
+	return nil
+}
+
+func (f *fanPWM) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesFanResponse{
+		ObjectId:             f.objectID,
+		Key:                  f.key,
+		Name:                 f.name,
+		UniqueId:             f.uniqueID,
+		SupportsSpeed:        true,
+		SupportedSpeedLevels: f.count,
+	}
+}
+
+func (f *fanPWM) fanCommand(in *aioesphomeapi.FanCommandRequest) error {
+	f.mu.Lock()
+	if in.HasState {
+		f.on = in.State
+	}
+	if in.HasSpeedLevel {
+		if in.SpeedLevel < 0 || in.SpeedLevel > f.count {
+			f.mu.Unlock()
+			return fmt.Errorf("invalid speed level %d", in.SpeedLevel)
+		}
+		if in.SpeedLevel == 0 {
+			// This is how Home Assistant turns off a fan via the speed slider.
+			f.on = false
+		} else {
+			f.level = in.SpeedLevel
+		}
+	} else if in.HasSpeed {
+		// Legacy clients.
+		f.level = fanSpeedToLevel(in.Speed, f.count)
+	}
+	level := float32(0)
+	if f.on {
+		level = float32(f.level) / float32(f.count)
+	}
+	msg := f.stateLocked()
+	f.mu.Unlock()
+	if err := f.o.set(level); err != nil {
+		return err
+	}
+	f.onNewState(msg)
+	return nil
+}
+
+// stateLocked returns the current state. f.mu must be held, except in init().
+func (f *fanPWM) stateLocked() *aioesphomeapi.FanStateResponse {
+	return &aioesphomeapi.FanStateResponse{
+		Key:        f.key,
+		State:      f.on,
+		Speed:      fanLevelToSpeed(f.level, f.count),
+		SpeedLevel: f.level,
+	}
+}
+
+// fanSpeedToLevel converts a legacy speed to a level.
+func fanSpeedToLevel(s aioesphomeapi.FanSpeed, count int32) int32 {
+	l := (int32(s) + 1) * count / 3
+	if l < 1 {
+		return 1
+	}
+	return l
+}
+
+// fanLevelToSpeed converts a level to a legacy speed.
+func fanLevelToSpeed(l, count int32) aioesphomeapi.FanSpeed {
+	switch {
+	case l*3 <= count:
+		return aioesphomeapi.FanSpeed_FAN_SPEED_LOW
+	case l*3 <= count*2:
+		return aioesphomeapi.FanSpeed_FAN_SPEED_MEDIUM
+	default:
+		return aioesphomeapi.FanSpeed_FAN_SPEED_HIGH
+	}
+}
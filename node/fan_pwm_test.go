@@ -0,0 +1,70 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestFanPWM(t *testing.T) {
+	o := &outputRecord{float: true}
+	n := &Node{
+		cfg:     &config.Root{},
+		lookup:  map[uint32]component{},
+		outputs: map[string]output{"pwm": o},
+	}
+	cfg := config.Fan{Platform: "pwm", Name: "Exhaust", Output: "pwm", SpeedCount: 4}
+	if err := n.loadFan(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	f := n.entities[0]
+	if d := f.describe().(*aioesphomeapi.ListEntitiesFanResponse); !d.SupportsSpeed || d.SupportedSpeedLevels != 4 {
+		t.Fatalf("unexpected %v", d)
+	}
+	cmds := []aioesphomeapi.FanCommandRequest{
+		{HasState: true, State: true},
+		{HasSpeedLevel: true, SpeedLevel: 1},
+		{HasOscillating: true, Oscillating: true},
+		{HasSpeed: true, Speed: aioesphomeapi.FanSpeed_FAN_SPEED_MEDIUM},
+		{HasSpeedLevel: true, SpeedLevel: 0},
+	}
+	for i := range cmds {
+		if err := f.fanCommand(&cmds[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []float32{1, 0.25, 0.25, 0.5, 0}
+	if len(o.levels) != len(want) {
+		t.Fatalf("%v != %v", want, o.levels)
+	}
+	for i := range want {
+		if o.levels[i] != want[i] {
+			t.Fatalf("%v != %v", want, o.levels)
+		}
+	}
+	s := f.getState().(*aioesphomeapi.FanStateResponse)
+	if s.State || s.SpeedLevel != 2 || s.Speed != aioesphomeapi.FanSpeed_FAN_SPEED_MEDIUM {
+		t.Fatalf("unexpected state %v", s)
+	}
+	if err := f.fanCommand(&aioesphomeapi.FanCommandRequest{HasSpeedLevel: true, SpeedLevel: 5}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestFanPWM_BinaryOutput(t *testing.T) {
+	n := &Node{
+		cfg:     &config.Root{},
+		lookup:  map[uint32]component{},
+		outputs: map[string]output{"relay": &outputRecord{}},
+	}
+	cfg := config.Fan{Platform: "pwm", Name: "Exhaust", Output: "relay"}
+	if err := n.loadFan(context.Background(), &cfg); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package node
+
+import "errors"
+
+// fsSize returns the size in bytes of the file system containing path.
+func fsSize(path string) (uint64, error) {
+	return 0, errors.New("file system size is not supported on this OS")
+}
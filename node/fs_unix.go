@@ -0,0 +1,19 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package node
+
+import "syscall"
+
+// fsSize returns the size in bytes of the file system containing path.
+func fsSize(path string) (uint64, error) {
+	st := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bsize) * st.Blocks, nil
+}
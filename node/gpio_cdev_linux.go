@@ -0,0 +1,162 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// Linux gpio character device uAPI v2, from linux/gpio.h. Requires Linux 5.10
+// or later.
+const (
+	gpioV2LineFlagInput        = 1 << 2
+	gpioV2LineFlagEdgeRising   = 1 << 4
+	gpioV2LineFlagEdgeFalling  = 1 << 5
+	gpioV2LineFlagBiasPullUp   = 1 << 8
+	gpioV2LineFlagBiasPullDown = 1 << 9
+	gpioV2LineFlagBiasDisabled = 1 << 10
+
+	gpioV2LineEventRisingEdge = 1
+)
+
+type gpioV2LineAttribute struct {
+	id      uint32
+	padding uint32
+	value   uint64
+}
+
+type gpioV2LineConfigAttribute struct {
+	attr gpioV2LineAttribute
+	mask uint64
+}
+
+type gpioV2LineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [10]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	offsets         [64]uint32
+	consumer        [32]byte
+	config          gpioV2LineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+type gpioV2LineValues struct {
+	bits uint64
+	mask uint64
+}
+
+type gpioV2LineEvent struct {
+	timestampNs uint64
+	id          uint32
+	offset      uint32
+	seqno       uint32
+	lineSeqno   uint32
+	padding     [6]uint32
+}
+
+// ioctlWR returns the _IOWR() ioctl number for the gpio driver.
+func ioctlWR(nr, size uintptr) uintptr {
+	return 3<<30 | size<<16 | 0xB4<<8 | nr
+}
+
+var (
+	gpioV2GetLineIoctl       = ioctlWR(0x07, unsafe.Sizeof(gpioV2LineRequest{}))
+	gpioV2LineGetValuesIoctl = ioctlWR(0x0E, unsafe.Sizeof(gpioV2LineValues{}))
+)
+
+// cdevLine is an input line requested via the Linux gpio character device.
+//
+// Edges are delivered by the kernel as events, without polling.
+type cdevLine struct {
+	f *os.File
+}
+
+// openCdevLine requests the line at offset on chip, e.g. "/dev/gpiochip0", as
+// an input reporting both edges.
+func openCdevLine(chip string, offset int, pull gpio.Pull, consumer string) (*cdevLine, error) {
+	if offset < 0 {
+		return nil, errors.New("invalid line offset")
+	}
+	/* #nosec G304 */
+	c, err := os.OpenFile(chip, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	req := gpioV2LineRequest{numLines: 1}
+	req.offsets[0] = uint32(offset)
+	copy(req.consumer[:len(req.consumer)-1], consumer)
+	req.config.flags = gpioV2LineFlagInput | gpioV2LineFlagEdgeRising | gpioV2LineFlagEdgeFalling
+	switch pull {
+	case gpio.PullUp:
+		req.config.flags |= gpioV2LineFlagBiasPullUp
+	case gpio.PullDown:
+		req.config.flags |= gpioV2LineFlagBiasPullDown
+	case gpio.Float:
+		req.config.flags |= gpioV2LineFlagBiasDisabled
+	}
+	if err := ioctl(c.Fd(), gpioV2GetLineIoctl, unsafe.Pointer(&req)); err != nil {
+		return nil, err
+	}
+	// Non-blocking so the file uses the runtime poller and Close() unblocks a
+	// pending read.
+	if err := syscall.SetNonblock(int(req.fd), true); err != nil {
+		_ = syscall.Close(int(req.fd))
+		return nil, err
+	}
+	return &cdevLine{f: os.NewFile(uintptr(req.fd), chip)}, nil
+}
+
+func (l *cdevLine) Close() error {
+	return l.f.Close()
+}
+
+// read returns the current level.
+func (l *cdevLine) read() (bool, error) {
+	v := gpioV2LineValues{mask: 1}
+	c, err := l.f.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+	var err2 error
+	if err := c.Control(func(fd uintptr) {
+		err2 = ioctl(fd, gpioV2LineGetValuesIoctl, unsafe.Pointer(&v))
+	}); err != nil {
+		return false, err
+	}
+	return v.bits&1 != 0, err2
+}
+
+// waitEdge blocks until the next edge and returns the level after it.
+//
+// It returns an error once the line is closed.
+func (l *cdevLine) waitEdge() (bool, error) {
+	var e gpioV2LineEvent
+	b := (*[unsafe.Sizeof(e)]byte)(unsafe.Pointer(&e))[:]
+	if _, err := io.ReadFull(l.f, b); err != nil {
+		return false, err
+	}
+	return e.id == gpioV2LineEventRisingEdge, nil
+}
+
+func ioctl(fd, op uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, op, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package node
+
+import (
+	"errors"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// cdevLine is an input line requested via the Linux gpio character device.
+type cdevLine struct{}
+
+// openCdevLine requests the line at offset on chip, e.g. "/dev/gpiochip0", as
+// an input reporting both edges.
+func openCdevLine(chip string, offset int, pull gpio.Pull, consumer string) (*cdevLine, error) {
+	return nil, errors.New("gpio character device is not supported on this OS")
+}
+
+func (l *cdevLine) Close() error {
+	return nil
+}
+
+// read returns the current level.
+func (l *cdevLine) read() (bool, error) {
+	return false, errors.New("gpio character device is not supported on this OS")
+}
+
+// waitEdge blocks until the next edge and returns the level after it.
+func (l *cdevLine) waitEdge() (bool, error) {
+	return false, errors.New("gpio character device is not supported on this OS")
+}
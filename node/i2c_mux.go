@@ -0,0 +1,103 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/home/node/config"
+)
+
+// loadI2CMux opens a TCA9548A I²C multiplexer.
+//
+// Datasheet: https://www.ti.com/lit/ds/symlink/tca9548a.pdf
+func (n *Node) loadI2CMux(cfg *config.I2CMux) error {
+	log.Printf("loading i2c_mux %s", cfg.ID)
+	addr := uint16(0x70)
+	if cfg.Address != 0 {
+		addr = uint16(cfg.Address)
+	}
+	b, err := i2creg.Open(cfg.I2CID)
+	if err != nil {
+		return fmt.Errorf("i2c_mux(%s): %w", cfg.ID, err)
+	}
+	m := &i2cMux{bus: b, addr: addr}
+	// Confirm the multiplexer is present by disabling all the channels.
+	if err = m.bus.Tx(m.addr, []byte{0}, nil); err != nil {
+		_ = b.Close()
+		return fmt.Errorf("i2c_mux(%s): %w", cfg.ID, err)
+	}
+	n.muxes[cfg.ID] = m
+	return nil
+}
+
+// openSensorI2C opens the I²C bus specified by the sensor, which may be behind
+// a multiplexer.
+func (n *Node) openSensorI2C(cfg *config.Sensor) (i2c.BusCloser, error) {
+	if cfg.I2CMux == "" {
+		return i2creg.Open(cfg.I2CID)
+	}
+	m := n.muxes[cfg.I2CMux]
+	if m == nil {
+		return nil, fmt.Errorf("unknown i2c_mux %q", cfg.I2CMux)
+	}
+	if cfg.I2CMuxChannel < 0 || cfg.I2CMuxChannel > 7 {
+		return nil, fmt.Errorf("invalid i2c_mux_channel %d", cfg.I2CMuxChannel)
+	}
+	return &i2cMuxChannel{m: m, channel: uint8(cfg.I2CMuxChannel)}, nil
+}
+
+// i2cMux is a TCA9548A I²C multiplexer.
+type i2cMux struct {
+	bus  i2c.BusCloser
+	addr uint16
+
+	// mu is held while a channel is selected.
+	mu sync.Mutex
+}
+
+func (m *i2cMux) Close() error {
+	return m.bus.Close()
+}
+
+// i2cMuxChannel is a bus behind one channel of a multiplexer.
+type i2cMuxChannel struct {
+	m       *i2cMux
+	channel uint8
+}
+
+func (c *i2cMuxChannel) String() string {
+	return c.m.bus.String() + "/0x" + strconv.FormatUint(uint64(c.m.addr), 16) + "/" + strconv.Itoa(int(c.channel))
+}
+
+// Tx selects the channel, then does the transaction.
+//
+// The channel is selected each time, so another master or a reset of the
+// multiplexer doesn't redirect the transaction.
+func (c *i2cMuxChannel) Tx(addr uint16, w, r []byte) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	if err := c.m.bus.Tx(c.m.addr, []byte{1 << c.channel}, nil); err != nil {
+		return fmt.Errorf("i2c_mux: %w", err)
+	}
+	return c.m.bus.Tx(addr, w, r)
+}
+
+// SetSpeed is not supported since the bus is shared by all channels.
+func (c *i2cMuxChannel) SetSpeed(f physic.Frequency) error {
+	return errors.New("i2c_mux: can't change the bus speed of a channel")
+}
+
+// Close does nothing, the multiplexer owns the bus.
+func (c *i2cMuxChannel) Close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"testing"
+
+	"periph.io/x/conn/v3/i2c/i2ctest"
+	"periph.io/x/home/node/config"
+)
+
+func TestI2CMuxChannel(t *testing.T) {
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x71, W: []byte{0x08}},
+			{Addr: 0x76, W: []byte{0xD0}, R: []byte{0x60}},
+			{Addr: 0x71, W: []byte{0x01}},
+			{Addr: 0x76, W: []byte{0xD0}, R: []byte{0x58}},
+		},
+	}
+	n := &Node{muxes: map[string]*i2cMux{"mux": {bus: bus, addr: 0x71}}}
+	c3, err := n.openSensorI2C(&config.Sensor{I2CMux: "mux", I2CMuxChannel: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c0, err := n.openSensorI2C(&config.Sensor{I2CMux: "mux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both devices share the same address.
+	var r [1]byte
+	if err = c3.Tx(0x76, []byte{0xD0}, r[:]); err != nil {
+		t.Fatal(err)
+	}
+	if r[0] != 0x60 {
+		t.Fatalf("got 0x%x", r[0])
+	}
+	if err = c0.Tx(0x76, []byte{0xD0}, r[:]); err != nil {
+		t.Fatal(err)
+	}
+	if r[0] != 0x58 {
+		t.Fatalf("got 0x%x", r[0])
+	}
+	if _, err = n.openSensorI2C(&config.Sensor{I2CMux: "unknown"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// skipComponent handles a component that failed to initialize.
+//
+// With continue_on_error, the failure is published as a diagnostic text sensor
+// so the user can see in Home Assistant which component is broken, and the
+// node keeps loading the rest. Otherwise, err is returned.
+//
+// kind is the configuration section, name and platform are from the
+// component's configuration and i is its index in the section.
+func (n *Node) skipComponent(ctx context.Context, kind, name, platform string, i int, err error) error {
+	if !n.cfg.PeriphHome.ContinueOnError {
+		return err
+	}
+	log.Printf("skipping %s #%d: %s", kind, i, err)
+	label := name
+	if label == "" {
+		// Components like bme280 do not have a name.
+		label = fmt.Sprintf("%s #%d", platform, i+1)
+	}
+	t := &textSensorDiagnostic{
+		componentBase: componentBase{name: fmt.Sprintf("%s %s error", kind, label)},
+		icon:          "mdi:alert-circle-outline",
+	}
+	if err2 := n.addEntity(ctx, t); err2 != nil {
+		return fmt.Errorf("%w; failed to report it: %v", err, err2)
+	}
+	t.setValue(err.Error())
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+
+	"periph.io/x/home/node/config"
+)
+
+func TestContinueOnError(t *testing.T) {
+	cfg := config.Root{
+		Sensors: []config.Sensor{
+			// update_interval is missing.
+			{Platform: "fake", Name: "Broken"},
+			{Platform: "bme280"},
+		},
+	}
+	if n, err := New(context.Background(), &cfg); err == nil {
+		_ = n.Close()
+		t.Fatal("expected error")
+	}
+
+	cfg.PeriphHome.ContinueOnError = true
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if len(n.entities) != 2 {
+		t.Fatalf("got %d entities", len(n.entities))
+	}
+	want := []struct{ name, state string }{
+		{"sensor Broken error", "sensor(fake): update_interval is required"},
+		{"sensor bme280 #2 error", "sensor(bme280): specify a name for at least one sensor"},
+	}
+	for i, w := range want {
+		if got := n.entities[i].getName(); got != w.name {
+			t.Errorf("#%d: got name %q", i, got)
+		}
+		if got := stateString(n.entities[i]); got != w.state {
+			t.Errorf("#%d: got state %q", i, got)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"periph.io/x/home/node/config"
+)
+
+// lastError reports the most recent error of any component.
+type lastError struct {
+	mu sync.Mutex
+	t  *textSensorDiagnostic
+}
+
+// report is called by componentBase.setError().
+func (l *lastError) report(name string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.t != nil {
+		l.t.setValue(name + ": " + err.Error())
+	}
+}
+
+func (n *Node) loadTextSensorLastError(ctx context.Context, cfg *config.TextSensor) error {
+	if n.lastErr.t != nil {
+		return errors.New("only one last_error is supported")
+	}
+	t := &textSensorDiagnostic{
+		componentBase: componentBase{name: cfg.Name},
+		icon:          "mdi:alert-circle-outline",
+	}
+	if err := n.addEntity(ctx, t); err != nil {
+		return err
+	}
+	// No error yet.
+	t.setValue("")
+	n.lastErr.mu.Lock()
+	n.lastErr.t = t
+	n.lastErr.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestLastError(t *testing.T) {
+	ctx := context.Background()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	s := &textSensorDiagnostic{componentBase: componentBase{name: "Status"}}
+	if err := n.addEntity(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.loadTextSensorLastError(ctx, &config.TextSensor{Platform: "last_error", Name: "Last Error"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.loadTextSensorLastError(ctx, &config.TextSensor{Platform: "last_error", Name: "Other"}); err == nil {
+		t.Fatal("expected error")
+	}
+	l := n.entities[1]
+	get := func() string {
+		return l.getState().(*aioesphomeapi.TextSensorStateResponse).State
+	}
+	if v := get(); v != "" {
+		t.Fatal(v)
+	}
+	if msg, _ := s.getLastError(); msg != "" {
+		t.Fatal(msg)
+	}
+	s.setError(errors.New("i2c: nack"))
+	if v := get(); v != "Status: i2c: nack" {
+		t.Fatal(v)
+	}
+	if msg, ts := s.getLastError(); msg != "i2c: nack" || ts.IsZero() {
+		t.Fatal(msg, ts)
+	}
+}
@@ -6,10 +6,14 @@ package node
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 
+	"google.golang.org/protobuf/proto"
 	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
 
 func (n *Node) loadLight(ctx context.Context, cfg *config.Light) error {
@@ -25,7 +29,78 @@ func (n *Node) loadLight(ctx context.Context, cfg *config.Light) error {
 			return fmt.Errorf("light(%s): %w", cfg.Name, err)
 		}
 		return nil
+	case "group":
+		if err := n.loadLightGroup(ctx, cfg); err != nil {
+			return fmt.Errorf("light(%s): %w", cfg.Name, err)
+		}
+		return nil
+	case "monochromatic":
+		if err := n.loadLightMonochromatic(ctx, cfg); err != nil {
+			return fmt.Errorf("light(%s): %w", cfg.Name, err)
+		}
+		return nil
+	case "neopixel", "ws2812":
+		if err := n.loadLightWS2812(ctx, cfg); err != nil {
+			return fmt.Errorf("light(%s): %w", cfg.Name, err)
+		}
+		return nil
 	default:
 		return fmt.Errorf("unknown platform %q", cfg.Platform)
 	}
 }
+
+// lightState is the saved state of a light.
+type lightState struct {
+	State            bool    `json:"state"`
+	Brightness       float32 `json:"brightness"`
+	Red              float32 `json:"red"`
+	Green            float32 `json:"green"`
+	Blue             float32 `json:"blue"`
+	White            float32 `json:"white"`
+	ColorTemperature float32 `json:"color_temperature"`
+	Effect           string  `json:"effect,omitempty"`
+}
+
+// marshalLightState implements restorable.MarshalState for a light whose
+// current state is msg.
+func marshalLightState(msg proto.Message) ([]byte, error) {
+	s, _ := msg.(*aioesphomeapi.LightStateResponse)
+	if s == nil {
+		return nil, errors.New("no state")
+	}
+	return json.Marshal(&lightState{
+		State:            s.State,
+		Brightness:       s.Brightness,
+		Red:              s.Red,
+		Green:            s.Green,
+		Blue:             s.Blue,
+		White:            s.White,
+		ColorTemperature: s.ColorTemperature,
+		Effect:           s.Effect,
+	})
+}
+
+// unmarshalLightState implements restorable.UnmarshalState by replaying the
+// saved state as a command.
+func unmarshalLightState(b []byte, lightCommand func(in *aioesphomeapi.LightCommandRequest) error) error {
+	v := lightState{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return lightCommand(&aioesphomeapi.LightCommandRequest{
+		HasState:            true,
+		State:               v.State,
+		HasBrightness:       true,
+		Brightness:          v.Brightness,
+		HasRgb:              true,
+		Red:                 v.Red,
+		Green:               v.Green,
+		Blue:                v.Blue,
+		HasWhite:            true,
+		White:               v.White,
+		HasColorTemperature: true,
+		ColorTemperature:    v.ColorTemperature,
+		HasEffect:           v.Effect != "",
+		Effect:              v.Effect,
+	})
+}
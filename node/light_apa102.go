@@ -6,8 +6,7 @@ package node
 
 import (
 	"context"
-	"image"
-	"image/color"
+	"errors"
 
 	"google.golang.org/protobuf/proto"
 	"periph.io/x/conn/v3/spi"
@@ -18,55 +17,53 @@ import (
 )
 
 func (n *Node) loadLightAPA102(ctx context.Context, cfg *config.Light) error {
+	if cfg.NumLEDs == 0 {
+		return errors.New("num_leds is required")
+	}
 	// TODO(maruel): Allow specifying port.
 	p, err := spireg.Open("")
 	if err != nil {
 		return err
 	}
-	dev, err := apa102.New(p, &apa102.DefaultOpts)
+	opts := apa102.DefaultOpts
+	opts.NumPixels = cfg.NumLEDs
+	dev, err := apa102.New(p, &opts)
 	if err != nil {
 		_ = p.Close()
 		return err
 	}
-	return n.addEntity(ctx, &lightAPA102{
-		componentBase: componentBase{
-			name:          cfg.Name,
-			componentType: lightComponent,
-		},
-		p:   p,
-		d:   dev,
-		img: image.NewNRGBA(image.Rect(0, 0, cfg.NumLEDs, 1)),
-	})
+	l := &lightAPA102{
+		stripLight: newStripLight(cfg.Name, dev, cfg.NumLEDs),
+		p:          p,
+	}
+	l.colorTemperature = float32(dev.Temperature)
+	l.intensity = func(brightness, colorTemperature float32) {
+		dev.Intensity = uint8(255.*brightness + 0.5)
+		dev.Temperature = uint16(colorTemperature)
+	}
+	if err = n.addEntity(ctx, l); err != nil {
+		_ = p.Close()
+	}
+	return err
 }
 
+// lightAPA102 is an APA102 LED strip. It has a global intensity and color
+// temperature.
 type lightAPA102 struct {
-	componentBase
-	p   spi.PortCloser
-	d   *apa102.Dev
-	img *image.NRGBA
+	stripLight
+	p spi.PortCloser
 }
 
 func (l *lightAPA102) Close() error {
-	err := l.d.Halt()
+	err := l.stripLight.Close()
 	if err2 := l.p.Close(); err == nil {
 		err = err2
 	}
 	return err
 }
 
-func (l *lightAPA102) init(ctx context.Context, n *Node) error {
-	if err := l.componentBase.init(ctx, n); err != nil {
-		return err
-	}
-	l.onNewState(&aioesphomeapi.LightStateResponse{
-		Key:              l.key,
-		ColorTemperature: float32(l.d.Temperature),
-	})
-	return nil
-}
-
 func (l *lightAPA102) describe() proto.Message {
-	// TODO(maruel): Add mireds limits and effects.
+	// TODO(maruel): Add mireds limits.
 	return &aioesphomeapi.ListEntitiesLightResponse{
 		ObjectId:                       l.objectID,
 		Key:                            l.key,
@@ -78,34 +75,6 @@ func (l *lightAPA102) describe() proto.Message {
 		LegacySupportsColorTemperature: true,
 		MinMireds:                      0,
 		MaxMireds:                      0,
-		Effects:                        nil,
+		Effects:                        addressableEffects,
 	}
 }
-
-func (l *lightAPA102) lightCommand(in *aioesphomeapi.LightCommandRequest) error {
-	if !in.State {
-		_ = l.d.Halt()
-	} else {
-		// TODO(maruel): Proper rounding.
-		l.d.Intensity = uint8(255. * in.Brightness)
-		l.d.Temperature = uint16(in.ColorTemperature)
-		c := color.NRGBA{uint8(255. * in.Red), uint8(255. * in.Green), uint8(255. * in.Blue), 255}
-		for x := 0; x < 150; x++ {
-			l.img.SetNRGBA(x, 0, c)
-		}
-		_ = l.d.Draw(l.d.Bounds(), l.img, image.Point{})
-	}
-
-	l.onNewState(&aioesphomeapi.LightStateResponse{
-		Key:              l.key,
-		State:            in.State,
-		Brightness:       in.Brightness,
-		Red:              in.Red,
-		Green:            in.Green,
-		Blue:             in.Blue,
-		White:            in.White,
-		ColorTemperature: in.ColorTemperature,
-		Effect:           in.Effect,
-	})
-	return nil
-}
@@ -0,0 +1,129 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spireg"
+	"periph.io/x/conn/v3/spi/spitest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestLightAPA102(t *testing.T) {
+	r := &spitest.Record{}
+	o := func() (spi.PortCloser, error) {
+		return r, nil
+	}
+	if err := spireg.Register("FAKE_SPI", nil, 0, o); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := spireg.Unregister("FAKE_SPI"); err != nil {
+			t.Error(err)
+		}
+	}()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Light{Platform: "apa102", Name: "Strip", NumLEDs: 20}
+	if err := n.loadLight(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	l := n.entities[0]
+	in := aioesphomeapi.LightCommandRequest{State: true, Brightness: 1, Red: 1}
+	if err := l.lightCommand(&in); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Ops) == 0 {
+		t.Fatal("expected a write")
+	}
+	// Start frame, one frame per pixel and the end frame.
+	w := r.Ops[len(r.Ops)-1].W
+	if want := 4*(cfg.NumLEDs+1) + cfg.NumLEDs/16 + 1; len(w) != want {
+		t.Fatalf("wrote %d bytes, expected %d", len(w), want)
+	}
+	for i := 0; i < cfg.NumLEDs; i++ {
+		if w[4+4*i]&0xE0 != 0xE0 {
+			t.Fatalf("pixel %d: invalid frame %x", i, w[4+4*i:8+4*i])
+		}
+	}
+}
+
+func TestLightAPA102_Effect(t *testing.T) {
+	r := &spitest.Record{}
+	o := func() (spi.PortCloser, error) {
+		return r, nil
+	}
+	if err := spireg.Register("FAKE_SPI", nil, 0, o); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := spireg.Unregister("FAKE_SPI"); err != nil {
+			t.Error(err)
+		}
+	}()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Light{Platform: "apa102", Name: "Strip", NumLEDs: 2}
+	if err := n.loadLight(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	l := n.entities[0]
+	if d := l.describe().(*aioesphomeapi.ListEntitiesLightResponse); len(d.Effects) != len(addressableEffects) {
+		t.Fatalf("unexpected effects %v", d.Effects)
+	}
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{State: true, Brightness: 1, Effect: "Fireworks"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{State: true, Brightness: 1, Effect: "Rainbow"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := l.getState().(*aioesphomeapi.LightStateResponse); !s.State || s.Effect != "Rainbow" {
+		t.Fatalf("unexpected state %v", s)
+	}
+	// The effect draws frames on its own.
+	for start := time.Now(); ; {
+		r.Lock()
+		ops := len(r.Ops)
+		r.Unlock()
+		if ops >= 3 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// A static color stops the effect.
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{State: true, Brightness: 1, Red: 1, Effect: "None"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := l.getState().(*aioesphomeapi.LightStateResponse); !s.State || s.Effect != "" {
+		t.Fatalf("unexpected state %v", s)
+	}
+	r.Lock()
+	ops := len(r.Ops)
+	r.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	r.Lock()
+	running := len(r.Ops) != ops
+	r.Unlock()
+	if running {
+		t.Fatal("the effect is still running")
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLightAPA102_Err(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Light{Platform: "apa102", Name: "Strip"}
+	if err := n.loadLight(context.Background(), &cfg); err == nil {
+		t.Fatal("expected error")
+	}
+}
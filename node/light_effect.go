@@ -0,0 +1,119 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"time"
+)
+
+// addressableEffects are the names of the effects supported by addressable
+// LED strips, as shown in Home Assistant.
+var addressableEffects = []string{"Rainbow", "Color Wipe"}
+
+// addressableEffect is an animation on an addressable LED strip.
+type addressableEffect interface {
+	// interval is the delay between two frames.
+	interval() time.Duration
+	// next draws the next frame in img. It returns true at the end of a cycle.
+	next(img *image.NRGBA) bool
+}
+
+// newAddressableEffect returns the effect by name, or nil for "" and "None",
+// which mean a static color.
+//
+// c is the color selected, used by the effects that do not generate their
+// own.
+func newAddressableEffect(name string, c color.NRGBA) (addressableEffect, error) {
+	switch {
+	case name == "" || strings.EqualFold(name, "None"):
+		return nil, nil
+	case strings.EqualFold(name, "Rainbow"):
+		return &rainbowEffect{}, nil
+	case strings.EqualFold(name, "Color Wipe"):
+		return &colorWipeEffect{c: c}, nil
+	default:
+		return nil, fmt.Errorf("unknown effect %q", name)
+	}
+}
+
+// rainbowEffect scrolls a rainbow along the strip.
+type rainbowEffect struct {
+	// hue is the hue of the first LED, in degrees.
+	hue float64
+}
+
+func (r *rainbowEffect) interval() time.Duration {
+	return 20 * time.Millisecond
+}
+
+func (r *rainbowEffect) next(img *image.NRGBA) bool {
+	// A full rainbow spans 50 LEDs.
+	const width = 50
+	b := img.Bounds()
+	for x := b.Min.X; x < b.Max.X; x++ {
+		img.SetNRGBA(x, b.Min.Y, hueToNRGBA(r.hue+float64(x-b.Min.X)*360/width))
+	}
+	r.hue += 2
+	if r.hue >= 360 {
+		r.hue -= 360
+		return true
+	}
+	return false
+}
+
+// colorWipeEffect lights up the LEDs one at a time, then turns them off one
+// at a time.
+type colorWipeEffect struct {
+	c   color.NRGBA
+	pos int
+	off bool
+}
+
+func (w *colorWipeEffect) interval() time.Duration {
+	return 100 * time.Millisecond
+}
+
+func (w *colorWipeEffect) next(img *image.NRGBA) bool {
+	b := img.Bounds()
+	c := w.c
+	if w.off {
+		c = color.NRGBA{A: 255}
+	}
+	img.SetNRGBA(b.Min.X+w.pos, b.Min.Y, c)
+	if w.pos++; w.pos < b.Dx() {
+		return false
+	}
+	w.pos = 0
+	w.off = !w.off
+	// A cycle is done once the strip is off again.
+	return !w.off
+}
+
+// hueToNRGBA returns the fully saturated color at hue h, in degrees.
+func hueToNRGBA(h float64) color.NRGBA {
+	h = math.Mod(h, 360) / 60
+	f := h - math.Floor(h)
+	up := uint8(255*f + 0.5)
+	down := 255 - up
+	switch int(h) {
+	case 0:
+		return color.NRGBA{255, up, 0, 255}
+	case 1:
+		return color.NRGBA{down, 255, 0, 255}
+	case 2:
+		return color.NRGBA{0, 255, up, 255}
+	case 3:
+		return color.NRGBA{0, down, 255, 255}
+	case 4:
+		return color.NRGBA{up, 0, 255, 255}
+	default:
+		return color.NRGBA{255, 0, down, 255}
+	}
+}
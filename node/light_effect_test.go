@@ -0,0 +1,99 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNewAddressableEffect(t *testing.T) {
+	for _, name := range []string{"", "None", "none"} {
+		if e, err := newAddressableEffect(name, color.NRGBA{}); e != nil || err != nil {
+			t.Fatalf("%q: %v, %v", name, e, err)
+		}
+	}
+	for _, name := range addressableEffects {
+		if e, err := newAddressableEffect(name, color.NRGBA{}); e == nil || err != nil {
+			t.Fatalf("%q: %v, %v", name, e, err)
+		}
+	}
+	if _, err := newAddressableEffect("Fireworks", color.NRGBA{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRainbowEffect(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 26, 1))
+	e := &rainbowEffect{}
+	if e.next(img) {
+		t.Fatal("unexpected end of cycle")
+	}
+	// Pixel 25 is half way through the rainbow.
+	want := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 255, 255}}
+	for i, x := range []int{0, 25} {
+		if c := img.NRGBAAt(x, 0); c != want[i] {
+			t.Fatalf("pixel %d: %v != %v", x, c, want[i])
+		}
+	}
+	cycles := 0
+	// 2° per frame.
+	for i := 1; i < 180; i++ {
+		if e.next(img) {
+			cycles++
+		}
+	}
+	if cycles != 1 {
+		t.Fatalf("expected one cycle, got %d", cycles)
+	}
+}
+
+func TestColorWipeEffect(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	red := color.NRGBA{255, 0, 0, 255}
+	black := color.NRGBA{A: 255}
+	e := &colorWipeEffect{c: red}
+	want := [][]color.NRGBA{
+		{red, {}, {}},
+		{red, red, {}},
+		{red, red, red},
+		{black, red, red},
+		{black, black, red},
+		{black, black, black},
+	}
+	for i, w := range want {
+		cycle := e.next(img)
+		if cycle != (i == len(want)-1) {
+			t.Fatalf("#%d: unexpected cycle %t", i, cycle)
+		}
+		for x := range w {
+			if c := img.NRGBAAt(x, 0); c != w[x] {
+				t.Fatalf("#%d: pixel %d: %v != %v", i, x, c, w[x])
+			}
+		}
+	}
+}
+
+func TestHueToNRGBA(t *testing.T) {
+	data := []struct {
+		h    float64
+		want color.NRGBA
+	}{
+		{0, color.NRGBA{255, 0, 0, 255}},
+		{60, color.NRGBA{255, 255, 0, 255}},
+		{120, color.NRGBA{0, 255, 0, 255}},
+		{180, color.NRGBA{0, 255, 255, 255}},
+		{240, color.NRGBA{0, 0, 255, 255}},
+		{300, color.NRGBA{255, 0, 255, 255}},
+		{330, color.NRGBA{255, 0, 127, 255}},
+		{420, color.NRGBA{255, 255, 0, 255}},
+	}
+	for i, l := range data {
+		if got := hueToNRGBA(l.h); got != l.want {
+			t.Fatalf("#%d: %v != %v", i, got, l.want)
+		}
+	}
+}
@@ -55,6 +55,16 @@ func (l *lightFake) describe() proto.Message {
 	}
 }
 
+// MarshalState implements restorable.
+func (l *lightFake) MarshalState() ([]byte, error) {
+	return marshalLightState(l.getState())
+}
+
+// UnmarshalState implements restorable.
+func (l *lightFake) UnmarshalState(b []byte) error {
+	return unmarshalLightState(b, l.lightCommand)
+}
+
 func (l *lightFake) lightCommand(in *aioesphomeapi.LightCommandRequest) error {
 	l.onNewState(&aioesphomeapi.LightStateResponse{
 		Key:              l.key,
@@ -0,0 +1,168 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadLightGroup loads a light controlling other lights together.
+func (n *Node) loadLightGroup(ctx context.Context, cfg *config.Light) error {
+	if len(cfg.Lights) == 0 {
+		return errors.New("lights is required")
+	}
+	if cfg.NumLEDs != 0 || cfg.Output != "" || cfg.Pin != "" {
+		return errors.New("do not use num_leds / output / pin")
+	}
+	members, err := n.findEntities(cfg.Lights)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if m.getType() != lightComponent {
+			return fmt.Errorf("%s is not a light", m.getName())
+		}
+	}
+	return n.addEntity(ctx, &lightGroup{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: lightComponent,
+		},
+		members: members,
+	})
+}
+
+type lightGroup struct {
+	componentBase
+	members []component
+
+	wg     sync.WaitGroup
+	cancel func()
+
+	stateMu sync.Mutex
+	// states is the state of each member; nil until known.
+	states []*aioesphomeapi.LightStateResponse
+}
+
+func (l *lightGroup) Close() error {
+	l.cancel()
+	l.wg.Wait()
+	return nil
+}
+
+func (l *lightGroup) init(ctx context.Context, n *Node) error {
+	if err := l.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	l.states = make([]*aioesphomeapi.LightStateResponse, len(l.members))
+	ctx, l.cancel = context.WithCancel(ctx)
+	for i, m := range l.members {
+		l.wg.Add(1)
+		go func(i int, m component) {
+			defer l.wg.Done()
+			// The current state, if any, is sent right away.
+			m.subscribe(ctx, &groupInput{l: l, i: i})
+		}(i, m)
+	}
+	return nil
+}
+
+// describe advertises the features supported by any of the members.
+func (l *lightGroup) describe() proto.Message {
+	d := &aioesphomeapi.ListEntitiesLightResponse{
+		ObjectId: l.objectID,
+		Key:      l.key,
+		Name:     l.name,
+		UniqueId: l.uniqueID,
+	}
+	seen := map[int32]bool{}
+	for _, m := range l.members {
+		md, ok := m.describe().(*aioesphomeapi.ListEntitiesLightResponse)
+		if !ok {
+			continue
+		}
+		d.LegacySupportsBrightness = d.LegacySupportsBrightness || md.LegacySupportsBrightness
+		d.LegacySupportsRgb = d.LegacySupportsRgb || md.LegacySupportsRgb
+		d.LegacySupportsWhiteValue = d.LegacySupportsWhiteValue || md.LegacySupportsWhiteValue
+		d.LegacySupportsColorTemperature = d.LegacySupportsColorTemperature || md.LegacySupportsColorTemperature
+		for _, c := range md.SupportedColorModes {
+			if !seen[c] {
+				seen[c] = true
+				d.SupportedColorModes = append(d.SupportedColorModes, c)
+			}
+		}
+	}
+	return d
+}
+
+// lightCommand forwards the command to all the members.
+//
+// The group's state is updated as the members report their new state.
+func (l *lightGroup) lightCommand(in *aioesphomeapi.LightCommandRequest) error {
+	var err error
+	for _, m := range l.members {
+		c := proto.Clone(in).(*aioesphomeapi.LightCommandRequest)
+		c.Key = m.getHash()
+		if err2 := m.lightCommand(c); err2 != nil && err == nil {
+			err = fmt.Errorf("%s: %w", m.getName(), err2)
+		}
+	}
+	return err
+}
+
+// update processes a new state from member i.
+func (l *lightGroup) update(i int, msg *aioesphomeapi.LightStateResponse) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	l.states[i] = msg
+	s := aggregateLights(l.states)
+	s.Key = l.key
+	l.onNewState(s)
+}
+
+// aggregateLights returns the state of a group of lights.
+//
+// The group is on if any member is on, with the average brightness of the
+// members that are on. The color is the one of the first member that is on.
+// Unknown states are ignored.
+func aggregateLights(states []*aioesphomeapi.LightStateResponse) *aioesphomeapi.LightStateResponse {
+	out := &aioesphomeapi.LightStateResponse{}
+	var sum float32
+	on := 0
+	for _, s := range states {
+		if s == nil || !s.State {
+			continue
+		}
+		if on == 0 {
+			out = proto.Clone(s).(*aioesphomeapi.LightStateResponse)
+		}
+		sum += s.Brightness
+		on++
+	}
+	if on != 0 {
+		out.Brightness = sum / float32(on)
+	}
+	return out
+}
+
+// groupInput implements clientConn to receive the state updates of a member.
+type groupInput struct {
+	l *lightGroup
+	i int
+}
+
+func (g *groupInput) reply(msg proto.Message) error {
+	if s, ok := msg.(*aioesphomeapi.LightStateResponse); ok {
+		g.l.update(g.i, s)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestAggregateLights(t *testing.T) {
+	on := func(b float32) *aioesphomeapi.LightStateResponse {
+		return &aioesphomeapi.LightStateResponse{State: true, Brightness: b}
+	}
+	off := &aioesphomeapi.LightStateResponse{Brightness: 1}
+	data := []struct {
+		states         []*aioesphomeapi.LightStateResponse
+		wantState      bool
+		wantBrightness float32
+	}{
+		{[]*aioesphomeapi.LightStateResponse{nil, nil}, false, 0},
+		{[]*aioesphomeapi.LightStateResponse{off, off}, false, 0},
+		{[]*aioesphomeapi.LightStateResponse{on(0.5), off}, true, 0.5},
+		{[]*aioesphomeapi.LightStateResponse{on(0.25), on(0.75), nil}, true, 0.5},
+	}
+	for i, line := range data {
+		got := aggregateLights(line.states)
+		if got.State != line.wantState || got.Brightness != line.wantBrightness {
+			t.Errorf("#%d: got %t, %g", i, got.State, got.Brightness)
+		}
+	}
+}
+
+func TestLightGroup(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	ctx := context.Background()
+	for _, name := range []string{"Left", "Right"} {
+		if err := n.loadLight(ctx, &config.Light{Platform: "fake", Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := n.loadLight(ctx, &config.Light{Platform: "group", Name: "Both", Lights: []string{"Left", "Missing"}}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := n.loadLight(ctx, &config.Light{Platform: "group", Name: "Both", Lights: []string{"Left", "Right"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, e := range n.entities {
+			_ = e.Close()
+		}
+	}()
+	g := n.entities[2].(*lightGroup)
+	_, ch, _ := g.register()
+	// Wait for the group state to match.
+	wait := func(state bool, brightness float32) {
+		for {
+			if s, ok := g.getState().(*aioesphomeapi.LightStateResponse); ok && s.State == state && s.Brightness == brightness {
+				return
+			}
+			select {
+			case <-ch:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %t %g", state, brightness)
+			}
+		}
+	}
+	if err := g.lightCommand(&aioesphomeapi.LightCommandRequest{Key: g.getHash(), HasState: true, State: true, HasBrightness: true, Brightness: 0.8}); err != nil {
+		t.Fatal(err)
+	}
+	wait(true, 0.8)
+	for _, m := range n.entities[:2] {
+		if s := m.getState().(*aioesphomeapi.LightStateResponse); !s.State || s.Key != m.getHash() {
+			t.Fatalf("unexpected %v", s)
+		}
+	}
+	// A member changed on its own.
+	r := n.entities[1]
+	if err := r.lightCommand(&aioesphomeapi.LightCommandRequest{Key: r.getHash(), HasState: true, State: true, HasBrightness: true, Brightness: 0.4}); err != nil {
+		t.Fatal(err)
+	}
+	wait(true, 0.6)
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// ESPHome ColorMode values used by lights.
+const (
+	colorModeOnOff      = 1
+	colorModeBrightness = 3
+)
+
+func (n *Node) loadLightMonochromatic(ctx context.Context, cfg *config.Light) error {
+	if cfg.NumLEDs != 0 {
+		return errors.New("do not use num_leds")
+	}
+	o, err := n.findOutput(cfg.Output)
+	if err != nil {
+		return err
+	}
+	return n.addEntity(ctx, &lightMonochromatic{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: lightComponent,
+		},
+		o:          o,
+		brightness: 1,
+	})
+}
+
+// lightMonochromatic is a single channel light driven by an output.
+//
+// With a binary output, it is a simple on/off light.
+type lightMonochromatic struct {
+	componentBase
+	o output
+
+	// Protected by componentBase.mu.
+	on         bool
+	brightness float32
+}
+
+func (l *lightMonochromatic) Close() error {
+	return nil
+}
+
+func (l *lightMonochromatic) init(ctx context.Context, n *Node) error {
+	if err := l.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	l.onNewState(l.stateLocked())
+	return nil
+}
+
+func (l *lightMonochromatic) colorMode() int32 {
+	if l.o.isFloat() {
+		return colorModeBrightness
+	}
+	return colorModeOnOff
+}
+
+func (l *lightMonochromatic) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesLightResponse{
+		ObjectId:                 l.objectID,
+		Key:                      l.key,
+		Name:                     l.name,
+		UniqueId:                 l.uniqueID,
+		SupportedColorModes:      []int32{l.colorMode()},
+		LegacySupportsBrightness: l.o.isFloat(),
+	}
+}
+
+func (l *lightMonochromatic) lightCommand(in *aioesphomeapi.LightCommandRequest) error {
+	l.mu.Lock()
+	if in.HasState {
+		l.on = in.State
+	}
+	if in.HasBrightness && l.o.isFloat() {
+		l.brightness = in.Brightness
+	}
+	level := float32(0)
+	if l.on {
+		level = l.brightness
+	}
+	msg := l.stateLocked()
+	l.mu.Unlock()
+	if err := l.o.set(level); err != nil {
+		return err
+	}
+	l.onNewState(msg)
+	return nil
+}
+
+// MarshalState implements restorable.
+func (l *lightMonochromatic) MarshalState() ([]byte, error) {
+	return marshalLightState(l.getState())
+}
+
+// UnmarshalState implements restorable.
+func (l *lightMonochromatic) UnmarshalState(b []byte) error {
+	return unmarshalLightState(b, l.lightCommand)
+}
+
+// stateLocked returns the current state. l.mu must be held, except in init().
+func (l *lightMonochromatic) stateLocked() *aioesphomeapi.LightStateResponse {
+	return &aioesphomeapi.LightStateResponse{
+		Key:        l.key,
+		State:      l.on,
+		Brightness: l.brightness,
+		ColorMode:  l.colorMode(),
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestLightMonochromatic(t *testing.T) {
+	o := &outputRecord{float: true}
+	n := &Node{
+		cfg:     &config.Root{},
+		lookup:  map[uint32]component{},
+		outputs: map[string]output{"pwm": o},
+	}
+	cfg := config.Light{Platform: "monochromatic", Name: "Lamp", Output: "pwm"}
+	if err := n.loadLight(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	l := n.entities[0]
+	cmds := []aioesphomeapi.LightCommandRequest{
+		{HasState: true, State: true},
+		{HasBrightness: true, Brightness: 0.25},
+		{HasState: true, State: false},
+		{HasState: true, State: true},
+	}
+	for i := range cmds {
+		if err := l.lightCommand(&cmds[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []float32{1, 0.25, 0, 0.25}
+	if len(o.levels) != len(want) {
+		t.Fatalf("%v != %v", want, o.levels)
+	}
+	for i := range want {
+		if o.levels[i] != want[i] {
+			t.Fatalf("%v != %v", want, o.levels)
+		}
+	}
+	s := l.getState().(*aioesphomeapi.LightStateResponse)
+	if !s.State || s.Brightness != 0.25 || s.ColorMode != colorModeBrightness {
+		t.Fatalf("unexpected state %v", s)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLightMonochromatic_UnknownOutput(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}, outputs: map[string]output{}}
+	cfg := config.Light{Platform: "monochromatic", Name: "Lamp", Output: "pwm"}
+	if err := n.loadLight(context.Background(), &cfg); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// outputRecord is a fake output recording the levels set.
+type outputRecord struct {
+	float  bool
+	levels []float32
+}
+
+func (o *outputRecord) Close() error {
+	return nil
+}
+
+func (o *outputRecord) set(level float32) error {
+	o.levels = append(o.levels, level)
+	return nil
+}
+
+func (o *outputRecord) isFloat() bool {
+	return o.float
+}
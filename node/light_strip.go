@@ -0,0 +1,233 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// stripDevice is an addressable LED strip driver, e.g. *apa102.Dev or
+// *nrzled.Dev.
+type stripDevice interface {
+	Bounds() image.Rectangle
+	Draw(r image.Rectangle, src image.Image, sp image.Point) error
+	Halt() error
+}
+
+// stripLight implements the commands and the effects of an addressable LED
+// strip. It is embedded by the platforms.
+type stripLight struct {
+	componentBase
+	d   stripDevice
+	img *image.NRGBA
+	// intensity sets the global brightness, between 0 and 1, and the color
+	// temperature of the strip. When nil, the strip has no global intensity
+	// and the colors are scaled instead.
+	intensity func(brightness, colorTemperature float32)
+	// colorTemperature is the initial color temperature reported.
+	colorTemperature float32
+
+	// mu serializes the drawing.
+	mu sync.Mutex
+	// brightness scales the colors when intensity is nil.
+	brightness float32
+	scaled     *image.NRGBA
+	wg         sync.WaitGroup
+	// effects sends the effect to run to the animation goroutine, nil to stop
+	// it.
+	effects chan addressableEffect
+	done    <-chan struct{}
+	cancel  func()
+}
+
+// newStripLight returns a strip of n LEDs, initially off.
+func newStripLight(name string, d stripDevice, n int) stripLight {
+	return stripLight{
+		componentBase: componentBase{
+			name:          name,
+			componentType: lightComponent,
+		},
+		d:          d,
+		img:        image.NewNRGBA(image.Rect(0, 0, n, 1)),
+		brightness: 1,
+	}
+}
+
+// Close stops the effect and turns the LEDs off.
+func (l *stripLight) Close() error {
+	if l.cancel != nil {
+		l.cancel()
+		l.wg.Wait()
+	}
+	return l.d.Halt()
+}
+
+func (l *stripLight) init(ctx context.Context, n *Node) error {
+	if err := l.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	l.onNewState(&aioesphomeapi.LightStateResponse{
+		Key:              l.key,
+		ColorTemperature: l.colorTemperature,
+	})
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.done = ctx.Done()
+	l.effects = make(chan addressableEffect)
+	l.wg.Add(1)
+	go l.animate()
+	return nil
+}
+
+// animate runs the effect received on l.effects until the next one.
+func (l *stripLight) animate() {
+	defer l.wg.Done()
+	var e addressableEffect
+	var t *time.Ticker
+	var tick <-chan time.Time
+	defer func() {
+		if t != nil {
+			t.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-l.done:
+			return
+		case e = <-l.effects:
+			if t != nil {
+				t.Stop()
+				t, tick = nil, nil
+			}
+			if e == nil {
+				continue
+			}
+			t = time.NewTicker(e.interval())
+			tick = t.C
+		case <-tick:
+		}
+		l.mu.Lock()
+		cycle := e.next(l.img)
+		err := l.drawLocked()
+		c := l.img.NRGBAAt(0, 0)
+		l.mu.Unlock()
+		if err != nil {
+			l.setError(err)
+		}
+		if cycle {
+			// Report the color of the first LED, so it is visible that the
+			// effect is running.
+			if prev, ok := l.getState().(*aioesphomeapi.LightStateResponse); ok {
+				msg := proto.Clone(prev).(*aioesphomeapi.LightStateResponse)
+				msg.Red = float32(c.R) / 255
+				msg.Green = float32(c.G) / 255
+				msg.Blue = float32(c.B) / 255
+				l.onNewState(msg)
+			}
+		}
+	}
+}
+
+func (l *stripLight) lightCommand(in *aioesphomeapi.LightCommandRequest) error {
+	c := rgbToPixel(in.Red, in.Green, in.Blue)
+	var e addressableEffect
+	if in.State {
+		var err error
+		if e, err = newAddressableEffect(in.Effect, c); err != nil {
+			return err
+		}
+	}
+	// Stop the current effect, if any, before drawing.
+	select {
+	case l.effects <- nil:
+	case <-l.done:
+		return errors.New("light is closed")
+	}
+	var err error
+	l.mu.Lock()
+	if !in.State {
+		err = l.d.Halt()
+	} else {
+		if l.intensity != nil {
+			l.intensity(in.Brightness, in.ColorTemperature)
+		} else {
+			l.brightness = in.Brightness
+		}
+		if e == nil {
+			for x := 0; x < l.img.Bounds().Dx(); x++ {
+				l.img.SetNRGBA(x, 0, c)
+			}
+			err = l.drawLocked()
+		}
+	}
+	l.mu.Unlock()
+
+	effect := in.Effect
+	if e == nil {
+		effect = ""
+	}
+	l.onNewState(&aioesphomeapi.LightStateResponse{
+		Key:              l.key,
+		State:            in.State,
+		Brightness:       in.Brightness,
+		Red:              in.Red,
+		Green:            in.Green,
+		Blue:             in.Blue,
+		White:            in.White,
+		ColorTemperature: in.ColorTemperature,
+		Effect:           effect,
+	})
+	if e != nil {
+		select {
+		case l.effects <- e:
+		case <-l.done:
+		}
+	}
+	return err
+}
+
+// MarshalState implements restorable.
+func (l *stripLight) MarshalState() ([]byte, error) {
+	return marshalLightState(l.getState())
+}
+
+// UnmarshalState implements restorable.
+func (l *stripLight) UnmarshalState(b []byte) error {
+	return unmarshalLightState(b, l.lightCommand)
+}
+
+// drawLocked writes the image to the strip, scaled by the brightness when
+// the strip has no global intensity. l.mu must be held.
+func (l *stripLight) drawLocked() error {
+	img := l.img
+	if l.intensity == nil && l.brightness != 1 {
+		if l.scaled == nil {
+			l.scaled = image.NewNRGBA(l.img.Rect)
+		}
+		for i, v := range l.img.Pix {
+			if i%4 == 3 {
+				// Alpha.
+				l.scaled.Pix[i] = v
+			} else {
+				l.scaled.Pix[i] = uint8(float32(v)*l.brightness + 0.5)
+			}
+		}
+		img = l.scaled
+	}
+	return l.d.Draw(l.d.Bounds(), img, image.Point{})
+}
+
+// rgbToPixel converts the color channels of a LightCommandRequest, between 0
+// and 1, to a pixel.
+func rgbToPixel(r, g, b float32) color.NRGBA {
+	return color.NRGBA{uint8(255.*r + 0.5), uint8(255.*g + 0.5), uint8(255.*b + 0.5), 255}
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestStripLight(t *testing.T) {
+	d := &fakeStrip{}
+	l := newStripLight("Strip", d, 2)
+	n := &Node{cfg: &config.Root{}}
+	if err := l.init(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	// Without global intensity, the colors are scaled.
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{State: true, Brightness: 0.5, Red: 1, Blue: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{128, 0, 64, 255, 128, 0, 64, 255}; !bytes.Equal(d.pix, want) {
+		t.Fatalf("got %v, expected %v", d.pix, want)
+	}
+	if s := l.getState().(*aioesphomeapi.LightStateResponse); !s.State || s.Brightness != 0.5 || s.Red != 1 {
+		t.Fatalf("unexpected %v", s)
+	}
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if d.halted != 1 {
+		t.Fatal("expected halt")
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d.halted != 2 {
+		t.Fatal("expected halt")
+	}
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{State: true}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestStripLight_Intensity(t *testing.T) {
+	d := &fakeStrip{}
+	l := newStripLight("Strip", d, 1)
+	var brightness, temp float32
+	l.intensity = func(b, c float32) {
+		brightness, temp = b, c
+	}
+	if err := l.init(context.Background(), &Node{cfg: &config.Root{}}); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{State: true, Brightness: 0.5, Green: 1, ColorTemperature: 300}); err != nil {
+		t.Fatal(err)
+	}
+	// The strip applies the brightness itself.
+	if want := []byte{0, 255, 0, 255}; !bytes.Equal(d.pix, want) {
+		t.Fatalf("got %v, expected %v", d.pix, want)
+	}
+	if brightness != 0.5 || temp != 300 {
+		t.Fatalf("unexpected %g, %g", brightness, temp)
+	}
+}
+
+func TestRGBToPixel(t *testing.T) {
+	if c := rgbToPixel(1, 0.5, 0); c != (color.NRGBA{255, 128, 0, 255}) {
+		t.Fatal(c)
+	}
+}
+
+// fakeStrip is a stripDevice recording the last image drawn.
+type fakeStrip struct {
+	pix    []byte
+	halted int
+}
+
+func (f *fakeStrip) Bounds() image.Rectangle {
+	return image.Rect(0, 0, 1, 1)
+}
+
+func (f *fakeStrip) Draw(r image.Rectangle, src image.Image, sp image.Point) error {
+	f.pix = append([]byte(nil), src.(*image.NRGBA).Pix...)
+	return nil
+}
+
+func (f *fakeStrip) Halt() error {
+	f.halted++
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/gpio/gpiostream"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi/spireg"
+	"periph.io/x/devices/v3/nrzled"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+	"periph.io/x/host/v3/rpi"
+)
+
+// loadLightWS2812 loads a WS2812 (NeoPixel) LED strip, as platform
+// "neopixel" or "ws2812".
+//
+// On a Raspberry Pi with a pin specified, the bits are clocked out by DMA,
+// which is not affected by the CPU load. Otherwise the bits are encoded on the
+// SPI MOSI line.
+func (n *Node) loadLightWS2812(ctx context.Context, cfg *config.Light) error {
+	if cfg.NumLEDs == 0 {
+		return errors.New("num_leds is required")
+	}
+	opts := nrzled.DefaultOpts
+	opts.NumPixels = cfg.NumLEDs
+	l := &lightWS2812{}
+	if cfg.Pin != "" {
+		if !rpi.Present() {
+			return errors.New("pin is only supported on a Raspberry Pi, remove it to use SPI")
+		}
+		p := gpioreg.ByName(cfg.Pin)
+		if p == nil {
+			return fmt.Errorf("unknown pin %q", cfg.Pin)
+		}
+		// The other pins are DMA driven at up to 200kHz, which is too slow for
+		// the 800kHz of the WS2812.
+		s, ok := p.(gpiostream.PinOut)
+		if !ok || p.Number() != 21 {
+			return fmt.Errorf("pin %s doesn't support DMA streaming at 800kHz, use GPIO21", p)
+		}
+		dev, err := nrzled.NewStream(s, &opts)
+		if err != nil {
+			return err
+		}
+		l.stripLight = newStripLight(cfg.Name, dev, cfg.NumLEDs)
+	} else {
+		p, err := spireg.Open("")
+		if err != nil {
+			return err
+		}
+		// Each bit is encoded as 4 SPI bits, which NewSPI only supports at
+		// this clock.
+		opts.Freq = 2500 * physic.KiloHertz
+		dev, err := nrzled.NewSPI(p, &opts)
+		if err != nil {
+			_ = p.Close()
+			return err
+		}
+		l.stripLight = newStripLight(cfg.Name, dev, cfg.NumLEDs)
+		l.p = p
+	}
+	err := n.addEntity(ctx, l)
+	if err != nil && l.p != nil {
+		_ = l.p.Close()
+	}
+	return err
+}
+
+// lightWS2812 is a WS2812 LED strip. It has no global intensity, so the
+// colors are scaled by the brightness.
+type lightWS2812 struct {
+	stripLight
+	// p is the SPI port, if used.
+	p io.Closer
+}
+
+func (l *lightWS2812) Close() error {
+	err := l.stripLight.Close()
+	if l.p != nil {
+		if err2 := l.p.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (l *lightWS2812) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesLightResponse{
+		ObjectId:                 l.objectID,
+		Key:                      l.key,
+		Name:                     l.name,
+		UniqueId:                 l.uniqueID,
+		LegacySupportsBrightness: true,
+		LegacySupportsRgb:        true,
+		Effects:                  addressableEffects,
+	}
+}
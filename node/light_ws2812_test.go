@@ -0,0 +1,87 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spireg"
+	"periph.io/x/conn/v3/spi/spitest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestLightWS2812_SPI(t *testing.T) {
+	r := &spitest.Record{}
+	o := func() (spi.PortCloser, error) {
+		return r, nil
+	}
+	if err := spireg.Register("FAKE_SPI", nil, 0, o); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := spireg.Unregister("FAKE_SPI"); err != nil {
+			t.Error(err)
+		}
+	}()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Light{Platform: "ws2812", Name: "Strip", NumLEDs: 8}
+	if err := n.loadLight(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	l := n.entities[0]
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{State: true, Brightness: 1, Red: 1}); err != nil {
+		t.Fatal(err)
+	}
+	r.Lock()
+	if len(r.Ops) == 0 {
+		r.Unlock()
+		t.Fatal("expected a write")
+	}
+	// The latch, 4 bytes per color channel and the latch.
+	w := r.Ops[len(r.Ops)-1].W
+	r.Unlock()
+	if want := 3 + 4*3*cfg.NumLEDs + 3; len(w) != want {
+		t.Fatalf("wrote %d bytes, expected %d", len(w), want)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLightNeopixel(t *testing.T) {
+	r := &spitest.Record{}
+	o := func() (spi.PortCloser, error) {
+		return r, nil
+	}
+	if err := spireg.Register("FAKE_SPI", nil, 0, o); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := spireg.Unregister("FAKE_SPI"); err != nil {
+			t.Error(err)
+		}
+	}()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	if err := n.loadLight(context.Background(), &config.Light{Platform: "neopixel", Name: "Strip"}); err == nil {
+		t.Fatal("expected num_leds to be required")
+	}
+	if err := n.loadLight(context.Background(), &config.Light{Platform: "neopixel", Name: "Strip", NumLEDs: 8}); err != nil {
+		t.Fatal(err)
+	}
+	l := n.entities[0]
+	d := l.describe().(*aioesphomeapi.ListEntitiesLightResponse)
+	if !d.LegacySupportsRgb || !d.LegacySupportsBrightness || len(d.Effects) != len(addressableEffects) {
+		t.Fatalf("unexpected %v", d)
+	}
+	if err := l.lightCommand(&aioesphomeapi.LightCommandRequest{State: true, Brightness: 1, Red: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// listenRetries is the number of times listen() retries when the port is in
+// use, listenRetryDelay apart. When restarted by systemd, the previous
+// instance may still be shutting down.
+const listenRetries = 5
+
+// listenRetryDelay is a variable to be overridden in tests.
+var listenRetryDelay = time.Second
+
+// listen listens on the TCP port of host, retrying for a few seconds if the
+// port is in use. what is the name of the server for the error message.
+//
+// Go already sets SO_REUSEADDR on unix, so a port lingering in TIME_WAIT from
+// a previous instance is not an issue. The port being in use means another
+// process is actively listening on it.
+func listen(ctx context.Context, what, host string, port int) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	// When host is empty, Go listens on both IPv4 and IPv6 so IPv6-only
+	// networks work. JoinHostPort adds the brackets around IPv6 literals.
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	for i := 0; ; i++ {
+		ln, err := lc.Listen(ctx, "tcp", addr)
+		if err == nil {
+			return ln, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+		if i == listenRetries {
+			return nil, fmt.Errorf("%s port %d is already in use, likely by another periphhome or ESPHome instance; stop it or change the port in the config: %w", what, port, err)
+		}
+		log.Printf("%s port %d is in use, retrying", what, port)
+		sleepContext(ctx, listenRetryDelay)
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListen_InUse(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows reports WSAEADDRINUSE")
+	}
+	old := listenRetryDelay
+	listenRetryDelay = time.Millisecond
+	defer func() {
+		listenRetryDelay = old
+	}()
+	port := getFreePort(t)
+	l, err := listen(context.Background(), "api", networkBind, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, err = listen(context.Background(), "api", networkBind, port)
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("unexpected %v", err)
+	}
+	if !strings.Contains(err.Error(), "api port") || !strings.Contains(err.Error(), "already in use") {
+		t.Fatal(err)
+	}
+}
+
+func TestListen_IPv6(t *testing.T) {
+	l, err := listen(context.Background(), "api", "::1", 0)
+	if err != nil {
+		// The host may not have IPv6 at all.
+		t.Skip(err)
+	}
+	defer l.Close()
+	if a := l.Addr().(*net.TCPAddr); !a.IP.Equal(net.IPv6loopback) {
+		t.Fatalf("unexpected %s", a)
+	}
+}
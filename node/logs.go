@@ -0,0 +1,105 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// logSink is the output of the log package while the node is running.
+//
+// It writes to the previous output and forwards each line to the clients that
+// called SubscribeLogs.
+type logSink struct {
+	w io.Writer
+
+	mu   sync.Mutex
+	subs map[chan *aioesphomeapi.SubscribeLogsResponse]aioesphomeapi.LogLevel
+}
+
+func newLogSink(w io.Writer) *logSink {
+	return &logSink{w: w, subs: map[chan *aioesphomeapi.SubscribeLogsResponse]aioesphomeapi.LogLevel{}}
+}
+
+// Write implements io.Writer.
+//
+// The log package calls it once per line.
+func (l *logSink) Write(b []byte) (int, error) {
+	n, err := l.w.Write(b)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.subs) == 0 {
+		return n, err
+	}
+	level := parseLogLevel(string(b))
+	var msg *aioesphomeapi.SubscribeLogsResponse
+	for ch, max := range l.subs {
+		if level > max {
+			continue
+		}
+		if msg == nil {
+			// b is reused by the caller.
+			msg = &aioesphomeapi.SubscribeLogsResponse{
+				Level:   level,
+				Message: []byte(strings.TrimSuffix(string(b), "\n")),
+			}
+		}
+		// Never block logging on a slow client; drop the line instead.
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+	return n, err
+}
+
+// add registers a subscriber for the lines at level or more severe.
+func (l *logSink) add(level aioesphomeapi.LogLevel) chan *aioesphomeapi.SubscribeLogsResponse {
+	ch := make(chan *aioesphomeapi.SubscribeLogsResponse, 64)
+	l.mu.Lock()
+	l.subs[ch] = level
+	l.mu.Unlock()
+	return ch
+}
+
+// remove unregisters a subscriber returned by add.
+func (l *logSink) remove(ch chan *aioesphomeapi.SubscribeLogsResponse) {
+	l.mu.Lock()
+	delete(l.subs, ch)
+	l.mu.Unlock()
+}
+
+// logLevels maps the severity prefixes to the log levels.
+var logLevels = map[string]aioesphomeapi.LogLevel{
+	"ERROR:":   aioesphomeapi.LogLevel_LOG_LEVEL_ERROR,
+	"WARN:":    aioesphomeapi.LogLevel_LOG_LEVEL_WARN,
+	"WARNING:": aioesphomeapi.LogLevel_LOG_LEVEL_WARN,
+	"INFO:":    aioesphomeapi.LogLevel_LOG_LEVEL_INFO,
+	"CONFIG:":  aioesphomeapi.LogLevel_LOG_LEVEL_CONFIG,
+	"DEBUG:":   aioesphomeapi.LogLevel_LOG_LEVEL_DEBUG,
+	"VERBOSE:": aioesphomeapi.LogLevel_LOG_LEVEL_VERBOSE,
+}
+
+// parseLogLevel returns the severity of a log line.
+//
+// The severity is an optional prefix to the message, like "WARN: disk full".
+// The date, time and file prefixes added by the log package are skipped.
+// Lines without a severity are INFO.
+func parseLogLevel(line string) aioesphomeapi.LogLevel {
+	// At most date, time and file precede the message.
+	for i, f := range strings.Fields(line) {
+		if i == 4 {
+			break
+		}
+		if l, ok := logLevels[f]; ok {
+			return l
+		}
+	}
+	return aioesphomeapi.LogLevel_LOG_LEVEL_INFO
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	data := []struct {
+		line string
+		want aioesphomeapi.LogLevel
+	}{
+		{"hello\n", aioesphomeapi.LogLevel_LOG_LEVEL_INFO},
+		{"WARN: disk full\n", aioesphomeapi.LogLevel_LOG_LEVEL_WARN},
+		{"2021/01/02 15:04:05.000000 api.go:12: ERROR: boom\n", aioesphomeapi.LogLevel_LOG_LEVEL_ERROR},
+		{"2021/01/02 15:04:05 DEBUG: x\n", aioesphomeapi.LogLevel_LOG_LEVEL_DEBUG},
+		// Only a prefix counts.
+		{"2021/01/02 15:04:05 api.go:12: got an ERROR: boom\n", aioesphomeapi.LogLevel_LOG_LEVEL_INFO},
+	}
+	for i, l := range data {
+		if got := parseLogLevel(l.line); got != l.want {
+			t.Errorf("#%d: %s != %s", i, got, l.want)
+		}
+	}
+}
+
+func TestLogSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := newLogSink(&buf)
+	warn := s.add(aioesphomeapi.LogLevel_LOG_LEVEL_WARN)
+	debug := s.add(aioesphomeapi.LogLevel_LOG_LEVEL_DEBUG)
+	l := log.New(s, "", 0)
+	l.Printf("DEBUG: details")
+	l.Printf("WARN: careful")
+	s.remove(debug)
+	l.Printf("ERROR: broken")
+
+	if got := buf.String(); got != "DEBUG: details\nWARN: careful\nERROR: broken\n" {
+		t.Fatalf("%q", got)
+	}
+	for i, want := range []string{"WARN: careful", "ERROR: broken"} {
+		if got := string((<-warn).Message); got != want {
+			t.Errorf("#%d: %q != %q", i, got, want)
+		}
+	}
+	for i, want := range []string{"DEBUG: details", "WARN: careful"} {
+		if got := string((<-debug).Message); got != want {
+			t.Errorf("#%d: %q != %q", i, got, want)
+		}
+	}
+	select {
+	case msg := <-warn:
+		t.Fatalf("unexpected %q", msg.Message)
+	case msg := <-debug:
+		t.Fatalf("unexpected %q", msg.Message)
+	default:
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// pauser is implemented by components accessing hardware.
+//
+// While paused, a component doesn't touch the hardware and released its bus
+// handles, so it can be rewired safely. It keeps its last state so clients do
+// not see it as unavailable.
+type pauser interface {
+	pause() error
+	// resume reopens the hardware and restarts sensing.
+	resume(ctx context.Context) error
+}
+
+// loadSwitchMaintenance loads the switch toggling maintenance mode.
+func (n *Node) loadSwitchMaintenance(ctx context.Context) error {
+	return n.addEntity(ctx, &switchMaintenance{
+		componentBase: componentBase{name: "Maintenance", componentType: switchComponent},
+		n:             n,
+	})
+}
+
+// switchMaintenance pauses all the components implementing pauser while on.
+type switchMaintenance struct {
+	componentBase
+	n   *Node
+	ctx context.Context
+
+	// opMu serializes the transitions.
+	opMu sync.Mutex
+	on   bool
+}
+
+func (s *switchMaintenance) Close() error {
+	return nil
+}
+
+func (s *switchMaintenance) init(ctx context.Context, n *Node) error {
+	if err := s.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	s.ctx = ctx
+	s.onNewState(&aioesphomeapi.SwitchStateResponse{Key: s.key})
+	return nil
+}
+
+func (s *switchMaintenance) switchCommand(in *aioesphomeapi.SwitchCommandRequest) error {
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+	if in.State == s.on {
+		return nil
+	}
+	s.on = in.State
+	if s.on {
+		log.Printf("entering maintenance mode")
+	} else {
+		log.Printf("leaving maintenance mode")
+	}
+	for _, e := range s.n.entities {
+		p, ok := e.(pauser)
+		if !ok {
+			continue
+		}
+		var err error
+		if s.on {
+			err = p.pause()
+		} else {
+			err = p.resume(s.ctx)
+		}
+		// Keep going so a single broken component doesn't block the others.
+		if err != nil {
+			log.Printf("%s: %s", e.getName(), err)
+		}
+	}
+	s.onNewState(&aioesphomeapi.SwitchStateResponse{Key: s.key, State: s.on})
+	return nil
+}
+
+func (s *switchMaintenance) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesSwitchResponse{
+		ObjectId:       s.objectID,
+		Key:            s.key,
+		Name:           s.name,
+		UniqueId:       s.uniqueID,
+		Icon:           "mdi:wrench",
+		EntityCategory: aioesphomeapi.EntityCategory_ENTITY_CATEGORY_DIAGNOSTIC,
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestSwitchMaintenance(t *testing.T) {
+	ctx := context.Background()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	p := &fakePauser{textSensorDiagnostic: textSensorDiagnostic{componentBase: componentBase{name: "Status"}}}
+	if err := n.addEntity(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := n.loadSwitchMaintenance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s := n.entities[1]
+	state := func() bool {
+		return s.getState().(*aioesphomeapi.SwitchStateResponse).State
+	}
+	if state() {
+		t.Fatal("expected off")
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.switchCommand(&aioesphomeapi.SwitchCommandRequest{Key: s.getHash(), State: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !state() || p.paused != 1 || p.resumed != 0 {
+		t.Fatalf("unexpected %t %d %d", state(), p.paused, p.resumed)
+	}
+	if err := s.switchCommand(&aioesphomeapi.SwitchCommandRequest{Key: s.getHash()}); err != nil {
+		t.Fatal(err)
+	}
+	if state() || p.paused != 1 || p.resumed != 1 {
+		t.Fatalf("unexpected %t %d %d", state(), p.paused, p.resumed)
+	}
+}
+
+type fakePauser struct {
+	textSensorDiagnostic
+	paused  int
+	resumed int
+}
+
+func (f *fakePauser) pause() error {
+	f.paused++
+	return nil
+}
+
+func (f *fakePauser) resume(ctx context.Context) error {
+	f.resumed++
+	return nil
+}
@@ -8,10 +8,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"hash/fnv"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,58 +24,101 @@ import (
 
 	"github.com/grandcat/zeroconf"
 	"google.golang.org/protobuf/proto"
+	"periph.io/x/conn/v3/gpio/gpioreg"
 	"periph.io/x/home/node/config"
 	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
 
 const version = "0.1"
 
+// ErrShutdownTimeout is returned by Close when connections or components did
+// not stop within periphhome/shutdown_timeout.
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
+// defaultShutdownTimeout is used when periphhome/shutdown_timeout is not set.
+const defaultShutdownTimeout = 10 * time.Second
+
 // New loads a configuration and instantiate a node.
 func New(ctx context.Context, cfg *config.Root) (*Node, error) {
-	ifa, mac := getMainAddr()
+	return newNode(ctx, cfg, nil)
+}
+
+// NewSafeMode instantiates a node exposing a diagnostic text sensor reporting
+// cfgErr, the error that prevented the normal configuration from loading.
+//
+// cfg is expected to be the minimal configuration returned by
+// config.SafeMode(), so that the node is still reachable over the network.
+func NewSafeMode(ctx context.Context, cfg *config.Root, cfgErr error) (*Node, error) {
+	return newNode(ctx, cfg, cfgErr)
+}
+
+func newNode(ctx context.Context, cfg *config.Root, cfgErr error) (*Node, error) {
+	// Fail fast on a typo before any hardware is opened.
+	if err := checkPins(cfg); err != nil {
+		return nil, err
+	}
+	ifa, mac, err := selectAddr(&cfg.PeriphHome)
+	if err != nil {
+		return nil, err
+	}
 	n := &Node{
-		cfg:    cfg,
-		lookup: map[uint32]component{},
-		mac:    mac,
+		cfg:       cfg,
+		lookup:    map[uint32]component{},
+		outputs:   map[string]output{},
+		muxes:     map[string]*i2cMux{},
+		mac:       mac,
+		bind:      networkBind,
+		startTime: time.Now(),
+	}
+	if cfg.PeriphHome.BindAddress != "" {
+		n.bind = cfg.PeriphHome.BindAddress
 	}
 
 	hostname, err := os.Hostname()
 	if err != nil {
 		return nil, err
 	}
+	n.model = boardModel()
 
-	// Parses all the sensors.
-	for i := range cfg.BinarySensors {
-		if err = n.loadBinarySensor(ctx, &cfg.BinarySensors[i]); err != nil {
-			// Since we're partially initialized, take the time to close the
-			// components that were initialized.
-			_ = n.Close()
+	if d := cfg.PeriphHome.StateDir; d != "" {
+		/* #nosec G301 */
+		if err = os.MkdirAll(d, 0o755); err != nil {
 			return nil, err
 		}
-	}
-	for i := range cfg.Sensors {
-		if err = n.loadSensor(ctx, &cfg.Sensors[i]); err != nil {
-			// Since we're partially initialized, take the time to close the
-			// components that were initialized.
-			_ = n.Close()
+		if err = n.recordBoot(d); err != nil {
 			return nil, err
 		}
-	}
-	for i := range cfg.Lights {
-		if err = n.loadLight(ctx, &cfg.Lights[i]); err != nil {
-			// Since we're partially initialized, take the time to close the
-			// components that were initialized.
-			_ = n.Close()
-			return nil, err
+		// A corrupted file is not a reason to fail startup, neither here nor
+		// for the state store below.
+		if err = n.stats.load(d, n.bootCount); err != nil {
+			log.Printf("failed to load connection stats: %s", err)
+		}
+		if cfg.PeriphHome.AvailabilityGrace != 0 {
+			if n.restored, err = loadStateSnapshot(d, cfg.PeriphHome.AvailabilityGrace); err != nil {
+				log.Printf("failed to load saved states: %s", err)
+			}
 		}
 	}
-	for i := range cfg.Cameras {
-		if err = n.loadCamera(ctx, &cfg.Cameras[i]); err != nil {
-			// Since we're partially initialized, take the time to close the
-			// components that were initialized.
-			_ = n.Close()
+
+	if d := cfg.PeriphHome.StateStore; d != "" {
+		if n.store, err = newStateStore(d); err != nil {
 			return nil, err
 		}
+		if err = n.store.load(); err != nil {
+			log.Printf("failed to load component states: %s", err)
+		}
+	}
+
+	// Forward the logs to the clients calling SubscribeLogs. Close() restores
+	// the previous output.
+	n.logs = newLogSink(log.Writer())
+	log.SetOutput(n.logs)
+
+	if err = n.loadComponents(ctx, cfgErr); err != nil {
+		// Since we're partially initialized, take the time to close the
+		// components that were initialized.
+		_ = n.Close()
+		return nil, err
 	}
 
 	// Start the native API server.
@@ -85,6 +133,14 @@ func New(ctx context.Context, cfg *config.Root) (*Node, error) {
 		}
 	}
 
+	// Start the web server.
+	if n.cfg.WebServer.IsPresent {
+		if err := n.webServer(ctx, n.webPort()); err != nil {
+			_ = n.Close()
+			return nil, fmt.Errorf("failed to start web server: %w", err)
+		}
+	}
+
 	// Make the device discoverable via eroconf but not in unit test because it
 	// will throw a firewall prompt on Windows.
 	if networkBind == "" {
@@ -99,6 +155,9 @@ func New(ctx context.Context, cfg *config.Root) (*Node, error) {
 		// TODO(maruel): What about when the native api is not enabled? Right now
 		// it exposes an invalid port.
 		log.Printf("Advertizing via zeroconf %v", text)
+		// zeroconf advertises both the A and AAAA records of the interface and
+		// only requires one of IPv4 or IPv6 multicast to work, so IPv6-only
+		// networks are supported.
 		var ifas []net.Interface
 		if ifa != nil {
 			ifas = append(ifas, *ifa)
@@ -110,29 +169,322 @@ func New(ctx context.Context, cfg *config.Root) (*Node, error) {
 		}
 		n.zc = zc
 	}
+	n.restored = nil
+	n.started = true
 	return n, nil
 }
 
+// pinExists returns true if the GPIO pin is registered.
+func pinExists(name string) bool {
+	return gpioreg.ByName(name) != nil
+}
+
+// checkPins returns an error if cfg uses unknown pins.
+//
+// With continue_on_error, it is only logged: the affected components fail to
+// load and are skipped like any other failing component.
+func checkPins(cfg *config.Root) error {
+	err := cfg.ValidatePins(pinExists)
+	if err == nil || !cfg.PeriphHome.ContinueOnError {
+		return err
+	}
+	log.Printf("%s; skipping the components using them", err)
+	return nil
+}
+
+// loadComponents loads everything defined in n.cfg, except the servers. It is
+// used by New() and Reload().
+//
+// cfgErr, if set, is reported by a text sensor.
+func (n *Node) loadComponents(ctx context.Context, cfgErr error) error {
+	cfg := n.cfg
+	var err error
+	// Time sources are loaded first, so the system time is set before anything
+	// else is started.
+	for i := range cfg.Times {
+		if err = n.loadTime(ctx, &cfg.Times[i]); err != nil {
+			return err
+		}
+	}
+
+	// Outputs are loaded before the entities referencing them.
+	for i := range cfg.Outputs {
+		c := &cfg.Outputs[i]
+		if err = n.loadOutput(c); err != nil {
+			// The entities using it fail to load, and are skipped as well.
+			if err = n.skipComponent(ctx, "output", c.ID, c.Platform, i, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Multiplexers are loaded before the sensors behind them.
+	for i := range cfg.I2CMuxes {
+		if err = n.loadI2CMux(&cfg.I2CMuxes[i]); err != nil {
+			return err
+		}
+	}
+
+	n.loaded = n.entries(cfg, cfgErr)
+	for _, e := range n.loaded {
+		if err = n.loadEntry(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	// All the entities are loaded, so the referenced targets exist.
+	n.startActions(ctx, "on_boot", cfg.PeriphHome.OnBoot)
+	n.loadServices()
+	return nil
+}
+
+// entry is an entry of the configuration loading entities or a display.
+//
+// Reload() compares the entries by id to only reload the ones that changed.
+type entry struct {
+	kind     string
+	name     string
+	platform string
+	// index is the position of the entry in its section.
+	index int
+	// cfg is the configuration of the entry, e.g. *config.Sensor.
+	cfg interface{}
+	// refs are the names of the entities the entry uses, which must be loaded
+	// before it.
+	refs []string
+	// required entries fail the load instead of being skipped with
+	// continue_on_error.
+	required bool
+	load     func(ctx context.Context) error
+
+	// Set by loadEntry().
+	entities []component
+	displays []display
+}
+
+// id identifies the entry across reloads. Entries of the same kind can't
+// share a name, since the unique IDs of their entities are derived from it.
+func (e *entry) id() string {
+	if e.name != "" {
+		return e.kind + "/" + e.name
+	}
+	return e.kind + "#" + strconv.Itoa(e.index)
+}
+
+// entries returns the entries of cfg in loading order.
+//
+// cfgErr, if set, is reported by a text sensor.
+func (n *Node) entries(cfg *config.Root, cfgErr error) []*entry {
+	var out []*entry
+	// Parses all the sensors.
+	for i := range cfg.BinarySensors {
+		c := &cfg.BinarySensors[i]
+		out = append(out, &entry{
+			kind: "binary_sensor", name: c.Name, platform: c.Platform, index: i, cfg: c, refs: c.Sensors,
+			load: func(ctx context.Context) error { return n.loadBinarySensor(ctx, c) },
+		})
+	}
+	for i := range cfg.Sensors {
+		c := &cfg.Sensors[i]
+		out = append(out, &entry{
+			kind: "sensor", name: c.Name, platform: c.Platform, index: i, cfg: c,
+			load: func(ctx context.Context) error { return n.loadSensor(ctx, c) },
+		})
+	}
+	if cfgErr != nil {
+		out = append(out, &entry{
+			kind: "text_sensor", name: "Config Error", required: true,
+			load: func(ctx context.Context) error { return n.loadTextSensorConfigError(ctx, cfgErr) },
+		})
+	}
+	for i := range cfg.TextSensors {
+		c := &cfg.TextSensors[i]
+		out = append(out, &entry{
+			kind: "text_sensor", name: c.Name, platform: c.Platform, index: i, cfg: c,
+			load: func(ctx context.Context) error { return n.loadTextSensor(ctx, c) },
+		})
+	}
+	for i := range cfg.Lights {
+		c := &cfg.Lights[i]
+		out = append(out, &entry{
+			kind: "light", name: c.Name, platform: c.Platform, index: i, cfg: c, refs: c.Lights,
+			load: func(ctx context.Context) error { return n.loadLight(ctx, c) },
+		})
+	}
+	for i := range cfg.Switches {
+		c := &cfg.Switches[i]
+		out = append(out, &entry{
+			kind: "switch", name: c.Name, platform: c.Platform, index: i, cfg: c,
+			load: func(ctx context.Context) error { return n.loadSwitch(ctx, c) },
+		})
+	}
+	for i := range cfg.Covers {
+		c := &cfg.Covers[i]
+		out = append(out, &entry{
+			kind: "cover", name: c.Name, platform: c.Platform, index: i, cfg: c,
+			load: func(ctx context.Context) error { return n.loadCover(ctx, c) },
+		})
+	}
+	for i := range cfg.Fans {
+		c := &cfg.Fans[i]
+		out = append(out, &entry{
+			kind: "fan", name: c.Name, platform: c.Platform, index: i, cfg: c,
+			load: func(ctx context.Context) error { return n.loadFan(ctx, c) },
+		})
+	}
+	// Climates are loaded after the sensors and switches they reference.
+	for i := range cfg.Climates {
+		c := &cfg.Climates[i]
+		out = append(out, &entry{
+			kind: "climate", name: c.Name, platform: c.Platform, index: i, cfg: c, refs: []string{c.Heater, c.Sensor},
+			load: func(ctx context.Context) error { return n.loadClimate(ctx, c) },
+		})
+	}
+	for i := range cfg.Buttons {
+		c := &cfg.Buttons[i]
+		out = append(out, &entry{
+			kind: "button", name: c.Name, platform: c.Platform, index: i, cfg: c,
+			load: func(ctx context.Context) error { return n.loadButton(ctx, c) },
+		})
+	}
+	for i := range cfg.Numbers {
+		c := &cfg.Numbers[i]
+		out = append(out, &entry{
+			kind: "number", name: c.Name, platform: c.Platform, index: i, cfg: c,
+			load: func(ctx context.Context) error { return n.loadNumber(ctx, c) },
+		})
+	}
+	for i := range cfg.Cameras {
+		c := &cfg.Cameras[i]
+		out = append(out, &entry{
+			kind: "camera", name: c.Name, platform: c.Platform, index: i, cfg: c,
+			load: func(ctx context.Context) error { return n.loadCamera(ctx, c) },
+		})
+	}
+	if cfg.PeriphHome.MaintenanceSwitch {
+		out = append(out, &entry{
+			kind: "switch", name: "Maintenance", required: true,
+			load: n.loadSwitchMaintenance,
+		})
+	}
+	// Displays are loaded last since they reference the other entities.
+	for i := range cfg.Displays {
+		c := &cfg.Displays[i]
+		out = append(out, &entry{
+			kind: "display", platform: c.Platform, index: i, cfg: c, refs: c.Entities,
+			load: func(ctx context.Context) error { return n.loadDisplay(ctx, c) },
+		})
+	}
+	return out
+}
+
+// loadEntry loads e and records what it loaded, even upon failure. With
+// continue_on_error, an entry failing to load is replaced with an entity
+// reporting the error.
+func (n *Node) loadEntry(ctx context.Context, e *entry) error {
+	entities, displays := len(n.entities), len(n.displays)
+	err := e.load(ctx)
+	if err != nil && !e.required {
+		err = n.skipComponent(ctx, e.kind, e.name, e.platform, e.index, err)
+	}
+	e.entities = append([]component(nil), n.entities[entities:]...)
+	e.displays = append([]display(nil), n.displays[displays:]...)
+	return err
+}
+
 // Node is the periphhome node.
 type Node struct {
+	// mu protects cfg and the components against Reload(). The native API
+	// requests and the web handlers hold it for reading.
+	mu  sync.RWMutex
 	cfg *config.Root
 	mac string
+	// model is the board name reported in the device info.
+	model string
+	// bind is the address the servers listen on, empty for all.
+	bind string
 
 	// Components.
 	entities []component
+	// The entries of cfg that loaded the entities and displays.
+	loaded []*entry
 	// For native API requests.
 	lookup map[uint32]component
+	// User defined services, by key and in configuration order.
+	services    map[uint32]*userService
+	serviceList []*userService
+	// Local displays.
+	displays []display
+	// Time source, if any.
+	clock timeSource
+	// Outputs by ID.
+	outputs map[string]output
+	// I²C multiplexers by ID.
+	muxes map[string]*i2cMux
+	// States saved at the last clean shutdown, by unique ID. Only set during
+	// New().
+	restored map[string]stateRecord
+	// Saves the states of the restorable components when state_store is
+	// configured.
+	store *stateStore
+	// started is set once New() succeeded.
+	started bool
+	// startTime is when New() was called, reported by uptime and boot_time.
+	startTime time.Time
+	// Set when state_dir is configured.
+	bootCount  int
+	bootReason string
+	// Reported by the config_status text sensor.
+	cfgStatus configStatus
+	// Reported by the last_error text sensor.
+	lastErr lastError
+	// Native API statistics, saved in state_dir.
+	stats connStats
+	// Output of the log package, streamed to the native API clients.
+	logs *logSink
+	// Automations in progress.
+	cancelActions func()
+	actionsWG     sync.WaitGroup
 
 	// Discovery.
 	zc *zeroconf.Server
 
 	// API server.
-	ln net.Listener
-	wg sync.WaitGroup
+	ln      net.Listener
+	allowed []*net.IPNet
+	wg      sync.WaitGroup
+	// psk is set when the connections are encrypted.
+	psk []byte
+	// auth tracks the invalid passwords per remote address.
+	auth authLimiter
+	// connCtx is derived from apiCtx. It is canceled by Reload() to disconnect
+	// the clients, so they list the entities again.
+	apiCtx      context.Context
+	connCtx     context.Context
+	cancelConns func()
+	// conns are the live native API connections, force closed if they do not
+	// disconnect in time on shutdown. closing is set once Close() started.
+	connsMu sync.Mutex
+	conns   map[*conn]struct{}
+	connsWG sync.WaitGroup
+	closing bool
+
+	// Web server.
+	web *http.Server
 }
 
 // Close stops all the sensors, devices and close the API server as relevant.
+//
+// The API clients are asked to disconnect. The connections and the components
+// still running after periphhome/shutdown_timeout are abandoned, in which case
+// the returned error wraps ErrShutdownTimeout and lists them.
 func (n *Node) Close() error {
+	timeout := n.cfg.PeriphHome.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	var late []string
 	// Close in the reverse order of New(). Has to handle partially initialized
 	// object when New() is failing.
 	if n.zc != nil {
@@ -140,34 +492,238 @@ func (n *Node) Close() error {
 		n.zc.Shutdown()
 	}
 	var err error
+	if n.web != nil {
+		log.Printf("shutting down web server")
+		err = n.web.Close()
+	}
 	if n.ln != nil {
 		log.Printf("shutting down api")
-		err = n.ln.Close()
+		if err2 := n.ln.Close(); err == nil {
+			err = err2
+		}
 	}
-	for i := range n.entities {
-		log.Printf("closing component %s", n.entities[i].getName())
-		if err2 := n.entities[i].Close(); err == nil {
+	n.mu.RLock()
+	if n.cancelConns != nil {
+		n.cancelConns()
+	}
+	n.mu.RUnlock()
+	late = append(late, n.drainConns(deadline)...)
+	n.mu.Lock()
+	states, err2 := n.closeComponents(deadline)
+	n.mu.Unlock()
+	var l *lateError
+	if errors.As(err2, &l) {
+		late = append(late, l.names...)
+	} else if err == nil {
+		err = err2
+	}
+	// Only save the states if the node was fully started, so a partially
+	// loaded node doesn't overwrite the previous snapshot.
+	if d := n.cfg.PeriphHome.StateDir; d != "" && n.cfg.PeriphHome.AvailabilityGrace != 0 && n.started {
+		if err2 := writeStateSnapshot(d, states); err2 != nil {
+			log.Printf("failed to save states: %s", err2)
+		}
+	}
+	if n.bootCount != 0 {
+		if err2 := recordCleanShutdown(n.cfg.PeriphHome.StateDir); err == nil {
 			err = err2
 		}
 	}
 	log.Printf("waiting for goroutines")
-	if os.Getenv("GOTRACEBACK") == "all" {
-		// This code exists to catch when there's a shutdown bug.
-		t := time.AfterFunc(time.Minute, func() {
+	if !waitUntil(&n.wg, deadline) {
+		if os.Getenv("GOTRACEBACK") == "all" {
+			// This code exists to catch when there's a shutdown bug.
 			panic("Took too long to shutdown, panicking")
-		})
-		n.wg.Wait()
-		t.Stop()
-	} else {
-		n.wg.Wait()
+		}
+		late = append(late, "goroutines")
+	}
+	// All the connections are closed.
+	if d := n.cfg.PeriphHome.StateDir; d != "" && n.bootCount != 0 {
+		if err2 := n.stats.save(d); err2 != nil {
+			log.Printf("failed to save connection stats: %s", err2)
+		}
+	}
+	// Unless another node took over the output since.
+	if n.logs != nil && log.Writer() == io.Writer(n.logs) {
+		log.SetOutput(n.logs.w)
+	}
+	if len(late) != 0 {
+		return &lateError{names: late}
 	}
 	return err
 }
 
+// drainConns waits for the native API connections to close until the
+// deadline, then force closes the remaining ones.
+//
+// It returns the connections that were force closed.
+func (n *Node) drainConns(deadline time.Time) []string {
+	n.connsMu.Lock()
+	n.closing = true
+	n.connsMu.Unlock()
+	if waitUntil(&n.connsWG, deadline) {
+		return nil
+	}
+	var late []string
+	n.connsMu.Lock()
+	for c := range n.conns {
+		late = append(late, "connection "+c.c.RemoteAddr().String())
+		_ = c.c.Close()
+	}
+	n.connsMu.Unlock()
+	sort.Strings(late)
+	return late
+}
+
+// lateError lists what didn't stop in time on shutdown.
+type lateError struct {
+	names []string
+}
+
+func (l *lateError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrShutdownTimeout, strings.Join(l.names, ", "))
+}
+
+func (l *lateError) Unwrap() error {
+	return ErrShutdownTimeout
+}
+
+// waitUntil waits for wg until the deadline. It returns false on timeout, in
+// which case the goroutines are abandoned.
+func waitUntil(wg *sync.WaitGroup, deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	t := time.NewTimer(untilDeadline(deadline))
+	defer t.Stop()
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// untilDeadline returns the time left to stop, with a short grace once the
+// deadline passed so what stops right away is not reported as late.
+func untilDeadline(deadline time.Time) time.Duration {
+	if d := time.Until(deadline); d > 100*time.Millisecond {
+		return d
+	}
+	return 100 * time.Millisecond
+}
+
+// closeComponents stops the automations and closes everything loaded by
+// loadComponents().
+//
+// It returns the last states of the entities, by unique ID.
+//
+// If deadline is set, the entities still closing at the deadline are
+// abandoned and the returned error is a *lateError listing them.
+func (n *Node) closeComponents(deadline time.Time) (map[string]stateRecord, error) {
+	// Actions reference entities and outputs, so stop them first.
+	n.stopActions()
+	n.runShutdownActions(n.loaded)
+	var err error
+	for i := range n.displays {
+		if err2 := n.displays[i].Close(); err == nil {
+			err = err2
+		}
+	}
+	states, err2 := stateRecords(n.entities)
+	if err2 != nil {
+		log.Printf("failed to snapshot states: %s", err2)
+	}
+	// Stop saving before closing, so turning the hardware off is not
+	// persisted.
+	if n.store != nil {
+		if err2 = n.store.stop(); err2 != nil {
+			log.Printf("failed to save component states: %s", err2)
+		}
+	}
+	var late []string
+	for i := range n.entities {
+		log.Printf("closing component %s", n.entities[i].getName())
+		ok, err2 := closeUntil(n.entities[i], deadline)
+		if !ok {
+			late = append(late, n.entities[i].getName())
+		} else if err == nil {
+			err = err2
+		}
+	}
+	for _, o := range n.outputs {
+		if err2 := o.Close(); err == nil {
+			err = err2
+		}
+	}
+	for _, m := range n.muxes {
+		if err2 := m.Close(); err == nil {
+			err = err2
+		}
+	}
+	if n.clock != nil {
+		if err2 := n.clock.Close(); err == nil {
+			err = err2
+		}
+	}
+	n.displays = nil
+	n.entities = nil
+	n.loaded = nil
+	n.lookup = map[uint32]component{}
+	n.outputs = map[string]output{}
+	n.muxes = map[string]*i2cMux{}
+	n.clock = nil
+	n.services = nil
+	n.serviceList = nil
+	n.cfgStatus.mu.Lock()
+	n.cfgStatus.t = nil
+	n.cfgStatus.mu.Unlock()
+	n.lastErr.mu.Lock()
+	n.lastErr.t = nil
+	n.lastErr.mu.Unlock()
+	if len(late) != 0 {
+		return states, &lateError{names: late}
+	}
+	return states, err
+}
+
+// closeUntil closes c, giving up at the deadline if set. It returns false on
+// timeout, in which case Close keeps running in the background.
+func closeUntil(c io.Closer, deadline time.Time) (bool, error) {
+	if deadline.IsZero() {
+		return true, c.Close()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Close()
+	}()
+	t := time.NewTimer(untilDeadline(deadline))
+	defer t.Stop()
+	select {
+	case err := <-done:
+		return true, err
+	case <-t.C:
+		return false, nil
+	}
+}
+
 func (n *Node) addEntity(ctx context.Context, c component) error {
 	if err := c.init(ctx, n); err != nil {
 		return err
 	}
+	if r, ok := n.restored[c.getUniqueID()]; ok {
+		// Replay the last known state until the hardware provides one.
+		if msg, err := r.decode(); err != nil {
+			log.Printf("%s: failed to restore state: %s", c.getName(), err)
+		} else {
+			c.restoreState(msg, r.LastChanged, r.LastUpdated)
+		}
+	}
+	if r, ok := c.(restorable); ok && n.store != nil {
+		n.store.watch(c, r)
+	}
 	n.entities = append(n.entities, c)
 	n.lookup[c.getHash()] = c
 	return nil
@@ -178,33 +734,90 @@ func (n *Node) addEntity(ctx context.Context, c component) error {
 // https://github.com/esphome/aioesphomeapi.
 func (n *Node) apiServer(ctx context.Context, port int) error {
 	log.Printf("loading API server on port %d", port)
-	lc := net.ListenConfig{}
-	ln, err := lc.Listen(ctx, "tcp", fmt.Sprintf("%s:%d", networkBind, port))
+	psk, err := n.cfg.API.Encryption.PSK()
+	if err != nil {
+		return err
+	}
+	n.psk = psk
+	for _, c := range n.cfg.API.AllowedClients {
+		subnet, err := config.ParseSubnet(c)
+		if err != nil {
+			return err
+		}
+		n.allowed = append(n.allowed, subnet)
+	}
+	ln, err := listen(ctx, "api", n.bind, port)
 	if err != nil {
 		return err
 	}
 	logf("listening on %s", ln.Addr())
 
 	n.ln = ln
+	n.apiCtx = ctx
+	n.connCtx, n.cancelConns = context.WithCancel(ctx)
 	n.wg.Add(1)
 	go func() {
 		defer n.wg.Done()
-		n.apiServerLoop(ctx)
+		n.apiServerLoop()
 	}()
 	return nil
 }
 
-func (n *Node) apiServerLoop(ctx context.Context) {
+// isAllowed returns true if the client is in api/allowed_clients.
+func (n *Node) isAllowed(addr net.Addr) bool {
+	if len(n.allowed) == 0 {
+		return true
+	}
+	t, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, subnet := range n.allowed {
+		if subnet.Contains(t.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Node) apiServerLoop() {
 	for {
 		c, err := n.ln.Accept()
 		if err != nil {
 			return
 		}
+		if !n.isAllowed(c.RemoteAddr()) {
+			log.Printf("rejecting connection from %s", c.RemoteAddr())
+			_ = c.Close()
+			continue
+		}
 		logf("New connection: %s", c.RemoteAddr())
+		n.mu.RLock()
+		cc := &conn{c: c, n: n, cfg: n.cfg}
+		connCtx := n.connCtx
+		n.mu.RUnlock()
+		n.connsMu.Lock()
+		if n.closing {
+			n.connsMu.Unlock()
+			_ = c.Close()
+			return
+		}
+		if n.conns == nil {
+			n.conns = map[*conn]struct{}{}
+		}
+		n.conns[cc] = struct{}{}
+		n.connsWG.Add(1)
+		n.connsMu.Unlock()
 		n.wg.Add(1)
 		go func() {
 			defer n.wg.Done()
-			(&conn{c: c, n: n}).handleConnection(ctx)
+			defer func() {
+				n.connsMu.Lock()
+				delete(n.conns, cc)
+				n.connsMu.Unlock()
+				n.connsWG.Done()
+			}()
+			cc.handleConnection(connCtx)
 		}()
 	}
 }
@@ -216,16 +829,45 @@ type component interface {
 	getUniqueID() string
 	getHash() uint32
 	getType() componentType
+	// getState returns the current state message, if any.
+	getState() proto.Message
+	// getTimestamps returns when the state last changed value and when it was
+	// last updated, even if the value was the same.
+	getTimestamps() (lastChanged, lastUpdated time.Time)
+	// restoreState sets the state saved at the previous shutdown, unless a
+	// state was already set.
+	restoreState(msg proto.Message, lastChanged, lastUpdated time.Time)
 	describe() proto.Message
+	// setError records a failure reading or commanding the hardware.
+	setError(err error)
+	// getLastError returns the last error recorded and when, if any.
+	getLastError() (string, time.Time)
 	// subscribe shall block and send updates until the context is closed.
 	subscribe(ctx context.Context, c clientConn)
 	// cameraStream shall block and send pictures until the context is closed.
 	cameraStream(ctx context.Context, c clientConn, in *aioesphomeapi.CameraImageRequest)
+	buttonCommand(in *aioesphomeapi.ButtonCommandRequest) error
 	climateCommand(in *aioesphomeapi.ClimateCommandRequest) error
 	coverCommand(in *aioesphomeapi.CoverCommandRequest) error
 	fanCommand(in *aioesphomeapi.FanCommandRequest) error
 	lightCommand(in *aioesphomeapi.LightCommandRequest) error
+	numberCommand(in *aioesphomeapi.NumberCommandRequest) error
 	switchCommand(in *aioesphomeapi.SwitchCommandRequest) error
+	// homeAssistantStates returns the Home Assistant entities whose state the
+	// component consumes, e.g. "sensor.outside_temperature".
+	homeAssistantStates() []string
+	// onHomeAssistantState is called with the new state of one of the entities
+	// returned by homeAssistantStates.
+	onHomeAssistantState(entityID, state string)
+}
+
+// republisher is implemented by components that can read their current value
+// on demand.
+//
+// It is used upon a new state subscription so a client reconnecting gets an
+// up to date value, not the one observed at the last change.
+type republisher interface {
+	republish()
 }
 
 type componentBase struct {
@@ -237,11 +879,27 @@ type componentBase struct {
 	uniqueID string
 	key      uint32
 
+	// sendMu serializes onNewState() so the subscribers get the states in
+	// order.
+	sendMu sync.Mutex
 	// For subscriptions.
 	mu         sync.Mutex
 	nextChKey  int
 	ch         map[int]chan proto.Message
 	currentMsg proto.Message
+	// onSubscribers, if set, is called with the number of subscribers each
+	// time it changes. It is called without mu held.
+	onSubscribers func(n int)
+	// lastChanged is when currentMsg last changed value. lastUpdated is when
+	// onNewState() was last called.
+	lastChanged time.Time
+	lastUpdated time.Time
+	// lastError is the last failure reported via setError(), at
+	// lastErrorTime.
+	lastError     string
+	lastErrorTime time.Time
+	// errSink is called by setError(). It is called without mu held.
+	errSink func(name string, err error)
 }
 
 func (c *componentBase) init(ctx context.Context, n *Node) error {
@@ -264,20 +922,41 @@ func (c *componentBase) init(ctx context.Context, n *Node) error {
 	if c.objectID == "" {
 		return errors.New("internal error: objectID is empty")
 	}
-	// Default uniqueID is Node.Name + component type + object_id. Some
-	// override with the mac address plus something related to the component.
-	c.uniqueID = n.cfg.PeriphHome.Name + string(c.componentType) + c.objectID
-
-	h := fnv.New32()
-	if _, err := h.Write([]byte(c.objectID)); err != nil {
-		return err
+	switch n.cfg.PeriphHome.IDScheme {
+	case "", "objectid_fnv":
+		// uniqueID is Node.Name + component type + object_id. The key only
+		// depends on the object_id.
+		c.uniqueID = n.cfg.PeriphHome.Name + string(c.componentType) + c.objectID
+		h := fnv.New32()
+		if _, err := h.Write([]byte(c.objectID)); err != nil {
+			return err
+		}
+		c.key = h.Sum32()
+	case "mac_crc":
+		// Both are derived from the mac address, so renaming the node doesn't
+		// change them, and entities of different types can share a name.
+		if n.mac == "" {
+			return errors.New("id_scheme mac_crc requires a network interface with a mac address")
+		}
+		mac := strings.ToLower(strings.ReplaceAll(n.mac, ":", ""))
+		c.uniqueID = mac + "-" + string(c.componentType) + "-" + c.objectID
+		c.key = crc32.ChecksumIEEE([]byte(c.uniqueID))
+	default:
+		return fmt.Errorf("unknown id_scheme %q", n.cfg.PeriphHome.IDScheme)
 	}
-	if c.key = h.Sum32(); c.key == 0 {
+	if c.key == 0 {
 		// I observed that if the hash value is 0, it is replaced with 1 by the
 		// client.
 		c.key = 1
 	}
+	// Checked before the entity starts anything, so the caller only has to
+	// release what it opened. Otherwise the clients would only see one of
+	// them.
+	if o, ok := n.lookup[c.key]; ok {
+		return fmt.Errorf("entity %q has the same key as %q, rename one of them", c.name, o.getName())
+	}
 	c.ch = map[int]chan proto.Message{}
+	c.errSink = n.lastErr.report
 	return nil
 }
 
@@ -297,10 +976,54 @@ func (c *componentBase) getType() componentType {
 	return c.componentType
 }
 
+func (c *componentBase) getState() proto.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.currentMsg
+}
+
+func (c *componentBase) getTimestamps() (time.Time, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastChanged, c.lastUpdated
+}
+
+func (c *componentBase) restoreState(msg proto.Message, lastChanged, lastUpdated time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.currentMsg == nil {
+		c.currentMsg = msg
+		c.lastChanged = lastChanged
+		c.lastUpdated = lastUpdated
+	}
+}
+
+func (c *componentBase) setError(err error) {
+	log.Printf("%s: %s", c.name, err)
+	c.mu.Lock()
+	c.lastError = err.Error()
+	c.lastErrorTime = time.Now()
+	sink := c.errSink
+	c.mu.Unlock()
+	if sink != nil {
+		sink(c.name, err)
+	}
+}
+
+func (c *componentBase) getLastError() (string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastError, c.lastErrorTime
+}
+
 func (c *componentBase) cameraStream(ctx context.Context, cc clientConn, in *aioesphomeapi.CameraImageRequest) {
 	log.Printf("%s is no camera", c.name)
 }
 
+func (c *componentBase) buttonCommand(in *aioesphomeapi.ButtonCommandRequest) error {
+	return fmt.Errorf("%s is no button", c.name)
+}
+
 func (c *componentBase) climateCommand(in *aioesphomeapi.ClimateCommandRequest) error {
 	return fmt.Errorf("%s is no climate", c.name)
 }
@@ -317,10 +1040,21 @@ func (c *componentBase) lightCommand(in *aioesphomeapi.LightCommandRequest) erro
 	return fmt.Errorf("%s is no light", c.name)
 }
 
+func (c *componentBase) numberCommand(in *aioesphomeapi.NumberCommandRequest) error {
+	return fmt.Errorf("%s is no number", c.name)
+}
+
 func (c *componentBase) switchCommand(in *aioesphomeapi.SwitchCommandRequest) error {
 	return fmt.Errorf("%s is no switch", c.name)
 }
 
+func (c *componentBase) homeAssistantStates() []string {
+	return nil
+}
+
+func (c *componentBase) onHomeAssistantState(entityID, state string) {
+}
+
 func (c *componentBase) register() (int, chan proto.Message, proto.Message) {
 	// It's not awesome, we should have proper locking semantics instead.
 	ch := make(chan proto.Message, 8)
@@ -329,32 +1063,77 @@ func (c *componentBase) register() (int, chan proto.Message, proto.Message) {
 	c.nextChKey++
 	c.ch[k] = ch
 	cur := c.currentMsg
+	n := len(c.ch)
+	cb := c.onSubscribers
 	c.mu.Unlock()
+	if cb != nil {
+		cb(n)
+	}
 	return k, ch, cur
 }
 
 func (c *componentBase) unregister(k int) {
 	c.mu.Lock()
 	delete(c.ch, k)
+	n := len(c.ch)
+	cb := c.onSubscribers
 	c.mu.Unlock()
+	if cb != nil {
+		cb(n)
+	}
+}
+
+// subscribers returns the number of active subscriptions.
+func (c *componentBase) subscribers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.ch)
 }
 
 // onNewState sends the state update it to every subscription.
+//
+// It never blocks: when a subscriber is lagging behind, its oldest pending
+// state is dropped so it eventually gets the latest one.
 func (c *componentBase) onNewState(msg proto.Message) {
+	now := time.Now()
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
 	c.mu.Lock()
+	if c.currentMsg == nil || !proto.Equal(c.currentMsg, msg) {
+		c.lastChanged = now
+	}
+	c.lastUpdated = now
 	c.currentMsg = msg
+	chs := make([]chan proto.Message, 0, len(c.ch))
 	for _, ch := range c.ch {
-		ch <- msg
+		chs = append(chs, ch)
 	}
 	c.mu.Unlock()
+	for _, ch := range chs {
+		select {
+		case ch <- msg:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			// There's room now since only onNewState() sends.
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	}
 }
 
 func (c *componentBase) subscribe(ctx context.Context, cc clientConn) {
 	k, ch, msg := c.register()
 	defer c.unregister(k)
-	// Send initial message.
-	if err := cc.reply(msg); err != nil {
-		return
+	// Send initial message, if the component has a state yet.
+	if msg != nil {
+		if err := cc.reply(msg); err != nil {
+			return
+		}
 	}
 
 	done := ctx.Done()
@@ -370,17 +1149,29 @@ func (c *componentBase) subscribe(ctx context.Context, cc clientConn) {
 	}
 }
 
+// friendlyName returns the entity name as shown to the user, with the
+// name_prefix applied.
+func (n *Node) friendlyName(name string) string {
+	if p := strings.TrimSpace(n.cfg.PeriphHome.NamePrefix); p != "" {
+		return p + " " + name
+	}
+	return name
+}
+
 type componentType string
 
 const (
 	binarySensorComponent componentType = "binary_sensor"
+	buttonComponent       componentType = "button"
 	cameraComponent       componentType = "camera"
 	climateComponent      componentType = "climate"
 	coverComponent        componentType = "cover"
 	fanComponent          componentType = "fan"
 	lightComponent        componentType = "light"
+	numberComponent       componentType = "number"
 	sensorComponent       componentType = "sensor"
 	switchComponent       componentType = "switch"
+	textSensorComponent   componentType = "text_sensor"
 )
 
 // clientConn is used by interface component.
@@ -391,6 +1182,9 @@ type clientConn interface {
 // getMainAddr returns the first IP and mac addresses that are not a loopback
 // and support multicast.
 //
+// Any address family is accepted, so an interface with only IPv6 addresses is
+// returned.
+//
 // This assumes that lesser use network adapters like docker and tailscale are
 // after the base one. Still it's not clear which one is useful to return so
 // this code will likely have to change.
@@ -413,6 +1207,45 @@ func getMainAddr() (*net.Interface, string) {
 	return nil, ""
 }
 
+// selectAddr returns the network interface advertised via zeroconf and its mac
+// address, which identifies the node.
+//
+// It is periphhome/interface if set, otherwise the interface owning
+// periphhome/bind_address if any. It falls back to getMainAddr().
+func selectAddr(cfg *config.PeriphHome) (*net.Interface, string, error) {
+	if cfg.Interface != "" {
+		ifa, err := net.InterfaceByName(cfg.Interface)
+		if err != nil {
+			return nil, "", fmt.Errorf("periphhome: interface %q: %w", cfg.Interface, err)
+		}
+		return ifa, ifa.HardwareAddr.String(), nil
+	}
+	if cfg.BindAddress != "" {
+		if ifa := interfaceByIP(net.ParseIP(cfg.BindAddress)); ifa != nil {
+			return ifa, ifa.HardwareAddr.String(), nil
+		}
+	}
+	ifa, mac := getMainAddr()
+	return ifa, mac, nil
+}
+
+// interfaceByIP returns the interface having the IP address, if any.
+func interfaceByIP(ip net.IP) *net.Interface {
+	ifas, _ := net.Interfaces()
+	for i := range ifas {
+		addrs, err := ifas[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return &ifas[i]
+			}
+		}
+	}
+	return nil
+}
+
 // networkBind is set in test so the temporary server is bound on the
 // local loop network.
 var networkBind = ""
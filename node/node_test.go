@@ -0,0 +1,226 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestComponentBase_IDScheme(t *testing.T) {
+	data := []struct {
+		scheme   string
+		typ      componentType
+		uniqueID string
+		key      uint32
+	}{
+		{"", sensorComponent, "pisensortemperature", 0x35a123f9},
+		{"objectid_fnv", binarySensorComponent, "pibinary_sensortemperature", 0x35a123f9},
+		{"mac_crc", sensorComponent, "b827eb0102ab-sensor-temperature", 0},
+		{"mac_crc", binarySensorComponent, "b827eb0102ab-binary_sensor-temperature", 0},
+	}
+	keys := map[uint32]bool{}
+	for i, l := range data {
+		n := &Node{cfg: &config.Root{PeriphHome: config.PeriphHome{Name: "pi", IDScheme: l.scheme}}, mac: "B8:27:EB:01:02:AB"}
+		c := componentBase{name: "Temperature", componentType: l.typ}
+		if err := c.init(context.Background(), n); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if c.uniqueID != l.uniqueID {
+			t.Errorf("#%d: %q != %q", i, c.uniqueID, l.uniqueID)
+		}
+		if l.key != 0 && c.key != l.key {
+			t.Errorf("#%d: %#x != %#x", i, c.key, l.key)
+		}
+		if l.scheme == "mac_crc" {
+			if keys[c.key] {
+				t.Errorf("#%d: duplicate key %#x", i, c.key)
+			}
+			keys[c.key] = true
+		}
+	}
+}
+
+func TestComponentBase_IDScheme_NoMAC(t *testing.T) {
+	n := &Node{cfg: &config.Root{PeriphHome: config.PeriphHome{IDScheme: "mac_crc"}}}
+	c := componentBase{name: "Temperature", componentType: sensorComponent}
+	if c.init(context.Background(), n) == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestComponentBase_SlowSubscriber(t *testing.T) {
+	n := &Node{cfg: &config.Root{}}
+	c := componentBase{name: "Temperature", componentType: sensorComponent}
+	if err := c.init(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	// The subscription is never drained.
+	_, ch, _ := c.register()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.onNewState(&aioesphomeapi.SensorStateResponse{Key: c.key, State: float32(i)})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onNewState is blocked")
+	}
+	// The subscriber gets the latest states.
+	var got []float32
+	for len(ch) != 0 {
+		got = append(got, (<-ch).(*aioesphomeapi.SensorStateResponse).State)
+	}
+	if len(got) != cap(ch) || got[len(got)-1] != 99 || got[0] != float32(100-cap(ch)) {
+		t.Fatalf("unexpected %v", got)
+	}
+}
+
+func TestClose_ShutdownTimeout_Connection(t *testing.T) {
+	shouldLog = testing.Verbose()
+	port := getFreePort(t)
+	cfg := &config.Root{}
+	y := fmt.Sprintf("periphhome:\n  name: pi\n  shutdown_timeout: 100ms\napi:\n  port: %d\n", port)
+	if err := cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The client never acknowledges the DisconnectRequest.
+	c := dialTestClient(t, port, "")
+	defer c.c.Close()
+	start := time.Now()
+	err = n.Close()
+	if !errors.Is(err, ErrShutdownTimeout) || !strings.Contains(err.Error(), "connection 127.0.0.1:") {
+		t.Fatalf("unexpected %v", err)
+	}
+	// It would otherwise wait 5s for the DisconnectResponse.
+	if d := time.Since(start); d > 3*time.Second {
+		t.Fatalf("took %s", d)
+	}
+}
+
+func TestClose_ShutdownTimeout_Component(t *testing.T) {
+	n := &Node{
+		cfg:    &config.Root{PeriphHome: config.PeriphHome{ShutdownTimeout: 10 * time.Millisecond}},
+		lookup: map[uint32]component{},
+	}
+	s := &stuckComponent{
+		componentBase: componentBase{name: "Stuck", componentType: sensorComponent},
+		release:       make(chan struct{}),
+	}
+	defer close(s.release)
+	n.entities = []component{s}
+	if err := n.Close(); !errors.Is(err, ErrShutdownTimeout) || !strings.HasSuffix(err.Error(), ": Stuck") {
+		t.Fatalf("unexpected %v", err)
+	}
+}
+
+// stuckComponent never finishes closing until released.
+type stuckComponent struct {
+	componentBase
+	release chan struct{}
+}
+
+func (s *stuckComponent) Close() error {
+	<-s.release
+	return nil
+}
+
+func (s *stuckComponent) describe() proto.Message {
+	return nil
+}
+
+func TestNew_UnknownPin(t *testing.T) {
+	cfg := &config.Root{}
+	y := "periphhome:\n  name: pi\nbinary_sensor:\n  - platform: gpio\n    name: Door\n    pin:\n      number: GPI017\n"
+	if err := cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := New(context.Background(), cfg)
+	if err == nil {
+		_ = n.Close()
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), `unknown pins: "GPI017"`) {
+		t.Fatal(err)
+	}
+
+	// With continue_on_error, only the components using them are skipped.
+	cfg = &config.Root{}
+	y = "periphhome:\n  name: pi\n  continue_on_error: true\n" +
+		"output:\n  - platform: pwm\n    id: dimmer\n    pin:\n      number: GPI018\n" +
+		"binary_sensor:\n  - platform: gpio\n    name: Door\n    pin:\n      number: GPI017\n" +
+		"sensor:\n  - platform: fake\n    name: Fake\n    update_interval: 1h\n" +
+		"light:\n  - platform: monochromatic\n    name: Lamp\n    output: dimmer\n"
+	if err = cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = New(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	want := []struct{ name, state string }{
+		{"output dimmer error", `output(dimmer): unknown pin "GPI018"`},
+		{"binary_sensor Door error", `unknown pin "GPI017"`},
+		{"Fake", ""},
+		{"light Lamp error", `light(Lamp): unknown output "dimmer"`},
+	}
+	if len(n.entities) != len(want) {
+		t.Fatalf("got %d entities", len(n.entities))
+	}
+	for i, w := range want {
+		if got := n.entities[i].getName(); got != w.name {
+			t.Errorf("#%d: got name %q", i, got)
+		}
+		if w.state == "" {
+			continue
+		}
+		if got := stateString(n.entities[i]); !strings.Contains(got, w.state) {
+			t.Errorf("#%d: got state %q", i, got)
+		}
+	}
+}
+
+func TestSelectAddr(t *testing.T) {
+	ifas, err := net.Interfaces()
+	if err != nil || len(ifas) == 0 {
+		t.Skip("no network interface")
+	}
+	ifa, mac, err := selectAddr(&config.PeriphHome{Interface: ifas[0].Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ifa.Name != ifas[0].Name || mac != ifas[0].HardwareAddr.String() {
+		t.Fatalf("unexpected %v %q", ifa, mac)
+	}
+	if _, _, err = selectAddr(&config.PeriphHome{Interface: "nonexistent0"}); err == nil {
+		t.Fatal("expected error")
+	}
+	// The interface owning the bind address is used.
+	if ifa := interfaceByIP(net.IPv4(127, 0, 0, 1)); ifa != nil {
+		if got, _, err := selectAddr(&config.PeriphHome{BindAddress: "127.0.0.1"}); err != nil || got.Name != ifa.Name {
+			t.Fatalf("unexpected %v %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"periph.io/x/home/node/config"
+)
+
+func (n *Node) loadNumber(ctx context.Context, cfg *config.Number) error {
+	log.Printf("loading number %s", cfg.Platform)
+	switch cfg.Platform {
+	case "template":
+		if err := n.loadNumberTemplate(ctx, cfg); err != nil {
+			return fmt.Errorf("number(%s): %w", cfg.Name, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown platform %q", cfg.Platform)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadNumberTemplate loads a number whose value is only kept in memory, to be
+// set from Home Assistant.
+func (n *Node) loadNumberTemplate(ctx context.Context, cfg *config.Number) error {
+	t := &numberTemplate{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: numberComponent,
+		},
+		icon:    cfg.Icon,
+		unit:    cfg.UnitOfMeasurement,
+		min:     float32(cfg.MinValue),
+		max:     float32(cfg.MaxValue),
+		step:    float32(cfg.Step),
+		mode:    numberModes[cfg.Mode],
+		initial: float32(cfg.MinValue),
+	}
+	if t.step == 0 {
+		t.step = 1
+	}
+	if cfg.InitialValue != nil {
+		t.initial = float32(*cfg.InitialValue)
+	}
+	if t.min >= t.max {
+		return errors.New("min_value must be lower than max_value")
+	}
+	if t.initial < t.min || t.initial > t.max {
+		return fmt.Errorf("initial_value must be between %g and %g", t.min, t.max)
+	}
+	return n.addEntity(ctx, t)
+}
+
+// numberModes maps config.Number.Mode to the native API type.
+var numberModes = map[string]aioesphomeapi.NumberMode{
+	"":       aioesphomeapi.NumberMode_NUMBER_MODE_AUTO,
+	"auto":   aioesphomeapi.NumberMode_NUMBER_MODE_AUTO,
+	"box":    aioesphomeapi.NumberMode_NUMBER_MODE_BOX,
+	"slider": aioesphomeapi.NumberMode_NUMBER_MODE_SLIDER,
+}
+
+type numberTemplate struct {
+	componentBase
+	icon string
+	unit string
+	min  float32
+	max  float32
+	step float32
+	mode aioesphomeapi.NumberMode
+	// initial is the value published on startup.
+	initial float32
+}
+
+func (t *numberTemplate) Close() error {
+	return nil
+}
+
+func (t *numberTemplate) init(ctx context.Context, n *Node) error {
+	if err := t.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	t.onNewState(&aioesphomeapi.NumberStateResponse{Key: t.key, State: t.initial})
+	return nil
+}
+
+// numberCommand sets the value and re-emits it to all clients.
+func (t *numberTemplate) numberCommand(in *aioesphomeapi.NumberCommandRequest) error {
+	if in.State < t.min || in.State > t.max {
+		return fmt.Errorf("%s: %g is not between %g and %g", t.name, in.State, t.min, t.max)
+	}
+	t.onNewState(&aioesphomeapi.NumberStateResponse{Key: t.key, State: in.State})
+	return nil
+}
+
+// numberState is the saved state of a number.
+type numberState struct {
+	State float32 `json:"state"`
+}
+
+// MarshalState implements restorable.
+func (t *numberTemplate) MarshalState() ([]byte, error) {
+	s, _ := t.getState().(*aioesphomeapi.NumberStateResponse)
+	if s == nil {
+		return nil, errors.New("no state")
+	}
+	return json.Marshal(&numberState{State: s.State})
+}
+
+// UnmarshalState implements restorable.
+func (t *numberTemplate) UnmarshalState(b []byte) error {
+	v := numberState{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return t.numberCommand(&aioesphomeapi.NumberCommandRequest{Key: t.key, State: v.State})
+}
+
+func (t *numberTemplate) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesNumberResponse{
+		ObjectId:          t.objectID,
+		Key:               t.key,
+		Name:              t.name,
+		UniqueId:          t.uniqueID,
+		Icon:              t.icon,
+		MinValue:          t.min,
+		MaxValue:          t.max,
+		Step:              t.step,
+		UnitOfMeasurement: t.unit,
+		Mode:              t.mode,
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestNumberTemplate(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	initial := 0.5
+	cfg := config.Number{Platform: "template", Name: "Hysteresis", UnitOfMeasurement: "°C", MaxValue: 2, Step: 0.1, InitialValue: &initial, Mode: "box"}
+	if err := n.loadNumber(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	c := n.entities[0]
+	defer c.Close()
+	d := c.describe().(*aioesphomeapi.ListEntitiesNumberResponse)
+	if d.MinValue != 0 || d.MaxValue != 2 || d.Step != 0.1 || d.Mode != aioesphomeapi.NumberMode_NUMBER_MODE_BOX {
+		t.Fatalf("unexpected %v", d)
+	}
+	if s := stateString(c); s != "0.5 °C" {
+		t.Fatal(s)
+	}
+	_, ch, _ := c.(*numberTemplate).register()
+	if err := c.numberCommand(&aioesphomeapi.NumberCommandRequest{Key: c.getHash(), State: 1.5}); err != nil {
+		t.Fatal(err)
+	}
+	if s := (<-ch).(*aioesphomeapi.NumberStateResponse); s.State != 1.5 {
+		t.Fatalf("unexpected %v", s)
+	}
+	if c.numberCommand(&aioesphomeapi.NumberCommandRequest{Key: c.getHash(), State: 3}) == nil {
+		t.Fatal("expected out of range")
+	}
+	if s := c.getState().(*aioesphomeapi.NumberStateResponse); s.State != 1.5 {
+		t.Fatalf("unexpected %v", s)
+	}
+}
+
+func TestLoadNumber_Err(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	high := 5.
+	data := []config.Number{
+		{Platform: "unknown", MaxValue: 1},
+		{Platform: "template", MinValue: 1},
+		{Platform: "template", MaxValue: 1, InitialValue: &high},
+	}
+	for i := range data {
+		data[i].Name = "Number"
+		if err := n.loadNumber(context.Background(), &data[i]); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
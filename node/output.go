@@ -0,0 +1,103 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/home/node/config"
+)
+
+// output is a binary or float output driving an actuator.
+//
+// It is not an entity by itself, entities like lights reference it by ID.
+type output interface {
+	Close() error
+	// set sets the output level between 0 and 1. A binary output is on for
+	// any level above 0.
+	set(level float32) error
+	// isFloat returns true if the output supports levels between 0 and 1.
+	isFloat() bool
+}
+
+func (n *Node) loadOutput(cfg *config.OutputPin) error {
+	log.Printf("loading output %s", cfg.Platform)
+	var o output
+	var err error
+	switch cfg.Platform {
+	case "gpio":
+		o, err = loadOutputGPIO(cfg)
+	case "pwm":
+		o, err = loadOutputPWM(cfg)
+	default:
+		return fmt.Errorf("unknown platform %q", cfg.Platform)
+	}
+	if err != nil {
+		return fmt.Errorf("output(%s): %w", cfg.ID, err)
+	}
+	n.outputs[cfg.ID] = o
+	return nil
+}
+
+// findOutput returns the output by its ID.
+func (n *Node) findOutput(id string) (output, error) {
+	if id == "" {
+		return nil, errors.New("output is required")
+	}
+	o := n.outputs[id]
+	if o == nil {
+		return nil, fmt.Errorf("unknown output %q", id)
+	}
+	return o, nil
+}
+
+// openOutputPin returns the pin to use as an output.
+func openOutputPin(cfg *config.Pin) (gpio.PinOut, error) {
+	p := gpioreg.ByName(cfg.Number)
+	if p == nil {
+		return nil, fmt.Errorf("unknown pin %q", cfg.Number)
+	}
+	if cfg.Mode == config.OutputOpenDrain {
+		return nil, errors.New("open drain is not supported")
+	}
+	return p, nil
+}
+
+// outputGPIO is a binary output.
+type outputGPIO struct {
+	p        gpio.PinOut
+	inverted bool
+}
+
+func loadOutputGPIO(cfg *config.OutputPin) (*outputGPIO, error) {
+	if cfg.Frequency != 0 {
+		return nil, errors.New("frequency is only supported with pwm")
+	}
+	p, err := openOutputPin(&cfg.Pin)
+	if err != nil {
+		return nil, err
+	}
+	o := &outputGPIO{p: p, inverted: cfg.Pin.Inverted}
+	if err = o.set(0); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *outputGPIO) Close() error {
+	return o.set(0)
+}
+
+func (o *outputGPIO) set(level float32) error {
+	return o.p.Out(gpio.Level((level > 0) != o.inverted))
+}
+
+func (o *outputGPIO) isFloat() bool {
+	return false
+}
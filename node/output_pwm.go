@@ -0,0 +1,60 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/home/node/config"
+)
+
+// outputPWM is a float output using hardware PWM.
+type outputPWM struct {
+	p        gpio.PinOut
+	freq     physic.Frequency
+	inverted bool
+}
+
+func loadOutputPWM(cfg *config.OutputPin) (*outputPWM, error) {
+	p, err := openOutputPin(&cfg.Pin)
+	if err != nil {
+		return nil, err
+	}
+	o := &outputPWM{p: p, freq: 1000 * physic.Hertz, inverted: cfg.Pin.Inverted}
+	if cfg.Frequency != 0 {
+		o.freq = physic.Frequency(cfg.Frequency) * physic.Hertz
+	}
+	if err = o.set(0); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *outputPWM) Close() error {
+	return o.set(0)
+}
+
+func (o *outputPWM) set(level float32) error {
+	if level < 0 {
+		level = 0
+	} else if level > 1 {
+		level = 1
+	}
+	if o.inverted {
+		level = 1 - level
+	}
+	// Use a steady level at both ends; not all drivers accept 0% or 100%.
+	if level == 0 {
+		return o.p.Out(gpio.Low)
+	}
+	if level == 1 {
+		return o.p.Out(gpio.High)
+	}
+	return o.p.PWM(gpio.Duty(level*float32(gpio.DutyMax)+0.5), o.freq)
+}
+
+func (o *outputPWM) isFloat() bool {
+	return true
+}
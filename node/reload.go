@@ -0,0 +1,324 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"periph.io/x/home/node/config"
+)
+
+// ErrRestartRequired is returned by Reload() when the new configuration
+// cannot be applied without restarting the process.
+var ErrRestartRequired = errors.New("restart required")
+
+// Reload replaces the configuration without restarting the process.
+//
+// The entries of the configuration are compared by kind and name, which
+// determine the unique IDs of their entities. Only the entries that were
+// removed, added or modified are closed and loaded, along with the ones
+// referencing their entities, e.g. a display showing a modified sensor. The
+// on_shutdown actions of the actuators closed are run and their last states
+// are replayed once loaded again; on_boot is not run. The native API clients
+// are disconnected when the entities or the api and periphhome settings
+// changed, so they list the entities again when they reconnect.
+//
+// Changing the time sources, the outputs or the I²C multiplexers closes and
+// loads everything again, running the on_shutdown and on_boot actions like a
+// restart would, since the entities hold them. The native API listener, the
+// web server and the zeroconf registration are always left untouched.
+//
+// The settings used by the servers cannot be changed this way, in which case
+// an error wrapping ErrRestartRequired is returned and nothing is changed. If
+// cfg fails to load, the previous configuration is loaded back and the error
+// is returned.
+func (n *Node) Reload(ctx context.Context, cfg *config.Root) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if diff := restartSettings(n.cfg, cfg); len(diff) != 0 {
+		return fmt.Errorf("%w: %s changed", ErrRestartRequired, strings.Join(diff, ", "))
+	}
+	if err := checkPins(cfg); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(n.cfg.Times, cfg.Times) || !reflect.DeepEqual(n.cfg.Outputs, cfg.Outputs) || !reflect.DeepEqual(n.cfg.I2CMuxes, cfg.I2CMuxes) {
+		return n.reloadAll(ctx, cfg)
+	}
+	return n.reloadEntries(ctx, cfg)
+}
+
+// reloadAll closes all the components and loads them again from cfg.
+func (n *Node) reloadAll(ctx context.Context, cfg *config.Root) error {
+	n.disconnectClients()
+	states, err := n.closeComponents(time.Time{})
+	if err != nil {
+		log.Printf("reload: failed to close components: %s", err)
+	}
+	// Replay the states to the entities that are kept.
+	n.restored = states
+	defer func() {
+		n.restored = nil
+	}()
+	old := n.cfg
+	n.cfg = cfg
+	if err = n.loadComponents(ctx, nil); err != nil {
+		_, _ = n.closeComponents(time.Time{})
+		n.cfg = old
+		if err2 := n.loadComponents(ctx, nil); err2 != nil {
+			return fmt.Errorf("%w: %v; failed to load the previous config back: %v", ErrRestartRequired, err, err2)
+		}
+		return err
+	}
+	log.Printf("reload: %d entities", len(n.entities))
+	return nil
+}
+
+// reloadEntries only closes and loads the entries that differ between n.cfg
+// and cfg.
+func (n *Node) reloadEntries(ctx context.Context, cfg *config.Root) error {
+	old, before := n.cfg, n.loaded
+	after := n.entries(cfg, nil)
+	kept := keptEntries(before, after)
+	var closing, loading []*entry
+	for _, e := range before {
+		if kept[e.id()] == nil {
+			closing = append(closing, e)
+		}
+	}
+	for _, e := range after {
+		if p := kept[e.id()]; p != nil {
+			e.entities, e.displays = p.entities, p.displays
+		} else {
+			loading = append(loading, e)
+		}
+	}
+	if len(closing) != 0 || len(loading) != 0 || !reflect.DeepEqual(old.API, cfg.API) || !reflect.DeepEqual(old.PeriphHome, cfg.PeriphHome) {
+		n.disconnectClients()
+	}
+
+	n.runShutdownActions(closing)
+	var closed []component
+	for _, e := range closing {
+		closed = append(closed, e.entities...)
+	}
+	states, err := stateRecords(closed)
+	if err != nil {
+		log.Printf("reload: failed to snapshot states: %s", err)
+	}
+	// Stop saving before closing, so turning the hardware off is not
+	// persisted.
+	if n.store != nil {
+		if err = n.store.stop(); err != nil {
+			log.Printf("reload: failed to save component states: %s", err)
+		}
+		defer func() {
+			for _, p := range kept {
+				for _, c := range p.entities {
+					if r, ok := c.(restorable); ok {
+						n.store.follow(c, r)
+					}
+				}
+			}
+		}()
+	}
+	n.closeEntries(closing)
+	var unchanged []*entry
+	for _, e := range before {
+		if kept[e.id()] != nil {
+			unchanged = append(unchanged, e)
+		}
+	}
+	n.setEntries(unchanged)
+
+	// Replay the states to the entities loaded again.
+	n.restored = states
+	defer func() {
+		n.restored = nil
+	}()
+	n.cfg = cfg
+	for _, e := range loading {
+		if err = n.loadEntry(ctx, e); err == nil {
+			continue
+		}
+		n.closeEntries(loading)
+		n.setEntries(unchanged)
+		n.cfg = old
+		for _, p := range closing {
+			if err2 := n.loadEntry(ctx, p); err2 != nil {
+				return fmt.Errorf("%w: %v; failed to load the previous config back: %v", ErrRestartRequired, err, err2)
+			}
+		}
+		n.setEntries(before)
+		return err
+	}
+	n.setEntries(after)
+	n.loaded = after
+	n.services = nil
+	n.serviceList = nil
+	n.loadServices()
+
+	ids := map[string]bool{}
+	for _, e := range after {
+		ids[e.id()] = true
+	}
+	for _, e := range closing {
+		if ids[e.id()] {
+			log.Printf("reload: reloading %s", e.id())
+		} else {
+			log.Printf("reload: removed %s", e.id())
+		}
+	}
+	ids = map[string]bool{}
+	for _, e := range before {
+		ids[e.id()] = true
+	}
+	for _, e := range loading {
+		if !ids[e.id()] {
+			log.Printf("reload: added %s", e.id())
+		}
+	}
+	log.Printf("reload: %d entities", len(n.entities))
+	return nil
+}
+
+// keptEntries returns the entries of before that are unchanged in after, by
+// id.
+//
+// An entry referencing an entity of an entry that changed is not kept either,
+// since it holds the entity that is closed.
+func keptEntries(before, after []*entry) map[string]*entry {
+	prev := make(map[string]*entry, len(before))
+	for _, e := range before {
+		prev[e.id()] = e
+	}
+	kept := map[string]*entry{}
+	for _, e := range after {
+		if p := prev[e.id()]; p != nil && reflect.DeepEqual(p.cfg, e.cfg) {
+			kept[e.id()] = p
+		}
+	}
+	for {
+		// The names of the entities closed or loaded.
+		changed := map[string]bool{}
+		for _, e := range before {
+			if kept[e.id()] == nil {
+				for _, c := range e.entities {
+					changed[c.getName()] = true
+				}
+			}
+		}
+		for _, e := range after {
+			if kept[e.id()] == nil && e.name != "" {
+				changed[e.name] = true
+			}
+		}
+		done := true
+		for id, p := range kept {
+			for _, r := range p.refs {
+				if changed[r] {
+					delete(kept, id)
+					done = false
+					break
+				}
+			}
+		}
+		if done {
+			return kept
+		}
+	}
+}
+
+// closeEntries closes the displays and the entities loaded by the entries.
+func (n *Node) closeEntries(entries []*entry) {
+	for _, e := range entries {
+		for _, d := range e.displays {
+			if err := d.Close(); err != nil {
+				log.Printf("reload: failed to close display: %s", err)
+			}
+		}
+	}
+	for _, e := range entries {
+		for _, c := range e.entities {
+			log.Printf("closing component %s", c.getName())
+			if err := c.Close(); err != nil {
+				log.Printf("reload: failed to close %s: %s", c.getName(), err)
+			}
+			delete(n.lookup, c.getHash())
+			n.cfgStatus.mu.Lock()
+			if n.cfgStatus.t != nil && component(n.cfgStatus.t) == c {
+				n.cfgStatus.t = nil
+			}
+			n.cfgStatus.mu.Unlock()
+			n.lastErr.mu.Lock()
+			if n.lastErr.t != nil && component(n.lastErr.t) == c {
+				n.lastErr.t = nil
+			}
+			n.lastErr.mu.Unlock()
+		}
+	}
+}
+
+// setEntries sets the entities and the displays to the ones loaded by the
+// entries, in order.
+func (n *Node) setEntries(entries []*entry) {
+	n.entities = nil
+	n.displays = nil
+	for _, e := range entries {
+		n.entities = append(n.entities, e.entities...)
+		n.displays = append(n.displays, e.displays...)
+	}
+}
+
+// disconnectClients disconnects the native API clients so they list the
+// entities again when they reconnect.
+func (n *Node) disconnectClients() {
+	if n.cancelConns != nil {
+		n.cancelConns()
+		n.connCtx, n.cancelConns = context.WithCancel(n.apiCtx)
+	}
+}
+
+// restartSettings returns the settings that differ between old and cfg and
+// that can only be applied by restarting the node.
+func restartSettings(old, cfg *config.Root) []string {
+	var out []string
+	if old.PeriphHome.Name != cfg.PeriphHome.Name {
+		out = append(out, "periphhome/name")
+	}
+	if old.PeriphHome.StateDir != cfg.PeriphHome.StateDir {
+		out = append(out, "periphhome/state_dir")
+	}
+	if old.PeriphHome.StateStore != cfg.PeriphHome.StateStore {
+		out = append(out, "periphhome/state_store")
+	}
+	if old.PeriphHome.IDScheme != cfg.PeriphHome.IDScheme {
+		out = append(out, "periphhome/id_scheme")
+	}
+	if old.PeriphHome.BindAddress != cfg.PeriphHome.BindAddress {
+		out = append(out, "periphhome/bind_address")
+	}
+	if old.PeriphHome.Interface != cfg.PeriphHome.Interface {
+		out = append(out, "periphhome/interface")
+	}
+	if old.API.IsPresent != cfg.API.IsPresent || old.API.Port != cfg.API.Port {
+		out = append(out, "api/port")
+	}
+	if !reflect.DeepEqual(old.API.Encryption, cfg.API.Encryption) {
+		out = append(out, "api/encryption")
+	}
+	if !reflect.DeepEqual(old.API.AllowedClients, cfg.API.AllowedClients) {
+		out = append(out, "api/allowed_clients")
+	}
+	if !reflect.DeepEqual(old.WebServer, cfg.WebServer) {
+		out = append(out, "web_server")
+	}
+	return out
+}
@@ -0,0 +1,249 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestReload(t *testing.T) {
+	shouldLog = testing.Verbose()
+	port := getFreePort(t)
+	load := func(sensors ...string) *config.Root {
+		y := fmt.Sprintf("periphhome:\n  name: pi\napi:\n  port: %d\ntext_sensor:\n  - platform: config_status\n    name: Config\nsensor:\n", port)
+		for _, s := range sensors {
+			y += fmt.Sprintf("  - platform: fake\n    name: %s\n    update_interval: 60s\n", s)
+		}
+		cfg := &config.Root{}
+		if err := cfg.LoadYaml([]byte(y)); err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+	ctx := context.Background()
+	n, err := New(ctx, load("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	c := dialTestClient(t, port, "")
+	if diff := cmp.Diff([]string{"a", "b", "Config"}, listEntityNames(c)); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+
+	if err = n.Reload(ctx, load("a", "c")); err != nil {
+		t.Fatal(err)
+	}
+	// The client is asked to disconnect so it lists the entities again.
+	if _, ok := c.recv().(*aioesphomeapi.DisconnectRequest); !ok {
+		t.Fatal("expected DisconnectRequest")
+	}
+	c.send(&aioesphomeapi.DisconnectResponse{})
+	if err = c.c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The listener was kept.
+	c = dialTestClient(t, port, "")
+	defer c.close()
+	if diff := cmp.Diff([]string{"a", "c", "Config"}, listEntityNames(c)); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+	n.SetConfigFile("/etc/periphhome.yaml", time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+	if s := stateString(n.entities[2]); s != "loaded /etc/periphhome.yaml (2021-03-04 05:06:07)" {
+		t.Fatal(s)
+	}
+}
+
+func TestReload_Unchanged(t *testing.T) {
+	shouldLog = testing.Verbose()
+	port := getFreePort(t)
+	load := func(lamp string, sensors ...string) *config.Root {
+		y := fmt.Sprintf("periphhome:\n  name: pi\n  on_boot:\n    - light.turn_on: {name: Lamp}\napi:\n  port: %d\n", port)
+		y += "light:\n  - platform: fake\n    name: Lamp\n" + lamp
+		y += "  - platform: group\n    name: All\n    lights: [Lamp]\n"
+		y += "  - platform: fake\n    name: Other\n"
+		y += "sensor:\n"
+		for _, s := range sensors {
+			y += fmt.Sprintf("  - platform: fake\n    name: %s\n    update_interval: 60s\n", s)
+		}
+		cfg := &config.Root{}
+		if err := cfg.LoadYaml([]byte(y)); err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+	ctx := context.Background()
+	n, err := New(ctx, load("", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	find := func() []component {
+		e, err := n.findEntities([]string{"Lamp", "All", "Other", "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	e := find()
+	for start := time.Now(); stateString(e[0]) != "ON"; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("on_boot didn't run")
+		}
+	}
+	if err = e[0].lightCommand(&aioesphomeapi.LightCommandRequest{Key: e[0].getHash(), HasState: true}); err != nil {
+		t.Fatal(err)
+	}
+	c := dialTestClient(t, port, "")
+	defer func() {
+		c.close()
+	}()
+
+	// Nothing changed, so nothing is reloaded and the client stays connected.
+	if err = n.Reload(ctx, load("", "a")); err != nil {
+		t.Fatal(err)
+	}
+	c.send(&aioesphomeapi.PingRequest{})
+	if _, ok := c.recv().(*aioesphomeapi.PingResponse); !ok {
+		t.Fatal("expected PingResponse")
+	}
+	if diff := cmp.Diff(e, find(), cmp.Comparer(func(a, b component) bool { return a == b })); diff != "" {
+		t.Fatalf("expected the same entities (-want +got):\n%s", diff)
+	}
+	if s := stateString(e[0]); s != "OFF" {
+		t.Fatalf("on_boot ran again: %s", s)
+	}
+
+	// Only the modified light and the group using it are loaded again.
+	if err = n.Reload(ctx, load("    on_shutdown: [{delay: 1ms}]\n", "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	e2 := find()
+	if e2[0] == e[0] || e2[1] == e[1] || e2[2] != e[2] || e2[3] != e[3] {
+		t.Fatal("unexpected entities reloaded")
+	}
+	if len(n.entities) != 5 {
+		t.Fatalf("got %d entities", len(n.entities))
+	}
+	// The client lists the entities again.
+	if _, ok := c.recv().(*aioesphomeapi.DisconnectRequest); !ok {
+		t.Fatal("expected DisconnectRequest")
+	}
+	c.send(&aioesphomeapi.DisconnectResponse{})
+	if err = c.c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c = dialTestClient(t, port, "")
+	if diff := cmp.Diff([]string{"a", "b", "Lamp", "All", "Other"}, listEntityNames(c)); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+}
+
+func TestReload_RestartRequired(t *testing.T) {
+	n := Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	data := []config.Root{
+		{PeriphHome: config.PeriphHome{Name: "other"}},
+		{PeriphHome: config.PeriphHome{StateDir: "/var/lib/periphhome"}},
+		{PeriphHome: config.PeriphHome{StateStore: "/var/lib/periphhome"}},
+		{PeriphHome: config.PeriphHome{IDScheme: "mac"}},
+		{PeriphHome: config.PeriphHome{BindAddress: "127.0.0.1"}},
+		{PeriphHome: config.PeriphHome{Interface: "eth0"}},
+		{API: config.API{IsPresent: true}},
+		{API: config.API{AllowedClients: []string{"10.0.0.0/8"}}},
+		{WebServer: config.WebServer{IsPresent: true}},
+	}
+	for i := range data {
+		if err := n.Reload(context.Background(), &data[i]); !errors.Is(err, ErrRestartRequired) {
+			t.Fatalf("#%d: %v", i, err)
+		}
+	}
+}
+
+func TestReload_LoadError(t *testing.T) {
+	shouldLog = testing.Verbose()
+	old := &config.Root{Sensors: []config.Sensor{{Platform: "fake", Name: "a", UpdateInterval: time.Minute}}}
+	n := Node{cfg: old, lookup: map[uint32]component{}, outputs: map[string]output{}, muxes: map[string]*i2cMux{}}
+	ctx := context.Background()
+	if err := n.loadComponents(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := n.closeComponents(time.Time{}); err != nil {
+			t.Error(err)
+		}
+	}()
+	// update_interval is missing.
+	cfg := &config.Root{Sensors: []config.Sensor{{Platform: "fake", Name: "b"}}}
+	if err := n.Reload(ctx, cfg); err == nil || errors.Is(err, ErrRestartRequired) {
+		t.Fatal(err)
+	}
+	if n.cfg != old {
+		t.Fatal("expected the previous config")
+	}
+	if len(n.entities) != 1 || n.entities[0].getName() != "a" {
+		t.Fatalf("unexpected entities %v", n.entities)
+	}
+}
+
+func TestReload_UnknownPin(t *testing.T) {
+	shouldLog = testing.Verbose()
+	old := &config.Root{Sensors: []config.Sensor{{Platform: "fake", Name: "a", UpdateInterval: time.Minute}}}
+	n := Node{cfg: old, lookup: map[uint32]component{}, outputs: map[string]output{}, muxes: map[string]*i2cMux{}}
+	ctx := context.Background()
+	if err := n.loadComponents(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := n.closeComponents(time.Time{}); err != nil {
+			t.Error(err)
+		}
+	}()
+	cfg := &config.Root{
+		Sensors:       old.Sensors,
+		BinarySensors: []config.BinarySensor{{Platform: "gpio", Name: "Door", Pin: config.Pin{Number: "GPI017"}}},
+	}
+	if err := n.Reload(ctx, cfg); err == nil || n.cfg != old {
+		t.Fatal(err)
+	}
+	// With continue_on_error, only the binary sensor is skipped.
+	cfg.PeriphHome.ContinueOnError = true
+	if err := n.Reload(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.entities) != 2 || n.entities[0].getName() != "binary_sensor Door error" || n.entities[1].getName() != "a" {
+		t.Fatalf("unexpected entities %v", n.entities)
+	}
+}
+
+// listEntityNames lists the entities over the native API.
+func listEntityNames(c *testClient) []string {
+	c.send(&aioesphomeapi.ListEntitiesRequest{})
+	var out []string
+	for {
+		msg := c.recv()
+		if _, ok := msg.(*aioesphomeapi.ListEntitiesDoneResponse); ok {
+			return out
+		}
+		m := msg.ProtoReflect()
+		out = append(out, m.Get(m.Descriptor().Fields().ByName("name")).String())
+	}
+}
@@ -8,23 +8,107 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"time"
 
+	"google.golang.org/protobuf/proto"
 	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
 
 func (n *Node) loadSensor(ctx context.Context, cfg *config.Sensor) error {
 	log.Printf("loading sensor %s", cfg.Platform)
 	switch cfg.Platform {
+	case "adc":
+		if err := n.loadSensorADC(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "ads1115":
+		if err := n.loadSensorADS1115(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "aht10", "aht20":
+		if err := n.loadSensorAHTxx(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "bh1750":
+		if err := n.loadSensorBH1750(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
 	case "bme280":
 		if err := n.loadSensorBMxx80(ctx, cfg); err != nil {
 			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
 		}
 		return nil
+	case "boot_count":
+		if err := n.loadSensorBootCount(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "connection_stats":
+		if err := n.loadSensorConnectionStats(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "cpu_temperature":
+		if err := n.loadSensorCPUTemperature(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "dht":
+		if err := n.loadSensorDHT(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "ds18b20":
+		if err := n.loadSensorDS18B20(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
 	case "fake":
 		if err := n.loadSensorFake(ctx, cfg); err != nil {
 			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
 		}
 		return nil
+	case "go_runtime":
+		if err := n.loadSensorGoRuntime(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "gpio_bus":
+		if err := n.loadSensorGPIOBus(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "system_load":
+		if err := n.loadSensorSystemLoad(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "tsl2561", "tsl2591":
+		if err := n.loadSensorTSL25x1(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "ultrasonic":
+		if err := n.loadSensorUltrasonic(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "uptime":
+		if err := n.loadSensorUptime(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "vcgencmd":
+		if err := n.loadSensorVcgencmd(ctx, cfg); err != nil {
+			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
 	case "wifi_signal":
 		if err := n.loadSensorWifiSignal(ctx, cfg); err != nil {
 			return fmt.Errorf("sensor(%s): %w", cfg.Platform, err)
@@ -34,3 +118,126 @@ func (n *Node) loadSensor(ctx context.Context, cfg *config.Sensor) error {
 		return fmt.Errorf("unknown platform %q", cfg.Platform)
 	}
 }
+
+// sensorBase is the common code for sensors publishing a float value.
+type sensorBase struct {
+	componentBase
+	// calibration is the "calibrate_linear" mapping, if any.
+	calibration []config.CalibrationPoint
+
+	// Used in describe(). Platforms set their defaults, then call override().
+	//
+	// stateClass enables long-term statistics in Home Assistant. Platforms
+	// measuring a physical quantity default to measurement, counters to
+	// total_increasing.
+	icon        string
+	unit        string
+	accuracy    int32
+	deviceClass string
+	stateClass  aioesphomeapi.SensorStateClass
+}
+
+// override applies the values set in the config over the platform defaults.
+func (s *sensorBase) override(unit string, accuracy *int, deviceClass, stateClass string) {
+	if unit != "" {
+		s.unit = unit
+	}
+	if accuracy != nil {
+		s.accuracy = int32(*accuracy)
+	}
+	if deviceClass != "" {
+		s.deviceClass = deviceClass
+	}
+	switch stateClass {
+	case "":
+	case "none":
+		s.stateClass = aioesphomeapi.SensorStateClass_STATE_CLASS_NONE
+	case "measurement":
+		s.stateClass = aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT
+	case "total_increasing":
+		s.stateClass = aioesphomeapi.SensorStateClass_STATE_CLASS_TOTAL_INCREASING
+	}
+}
+
+func (s *sensorBase) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesSensorResponse{
+		ObjectId:          s.objectID,
+		Key:               s.key,
+		Name:              s.name,
+		UniqueId:          s.uniqueID,
+		Icon:              s.icon,
+		UnitOfMeasurement: s.unit,
+		AccuracyDecimals:  s.accuracy,
+		DeviceClass:       s.deviceClass,
+		StateClass:        s.stateClass,
+	}
+}
+
+// publish publishes a new measured value.
+//
+// When the sensor has no decimals, the value is rounded so Home Assistant
+// renders "1" instead of "1.0".
+func (s *sensorBase) publish(v float32) {
+	v = calibrate(s.calibration, v)
+	if s.accuracy == 0 {
+		v = float32(math.Round(float64(v)))
+	}
+	s.onNewState(&aioesphomeapi.SensorStateResponse{
+		Key:   s.key,
+		State: v,
+	})
+}
+
+// publishMissing publishes that the value could not be measured.
+func (s *sensorBase) publishMissing() {
+	s.onNewState(&aioesphomeapi.SensorStateResponse{
+		Key:          s.key,
+		MissingState: true,
+	})
+}
+
+// oversample does n readings, spaced by gap, and returns their average.
+//
+// Failed readings are skipped; it only fails if all of them fail.
+func oversample(n int, gap time.Duration, read func() (float32, error)) (float32, error) {
+	if n <= 1 {
+		return read()
+	}
+	var sum float32
+	ok := 0
+	var err error
+	for i := 0; i < n; i++ {
+		if i != 0 && gap != 0 {
+			time.Sleep(gap)
+		}
+		v, err2 := read()
+		if err2 != nil {
+			err = err2
+			continue
+		}
+		sum += v
+		ok++
+	}
+	if ok == 0 {
+		return 0, err
+	}
+	return sum / float32(ok), nil
+}
+
+// calibrate maps a measured value to the actual value by linear
+// interpolation between the two closest points.
+//
+// Values outside of the points are extrapolated from the first or last
+// segment. points must be sorted by Measured.
+func calibrate(points []config.CalibrationPoint, v float32) float32 {
+	if len(points) < 2 {
+		return v
+	}
+	x := float64(v)
+	i := 1
+	for i < len(points)-1 && x > points[i].Measured {
+		i++
+	}
+	a, b := points[i-1], points[i]
+	return float32(a.Actual + (x-a.Measured)*(b.Actual-a.Actual)/(b.Measured-a.Measured))
+}
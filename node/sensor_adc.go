@@ -0,0 +1,151 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/analog"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/pin/pinreg"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorADC loads an analog input pin measuring a voltage.
+func (n *Node) loadSensorADC(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" || cfg.Address != 0 {
+		return errors.New("do not use temperature / pressure / humidity / address")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	switch cfg.Pin.Mode {
+	case "", config.Analog:
+	default:
+		return errors.New("pin: mode must be ANALOG")
+	}
+	adc, err := findAnalogPin(cfg.Pin.Number)
+	if err != nil {
+		return err
+	}
+	s := &sensorADC{
+		sensorBase: sensorBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: sensorComponent,
+			},
+			calibration: cfg.CalibrateLinear,
+			icon:        "mdi:flash",
+			unit:        "V",
+			accuracy:    2,
+			deviceClass: "voltage",
+			stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+		},
+		p:        adc,
+		update:   cfg.UpdateInterval,
+		samples:  cfg.Samples,
+		multiply: float32(cfg.Multiply),
+	}
+	if s.multiply == 0 {
+		s.multiply = 1
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	return n.addEntity(ctx, s)
+}
+
+// findAnalogPin returns the analog input by name.
+//
+// Analog pins are not in gpioreg since they do not implement gpio.PinIO,
+// they are looked up in the headers instead.
+func findAnalogPin(name string) (analog.PinADC, error) {
+	for _, h := range pinreg.All() {
+		for _, row := range h {
+			for _, p := range row {
+				if p.Name() != name {
+					continue
+				}
+				if a, ok := p.(analog.PinADC); ok {
+					return a, nil
+				}
+				return nil, fmt.Errorf("pin %s is not an analog input", p)
+			}
+		}
+	}
+	if p := gpioreg.ByName(name); p != nil {
+		return nil, fmt.Errorf("pin %s is not an analog input", p)
+	}
+	return nil, fmt.Errorf("unknown pin %q", name)
+}
+
+type sensorADC struct {
+	sensorBase
+	p        analog.PinADC
+	update   time.Duration
+	samples  int
+	multiply float32
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (s *sensorADC) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+	return s.p.Halt()
+}
+
+func (s *sensorADC) init(ctx context.Context, n *Node) error {
+	if err := s.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	// Confirm the pin can be read.
+	if err := s.read(); err != nil {
+		return err
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTicker(s.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err := s.read(); err != nil {
+					s.setError(err)
+					s.publishMissing()
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// read reads the pin and publishes the voltage.
+func (s *sensorADC) read() error {
+	v, err := oversample(s.samples, 0, func() (float32, error) {
+		v, err := s.p.Read()
+		return float32(v.V) / float32(physic.Volt), err
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(v * s.multiply)
+	return nil
+}
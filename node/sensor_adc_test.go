@@ -0,0 +1,74 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/analog"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/pin"
+	"periph.io/x/conn/v3/pin/pinreg"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestSensorADC(t *testing.T) {
+	a := &fakeADCPin{BasicPin: pin.BasicPin{N: "FAKE_AIN0"}, v: 1650 * physic.MilliVolt}
+	d := &gpiotest.Pin{N: "FAKE_GPIO0"}
+	if err := pinreg.Register("FAKE", [][]pin.Pin{{a, d}}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := pinreg.Unregister("FAKE"); err != nil {
+			t.Error(err)
+		}
+	}()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Sensor{
+		Platform:       "adc",
+		Name:           "Battery",
+		Pin:            config.Pin{Number: "FAKE_AIN0"},
+		UpdateInterval: time.Minute,
+		Multiply:       2,
+	}
+	if err := n.loadSensor(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	s := n.entities[0]
+	if d := s.describe().(*aioesphomeapi.ListEntitiesSensorResponse); d.UnitOfMeasurement != "V" || d.DeviceClass != "voltage" {
+		t.Fatalf("unexpected %v", d)
+	}
+	if v := s.getState().(*aioesphomeapi.SensorStateResponse); v.MissingState || v.State != 3.3 {
+		t.Fatalf("unexpected %v", v)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, number := range []string{"FAKE_GPIO0", "FAKE_UNKNOWN"} {
+		n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+		cfg.Pin.Number = number
+		if err := n.loadSensor(context.Background(), &cfg); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
+
+type fakeADCPin struct {
+	pin.BasicPin
+	v physic.ElectricPotential
+}
+
+func (f *fakeADCPin) Range() (analog.Sample, analog.Sample) {
+	return analog.Sample{}, analog.Sample{V: 3300 * physic.MilliVolt, Raw: 4095}
+}
+
+func (f *fakeADCPin) Read() (analog.Sample, error) {
+	return analog.Sample{V: f.v, Raw: int32(f.v * 4095 / (3300 * physic.MilliVolt))}, nil
+}
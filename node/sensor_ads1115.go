@@ -0,0 +1,200 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/devices/v3/ads1x15"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorADS1115 loads an ADS1115 4 channels 16 bits ADC and each channel
+// separately.
+func (n *Node) loadSensorADS1115(ctx context.Context, cfg *config.Sensor) error {
+	if len(cfg.Channels) == 0 {
+		return errors.New("channels is required")
+	}
+	if cfg.Name != "" || cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" {
+		return errors.New("do not use name / temperature / pressure / humidity, use channels")
+	}
+	if len(cfg.CalibrateLinear) != 0 || cfg.UnitOfMeasurement != "" || cfg.AccuracyDecimals != nil || cfg.DeviceClass != "" || cfg.StateClass != "" {
+		return errors.New("set calibrate_linear / unit_of_measurement / accuracy_decimals / device_class / state_class in channels")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	opts := ads1x15.DefaultOpts
+	if cfg.Address != 0 {
+		opts.I2cAddress = uint16(cfg.Address)
+	}
+	gain := cfg.Gain
+	if gain == 0 {
+		gain = 2.048
+	}
+	rate := physic.Frequency(cfg.DataRate) * physic.Hertz
+	if rate == 0 {
+		rate = 128 * physic.Hertz
+	}
+	b, err := n.openSensorI2C(cfg)
+	if err != nil {
+		return err
+	}
+	dev, err := ads1x15.NewADS1115(b, &opts)
+	if err != nil {
+		_ = b.Close()
+		return err
+	}
+	d := &devADS1115{bus: b, d: dev, update: cfg.UpdateInterval, samples: cfg.Samples}
+
+	// Add one component per channel. The pins must be created before the
+	// entities are added, so the first read in init() works.
+	for i := range cfg.Channels {
+		ch := &cfg.Channels[i]
+		g := ch.Gain
+		if g == 0 {
+			g = gain
+		}
+		v := physic.ElectricPotential(g * float64(physic.Volt))
+		p, err := dev.PinForChannel(ads1115Channels[ch.Multiplexer], v, rate, ads1x15.BestQuality)
+		if err != nil {
+			_ = d.Close()
+			return err
+		}
+		// Each LSB is g/32768 V, so use one more decimal for the lower ranges.
+		accuracy := int32(3)
+		if g < 4 {
+			accuracy = 4
+		}
+		s := &sensorADS1115{
+			sensorBase: sensorBase{
+				componentBase: componentBase{
+					name:          ch.Name,
+					componentType: sensorComponent,
+				},
+				calibration: ch.CalibrateLinear,
+				icon:        "mdi:flash",
+				unit:        "V",
+				accuracy:    accuracy,
+				deviceClass: "voltage",
+				stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+			},
+			d:     d,
+			p:     p,
+			first: i == 0,
+		}
+		s.override(ch.UnitOfMeasurement, ch.AccuracyDecimals, ch.DeviceClass, ch.StateClass)
+		d.channels = append(d.channels, s)
+	}
+	for i, s := range d.channels {
+		if err := n.addEntity(ctx, s); err != nil {
+			if i == 0 {
+				_ = d.Close()
+			}
+			// Otherwise the first channel, already added, closes the device.
+			return err
+		}
+	}
+	d.init(ctx)
+	return nil
+}
+
+// ads1115Channels maps the multiplexer configuration to the channel.
+var ads1115Channels = map[string]ads1x15.Channel{
+	"A0_GND": ads1x15.Channel0,
+	"A1_GND": ads1x15.Channel1,
+	"A2_GND": ads1x15.Channel2,
+	"A3_GND": ads1x15.Channel3,
+	"A0_A1":  ads1x15.Channel0Minus1,
+	"A0_A3":  ads1x15.Channel0Minus3,
+	"A1_A3":  ads1x15.Channel1Minus3,
+	"A2_A3":  ads1x15.Channel2Minus3,
+}
+
+type sensorADS1115 struct {
+	sensorBase
+	d     *devADS1115
+	p     ads1x15.PinADC
+	first bool
+}
+
+func (s *sensorADS1115) Close() error {
+	// Have the first Close close them all, like bme280.
+	if s.first {
+		return s.d.Close()
+	}
+	return nil
+}
+
+// read reads the channel and publishes the voltage.
+func (s *sensorADS1115) read() error {
+	v, err := oversample(s.d.samples, 0, func() (float32, error) {
+		v, err := s.p.Read()
+		return float32(v.V) / float32(physic.Volt), err
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(v)
+	return nil
+}
+
+// devADS1115 is the underlying connection shared by the channels.
+type devADS1115 struct {
+	bus      i2c.BusCloser
+	d        *ads1x15.Dev
+	update   time.Duration
+	samples  int
+	channels []*sensorADS1115
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (d *devADS1115) Close() error {
+	if d.cancel != nil {
+		d.cancel()
+		d.wg.Wait()
+	}
+	for _, s := range d.channels {
+		_ = s.p.Halt()
+	}
+	err := d.d.Halt()
+	if err2 := d.bus.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (d *devADS1115) init(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		t := time.NewTicker(d.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			// The channels are read one after the other as there is only one
+			// converter.
+			for _, s := range d.channels {
+				if err := s.read(); err != nil {
+					s.setError(err)
+				}
+			}
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
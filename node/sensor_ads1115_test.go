@@ -0,0 +1,119 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/i2c/i2ctest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestLoadSensorADS1115(t *testing.T) {
+	shouldLog = testing.Verbose()
+	bus := &closeCounter{
+		Playback: i2ctest.Playback{
+			Ops: []i2ctest.IO{
+				// A0_GND at 4.096V, 128Hz, single shot, comparator disabled.
+				{Addr: 0x48, W: []byte{0x01, 0xC3, 0x83}},
+				{Addr: 0x48, W: []byte{0x00}, R: []byte{0x40, 0x00}},
+				// A1_A3 at the default 2.048V.
+				{Addr: 0x48, W: []byte{0x01, 0xA5, 0x83}},
+				{Addr: 0x48, W: []byte{0x00}, R: []byte{0x20, 0x00}},
+			},
+			DontPanic: true,
+		},
+	}
+	opened := 0
+	open := func() (i2c.BusCloser, error) {
+		opened++
+		return bus, nil
+	}
+	if err := i2creg.Register("FAKE_I2C_ADS1115", nil, -1, open); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := i2creg.Unregister("FAKE_I2C_ADS1115"); err != nil {
+			t.Error(err)
+		}
+	}()
+	cfg := &config.Root{}
+	y := "periphhome:\n  name: pi\n" +
+		"sensor:\n" +
+		"  - platform: ads1115\n" +
+		"    i2c_id: FAKE_I2C_ADS1115\n" +
+		"    update_interval: 1h\n" +
+		"    channels:\n" +
+		"      - name: Battery\n" +
+		"        multiplexer: A0_GND\n" +
+		"        gain: 4.096\n" +
+		"      - name: Shunt\n" +
+		"        multiplexer: A1_A3\n"
+	if err := cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			_ = n.Close()
+		}
+	}()
+	if len(n.entities) != 2 {
+		t.Fatalf("got %d entities", len(n.entities))
+	}
+	for i, want := range []struct {
+		v        float32
+		accuracy int32
+	}{{2.048, 3}, {0.512, 4}} {
+		for start := time.Now(); ; time.Sleep(time.Millisecond) {
+			if s, ok := n.entities[i].getState().(*aioesphomeapi.SensorStateResponse); ok && !s.MissingState {
+				if s.State != want.v {
+					t.Fatalf("#%d: got %g; want %g", i, s.State, want.v)
+				}
+				break
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("#%d: timed out", i)
+			}
+		}
+		l, ok := n.entities[i].describe().(*aioesphomeapi.ListEntitiesSensorResponse)
+		if !ok || l.AccuracyDecimals != want.accuracy || l.UnitOfMeasurement != "V" {
+			t.Fatalf("#%d: unexpected %v", i, l)
+		}
+	}
+	closed = true
+	if err = n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if opened != 1 || bus.closed != 1 {
+		t.Fatalf("opened %d, closed %d", opened, bus.closed)
+	}
+}
+
+// closeCounter is a i2ctest.Playback that counts the calls to Close.
+type closeCounter struct {
+	i2ctest.Playback
+	mu     sync.Mutex
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.mu.Lock()
+	c.closed++
+	c.mu.Unlock()
+	return c.Playback.Close()
+}
@@ -0,0 +1,266 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorAHTxx loads an AHT10 or AHT20/AHT21 temperature and humidity
+// sensor and each component separately.
+//
+// Datasheet:
+// http://www.aosong.com/userfiles/files/media/Data%20Sheet%20AHT20.pdf
+func (n *Node) loadSensorAHTxx(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name == "" && cfg.Humidity.Name == "" {
+		return errors.New("specify a name for at least one of temperature / humidity")
+	}
+	if cfg.Name != "" || cfg.Pressure.Name != "" {
+		return errors.New("do not use name / pressure")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	if len(cfg.CalibrateLinear) != 0 || cfg.UnitOfMeasurement != "" || cfg.AccuracyDecimals != nil || cfg.DeviceClass != "" || cfg.StateClass != "" {
+		return errors.New("set calibrate_linear / unit_of_measurement / accuracy_decimals / device_class / state_class in temperature / humidity")
+	}
+	d := &devAHTxx{
+		update: cfg.UpdateInterval,
+		aht20:  cfg.Platform == "aht20",
+	}
+	addr := uint16(0x38)
+	switch cfg.Address {
+	case 0, 0x38:
+	case 0x39:
+		// Only the AHT10 has an address pin.
+		if d.aht20 {
+			return errors.New("invalid address 0x39; the aht20 only supports 0x38")
+		}
+		addr = 0x39
+	default:
+		return fmt.Errorf("invalid address 0x%x; use 0x38 or 0x39", cfg.Address)
+	}
+	bus, err := n.openSensorI2C(cfg)
+	if err != nil {
+		return err
+	}
+	d.bus = bus
+	d.d = i2c.Dev{Bus: bus, Addr: addr}
+	if err = d.calibrate(); err != nil {
+		_ = bus.Close()
+		return err
+	}
+
+	// Add one component per activated sensor.
+	add := func(p *config.SensorParams, unit, deviceClass string) (*sensorAHTxx, error) {
+		if p.Name == "" {
+			return nil, nil
+		}
+		s := &sensorAHTxx{
+			sensorBase: sensorBase{
+				componentBase: componentBase{
+					name:          p.Name,
+					componentType: sensorComponent,
+				},
+				calibration: p.CalibrateLinear,
+				unit:        unit,
+				accuracy:    1,
+				deviceClass: deviceClass,
+				stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+			},
+			d: d,
+		}
+		s.override(p.UnitOfMeasurement, p.AccuracyDecimals, p.DeviceClass, p.StateClass)
+		return s, n.addEntity(ctx, s)
+	}
+	if d.temp, err = add(&cfg.Temperature, "°C", "temperature"); err != nil {
+		_ = d.Close()
+		return err
+	}
+	if d.humi, err = add(&cfg.Humidity, "%", "humidity"); err != nil {
+		_ = d.Close()
+		return err
+	}
+	// The first sensor closes the device.
+	if d.temp != nil {
+		d.temp.first = true
+	} else {
+		d.humi.first = true
+	}
+	d.init(ctx)
+	return nil
+}
+
+// AHTxx commands.
+var (
+	aht10Init    = []byte{0xE1, 0x08, 0x00}
+	aht20Init    = []byte{0xBE, 0x08, 0x00}
+	ahtxxTrigger = []byte{0xAC, 0x33, 0x00}
+)
+
+// AHTxx status bits.
+const (
+	ahtxxBusy       = 0x80
+	ahtxxCalibrated = 0x08
+)
+
+type sensorAHTxx struct {
+	sensorBase
+	d     *devAHTxx
+	first bool
+}
+
+func (s *sensorAHTxx) Close() error {
+	if s.first {
+		return s.d.Close()
+	}
+	return nil
+}
+
+// devAHTxx is the underlying connection for the sensors.
+type devAHTxx struct {
+	bus    i2c.BusCloser
+	d      i2c.Dev
+	update time.Duration
+	// aht20 is set for the AHT20/AHT21, which use a different initialization
+	// command than the AHT10 and append a CRC to the measurement.
+	aht20 bool
+	temp  *sensorAHTxx
+	humi  *sensorAHTxx
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (d *devAHTxx) Close() error {
+	if d.cancel != nil {
+		d.cancel()
+		d.wg.Wait()
+	}
+	return d.bus.Close()
+}
+
+// calibrate loads the calibration coefficients if the sensor reports it is
+// not calibrated yet.
+func (d *devAHTxx) calibrate() error {
+	// The sensor needs 40ms after power on.
+	time.Sleep(40 * time.Millisecond)
+	var s [1]byte
+	if err := d.d.Tx(nil, s[:]); err != nil {
+		return err
+	}
+	if s[0]&ahtxxCalibrated != 0 {
+		return nil
+	}
+	cmd := aht10Init
+	if d.aht20 {
+		cmd = aht20Init
+	}
+	if err := d.d.Tx(cmd, nil); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := d.d.Tx(nil, s[:]); err != nil {
+		return err
+	}
+	if s[0]&ahtxxCalibrated == 0 {
+		return errors.New("sensor failed to calibrate")
+	}
+	return nil
+}
+
+func (d *devAHTxx) init(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		t := time.NewTicker(d.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			d.sense()
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// sense reads the sensor and publishes the values.
+func (d *devAHTxx) sense() {
+	t, h, err := d.read()
+	if err != nil {
+		if d.temp != nil {
+			d.temp.setError(err)
+			d.temp.publishMissing()
+		}
+		if d.humi != nil {
+			d.humi.setError(err)
+			d.humi.publishMissing()
+		}
+		return
+	}
+	if d.temp != nil {
+		d.temp.publish(t)
+	}
+	if d.humi != nil {
+		d.humi.publish(h)
+	}
+}
+
+// read does one measurement and returns the temperature in °C and the
+// relative humidity in %.
+func (d *devAHTxx) read() (float32, float32, error) {
+	if err := d.d.Tx(ahtxxTrigger, nil); err != nil {
+		return 0, 0, err
+	}
+	// The conversion takes 75ms.
+	time.Sleep(80 * time.Millisecond)
+	// The AHT10 doesn't send the CRC.
+	b := make([]byte, 6, 7)
+	if d.aht20 {
+		b = b[:7]
+	}
+	if err := d.d.Tx(nil, b); err != nil {
+		return 0, 0, err
+	}
+	if b[0]&ahtxxBusy != 0 {
+		return 0, 0, errors.New("measurement not ready")
+	}
+	if d.aht20 {
+		if c := ahtxxCRC(b[:6]); c != b[6] {
+			return 0, 0, fmt.Errorf("invalid crc 0x%02x, expected 0x%02x", b[6], c)
+		}
+	}
+	h := uint32(b[1])<<12 | uint32(b[2])<<4 | uint32(b[3])>>4
+	t := uint32(b[3]&0x0F)<<16 | uint32(b[4])<<8 | uint32(b[5])
+	return float32(t)*200/(1<<20) - 50, float32(h) * 100 / (1 << 20), nil
+}
+
+// ahtxxCRC is CRC-8 with polynomial 0x31 initialized to 0xFF.
+func ahtxxCRC(b []byte) byte {
+	c := byte(0xFF)
+	for _, v := range b {
+		c ^= v
+		for i := 0; i < 8; i++ {
+			if c&0x80 != 0 {
+				c = c<<1 ^ 0x31
+			} else {
+				c <<= 1
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"testing"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2ctest"
+)
+
+func TestDevAHTxx_Read(t *testing.T) {
+	data := []struct {
+		aht20 bool
+		r     []byte
+		err   bool
+	}{
+		{true, []byte{0x1C, 0x80, 0x00, 0x06, 0x00, 0x00, 0x4E}, false},
+		{false, []byte{0x1C, 0x80, 0x00, 0x06, 0x00, 0x00}, false},
+		// Invalid CRC.
+		{true, []byte{0x1C, 0x80, 0x00, 0x06, 0x00, 0x00, 0x4F}, true},
+		// Busy.
+		{false, []byte{0x9C, 0x80, 0x00, 0x06, 0x00, 0x00}, true},
+	}
+	for i, l := range data {
+		bus := &i2ctest.Playback{
+			Ops: []i2ctest.IO{
+				{Addr: 0x38, W: ahtxxTrigger},
+				{Addr: 0x38, R: l.r},
+			},
+		}
+		d := devAHTxx{bus: bus, d: i2c.Dev{Bus: bus, Addr: 0x38}, aht20: l.aht20}
+		temp, humi, err := d.read()
+		if l.err {
+			if err == nil {
+				t.Errorf("#%d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if temp != 25 || humi != 50 {
+			t.Errorf("#%d: got %g°C %g%%", i, temp, humi)
+		}
+		if err = bus.Close(); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+	}
+}
+
+func TestDevAHTxx_Calibrate(t *testing.T) {
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x38, R: []byte{0x10}},
+			{Addr: 0x38, W: aht20Init},
+			{Addr: 0x38, R: []byte{0x18}},
+		},
+	}
+	d := devAHTxx{bus: bus, d: i2c.Dev{Bus: bus, Addr: 0x38}, aht20: true}
+	if err := d.calibrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAHTxxCRC(t *testing.T) {
+	// Example from Sensirion's datasheets, which use the same CRC.
+	if c := ahtxxCRC([]byte{0xBE, 0xEF}); c != 0x92 {
+		t.Fatalf("0x%02x", c)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorBH1750 loads a BH1750 ambient light sensor.
+//
+// Datasheet: https://www.mouser.com/datasheet/2/348/bh1750fvi-e-186247.pdf
+func (n *Node) loadSensorBH1750(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" {
+		return errors.New("do not use temperature / pressure / humidity")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	s := &sensorBH1750{
+		sensorBase: sensorBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: sensorComponent,
+			},
+			calibration: cfg.CalibrateLinear,
+			icon:        "mdi:brightness-5",
+			unit:        "lx",
+			accuracy:    1,
+			deviceClass: "illuminance",
+			stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+		},
+		update:  cfg.UpdateInterval,
+		samples: cfg.Samples,
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	switch cfg.Resolution {
+	case 0, 1:
+		s.mode = bh1750OneTimeHRes
+		s.conversion = 180 * time.Millisecond
+		s.divider = 12
+	case 0.5:
+		s.mode = bh1750OneTimeHRes2
+		s.conversion = 180 * time.Millisecond
+		s.divider = 24
+	case 4:
+		s.mode = bh1750OneTimeLRes
+		s.conversion = 24 * time.Millisecond
+		s.divider = 12
+	default:
+		return fmt.Errorf("invalid resolution %g; use 0.5, 1 or 4", cfg.Resolution)
+	}
+	addr := uint16(0x23)
+	switch cfg.Address {
+	case 0:
+	case 0x23, 0x5C:
+		addr = uint16(cfg.Address)
+	default:
+		return fmt.Errorf("invalid address 0x%x; use 0x23 or 0x5c", cfg.Address)
+	}
+	s.openBus = func() (i2c.BusCloser, error) { return n.openSensorI2C(cfg) }
+	s.d.Addr = addr
+	if err := s.open(); err != nil {
+		return err
+	}
+	err := n.addEntity(ctx, s)
+	if err != nil {
+		_ = s.bus.Close()
+	}
+	return err
+}
+
+// BH1750 instructions.
+const (
+	bh1750PowerOn      = 0x01
+	bh1750OneTimeHRes  = 0x20
+	bh1750OneTimeHRes2 = 0x21
+	bh1750OneTimeLRes  = 0x23
+)
+
+type sensorBH1750 struct {
+	sensorBase
+	openBus    func() (i2c.BusCloser, error)
+	bus        i2c.BusCloser
+	d          i2c.Dev
+	mode       byte
+	conversion time.Duration
+	// divider converts the raw count in tenth of a lux.
+	divider float32
+	update  time.Duration
+	samples int
+
+	wg     sync.WaitGroup
+	cancel func()
+	paused bool
+}
+
+func (s *sensorBH1750) Close() error {
+	if s.paused {
+		return nil
+	}
+	s.cancel()
+	s.wg.Wait()
+	return s.bus.Close()
+}
+
+// open opens the I²C bus.
+func (s *sensorBH1750) open() error {
+	b, err := s.openBus()
+	if err != nil {
+		return err
+	}
+	s.bus = b
+	s.d.Bus = b
+	return nil
+}
+
+// pause implements pauser.
+func (s *sensorBH1750) pause() error {
+	// A failed resume leaves it paused.
+	if s.paused {
+		return nil
+	}
+	s.paused = true
+	s.cancel()
+	s.wg.Wait()
+	return s.bus.Close()
+}
+
+// resume implements pauser.
+func (s *sensorBH1750) resume(ctx context.Context) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	s.paused = false
+	s.start(ctx)
+	return nil
+}
+
+func (s *sensorBH1750) init(ctx context.Context, n *Node) error {
+	if err := s.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	// Confirm the device is present.
+	v, err := oversample(s.samples, 0, s.read)
+	if err != nil {
+		return err
+	}
+	s.publish(v)
+	s.start(ctx)
+	return nil
+}
+
+// start starts the polling goroutine.
+func (s *sensorBH1750) start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTicker(s.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				v, err := oversample(s.samples, 0, s.read)
+				if err != nil {
+					s.setError(err)
+					continue
+				}
+				s.publish(v)
+			}
+		}
+	}()
+}
+
+// read does a one time measurement and returns the illuminance in lux.
+//
+// The sensor goes back to power down mode after the measurement.
+func (s *sensorBH1750) read() (float32, error) {
+	if err := s.d.Tx([]byte{bh1750PowerOn}, nil); err != nil {
+		return 0, err
+	}
+	if err := s.d.Tx([]byte{s.mode}, nil); err != nil {
+		return 0, err
+	}
+	time.Sleep(s.conversion)
+	var r [2]byte
+	if err := s.d.Tx(nil, r[:]); err != nil {
+		return 0, err
+	}
+	return float32(uint16(r[0])<<8|uint16(r[1])) * 10 / s.divider, nil
+}
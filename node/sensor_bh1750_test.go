@@ -0,0 +1,38 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"testing"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2ctest"
+)
+
+func TestSensorBH1750_Read(t *testing.T) {
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x23, W: []byte{bh1750PowerOn}},
+			{Addr: 0x23, W: []byte{bh1750OneTimeHRes2}},
+			{Addr: 0x23, R: []byte{0x01, 0x2C}},
+		},
+	}
+	s := sensorBH1750{
+		bus:     bus,
+		d:       i2c.Dev{Bus: bus, Addr: 0x23},
+		mode:    bh1750OneTimeHRes2,
+		divider: 24,
+	}
+	v, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 125 {
+		t.Fatalf("got %g", v)
+	}
+	if err = bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,11 +7,11 @@ package node
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"sync"
 	"time"
 
-	"google.golang.org/protobuf/proto"
-	"periph.io/x/conn/v3/i2c/i2creg"
 	"periph.io/x/conn/v3/physic"
 	"periph.io/x/conn/v3/spi/spireg"
 	"periph.io/x/devices/v3/bmxx80"
@@ -30,14 +30,32 @@ func (n *Node) loadSensorBMxx80(ctx context.Context, cfg *config.Sensor) error {
 	if cfg.Name != "" {
 		return errors.New("name is not supported")
 	}
+	if len(cfg.CalibrateLinear) != 0 || cfg.UnitOfMeasurement != "" || cfg.AccuracyDecimals != nil || cfg.DeviceClass != "" || cfg.StateClass != "" {
+		return errors.New("set calibrate_linear / unit_of_measurement / accuracy_decimals / device_class / state_class in temperature / pressure / humidity")
+	}
 	d := &devBMxx80{
 		update: cfg.UpdateInterval,
 	}
 
+	// The chip averages the samples itself.
+	o := bmxx80.O16x
+	switch cfg.Samples {
+	case 0, 16:
+	case 1:
+		o = bmxx80.O1x
+	case 2:
+		o = bmxx80.O2x
+	case 4:
+		o = bmxx80.O4x
+	case 8:
+		o = bmxx80.O8x
+	default:
+		return errors.New("samples must be 1, 2, 4, 8 or 16")
+	}
 	opts := bmxx80.Opts{
-		Temperature: bmxx80.O16x,
-		Pressure:    bmxx80.O16x,
-		Humidity:    bmxx80.O16x,
+		Temperature: o,
+		Pressure:    o,
+		Humidity:    o,
 	}
 	if cfg.Pressure.Name == "" {
 		opts.Pressure = bmxx80.Off
@@ -46,21 +64,30 @@ func (n *Node) loadSensorBMxx80(ctx context.Context, cfg *config.Sensor) error {
 		opts.Humidity = bmxx80.Off
 	}
 
-	// TODO(maruel): Define which SPI or I²C bus to use.
-	if cfg.Address != 0 {
-		p, err := i2creg.Open("")
-		if err != nil {
-			return err
-		}
-		dev, err := bmxx80.NewI2C(p, uint16(cfg.Address), &opts)
-		if err != nil {
-			_ = p.Close()
-			return err
+	// The address selects I²C, otherwise SPI is used.
+	addr := uint16(cfg.Address)
+	if addr != 0 && cfg.SPIID != "" {
+		return errors.New("use either address for I²C or spi_id")
+	}
+	if addr == 0 && (cfg.I2CID != "" || cfg.I2CMux != "") {
+		return errors.New("address is required with i2c_id / i2c_mux")
+	}
+	d.open = func() error {
+		if addr != 0 {
+			p, err := n.openSensorI2C(cfg)
+			if err != nil {
+				return err
+			}
+			dev, err := bmxx80.NewI2C(p, addr, &opts)
+			if err != nil {
+				_ = p.Close()
+				return err
+			}
+			d.bus = p
+			d.d = dev
+			return nil
 		}
-		d.bus = p
-		d.d = dev
-	} else {
-		p, err := spireg.Open("")
+		p, err := spireg.Open(cfg.SPIID)
 		if err != nil {
 			return err
 		}
@@ -71,27 +98,36 @@ func (n *Node) loadSensorBMxx80(ctx context.Context, cfg *config.Sensor) error {
 		}
 		d.bus = p
 		d.d = dev
+		return nil
 	}
-
-	if err := d.init(ctx); err != nil {
-		_ = d.Close()
-		return err
+	// Identify the chip in errors when there are multiple.
+	where := "spi"
+	if addr != 0 {
+		where = fmt.Sprintf("0x%02x", addr)
+	}
+	if err := d.open(); err != nil {
+		return fmt.Errorf("%s: %w", where, err)
 	}
 
 	// Add one component per activated sensor.
 	first := true
 	if cfg.Temperature.Name != "" {
 		c := &sensorBMxx80{
-			componentBase: componentBase{
-				name:          cfg.Temperature.Name,
-				componentType: sensorComponent,
+			sensorBase: sensorBase{
+				componentBase: componentBase{
+					name:          cfg.Temperature.Name,
+					componentType: sensorComponent,
+				},
+				calibration: cfg.Temperature.CalibrateLinear,
+				unit:        "°C",
+				accuracy:    1,
+				deviceClass: "temperature",
+				stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
 			},
-			d:        d,
-			unit:     "°C",
-			devcls:   "temperature",
-			accuracy: 1,
-			first:    first,
+			d:     d,
+			first: first,
 		}
+		c.override(cfg.Temperature.UnitOfMeasurement, cfg.Temperature.AccuracyDecimals, cfg.Temperature.DeviceClass, cfg.Temperature.StateClass)
 		if err := n.addEntity(ctx, c); err != nil {
 			_ = d.Close()
 			return err
@@ -101,16 +137,21 @@ func (n *Node) loadSensorBMxx80(ctx context.Context, cfg *config.Sensor) error {
 	}
 	if cfg.Pressure.Name != "" {
 		c := &sensorBMxx80{
-			componentBase: componentBase{
-				name:          cfg.Pressure.Name,
-				componentType: sensorComponent,
+			sensorBase: sensorBase{
+				componentBase: componentBase{
+					name:          cfg.Pressure.Name,
+					componentType: sensorComponent,
+				},
+				calibration: cfg.Pressure.CalibrateLinear,
+				unit:        "kPa",
+				accuracy:    2,
+				deviceClass: "pressure",
+				stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
 			},
-			d:        d,
-			unit:     "kPa",
-			devcls:   "pressure",
-			accuracy: 2,
-			first:    first,
+			d:     d,
+			first: first,
 		}
+		c.override(cfg.Pressure.UnitOfMeasurement, cfg.Pressure.AccuracyDecimals, cfg.Pressure.DeviceClass, cfg.Pressure.StateClass)
 		if err := n.addEntity(ctx, c); err != nil {
 			_ = d.Close()
 			return err
@@ -120,107 +161,238 @@ func (n *Node) loadSensorBMxx80(ctx context.Context, cfg *config.Sensor) error {
 	}
 	if cfg.Humidity.Name != "" {
 		c := &sensorBMxx80{
-			componentBase: componentBase{
-				name:          cfg.Humidity.Name,
-				componentType: sensorComponent,
+			sensorBase: sensorBase{
+				componentBase: componentBase{
+					name:          cfg.Humidity.Name,
+					componentType: sensorComponent,
+				},
+				calibration: cfg.Humidity.CalibrateLinear,
+				unit:        "%",
+				accuracy:    1,
+				deviceClass: "humidity",
+				stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
 			},
-			d:        d,
-			unit:     "%",
-			devcls:   "humidity",
-			accuracy: 1,
-			first:    first,
+			d:     d,
+			first: first,
 		}
+		c.override(cfg.Humidity.UnitOfMeasurement, cfg.Humidity.AccuracyDecimals, cfg.Humidity.DeviceClass, cfg.Humidity.StateClass)
 		if err := n.addEntity(ctx, c); err != nil {
 			_ = d.Close()
 			return err
 		}
 		d.humi = c
 	}
+
+	// Start measuring once the sensors are set, so the first measurement is
+	// not lost.
+	if err := d.init(ctx); err != nil {
+		_ = d.Close()
+		return fmt.Errorf("%s: %w", where, err)
+	}
 	return nil
 }
 
 type sensorBMxx80 struct {
-	componentBase
-	d        *devBMxx80
-	unit     string
-	devcls   string
-	accuracy int32
-	first    bool
+	sensorBase
+	d     *devBMxx80
+	first bool
 }
 
 func (s *sensorBMxx80) Close() error {
 	// There's a mismatch here because there's up to 3 sensors but one device
 	// handle. Have the first Close close them all. Since it only happens at
 	// shutdown, it's "fine".
-	if s.first {
+	if s.first && !s.d.paused {
 		return s.d.Close()
 	}
 	return nil
 }
 
-func (s *sensorBMxx80) describe() proto.Message {
-	// TODO(maruel): Add icon, tweak values.
-	return &aioesphomeapi.ListEntitiesSensorResponse{
-		ObjectId:          s.objectID,
-		Key:               s.key,
-		Name:              s.name,
-		UniqueId:          s.uniqueID,
-		Icon:              "",
-		UnitOfMeasurement: s.unit,
-		AccuracyDecimals:  s.accuracy,
-		ForceUpdate:       false,
-		DeviceClass:       s.devcls,
+// pause implements pauser.
+//
+// Like Close, the first sensor handles the device.
+func (s *sensorBMxx80) pause() error {
+	// A failed resume leaves it paused.
+	if !s.first || s.d.paused {
+		return nil
 	}
+	s.d.paused = true
+	return s.d.Close()
+}
+
+// resume implements pauser.
+func (s *sensorBMxx80) resume(ctx context.Context) error {
+	if !s.first {
+		return nil
+	}
+	if err := s.d.open(); err != nil {
+		return err
+	}
+	s.d.paused = false
+	return s.d.init(ctx)
 }
 
 // devBMxx80 is the underlying connection for the sensors.
 type devBMxx80 struct {
-	bus    io.Closer
-	d      *bmxx80.Dev
+	// open opens bus and d.
+	open   func() error
+	paused bool
 	update time.Duration
 	temp   *sensorBMxx80
 	pres   *sensorBMxx80
 	humi   *sensorBMxx80
+
+	// mu protects bus and d, which are replaced upon reconnection. They are
+	// nil while closed.
+	mu  sync.Mutex
+	bus io.Closer
+	d   senseContinuouser
+	// sensed is closed once the first measurement from d is received or d
+	// stopped sensing. bmxx80's Halt deadlocks when called before its first
+	// measurement, e.g. when a later component fails to load.
+	sensed chan struct{}
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+// senseContinuouser is implemented by *bmxx80.Dev.
+type senseContinuouser interface {
+	SenseContinuous(interval time.Duration) (<-chan physic.Env, error)
+	Halt() error
 }
 
+// Backoff between reconnection attempts after the device failed. They are
+// variables to be overridden in tests.
+var (
+	bmxx80MinBackoff = time.Second
+	bmxx80MaxBackoff = time.Minute
+)
+
 func (d *devBMxx80) Close() error {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.mu.Lock()
+	err := d.closeLocked()
+	d.mu.Unlock()
+	d.wg.Wait()
+	return err
+}
+
+// closeLocked halts the device and closes the bus, if opened. d.mu must be
+// held.
+func (d *devBMxx80) closeLocked() error {
+	if d.bus == nil {
+		return nil
+	}
+	if d.sensed != nil {
+		<-d.sensed
+	}
 	err := d.d.Halt()
 	if err2 := d.bus.Close(); err == nil {
 		err = err2
 	}
+	d.bus = nil
+	d.d = nil
 	return err
 }
 
-func (d *devBMxx80) init(cfx context.Context) error {
+func (d *devBMxx80) init(ctx context.Context) error {
 	ch, err := d.d.SenseContinuous(d.update)
 	if err != nil {
 		return err
 	}
+	d.sensed = make(chan struct{})
+	sensed := d.sensed
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.wg.Add(1)
 	go func() {
+		defer d.wg.Done()
+		d.run(ctx, ch, sensed)
+	}()
+	return nil
+}
+
+// run publishes the measurements.
+//
+// When the device fails, the channel is closed. The device is then reopened
+// with an exponential backoff until Close() is called.
+func (d *devBMxx80) run(ctx context.Context, ch <-chan physic.Env, sensed chan struct{}) {
+	backoff := bmxx80MinBackoff
+	for {
 		for e := range ch {
+			if sensed != nil {
+				close(sensed)
+				sensed = nil
+			}
 			d.send(e)
+			backoff = bmxx80MinBackoff
 		}
-	}()
-	return nil
+		if sensed != nil {
+			close(sensed)
+			sensed = nil
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		d.failed(errors.New("device stopped sensing, reconnecting"))
+		for ch = nil; ch == nil; {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > bmxx80MaxBackoff {
+				backoff = bmxx80MaxBackoff
+			}
+			var err error
+			if ch, sensed, err = d.reopen(ctx); err != nil {
+				d.failed(err)
+			}
+		}
+	}
+}
+
+// reopen reopens the device and restarts the measurements.
+func (d *devBMxx80) reopen(ctx context.Context) (<-chan physic.Env, chan struct{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Close() may have been called in the meantime.
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	_ = d.closeLocked()
+	d.sensed = nil
+	if err := d.open(); err != nil {
+		return nil, nil, err
+	}
+	ch, err := d.d.SenseContinuous(d.update)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.sensed = make(chan struct{})
+	return ch, d.sensed, nil
+}
+
+// failed reports the error and a missing state on each sensor.
+func (d *devBMxx80) failed(err error) {
+	for _, s := range []*sensorBMxx80{d.temp, d.pres, d.humi} {
+		if s != nil {
+			s.setError(err)
+			s.publishMissing()
+		}
+	}
 }
 
 func (d *devBMxx80) send(e physic.Env) {
 	if d.temp != nil {
-		d.temp.onNewState(&aioesphomeapi.SensorStateResponse{
-			Key:   d.temp.key,
-			State: float32(e.Temperature.Celsius()),
-		})
+		d.temp.publish(float32(e.Temperature.Celsius()))
 	}
 	if d.pres != nil {
-		d.pres.onNewState(&aioesphomeapi.SensorStateResponse{
-			Key:   d.pres.key,
-			State: float32(e.Pressure) / float32(physic.KiloPascal),
-		})
+		d.pres.publish(float32(e.Pressure) / float32(physic.KiloPascal))
 	}
 	if d.humi != nil {
-		d.humi.onNewState(&aioesphomeapi.SensorStateResponse{
-			Key:   d.humi.key,
-			State: float32(e.Humidity) / float32(physic.PercentRH),
-		})
+		d.humi.publish(float32(e.Humidity) / float32(physic.PercentRH))
 	}
 }
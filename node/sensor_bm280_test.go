@@ -0,0 +1,312 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestDevBMxx80_Reconnect(t *testing.T) {
+	oldMin, oldMax := bmxx80MinBackoff, bmxx80MaxBackoff
+	bmxx80MinBackoff, bmxx80MaxBackoff = time.Millisecond, 2*time.Millisecond
+	defer func() {
+		bmxx80MinBackoff, bmxx80MaxBackoff = oldMin, oldMax
+	}()
+
+	devs := make(chan *fakeBMxx80, 10)
+	d := &devBMxx80{update: time.Second}
+	// openFailures is the number of next open() calls that fail, like when the
+	// device is unplugged.
+	openFailures := 0
+	d.open = func() error {
+		if openFailures > 0 {
+			openFailures--
+			return errors.New("i2c: no device")
+		}
+		f := &fakeBMxx80{ch: make(chan physic.Env)}
+		d.bus = f
+		d.d = f
+		devs <- f
+		return nil
+	}
+	ctx := context.Background()
+	s := &sensorBMxx80{
+		sensorBase: sensorBase{
+			componentBase: componentBase{name: "Temperature", componentType: sensorComponent},
+		},
+		d:     d,
+		first: true,
+	}
+	if err := s.componentBase.init(ctx, &Node{cfg: &config.Root{}}); err != nil {
+		t.Fatal(err)
+	}
+	d.temp = s
+	_, ch, _ := s.register()
+	get := func() *aioesphomeapi.SensorStateResponse {
+		select {
+		case msg := <-ch:
+			return msg.(*aioesphomeapi.SensorStateResponse)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+			return nil
+		}
+	}
+
+	if err := d.open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	f := <-devs
+	f.ch <- physic.Env{Temperature: physic.ZeroCelsius + 20*physic.Kelvin}
+	if v := get(); v.MissingState || v.State != 20 {
+		t.Fatalf("unexpected %v", v)
+	}
+
+	// The device fails, and is not there for the first two reconnection
+	// attempts.
+	openFailures = 2
+	f.fail()
+	for i := 0; i < 3; i++ {
+		if v := get(); !v.MissingState {
+			t.Fatalf("#%d: unexpected %v", i, v)
+		}
+	}
+	f2 := <-devs
+	if !f.halted || !f.closed {
+		t.Fatal("expected the failed device to be closed")
+	}
+	f2.ch <- physic.Env{Temperature: physic.ZeroCelsius + 21*physic.Kelvin}
+	if v := get(); v.MissingState || v.State != 21 {
+		t.Fatalf("unexpected %v", v)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !f2.halted || !f2.closed {
+		t.Fatal("expected the device to be closed")
+	}
+}
+
+// fakeBMxx80 is both the bus and the device.
+type fakeBMxx80 struct {
+	ch      chan physic.Env
+	stopped bool
+	halted  bool
+	closed  bool
+}
+
+// fail simulates a failure, which stops the measurements.
+func (f *fakeBMxx80) fail() {
+	f.stopped = true
+	close(f.ch)
+}
+
+func (f *fakeBMxx80) SenseContinuous(interval time.Duration) (<-chan physic.Env, error) {
+	return f.ch, nil
+}
+
+func (f *fakeBMxx80) Halt() error {
+	// Like bmxx80, halting stops the measurements.
+	f.halted = true
+	if !f.stopped {
+		f.stopped = true
+		close(f.ch)
+	}
+	return nil
+}
+
+func (f *fakeBMxx80) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestLoadSensorBMxx80_Bus_Err(t *testing.T) {
+	data := []config.Sensor{
+		{Address: 0x76, SPIID: "/dev/spidev0.1"},
+		{I2CID: "1"},
+	}
+	for i := range data {
+		n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+		data[i].Platform = "bme280"
+		data[i].Temperature.Name = "Temperature"
+		data[i].UpdateInterval = time.Minute
+		if err := n.loadSensor(context.Background(), &data[i]); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
+
+func TestLoadSensorBMxx80_Multiple(t *testing.T) {
+	shouldLog = testing.Verbose()
+	bus := newFakeBME280Bus()
+	// 20°C and 25°C.
+	bus.regs[0x76][0xFA] = 0xC8
+	bus.regs[0x77][0xFA] = 0xFA
+	if err := i2creg.Register("FAKE_I2C_BME280", nil, -1, bus.open); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := i2creg.Unregister("FAKE_I2C_BME280"); err != nil {
+			t.Error(err)
+		}
+	}()
+	y := "periphhome:\n  name: pi\nsensor:\n"
+	for _, l := range []struct {
+		addr int
+		name string
+	}{{0x76, "Indoor"}, {0x77, "Outdoor"}} {
+		y += fmt.Sprintf("  - platform: bme280\n    address: 0x%x\n    i2c_id: FAKE_I2C_BME280\n    update_interval: 1h\n    temperature:\n      name: %s\n", l.addr, l.name)
+	}
+	cfg := &config.Root{}
+	if err := cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			_ = n.Close()
+		}
+	}()
+	for i, want := range []float32{20, 25} {
+		for start := time.Now(); ; time.Sleep(time.Millisecond) {
+			if s, ok := n.entities[i].getState().(*aioesphomeapi.SensorStateResponse); ok && !s.MissingState {
+				if s.State != want {
+					t.Fatalf("#%d: got %g; want %g", i, s.State, want)
+				}
+				break
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("#%d: timed out", i)
+			}
+		}
+	}
+	closed = true
+	if err = n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	for _, addr := range []uint16{0x76, 0x77} {
+		if bus.halts[addr] != 1 {
+			t.Fatalf("0x%x: halted %d times", addr, bus.halts[addr])
+		}
+	}
+	if bus.opened != 2 || bus.closed != 2 {
+		t.Fatalf("opened %d, closed %d", bus.opened, bus.closed)
+	}
+	bus.mu.Unlock()
+
+	// Both would have the same key, so only one would be visible.
+	y = "periphhome:\n  name: pi\nsensor:\n"
+	for _, addr := range []int{0x76, 0x77} {
+		y += fmt.Sprintf("  - platform: bme280\n    address: 0x%x\n    i2c_id: FAKE_I2C_BME280\n    update_interval: 1h\n    temperature:\n      name: Temperature\n", addr)
+	}
+	cfg = &config.Root{}
+	if err = cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = New(context.Background(), cfg); err == nil {
+		_ = n.Close()
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), `entity "Temperature" has the same key as "Temperature"`) {
+		t.Fatal(err)
+	}
+	bus.mu.Lock()
+	if bus.opened != bus.closed {
+		t.Fatalf("opened %d, closed %d", bus.opened, bus.closed)
+	}
+}
+
+// fakeBME280Bus emulates two BME280 at 0x76 and 0x77 on a I²C bus.
+//
+// The calibration is set so the temperature in °C is the raw value divided
+// by 40960.
+type fakeBME280Bus struct {
+	mu     sync.Mutex
+	regs   map[uint16]*[256]byte
+	halts  map[uint16]int
+	opened int
+	closed int
+}
+
+func newFakeBME280Bus() *fakeBME280Bus {
+	f := &fakeBME280Bus{regs: map[uint16]*[256]byte{}, halts: map[uint16]int{}}
+	for _, addr := range []uint16{0x76, 0x77} {
+		r := &[256]byte{}
+		// Chip ID.
+		r[0xD0] = 0x60
+		// dig_T2 = 2048.
+		r[0x8B] = 0x08
+		f.regs[addr] = r
+	}
+	return f
+}
+
+func (f *fakeBME280Bus) open() (i2c.BusCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opened++
+	return &fakeBME280Handle{f: f}, nil
+}
+
+// fakeBME280Handle is an opened handle to fakeBME280Bus.
+type fakeBME280Handle struct {
+	f *fakeBME280Bus
+}
+
+func (h *fakeBME280Handle) String() string {
+	return "FAKE_I2C_BME280"
+}
+
+func (h *fakeBME280Handle) Tx(addr uint16, w, r []byte) error {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	regs := h.f.regs[addr]
+	if regs == nil {
+		return errors.New("i2c: no device")
+	}
+	if len(r) != 0 {
+		copy(r, regs[w[0]:])
+		return nil
+	}
+	for i := 0; i+1 < len(w); i += 2 {
+		// ctrl_meas going from normal to sleep mode.
+		if w[i] == 0xF4 && regs[0xF4]&3 == 3 && w[i+1]&3 == 0 {
+			h.f.halts[addr]++
+		}
+		regs[w[i]] = w[i+1]
+	}
+	return nil
+}
+
+func (h *fakeBME280Handle) SetSpeed(f physic.Frequency) error {
+	return nil
+}
+
+func (h *fakeBME280Handle) Close() error {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	h.f.closed++
+	return nil
+}
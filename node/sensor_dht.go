@@ -0,0 +1,307 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorDHT loads a DHT11 or DHT22/AM2302 temperature and humidity sensor
+// and each component separately.
+//
+// The one-wire protocol is bit banged, which is unreliable on a busy host,
+// thus the retries.
+func (n *Node) loadSensorDHT(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name == "" && cfg.Humidity.Name == "" {
+		return errors.New("specify a name for at least one of temperature / humidity")
+	}
+	if cfg.Name != "" || cfg.Address != 0 || cfg.Pressure.Name != "" {
+		return errors.New("do not use name / address / pressure")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	if len(cfg.CalibrateLinear) != 0 || cfg.UnitOfMeasurement != "" || cfg.AccuracyDecimals != nil || cfg.DeviceClass != "" || cfg.StateClass != "" {
+		return errors.New("set calibrate_linear / unit_of_measurement / accuracy_decimals / device_class / state_class in temperature / humidity")
+	}
+	d := &devDHT{
+		update: cfg.UpdateInterval,
+		retry:  cfg.Retry,
+	}
+	switch cfg.Model {
+	case "dht11":
+		d.model = dht11
+	case "", "dht22", "am2302":
+		d.model = dht22
+	}
+	if cfg.UpdateInterval < d.model.minInterval {
+		return fmt.Errorf("update_interval must be at least %s", d.model.minInterval)
+	}
+	if d.p = gpioreg.ByName(cfg.Pin.Number); d.p == nil {
+		return fmt.Errorf("unknown pin %q", cfg.Pin.Number)
+	}
+	if cfg.Pin.Inverted {
+		return errors.New("inverted is not supported")
+	}
+	switch cfg.Pin.Mode {
+	case config.Input:
+		// An external pull up resistor is expected.
+		d.pull = gpio.Float
+	case "", config.InputPullup:
+		d.pull = gpio.PullUp
+	default:
+		return errors.New("pin mode must be INPUT or INPUT_PULLUP")
+	}
+	if err := d.p.In(d.pull, gpio.NoEdge); err != nil {
+		return err
+	}
+
+	// Add one component per activated sensor.
+	add := func(p *config.SensorParams, unit, deviceClass string, accuracy int32) (*sensorDHT, error) {
+		if p.Name == "" {
+			return nil, nil
+		}
+		s := &sensorDHT{
+			sensorBase: sensorBase{
+				componentBase: componentBase{
+					name:          p.Name,
+					componentType: sensorComponent,
+				},
+				calibration: p.CalibrateLinear,
+				unit:        unit,
+				accuracy:    accuracy,
+				deviceClass: deviceClass,
+				stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+			},
+			d: d,
+		}
+		s.override(p.UnitOfMeasurement, p.AccuracyDecimals, p.DeviceClass, p.StateClass)
+		return s, n.addEntity(ctx, s)
+	}
+	var err error
+	if d.temp, err = add(&cfg.Temperature, "°C", "temperature", d.model.accuracy); err != nil {
+		_ = d.Close()
+		return err
+	}
+	if d.humi, err = add(&cfg.Humidity, "%", "humidity", d.model.accuracy); err != nil {
+		_ = d.Close()
+		return err
+	}
+	// The first sensor closes the device.
+	if d.temp != nil {
+		d.temp.first = true
+	} else {
+		d.humi.first = true
+	}
+	d.init(ctx)
+	return nil
+}
+
+// dhtModel describes the differences between the DHT models.
+type dhtModel struct {
+	// start is the duration of the low pulse that wakes up the sensor.
+	start time.Duration
+	// minInterval is the minimum delay between two reads.
+	minInterval time.Duration
+	accuracy    int32
+	// decode converts the 4 data bytes into °C and %RH.
+	decode func(b []byte) (float32, float32)
+}
+
+var (
+	dht11 = &dhtModel{
+		start:       18 * time.Millisecond,
+		minInterval: time.Second,
+		accuracy:    0,
+		decode: func(b []byte) (float32, float32) {
+			// The decimal part is only non-zero on recent revisions.
+			h := float32(b[0]) + float32(b[1])/10
+			t := float32(b[2]) + float32(b[3]&0x7F)/10
+			if b[3]&0x80 != 0 {
+				t = -t
+			}
+			return t, h
+		},
+	}
+	dht22 = &dhtModel{
+		start:       time.Millisecond,
+		minInterval: 2 * time.Second,
+		accuracy:    1,
+		decode: func(b []byte) (float32, float32) {
+			h := float32(uint16(b[0])<<8|uint16(b[1])) / 10
+			t := float32(uint16(b[2]&0x7F)<<8|uint16(b[3])) / 10
+			if b[2]&0x80 != 0 {
+				t = -t
+			}
+			return t, h
+		},
+	}
+)
+
+type sensorDHT struct {
+	sensorBase
+	d     *devDHT
+	first bool
+}
+
+func (s *sensorDHT) Close() error {
+	if s.first {
+		return s.d.Close()
+	}
+	return nil
+}
+
+// devDHT is the underlying connection for the sensors.
+type devDHT struct {
+	p      gpio.PinIO
+	pull   gpio.Pull
+	model  *dhtModel
+	update time.Duration
+	retry  int
+	temp   *sensorDHT
+	humi   *sensorDHT
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (d *devDHT) Close() error {
+	if d.cancel != nil {
+		d.cancel()
+		d.wg.Wait()
+	}
+	return d.p.Halt()
+}
+
+func (d *devDHT) init(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		t := time.NewTicker(d.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			d.sense(ctx)
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// sense reads the sensor, retrying on failure, and publishes the values.
+//
+// The state is reported as missing only once all the retries failed.
+func (d *devDHT) sense(ctx context.Context) {
+	var err error
+	for i := 0; i <= d.retry; i++ {
+		if i != 0 {
+			// The sensor needs to rest between reads.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.model.minInterval):
+			}
+		}
+		var t, h float32
+		if t, h, err = d.read(); err == nil {
+			if d.temp != nil {
+				d.temp.publish(t)
+			}
+			if d.humi != nil {
+				d.humi.publish(h)
+			}
+			return
+		}
+	}
+	if d.temp != nil {
+		d.temp.setError(err)
+		d.temp.publishMissing()
+	}
+	if d.humi != nil {
+		d.humi.setError(err)
+		d.humi.publishMissing()
+	}
+}
+
+// read does one measurement and returns the temperature in °C and the
+// relative humidity in %.
+func (d *devDHT) read() (float32, float32, error) {
+	// Reduce the likelihood of being descheduled while bit banging.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := d.p.Out(gpio.Low); err != nil {
+		return 0, 0, err
+	}
+	time.Sleep(d.model.start)
+	if err := d.p.In(d.pull, gpio.NoEdge); err != nil {
+		return 0, 0, err
+	}
+	// The whole transmission takes less than 5ms.
+	b, err := dhtDecodePulses(dhtCapture(d.p, 6*time.Millisecond))
+	if err != nil {
+		return 0, 0, err
+	}
+	t, h := d.model.decode(b[:4])
+	return t, h, nil
+}
+
+// dhtCapture polls the pin for the specified duration and returns the duration
+// of each high pulse.
+func dhtCapture(p gpio.PinIn, timeout time.Duration) []time.Duration {
+	highs := make([]time.Duration, 0, 48)
+	start := time.Now()
+	last := gpio.High
+	edge := start
+	for now := start; now.Sub(start) < timeout; now = time.Now() {
+		l := p.Read()
+		if l == last {
+			continue
+		}
+		if l == gpio.Low {
+			highs = append(highs, now.Sub(edge))
+		}
+		last = l
+		edge = now
+	}
+	return highs
+}
+
+// dhtDecodePulses decodes the 40 bits of a transmission from the duration of
+// the high pulses.
+//
+// Each bit is sent as a 50µs low pulse followed by a high pulse of ~27µs for 0
+// and ~70µs for 1. The pulses before the last 40 are the host release and the
+// sensor's response.
+func dhtDecodePulses(highs []time.Duration) ([5]byte, error) {
+	var b [5]byte
+	if len(highs) < 40 {
+		return b, fmt.Errorf("got %d bits out of 40", len(highs))
+	}
+	highs = highs[len(highs)-40:]
+	for i, h := range highs {
+		b[i/8] <<= 1
+		if h > 48*time.Microsecond {
+			b[i/8] |= 1
+		}
+	}
+	if b[0]+b[1]+b[2]+b[3] != b[4] {
+		return b, fmt.Errorf("invalid checksum %x", b)
+	}
+	return b, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDHTDecodePulses(t *testing.T) {
+	// Host release and sensor response, then the bits.
+	highs := []time.Duration{30 * time.Microsecond, 80 * time.Microsecond}
+	for _, v := range []byte{0x02, 0x8C, 0x01, 0x5F, 0xEE} {
+		for i := 7; i >= 0; i-- {
+			if v&(1<<uint(i)) != 0 {
+				highs = append(highs, 70*time.Microsecond)
+			} else {
+				highs = append(highs, 27*time.Microsecond)
+			}
+		}
+	}
+	b, err := dhtDecodePulses(highs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != [5]byte{0x02, 0x8C, 0x01, 0x5F, 0xEE} {
+		t.Fatalf("%x", b)
+	}
+	// DHT22: 65.2%RH, 35.1°C.
+	if temp, humi := dht22.decode(b[:4]); temp != 35.1 || humi != 65.2 {
+		t.Fatalf("%g, %g", temp, humi)
+	}
+
+	// Corrupted bit.
+	highs[11] = 70 * time.Microsecond
+	if _, err = dhtDecodePulses(highs); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	if _, err = dhtDecodePulses(highs[:30]); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDHTModels(t *testing.T) {
+	data := []struct {
+		m    *dhtModel
+		in   []byte
+		temp float32
+		humi float32
+	}{
+		{dht11, []byte{45, 0, 22, 3}, 22.3, 45},
+		{dht11, []byte{45, 0, 2, 0x85}, -2.5, 45},
+		{dht22, []byte{0x01, 0x90, 0x80, 0x65}, -10.1, 40},
+	}
+	for i, line := range data {
+		temp, humi := line.m.decode(line.in)
+		if temp != line.temp || humi != line.humi {
+			t.Errorf("#%d: got %g, %g", i, temp, humi)
+		}
+	}
+}
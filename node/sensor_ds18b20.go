@@ -0,0 +1,186 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// w1Devices is where the Linux w1 subsystem exposes the 1-Wire devices.
+//
+// It is a variable for unit tests.
+var w1Devices = "/sys/bus/w1/devices"
+
+// loadSensorDS18B20 loads a DS18B20 1-Wire temperature probe.
+//
+// It relies on the Linux w1_therm driver, e.g. "dtoverlay=w1-gpio" on a
+// Raspberry Pi.
+//
+// Datasheet: https://datasheets.maximintegrated.com/en/ds/DS18B20.pdf
+func (n *Node) loadSensorDS18B20(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" {
+		return errors.New("do not use temperature / pressure / humidity")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	var dir string
+	if cfg.Address != 0 {
+		dir = filepath.Join(w1Devices, w1Name(cfg.Address))
+	} else {
+		var err error
+		if dir, err = findDS18B20(); err != nil {
+			return err
+		}
+	}
+	s := &sensorDS18B20{
+		sensorBase: sensorBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: sensorComponent,
+			},
+			calibration: cfg.CalibrateLinear,
+			icon:        "mdi:thermometer",
+			unit:        "°C",
+			accuracy:    1,
+			deviceClass: "temperature",
+			stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+		},
+		path:   filepath.Join(dir, "w1_slave"),
+		update: cfg.UpdateInterval,
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	return n.addEntity(ctx, s)
+}
+
+type sensorDS18B20 struct {
+	sensorBase
+	path   string
+	update time.Duration
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (s *sensorDS18B20) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *sensorDS18B20) init(ctx context.Context, n *Node) error {
+	if err := s.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	// Confirm the probe is present.
+	v, err := s.read()
+	if err != nil {
+		return err
+	}
+	s.publish(v)
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTicker(s.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				v, err := s.read()
+				if err != nil {
+					s.setError(err)
+					s.publishMissing()
+					continue
+				}
+				s.publish(v)
+			}
+		}
+	}()
+	return nil
+}
+
+// read does a conversion and returns the temperature in °C.
+//
+// The kernel driver triggers the conversion when the file is read, which takes
+// up to 750ms at the default 12 bits resolution.
+func (s *sensorDS18B20) read() (float32, error) {
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return 0, err
+	}
+	return parseW1Slave(string(b))
+}
+
+// parseW1Slave parses the content of a w1_therm w1_slave file.
+//
+// It looks like:
+//
+//   72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//   72 01 4b 46 7f ff 0e 10 57 t=23125
+//
+// The first line ends with NO when the scratchpad CRC is invalid, usually
+// because of a bad connection. t is in thousandth of °C.
+func parseW1Slave(s string) (float32, error) {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) != 2 {
+		return 0, fmt.Errorf("unexpected w1_slave content %q", s)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[0]), "YES") {
+		return 0, errors.New("invalid CRC, check the wiring")
+	}
+	i := strings.LastIndex(lines[1], "t=")
+	if i == -1 {
+		return 0, fmt.Errorf("unexpected w1_slave content %q", s)
+	}
+	t, err := strconv.Atoi(strings.TrimSpace(lines[1][i+2:]))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected w1_slave content %q", s)
+	}
+	return float32(t) / 1000, nil
+}
+
+// w1Name returns the directory name used by the Linux w1 subsystem for a
+// 64-bit ROM code.
+//
+// The ROM code is as printed by ESPHome, with the family code in the least
+// significant byte and the CRC in the most significant byte, e.g.
+// 0x1c0000031edd2a28 is "28-0000031edd2a".
+func w1Name(addr uint64) string {
+	return fmt.Sprintf("%02x-%012x", addr&0xFF, (addr>>8)&0xFFFFFFFFFFFF)
+}
+
+// findDS18B20 returns the directory of the first DS18B20 probe found.
+func findDS18B20() (string, error) {
+	// 0x28 is the DS18B20 family code.
+	m, err := filepath.Glob(filepath.Join(w1Devices, "28-*"))
+	if err != nil {
+		return "", err
+	}
+	if len(m) == 0 {
+		return "", fmt.Errorf("no probe found in %s; is the w1-gpio overlay enabled?", w1Devices)
+	}
+	sort.Strings(m)
+	return m[0], nil
+}
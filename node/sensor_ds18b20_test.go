@@ -0,0 +1,75 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseW1Slave(t *testing.T) {
+	data := []struct {
+		in   string
+		want float32
+	}{
+		{"72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n", 23.125},
+		{"5e ff 4b 46 7f ff 02 10 a4 : crc=a4 YES\n5e ff 4b 46 7f ff 02 10 a4 t=-10125\n", -10.125},
+	}
+	for i, l := range data {
+		got, err := parseW1Slave(l.in)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if got != l.want {
+			t.Fatalf("#%d: %g != %g", i, got, l.want)
+		}
+	}
+	for _, in := range []string{
+		"",
+		"72 01 4b 46 7f ff 0e 10 57 : crc=00 NO\n72 01 4b 46 7f ff 0e 10 57 t=23125\n",
+		"72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57\n",
+		"72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=x\n",
+	} {
+		if _, err := parseW1Slave(in); err == nil {
+			t.Fatalf("%q: expected error", in)
+		}
+	}
+}
+
+func TestW1Name(t *testing.T) {
+	if got := w1Name(0x1c0000031edd2a28); got != "28-0000031edd2a" {
+		t.Fatal(got)
+	}
+}
+
+func TestFindDS18B20(t *testing.T) {
+	d, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	old := w1Devices
+	defer func() {
+		w1Devices = old
+	}()
+	w1Devices = d
+	if _, err = findDS18B20(); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, n := range []string{"w1_bus_master1", "28-0000031edd2b", "28-0000031edd2a"} {
+		if err = os.Mkdir(filepath.Join(d, n), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := findDS18B20()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(d, "28-0000031edd2a"); got != want {
+		t.Fatalf("%q != %q", got, want)
+	}
+}
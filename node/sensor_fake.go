@@ -10,12 +10,12 @@ import (
 	"sync"
 	"time"
 
-	"google.golang.org/protobuf/proto"
 	"periph.io/x/home/node/config"
 	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
 
-// loadSensorFake is essentially uptime but only for the node itself.
+// loadSensorFake reports the seconds since the sensor started. It is meant for
+// tests, use uptime for the node.
 func (n *Node) loadSensorFake(ctx context.Context, cfg *config.Sensor) error {
 	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" || cfg.Address != 0 {
 		return errors.New("do not use temperature / pressure / humidity / address")
@@ -26,17 +26,24 @@ func (n *Node) loadSensorFake(ctx context.Context, cfg *config.Sensor) error {
 	if cfg.UpdateInterval == 0 {
 		return errors.New("update_interval is required")
 	}
-	return n.addEntity(ctx, &sensorFake{
-		componentBase: componentBase{
-			name:          cfg.Name,
-			componentType: sensorComponent,
+	s := &sensorFake{
+		sensorBase: sensorBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: sensorComponent,
+			},
+			calibration: cfg.CalibrateLinear,
+			icon:        "mdi:exclamation",
+			stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_TOTAL_INCREASING,
 		},
 		update: cfg.UpdateInterval,
-	})
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	return n.addEntity(ctx, s)
 }
 
 type sensorFake struct {
-	componentBase
+	sensorBase
 	update time.Duration
 
 	wg     sync.WaitGroup
@@ -54,10 +61,7 @@ func (s *sensorFake) init(ctx context.Context, n *Node) error {
 		return err
 	}
 
-	s.onNewState(&aioesphomeapi.SensorStateResponse{
-		Key:   s.key,
-		State: 1.0,
-	})
+	s.publish(1.0)
 
 	ctx, s.cancel = context.WithCancel(ctx)
 	s.wg.Add(1)
@@ -74,23 +78,9 @@ func (s *sensorFake) init(ctx context.Context, n *Node) error {
 			case <-done:
 				return
 			case <-t.C:
-				s.onNewState(&aioesphomeapi.SensorStateResponse{
-					Key:   s.key,
-					State: float32(time.Since(start)) / float32(time.Second),
-				})
+				s.publish(float32(time.Since(start)) / float32(time.Second))
 			}
 		}
 	}()
 	return nil
 }
-
-func (s *sensorFake) describe() proto.Message {
-	return &aioesphomeapi.ListEntitiesSensorResponse{
-		ObjectId:          s.objectID,
-		Key:               s.key,
-		Name:              s.name,
-		UniqueId:          s.uniqueID,
-		Icon:              "mdi:exclamation",
-		UnitOfMeasurement: "",
-	}
-}
@@ -0,0 +1,115 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorGoRuntime loads diagnostic sensors about the Go runtime of the
+// node itself, to catch memory or goroutine leaks.
+func (n *Node) loadSensorGoRuntime(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Goroutines.Name == "" && cfg.HeapAlloc.Name == "" && cfg.GCPause.Name == "" {
+		return errors.New("specify a name for at least one of goroutines / heap_alloc / gc_pause")
+	}
+	if cfg.Name != "" || cfg.Address != 0 || cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" {
+		return errors.New("do not use name / address / temperature / pressure / humidity")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	r := &goRuntime{}
+	ctx, cancel := context.WithCancel(ctx)
+	stop := func() {
+		cancel()
+		r.wg.Wait()
+	}
+	add := func(p *config.SensorParams, icon, unit string, accuracy int32) (*sensorDiagnostic, error) {
+		if p.Name == "" {
+			return nil, nil
+		}
+		s := &sensorDiagnostic{
+			sensorBase: sensorBase{
+				componentBase: componentBase{name: p.Name},
+				calibration:   p.CalibrateLinear,
+				icon:          icon,
+				unit:          unit,
+				accuracy:      accuracy,
+				stateClass:    aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+			},
+		}
+		s.override(p.UnitOfMeasurement, p.AccuracyDecimals, p.DeviceClass, p.StateClass)
+		if r.goroutines == nil && r.heap == nil && r.gc == nil {
+			// The first sensor stops the sampling.
+			s.stop = stop
+		}
+		return s, n.addEntity(ctx, s)
+	}
+	var err error
+	if r.goroutines, err = add(&cfg.Goroutines, "mdi:format-list-numbered", "", 0); err != nil {
+		cancel()
+		return err
+	}
+	if r.heap, err = add(&cfg.HeapAlloc, "mdi:memory", "B", 0); err != nil {
+		stop()
+		return err
+	}
+	if r.gc, err = add(&cfg.GCPause, "mdi:timer-outline", "ms", 3); err != nil {
+		stop()
+		return err
+	}
+	r.sample()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		t := time.NewTicker(cfg.UpdateInterval)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				r.sample()
+			}
+		}
+	}()
+	return nil
+}
+
+// goRuntime samples the Go runtime statistics.
+type goRuntime struct {
+	wg         sync.WaitGroup
+	goroutines *sensorDiagnostic
+	heap       *sensorDiagnostic
+	gc         *sensorDiagnostic
+}
+
+func (r *goRuntime) sample() {
+	if r.goroutines != nil {
+		r.goroutines.setValue(float32(runtime.NumGoroutine()))
+	}
+	if r.heap == nil && r.gc == nil {
+		return
+	}
+	// This stops the world, which is why the update interval should not be too
+	// short.
+	m := runtime.MemStats{}
+	runtime.ReadMemStats(&m)
+	if r.heap != nil {
+		r.heap.setValue(float32(m.HeapAlloc))
+	}
+	if r.gc != nil {
+		// Most recent GC pause.
+		r.gc.setValue(float32(m.PauseNs[(m.NumGC+255)%256]) / float32(time.Millisecond))
+	}
+}
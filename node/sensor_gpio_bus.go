@@ -0,0 +1,175 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/home/node/config"
+)
+
+// loadSensorGPIOBus loads a bank of input pins read as a binary number, e.g.
+// DIP switches or jumpers.
+func (n *Node) loadSensorGPIOBus(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" || cfg.Address != 0 {
+		return errors.New("do not use temperature / pressure / humidity / address")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(cfg.Pins) == 0 {
+		return errors.New("pins is required")
+	}
+	s := &sensorGPIOBus{
+		sensorBase: sensorBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: sensorComponent,
+			},
+			calibration: cfg.CalibrateLinear,
+			icon:        "mdi:dip-switch",
+		},
+		update: cfg.UpdateInterval,
+	}
+	// Edges are only needed when not polling.
+	edge := gpio.NoEdge
+	if s.update == 0 {
+		edge = gpio.BothEdges
+	}
+	for i := range cfg.Pins {
+		p := gpioreg.ByName(cfg.Pins[i].Number)
+		if p == nil {
+			_ = s.halt()
+			return fmt.Errorf("unknown pin %q", cfg.Pins[i].Number)
+		}
+		pull := gpio.Float
+		switch cfg.Pins[i].Mode {
+		case "", config.Input:
+		case config.InputPullup:
+			pull = gpio.PullUp
+		case config.InputPulldown:
+			pull = gpio.PullDown
+		default:
+			_ = s.halt()
+			return fmt.Errorf("pin %s: mode must be INPUT, INPUT_PULLUP or INPUT_PULLDOWN", p)
+		}
+		if err := p.In(pull, edge); err != nil {
+			_ = s.halt()
+			return err
+		}
+		s.pins = append(s.pins, p)
+		s.inverted = append(s.inverted, cfg.Pins[i].Inverted)
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	err := n.addEntity(ctx, s)
+	if err != nil {
+		_ = s.halt()
+	}
+	return err
+}
+
+type sensorGPIOBus struct {
+	sensorBase
+	// pins are least significant bit first.
+	pins     []gpio.PinIn
+	inverted []bool
+	// update is the polling interval. When 0, the pins are read on edges.
+	update time.Duration
+
+	wg     sync.WaitGroup
+	cancel func()
+	// mu serializes the reads by the per pin goroutines.
+	mu    sync.Mutex
+	value uint32
+}
+
+func (s *sensorGPIOBus) Close() error {
+	s.cancel()
+	err := s.halt()
+	s.wg.Wait()
+	return err
+}
+
+// halt releases the pins.
+func (s *sensorGPIOBus) halt() error {
+	var err error
+	for _, p := range s.pins {
+		if err2 := p.Halt(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (s *sensorGPIOBus) init(ctx context.Context, n *Node) error {
+	if err := s.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	s.value = s.read()
+	s.publish(float32(s.value))
+	ctx, s.cancel = context.WithCancel(ctx)
+	done := ctx.Done()
+	if s.update != 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			t := time.NewTicker(s.update)
+			defer t.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-t.C:
+					s.refresh()
+				}
+			}
+		}()
+		return nil
+	}
+	for _, p := range s.pins {
+		s.wg.Add(1)
+		go func(p gpio.PinIn) {
+			defer s.wg.Done()
+			for {
+				// The timeout is to notice the context being canceled.
+				if !p.WaitForEdge(time.Second) {
+					if ctx.Err() != nil {
+						return
+					}
+					continue
+				}
+				s.refresh()
+			}
+		}(p)
+	}
+	return nil
+}
+
+// refresh reads the pins and publishes the value if it changed.
+func (s *sensorGPIOBus) refresh() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v := s.read(); v != s.value {
+		s.value = v
+		s.publish(float32(v))
+	}
+}
+
+// read returns the value of the pins.
+func (s *sensorGPIOBus) read() uint32 {
+	var v uint32
+	for i, p := range s.pins {
+		if bool(p.Read()) != s.inverted[i] {
+			v |= 1 << uint(i)
+		}
+	}
+	return v
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestSensorGPIOBus(t *testing.T) {
+	pins := []*gpiotest.Pin{
+		{N: "FAKE_BUS0", L: gpio.High, EdgesChan: make(chan gpio.Level)},
+		{N: "FAKE_BUS1", L: gpio.Low, EdgesChan: make(chan gpio.Level)},
+		{N: "FAKE_BUS2", L: gpio.Low, EdgesChan: make(chan gpio.Level)},
+	}
+	for _, p := range pins {
+		if err := gpioreg.Register(p); err != nil {
+			t.Fatal(err)
+		}
+		defer func(n string) {
+			if err := gpioreg.Unregister(n); err != nil {
+				t.Error(err)
+			}
+		}(p.N)
+	}
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Sensor{
+		Platform: "gpio_bus",
+		Name:     "Address",
+		Pins: []config.Pin{
+			{Number: "FAKE_BUS0"},
+			{Number: "FAKE_BUS1"},
+			{Number: "FAKE_BUS2", Inverted: true},
+		},
+	}
+	if err := n.loadSensor(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	s := n.entities[0].(*sensorGPIOBus)
+	defer s.Close()
+	if got := s.getState().(*aioesphomeapi.SensorStateResponse).State; got != 5 {
+		t.Fatalf("got %g", got)
+	}
+	pins[1].Lock()
+	pins[1].L = gpio.High
+	pins[1].Unlock()
+	pins[1].EdgesChan <- gpio.High
+	for start := time.Now(); ; {
+		if got := s.getState().(*aioesphomeapi.SensorStateResponse).State; got == 7 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("edge not detected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
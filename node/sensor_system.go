@@ -0,0 +1,166 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorCPUTemperature loads a diagnostic sensor reporting the CPU
+// temperature of the host in °C.
+func (n *Node) loadSensorCPUTemperature(ctx context.Context, cfg *config.Sensor) error {
+	return n.loadSensorSystem(ctx, cfg, "mdi:thermometer", "°C", "temperature", 1, readCPUTemperature)
+}
+
+// loadSensorSystemLoad loads a diagnostic sensor reporting the system load
+// average over one minute.
+func (n *Node) loadSensorSystemLoad(ctx context.Context, cfg *config.Sensor) error {
+	return n.loadSensorSystem(ctx, cfg, "mdi:chip", "", "", 2, readSystemLoad)
+}
+
+// loadSensorSystem loads a diagnostic sensor sampling read every
+// update_interval.
+func (n *Node) loadSensorSystem(ctx context.Context, cfg *config.Sensor, icon, unit, deviceClass string, accuracy int32, read func() (float32, error)) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" || cfg.Address != 0 {
+		return errors.New("do not use temperature / pressure / humidity / address")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	// Fail early when the OS doesn't support it.
+	v, err := read()
+	if err != nil {
+		return err
+	}
+	s := &sensorDiagnostic{
+		sensorBase: sensorBase{
+			componentBase: componentBase{name: cfg.Name},
+			calibration:   cfg.CalibrateLinear,
+			icon:          icon,
+			unit:          unit,
+			accuracy:      accuracy,
+			deviceClass:   deviceClass,
+			stateClass:    aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+		},
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	s.stop = func() {
+		cancel()
+		wg.Wait()
+	}
+	if err = n.addEntity(ctx, s); err != nil {
+		cancel()
+		return err
+	}
+	s.setValue(v)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(cfg.UpdateInterval)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if v, err := read(); err == nil {
+					s.setValue(v)
+				} else {
+					s.setError(err)
+					s.publishMissing()
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// parseThermalZone parses /sys/class/thermal/thermal_zone*/temp, which is in
+// m°C, e.g. "48312".
+func parseThermalZone(b []byte) (float32, error) {
+	v, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected thermal zone temperature %q", b)
+	}
+	return float32(v) / 1000, nil
+}
+
+// parseLoadAvg returns the load average over one minute.
+//
+// It parses /proc/loadavg, which looks like "0.52 0.58 0.59 1/467 12345", and
+// the output of macOS' "sysctl -n vm.loadavg", which looks like
+// "{ 1.52 1.68 1.73 }".
+func parseLoadAvg(b []byte) (float32, error) {
+	items := strings.Fields(strings.Trim(strings.TrimSpace(string(b)), "{}"))
+	if len(items) == 0 {
+		return 0, fmt.Errorf("unexpected load average %q", b)
+	}
+	v, err := strconv.ParseFloat(items[0], 32)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected load average %q", b)
+	}
+	return float32(v), nil
+}
+
+// parsePowermetrics returns the CPU temperature in °C from the output of
+// macOS' "powermetrics --samplers smc".
+//
+// Looks like this:
+//
+//	**** SMC sensors ****
+//
+//	CPU Thermal level: 0
+//	GPU Thermal level: 0
+//	CPU die temperature: 48.31 C
+func parsePowermetrics(b []byte) (float32, error) {
+	for _, l := range strings.Split(string(b), "\n") {
+		i := strings.IndexByte(l, ':')
+		if i == -1 || strings.TrimSpace(l[:i]) != "CPU die temperature" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(l[i+1:]), " C"), 32)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse CPU temperature in powermetrics output: %w", err)
+		}
+		return float32(v), nil
+	}
+	return 0, errors.New("powermetrics doesn't report the CPU temperature")
+}
+
+// parseThermalZoneWMI returns the temperature in °C from the output of
+// Windows' "wmic /namespace:\\root\wmi path MSAcpi_ThermalZoneTemperature get
+// CurrentTemperature", which is in tenths of K.
+//
+// Looks like this:
+//
+//	CurrentTemperature
+//	3132
+func parseThermalZoneWMI(b []byte) (float32, error) {
+	items := strings.Fields(string(b))
+	if len(items) < 2 || items[0] != "CurrentTemperature" {
+		return 0, fmt.Errorf("unexpected wmic output %q", b)
+	}
+	// Use the first thermal zone.
+	v, err := strconv.ParseInt(items[1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected wmic output %q", b)
+	}
+	return float32(v)/10 - 273.15, nil
+}
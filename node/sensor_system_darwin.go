@@ -0,0 +1,37 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// readCPUTemperature returns the CPU temperature in °C.
+//
+// powermetrics requires running as root and only reports the temperature on
+// Intel based Macs.
+func readCPUTemperature() (float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "powermetrics", "--samplers", "smc", "-i", "1", "-n", "1").Output()
+	if err != nil {
+		return 0, fmt.Errorf("powermetrics: %w", err)
+	}
+	return parsePowermetrics(out)
+}
+
+// readSystemLoad returns the load average over one minute.
+func readSystemLoad() (float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "sysctl", "-n", "vm.loadavg").Output()
+	if err != nil {
+		return 0, fmt.Errorf("sysctl: %w", err)
+	}
+	return parseLoadAvg(out)
+}
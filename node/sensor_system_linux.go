@@ -0,0 +1,33 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import "io/ioutil"
+
+var (
+	// thermalZonePath is the thermal zone of the CPU.
+	thermalZonePath = "/sys/class/thermal/thermal_zone0/temp"
+	loadAvgPath     = "/proc/loadavg"
+)
+
+// readCPUTemperature returns the CPU temperature in °C.
+func readCPUTemperature() (float32, error) {
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(thermalZonePath)
+	if err != nil {
+		return 0, err
+	}
+	return parseThermalZone(b)
+}
+
+// readSystemLoad returns the load average over one minute.
+func readSystemLoad() (float32, error) {
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(loadAvgPath)
+	if err != nil {
+		return 0, err
+	}
+	return parseLoadAvg(b)
+}
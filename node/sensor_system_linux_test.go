@@ -0,0 +1,98 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestSensorSystem(t *testing.T) {
+	shouldLog = testing.Verbose()
+	dir, err := ioutil.TempDir("", "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldTemp, oldLoad := thermalZonePath, loadAvgPath
+	defer func() {
+		thermalZonePath, loadAvgPath = oldTemp, oldLoad
+	}()
+	thermalZonePath = filepath.Join(dir, "temp")
+	loadAvgPath = filepath.Join(dir, "loadavg")
+	if err = ioutil.WriteFile(thermalZonePath, []byte("48312\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(loadAvgPath, []byte("0.52 0.58 0.59 1/467 12345\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	ctx := context.Background()
+	if err = n.loadSensor(ctx, &config.Sensor{Platform: "cpu_temperature", Name: "CPU Temperature", UpdateInterval: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err = n.loadSensor(ctx, &config.Sensor{Platform: "system_load", Name: "Load", UpdateInterval: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := n.closeComponents(time.Time{}); err != nil {
+			t.Error(err)
+		}
+	}()
+	d := n.entities[0].describe().(*aioesphomeapi.ListEntitiesSensorResponse)
+	if d.UnitOfMeasurement != "°C" || d.DeviceClass != "temperature" || d.StateClass != aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT || d.EntityCategory != aioesphomeapi.EntityCategory_ENTITY_CATEGORY_DIAGNOSTIC {
+		t.Fatalf("unexpected %v", d)
+	}
+	if d = n.entities[1].describe().(*aioesphomeapi.ListEntitiesSensorResponse); d.UnitOfMeasurement != "" || d.DeviceClass != "" || d.AccuracyDecimals != 2 {
+		t.Fatalf("unexpected %v", d)
+	}
+	if s := stateString(n.entities[1]); s != "0.52" {
+		t.Fatal(s)
+	}
+
+	// The temperature is sampled again every update_interval.
+	_, ch, _ := n.entities[0].(*sensorDiagnostic).register()
+	if err = ioutil.WriteFile(thermalZonePath, []byte("51000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for timeout := time.After(5 * time.Second); ; {
+		select {
+		case msg := <-ch:
+			if msg.(*aioesphomeapi.SensorStateResponse).State == 51 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func TestSensorSystem_Err(t *testing.T) {
+	oldTemp := thermalZonePath
+	defer func() {
+		thermalZonePath = oldTemp
+	}()
+	thermalZonePath = "/nonexistent"
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	data := []config.Sensor{
+		{Platform: "system_load", UpdateInterval: time.Minute},
+		{Platform: "system_load", Name: "Load"},
+		{Platform: "system_load", Name: "Load", UpdateInterval: time.Minute, Address: 0x76},
+		{Platform: "cpu_temperature", Name: "CPU Temperature", UpdateInterval: time.Minute},
+	}
+	for i := range data {
+		if err := n.loadSensor(context.Background(), &data[i]); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
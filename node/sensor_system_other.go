@@ -0,0 +1,25 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package node
+
+import (
+	"errors"
+	"runtime"
+)
+
+// readCPUTemperature returns an error, as reading the CPU temperature is not
+// implemented on this OS.
+func readCPUTemperature() (float32, error) {
+	return 0, errors.New("cpu_temperature is not supported on " + runtime.GOOS)
+}
+
+// readSystemLoad returns an error, as reading the load average is not
+// implemented on this OS.
+func readSystemLoad() (float32, error) {
+	return 0, errors.New("system_load is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import "testing"
+
+func TestParseSystem(t *testing.T) {
+	data := []struct {
+		parse func([]byte) (float32, error)
+		in    string
+		want  float32
+	}{
+		{parseThermalZone, "48312\n", 48.312},
+		{parseThermalZone, "-1500\n", -1.5},
+		{parseLoadAvg, "0.52 0.58 0.59 1/467 12345\n", 0.52},
+		{parseLoadAvg, "{ 1.52 1.68 1.73 }\n", 1.52},
+		{parsePowermetrics, "**** SMC sensors ****\n\nCPU Thermal level: 0\nCPU die temperature: 48.31 C\n", 48.31},
+		{parseThermalZoneWMI, "CurrentTemperature  \r\r\n3132  \r\r\n\r\r\n", 40.05},
+	}
+	for i, l := range data {
+		got, err := l.parse([]byte(l.in))
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if d := got - l.want; d > 0.001 || d < -0.001 {
+			t.Fatalf("#%d: %g != %g", i, got, l.want)
+		}
+	}
+	bad := []struct {
+		parse func([]byte) (float32, error)
+		in    string
+	}{
+		{parseThermalZone, ""},
+		{parseThermalZone, "48.3"},
+		{parseLoadAvg, ""},
+		{parseLoadAvg, "{ }"},
+		{parseLoadAvg, "a b c"},
+		{parsePowermetrics, "CPU Thermal level: 0\n"},
+		{parsePowermetrics, "CPU die temperature: hot\n"},
+		{parseThermalZoneWMI, ""},
+		{parseThermalZoneWMI, "No Instance(s) Available.\n"},
+	}
+	for i, l := range bad {
+		if _, err := l.parse([]byte(l.in)); err == nil {
+			t.Fatalf("#%d: %q: expected error", i, l.in)
+		}
+	}
+}
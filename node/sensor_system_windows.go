@@ -0,0 +1,33 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// readCPUTemperature returns the temperature in °C of the first ACPI thermal
+// zone.
+//
+// Not all motherboards expose it and reading it may require running as
+// administrator.
+func readCPUTemperature() (float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "wmic", `/namespace:\\root\wmi`, "path", "MSAcpi_ThermalZoneTemperature", "get", "CurrentTemperature").Output()
+	if err != nil {
+		return 0, fmt.Errorf("wmic: %w", err)
+	}
+	return parseThermalZoneWMI(out)
+}
+
+// readSystemLoad returns an error, as Windows has no load average.
+func readSystemLoad() (float32, error) {
+	return 0, errors.New("system_load is not supported on windows")
+}
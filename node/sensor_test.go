@@ -0,0 +1,131 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestCalibrate(t *testing.T) {
+	points := []config.CalibrationPoint{
+		{Measured: 0, Actual: 1},
+		{Measured: 10, Actual: 21},
+		{Measured: 20, Actual: 31},
+	}
+	data := []struct {
+		points []config.CalibrationPoint
+		in     float32
+		want   float32
+	}{
+		{nil, 3, 3},
+		{points[:2], 5, 11},
+		{points[:2], 20, 41},
+		{points, -1, -1},
+		{points, 0, 1},
+		{points, 5, 11},
+		{points, 10, 21},
+		{points, 15, 26},
+		{points, 30, 41},
+	}
+	for i, line := range data {
+		if got := calibrate(line.points, line.in); got != line.want {
+			t.Errorf("#%d: calibrate(%g) = %g; want %g", i, line.in, got, line.want)
+		}
+	}
+}
+
+func TestSensorBase_Publish(t *testing.T) {
+	two := 2
+	zero := 0
+	data := []struct {
+		accuracy     int32
+		override     *int
+		in           float32
+		want         float32
+		wantDecimals int32
+	}{
+		{0, nil, 1.4, 1, 0},
+		{0, nil, -2.5, -3, 0},
+		{1, nil, 1.25, 1.25, 1},
+		{0, &two, 1.25, 1.25, 2},
+		{1, &zero, 1.6, 2, 0},
+	}
+	for i, l := range data {
+		s := &sensorBase{
+			componentBase: componentBase{name: "S", componentType: sensorComponent},
+			accuracy:      l.accuracy,
+		}
+		s.override("", l.override, "", "")
+		if err := s.componentBase.init(context.Background(), &Node{cfg: &config.Root{}}); err != nil {
+			t.Fatal(err)
+		}
+		s.publish(l.in)
+		if got := s.getState().(*aioesphomeapi.SensorStateResponse).State; got != l.want {
+			t.Errorf("#%d: %g != %g", i, got, l.want)
+		}
+		if got := s.describe().(*aioesphomeapi.ListEntitiesSensorResponse).AccuracyDecimals; got != l.wantDecimals {
+			t.Errorf("#%d: %d != %d", i, got, l.wantDecimals)
+		}
+	}
+}
+
+func TestSensorBase_StateClass(t *testing.T) {
+	data := []struct {
+		def  aioesphomeapi.SensorStateClass
+		cfg  string
+		want aioesphomeapi.SensorStateClass
+	}{
+		{aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT, "", aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT},
+		{aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT, "none", aioesphomeapi.SensorStateClass_STATE_CLASS_NONE},
+		{aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT, "total_increasing", aioesphomeapi.SensorStateClass_STATE_CLASS_TOTAL_INCREASING},
+		{aioesphomeapi.SensorStateClass_STATE_CLASS_NONE, "measurement", aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT},
+	}
+	for i, l := range data {
+		s := &sensorBase{stateClass: l.def}
+		s.override("", nil, "", l.cfg)
+		if got := s.describe().(*aioesphomeapi.ListEntitiesSensorResponse).StateClass; got != l.want {
+			t.Errorf("#%d: %s != %s", i, got, l.want)
+		}
+	}
+}
+
+func TestOversample(t *testing.T) {
+	data := []struct {
+		n    int
+		vals []float32
+		want float32
+	}{
+		{0, []float32{3}, 3},
+		{1, []float32{3}, 3},
+		{4, []float32{1, 2, 3, 6}, 3},
+		// Negative values are failed reads.
+		{3, []float32{1, -1, 5}, 3},
+	}
+	for i, line := range data {
+		j := 0
+		got, err := oversample(line.n, 0, func() (float32, error) {
+			v := line.vals[j]
+			j++
+			if v < 0 {
+				return 0, errors.New("failed")
+			}
+			return v, nil
+		})
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got != line.want {
+			t.Fatalf("#%d: got %v; want %v", i, got, line.want)
+		}
+	}
+	if _, err := oversample(2, 0, func() (float32, error) { return 0, errors.New("failed") }); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorTSL25x1 loads a TSL2561 or TSL2591 ambient light sensor.
+//
+// Both measure a broadband and an infrared channel, which is used to reject
+// the infrared part of the light, matching the human eye response.
+//
+// Datasheets:
+// https://cdn-shop.adafruit.com/datasheets/TSL2561.pdf
+// https://ams.com/documents/20143/36005/TSL2591_DS000338_6-00.pdf
+func (n *Node) loadSensorTSL25x1(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" {
+		return errors.New("do not use temperature / pressure / humidity")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	s := &sensorTSL25x1{
+		sensorBase: sensorBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: sensorComponent,
+			},
+			calibration: cfg.CalibrateLinear,
+			icon:        "mdi:brightness-5",
+			unit:        "lx",
+			accuracy:    1,
+			deviceClass: "illuminance",
+			stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+		},
+		tsl2591:     cfg.Platform == "tsl2591",
+		update:      cfg.UpdateInterval,
+		integration: cfg.IntegrationTime,
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	addr := uint16(0x39)
+	if s.tsl2591 {
+		s.gains = []float64{1, 25, 428, 9876}
+		addr = 0x29
+		if s.integration == 0 {
+			s.integration = 100 * time.Millisecond
+		}
+		if s.integration%(100*time.Millisecond) != 0 || s.integration > 600*time.Millisecond {
+			return fmt.Errorf("invalid integration_time %s; use 100ms to 600ms by steps of 100ms", s.integration)
+		}
+		if cfg.Address != 0 && cfg.Address != 0x29 {
+			return fmt.Errorf("invalid address 0x%x; the tsl2591 only supports 0x29", cfg.Address)
+		}
+	} else {
+		s.gains = []float64{1, 16}
+		if s.integration == 0 {
+			s.integration = 402 * time.Millisecond
+		}
+		switch s.integration {
+		case 13700 * time.Microsecond, 101 * time.Millisecond, 402 * time.Millisecond:
+		default:
+			return fmt.Errorf("invalid integration_time %s; use 13.7ms, 101ms or 402ms", s.integration)
+		}
+		switch cfg.Address {
+		case 0:
+		case 0x29, 0x39, 0x49:
+			addr = uint16(cfg.Address)
+		default:
+			return fmt.Errorf("invalid address 0x%x; use 0x29, 0x39 or 0x49", cfg.Address)
+		}
+	}
+	if cfg.Gain == 0 {
+		s.autoGain = true
+	} else {
+		for i, g := range s.gains {
+			if g == cfg.Gain {
+				s.gain = i
+			}
+		}
+	}
+	bus, err := n.openSensorI2C(cfg)
+	if err != nil {
+		return err
+	}
+	s.bus = bus
+	s.d = i2c.Dev{Bus: bus, Addr: addr}
+	if err = n.addEntity(ctx, s); err != nil {
+		_ = bus.Close()
+	}
+	return err
+}
+
+// TSL2561 registers and bits.
+const (
+	tsl2561Cmd     = 0x80
+	tsl2561Word    = 0x20
+	tsl2561Control = 0x00
+	tsl2561Timing  = 0x01
+	tsl2561Data0   = 0x0C
+	tsl2561Data1   = 0x0E
+	tsl2561Gain16x = 0x10
+)
+
+// TSL2591 registers.
+const (
+	tsl2591Cmd    = 0xA0
+	tsl2591Enable = 0x00
+	tsl2591Config = 0x01
+	tsl2591C0Data = 0x14
+)
+
+// errTSL25x1Saturated is returned when the light is too bright to be
+// measured.
+var errTSL25x1Saturated = errors.New("sensor is saturated, lower the gain or the integration_time")
+
+type sensorTSL25x1 struct {
+	sensorBase
+	bus i2c.BusCloser
+	d   i2c.Dev
+	// tsl2591 is set for the TSL2591, otherwise it is a TSL2561.
+	tsl2591     bool
+	update      time.Duration
+	integration time.Duration
+	// gains are the supported gains in increasing order; gain is the index of
+	// the one in use.
+	gains    []float64
+	gain     int
+	autoGain bool
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (s *sensorTSL25x1) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return s.bus.Close()
+}
+
+func (s *sensorTSL25x1) init(ctx context.Context, n *Node) error {
+	if err := s.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	// Confirm the device is present. Saturation is not fatal.
+	if v, err := s.read(); err == nil {
+		s.publish(v)
+	} else if err == errTSL25x1Saturated {
+		s.setError(err)
+		s.publishMissing()
+	} else {
+		return err
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTicker(s.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				v, err := s.read()
+				if err != nil {
+					s.setError(err)
+					s.publishMissing()
+					continue
+				}
+				s.publish(v)
+			}
+		}
+	}()
+	return nil
+}
+
+// read does a measurement and returns the illuminance in lux.
+//
+// With automatic gain, a saturated measurement is retried with a lower gain
+// and the gain is raised for the next measurement when the light is low
+// enough.
+func (s *sensorTSL25x1) read() (float32, error) {
+	for {
+		ch0, ch1, err := s.measure()
+		if err != nil {
+			return 0, err
+		}
+		max := s.maxCount()
+		if ch0 >= max || ch1 >= max {
+			if s.autoGain && s.gain > 0 {
+				s.gain--
+				continue
+			}
+			return 0, errTSL25x1Saturated
+		}
+		lux := s.lux(float64(ch0), float64(ch1))
+		if s.autoGain && s.gain < len(s.gains)-1 {
+			// Keep a margin so the next measurement does not saturate.
+			if float64(ch0)*s.gains[s.gain+1]/s.gains[s.gain] < float64(max)*0.8 {
+				s.gain++
+			}
+		}
+		return lux, nil
+	}
+}
+
+// measure powers on the sensor, waits for one integration cycle, returns the
+// raw broadband and infrared channels and powers it off.
+func (s *sensorTSL25x1) measure() (uint16, uint16, error) {
+	// Add a margin as the internal oscillator is not precise.
+	wait := s.integration + s.integration/10 + time.Millisecond
+	var r [4]byte
+	if s.tsl2591 {
+		cfg := byte(s.gain)<<4 | byte(s.integration/(100*time.Millisecond)-1)
+		if err := s.d.Tx([]byte{tsl2591Cmd | tsl2591Config, cfg}, nil); err != nil {
+			return 0, 0, err
+		}
+		// Power on and ALS enable.
+		if err := s.d.Tx([]byte{tsl2591Cmd | tsl2591Enable, 0x03}, nil); err != nil {
+			return 0, 0, err
+		}
+		time.Sleep(wait)
+		if err := s.d.Tx([]byte{tsl2591Cmd | tsl2591C0Data}, r[:]); err != nil {
+			return 0, 0, err
+		}
+		if err := s.d.Tx([]byte{tsl2591Cmd | tsl2591Enable, 0x00}, nil); err != nil {
+			return 0, 0, err
+		}
+	} else {
+		timing := byte(2)
+		switch s.integration {
+		case 13700 * time.Microsecond:
+			timing = 0
+		case 101 * time.Millisecond:
+			timing = 1
+		}
+		if s.gains[s.gain] == 16 {
+			timing |= tsl2561Gain16x
+		}
+		if err := s.d.Tx([]byte{tsl2561Cmd | tsl2561Control, 0x03}, nil); err != nil {
+			return 0, 0, err
+		}
+		if err := s.d.Tx([]byte{tsl2561Cmd | tsl2561Timing, timing}, nil); err != nil {
+			return 0, 0, err
+		}
+		time.Sleep(wait)
+		if err := s.d.Tx([]byte{tsl2561Cmd | tsl2561Word | tsl2561Data0}, r[:2]); err != nil {
+			return 0, 0, err
+		}
+		if err := s.d.Tx([]byte{tsl2561Cmd | tsl2561Word | tsl2561Data1}, r[2:]); err != nil {
+			return 0, 0, err
+		}
+		if err := s.d.Tx([]byte{tsl2561Cmd | tsl2561Control, 0x00}, nil); err != nil {
+			return 0, 0, err
+		}
+	}
+	return uint16(r[0]) | uint16(r[1])<<8, uint16(r[2]) | uint16(r[3])<<8, nil
+}
+
+// maxCount returns the count at which the channels saturate.
+func (s *sensorTSL25x1) maxCount() uint16 {
+	if s.tsl2591 {
+		if s.integration == 100*time.Millisecond {
+			return 36863
+		}
+		return 65535
+	}
+	switch s.integration {
+	case 13700 * time.Microsecond:
+		return 5047
+	case 101 * time.Millisecond:
+		return 37177
+	default:
+		return 65535
+	}
+}
+
+// lux converts the broadband and infrared counts to lux.
+func (s *sensorTSL25x1) lux(ch0, ch1 float64) float32 {
+	if ch0 == 0 {
+		return 0
+	}
+	g := s.gains[s.gain]
+	if s.tsl2591 {
+		// Counts per lux, 408 is the device factor.
+		cpl := float64(s.integration/time.Millisecond) * g / 408
+		lux := (ch0 - ch1) * (1 - ch1/ch0) / cpl
+		if lux < 0 {
+			return 0
+		}
+		return float32(lux)
+	}
+	// The TSL2561 equations are for 402ms at 16x, scale to it.
+	scale := float64(402*time.Millisecond) / float64(s.integration) * 16 / g
+	ch0 *= scale
+	ch1 *= scale
+	// T, FN and CL packages.
+	var lux float64
+	switch r := ch1 / ch0; {
+	case r <= 0.5:
+		lux = 0.0304*ch0 - 0.062*ch0*math.Pow(r, 1.4)
+	case r <= 0.61:
+		lux = 0.0224*ch0 - 0.031*ch1
+	case r <= 0.80:
+		lux = 0.0128*ch0 - 0.0153*ch1
+	case r <= 1.30:
+		lux = 0.00146*ch0 - 0.00112*ch1
+	}
+	if lux < 0 {
+		return 0
+	}
+	return float32(lux)
+}
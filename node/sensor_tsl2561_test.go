@@ -0,0 +1,91 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2ctest"
+)
+
+func TestSensorTSL2561_AutoGain(t *testing.T) {
+	measure := func(timing byte, ch0, ch1 uint16) []i2ctest.IO {
+		return []i2ctest.IO{
+			{Addr: 0x39, W: []byte{0x80, 0x03}},
+			{Addr: 0x39, W: []byte{0x81, timing}},
+			{Addr: 0x39, W: []byte{0xAC}, R: []byte{byte(ch0), byte(ch0 >> 8)}},
+			{Addr: 0x39, W: []byte{0xAE}, R: []byte{byte(ch1), byte(ch1 >> 8)}},
+			{Addr: 0x39, W: []byte{0x80, 0x00}},
+		}
+	}
+	// Saturated at 16x, then retried at 1x.
+	ops := append(measure(0x10, 5047, 2000), measure(0x00, 1000, 200)...)
+	bus := &i2ctest.Playback{Ops: ops}
+	s := sensorTSL25x1{
+		bus:         bus,
+		d:           i2c.Dev{Bus: bus, Addr: 0x39},
+		integration: 13700 * time.Microsecond,
+		gains:       []float64{1, 16},
+		gain:        1,
+		autoGain:    true,
+	}
+	v, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(v)-11214.3) > 1 {
+		t.Fatalf("got %g", v)
+	}
+	if s.gain != 0 {
+		t.Fatalf("expected gain 1x, got index %d", s.gain)
+	}
+	if err = bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSensorTSL2561_Saturated(t *testing.T) {
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x39, W: []byte{0x80, 0x03}},
+			{Addr: 0x39, W: []byte{0x81, 0x10}},
+			{Addr: 0x39, W: []byte{0xAC}, R: []byte{0xFF, 0xFF}},
+			{Addr: 0x39, W: []byte{0xAE}, R: []byte{0x00, 0x10}},
+			{Addr: 0x39, W: []byte{0x80, 0x00}},
+		},
+	}
+	s := sensorTSL25x1{
+		bus:         bus,
+		d:           i2c.Dev{Bus: bus, Addr: 0x39},
+		integration: 13700 * time.Microsecond,
+		gains:       []float64{1, 16},
+		gain:        1,
+	}
+	if _, err := s.read(); err != errTSL25x1Saturated {
+		t.Fatalf("unexpected %v", err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSensorTSL2591_Lux(t *testing.T) {
+	s := sensorTSL25x1{
+		tsl2591:     true,
+		integration: 100 * time.Millisecond,
+		gains:       []float64{1, 25, 428, 9876},
+		gain:        1,
+	}
+	// cpl = 100 * 25 / 408; lux = (1000 - 250) * (1 - 0.25) / cpl
+	if v := s.lux(1000, 250); math.Abs(float64(v)-91.8) > 0.01 {
+		t.Fatalf("got %g", v)
+	}
+	if v := s.lux(0, 0); v != 0 {
+		t.Fatalf("got %g", v)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorUltrasonic loads a HC-SR04 compatible ultrasonic distance sensor.
+//
+// A pulse on the trigger pin starts a measurement, then the sensor raises the
+// echo pin for the round trip time of the sound.
+func (n *Node) loadSensorUltrasonic(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" || cfg.Address != 0 {
+		return errors.New("do not use temperature / pressure / humidity / address")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	if cfg.TriggerPin.Inverted || cfg.EchoPin.Inverted {
+		return errors.New("inverted is not supported")
+	}
+	if cfg.TriggerPin.Mode != "" && cfg.TriggerPin.Mode != config.Output {
+		return errors.New("trigger_pin mode must be OUTPUT")
+	}
+	pull := gpio.Float
+	switch cfg.EchoPin.Mode {
+	case "", config.Input:
+		// The sensor drives the pin.
+	case config.InputPulldown:
+		pull = gpio.PullDown
+	default:
+		return errors.New("echo_pin mode must be INPUT or INPUT_PULLDOWN")
+	}
+	s := &sensorUltrasonic{
+		sensorBase: sensorBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: sensorComponent,
+			},
+			calibration: cfg.CalibrateLinear,
+			icon:        "mdi:arrow-expand-vertical",
+			unit:        "m",
+			accuracy:    2,
+			deviceClass: "distance",
+			stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+		},
+		update:  cfg.UpdateInterval,
+		timeout: cfg.Timeout,
+		samples: cfg.Samples,
+	}
+	if s.timeout == 0 {
+		s.timeout = 25 * time.Millisecond
+	}
+	if s.trigger = gpioreg.ByName(cfg.TriggerPin.Number); s.trigger == nil {
+		return fmt.Errorf("unknown trigger_pin %q", cfg.TriggerPin.Number)
+	}
+	if s.echo = gpioreg.ByName(cfg.EchoPin.Number); s.echo == nil {
+		return fmt.Errorf("unknown echo_pin %q", cfg.EchoPin.Number)
+	}
+	if err := s.trigger.Out(gpio.Low); err != nil {
+		return err
+	}
+	if err := s.echo.In(pull, gpio.NoEdge); err != nil {
+		_ = s.trigger.Halt()
+		return err
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	return n.addEntity(ctx, s)
+}
+
+type sensorUltrasonic struct {
+	sensorBase
+	trigger gpio.PinOut
+	echo    gpio.PinIn
+	update  time.Duration
+	timeout time.Duration
+	samples int
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (s *sensorUltrasonic) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+	err := s.trigger.Halt()
+	if err2 := s.echo.Halt(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (s *sensorUltrasonic) init(ctx context.Context, n *Node) error {
+	if err := s.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTicker(s.update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			s.sense()
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// sense does the measurements and publishes their average.
+func (s *sensorUltrasonic) sense() {
+	// Wait for the echoes of the previous measurement to fade.
+	v, err := oversample(s.samples, 60*time.Millisecond, func() (float32, error) {
+		d, err := s.measure()
+		return echoDistance(d), err
+	})
+	if err != nil {
+		s.setError(err)
+		s.publishMissing()
+		return
+	}
+	s.publish(v)
+}
+
+// measure triggers a measurement and returns the duration of the echo pulse.
+func (s *sensorUltrasonic) measure() (time.Duration, error) {
+	// Reduce the likelihood of being descheduled while timing the pulse.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := s.trigger.Out(gpio.High); err != nil {
+		return 0, err
+	}
+	// The trigger pulse must be at least 10µs.
+	for start := time.Now(); time.Since(start) < 10*time.Microsecond; {
+	}
+	if err := s.trigger.Out(gpio.Low); err != nil {
+		return 0, err
+	}
+	start, err := waitLevel(s.echo, gpio.High, time.Now().Add(s.timeout))
+	if err != nil {
+		return 0, errors.New("echo never started, is the sensor connected?")
+	}
+	end, err := waitLevel(s.echo, gpio.Low, start.Add(s.timeout))
+	if err != nil {
+		return 0, errors.New("no echo, is there an object in range?")
+	}
+	return end.Sub(start), nil
+}
+
+// waitLevel polls p until it reads l and returns the time it happened.
+func waitLevel(p gpio.PinIn, l gpio.Level, deadline time.Time) (time.Time, error) {
+	for {
+		now := time.Now()
+		if p.Read() == l {
+			return now, nil
+		}
+		if now.After(deadline) {
+			return now, errors.New("timed out")
+		}
+	}
+}
+
+// echoDistance converts the round trip time of the sound to a distance in
+// meters, at 20°C.
+func echoDistance(d time.Duration) float32 {
+	return float32(d.Seconds() * 343.2 / 2)
+}
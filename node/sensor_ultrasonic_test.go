@@ -0,0 +1,39 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+)
+
+func TestEchoDistance(t *testing.T) {
+	if got := echoDistance(5828 * time.Microsecond); math.Abs(float64(got)-1) > 0.001 {
+		t.Fatalf("%g != 1", got)
+	}
+}
+
+func TestSensorUltrasonic_Measure(t *testing.T) {
+	trigger := &gpiotest.Pin{N: "GPIO1"}
+	s := &sensorUltrasonic{trigger: trigger, timeout: time.Millisecond}
+
+	// The echo never rises.
+	s.echo = &gpiotest.Pin{N: "GPIO2", L: gpio.Low}
+	if _, err := s.measure(); err == nil {
+		t.Fatal("expected error")
+	}
+	if trigger.L != gpio.Low {
+		t.Fatal("trigger must be released")
+	}
+	// The echo never falls, e.g. no object in range.
+	s.echo = &gpiotest.Pin{N: "GPIO2", L: gpio.High}
+	if _, err := s.measure(); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorVcgencmd loads diagnostic sensors about the Raspberry Pi SoC
+// health, as reported by the firmware via vcgencmd.
+func (n *Node) loadSensorVcgencmd(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.ArmClock.Name == "" && cfg.CoreVolts.Name == "" && cfg.Temperature.Name == "" {
+		return errors.New("specify a name for at least one of arm_clock / core_volts / temperature")
+	}
+	if cfg.Name != "" || cfg.Address != 0 || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" {
+		return errors.New("do not use name / address / pressure / humidity")
+	}
+	if cfg.UpdateInterval == 0 {
+		return errors.New("update_interval is required")
+	}
+	if _, err := vcgencmdPath(); err != nil {
+		return err
+	}
+	v := &vcgencmd{}
+	ctx, cancel := context.WithCancel(ctx)
+	stop := func() {
+		cancel()
+		v.wg.Wait()
+	}
+	add := func(p *config.SensorParams, icon, unit, deviceClass string, accuracy int32) (*sensorDiagnostic, error) {
+		if p.Name == "" {
+			return nil, nil
+		}
+		s := &sensorDiagnostic{
+			sensorBase: sensorBase{
+				componentBase: componentBase{name: p.Name},
+				calibration:   p.CalibrateLinear,
+				icon:          icon,
+				unit:          unit,
+				accuracy:      accuracy,
+				deviceClass:   deviceClass,
+				stateClass:    aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
+			},
+		}
+		s.override(p.UnitOfMeasurement, p.AccuracyDecimals, p.DeviceClass, p.StateClass)
+		if v.clock == nil && v.volts == nil && v.temp == nil {
+			// The first sensor stops the sampling.
+			s.stop = stop
+		}
+		return s, n.addEntity(ctx, s)
+	}
+	var err error
+	if v.clock, err = add(&cfg.ArmClock, "mdi:speedometer", "MHz", "frequency", 0); err != nil {
+		cancel()
+		return err
+	}
+	if v.volts, err = add(&cfg.CoreVolts, "mdi:flash", "V", "voltage", 4); err != nil {
+		stop()
+		return err
+	}
+	if v.temp, err = add(&cfg.Temperature, "mdi:thermometer", "°C", "temperature", 1); err != nil {
+		stop()
+		return err
+	}
+	v.sample(ctx)
+	v.wg.Add(1)
+	go func() {
+		defer v.wg.Done()
+		t := time.NewTicker(cfg.UpdateInterval)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				v.sample(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// vcgencmd samples the SoC health.
+type vcgencmd struct {
+	wg    sync.WaitGroup
+	clock *sensorDiagnostic
+	volts *sensorDiagnostic
+	temp  *sensorDiagnostic
+}
+
+func (v *vcgencmd) sample(ctx context.Context) {
+	if v.clock != nil {
+		if f, err := runVcgencmd(ctx, "measure_clock", "arm"); err == nil {
+			v.clock.setValue(f / 1000000)
+		} else {
+			v.clock.setError(err)
+			v.clock.publishMissing()
+		}
+	}
+	if v.volts != nil {
+		if f, err := runVcgencmd(ctx, "measure_volts", "core"); err == nil {
+			v.volts.setValue(f)
+		} else {
+			v.volts.setError(err)
+			v.volts.publishMissing()
+		}
+	}
+	if v.temp != nil {
+		if f, err := runVcgencmd(ctx, "measure_temp"); err == nil {
+			v.temp.setValue(f)
+		} else {
+			v.temp.setError(err)
+			v.temp.publishMissing()
+		}
+	}
+}
+
+var (
+	vcgencmdOnce sync.Once
+	vcgencmdBin  string
+	vcgencmdErr  error
+)
+
+// vcgencmdPath returns the path to vcgencmd, looked up once.
+func vcgencmdPath() (string, error) {
+	vcgencmdOnce.Do(func() {
+		if vcgencmdBin, vcgencmdErr = exec.LookPath("vcgencmd"); vcgencmdErr != nil {
+			vcgencmdErr = errors.New("vcgencmd is not supported on this system, it is only available on a Raspberry Pi")
+		}
+	})
+	return vcgencmdBin, vcgencmdErr
+}
+
+// runVcgencmd runs vcgencmd and parses its single value output.
+func runVcgencmd(ctx context.Context, args ...string) (float32, error) {
+	p, err := vcgencmdPath()
+	if err != nil {
+		return 0, err
+	}
+	/* #nosec G204 */
+	out, err := exec.CommandContext(ctx, p, args...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("vcgencmd %s: %w", strings.Join(args, " "), err)
+	}
+	return parseVcgencmd(string(out))
+}
+
+// parseVcgencmd parses the output of vcgencmd measure_*.
+//
+// It looks like "frequency(48)=1500345728", "volt=0.8563V" or "temp=48.3'C".
+func parseVcgencmd(out string) (float32, error) {
+	out = strings.TrimSpace(out)
+	i := strings.LastIndexByte(out, '=')
+	if i == -1 {
+		return 0, fmt.Errorf("unexpected vcgencmd output %q", out)
+	}
+	v := strings.TrimRight(out[i+1:], "V'C")
+	f, err := strconv.ParseFloat(v, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected vcgencmd output %q", out)
+	}
+	return float32(f), nil
+}
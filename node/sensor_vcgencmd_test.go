@@ -0,0 +1,32 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import "testing"
+
+func TestParseVcgencmd(t *testing.T) {
+	data := []struct {
+		in   string
+		want float32
+	}{
+		{"frequency(48)=1500345728\n", 1500345728},
+		{"volt=0.8563V\n", 0.8563},
+		{"temp=48.3'C\n", 48.3},
+	}
+	for i, l := range data {
+		got, err := parseVcgencmd(l.in)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if got != l.want {
+			t.Fatalf("#%d: %g != %g", i, got, l.want)
+		}
+	}
+	for _, in := range []string{"", "error=2 error_msg=\"Command not registered\"", "volt=V"} {
+		if _, err := parseVcgencmd(in); err == nil {
+			t.Fatalf("%q: expected error", in)
+		}
+	}
+}
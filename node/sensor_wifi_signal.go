@@ -8,14 +8,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"google.golang.org/protobuf/proto"
 	"periph.io/x/home/node/config"
 	"periph.io/x/home/thirdparty/aioesphomeapi"
 )
@@ -30,17 +27,29 @@ func (n *Node) loadSensorWifiSignal(ctx context.Context, cfg *config.Sensor) err
 	if cfg.UpdateInterval == 0 {
 		return errors.New("update_interval is required")
 	}
-	return n.addEntity(ctx, &sensorWifiSignal{
-		componentBase: componentBase{
-			name:          cfg.Name,
-			componentType: sensorComponent,
+	s := &sensorWifiSignal{
+		sensorBase: sensorBase{
+			componentBase: componentBase{
+				name:          cfg.Name,
+				componentType: sensorComponent,
+			},
+			calibration: cfg.CalibrateLinear,
+			icon:        "mdi:wifi",
+			unit:        "dBm",
+			deviceClass: "signal_strength",
+			stateClass:  aioesphomeapi.SensorStateClass_STATE_CLASS_MEASUREMENT,
 		},
+		iface:  cfg.Interface,
 		update: cfg.UpdateInterval,
-	})
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	return n.addEntity(ctx, s)
 }
 
 type sensorWifiSignal struct {
-	componentBase
+	sensorBase
+	// iface is the wifi interface to report; the first one when empty.
+	iface  string
 	update time.Duration
 
 	wg     sync.WaitGroup
@@ -62,10 +71,7 @@ func (s *sensorWifiSignal) init(ctx context.Context, n *Node) error {
 	if err != nil {
 		return err
 	}
-	s.onNewState(&aioesphomeapi.SensorStateResponse{
-		Key:   s.key,
-		State: v,
-	})
+	s.publish(v)
 
 	ctx, s.cancel = context.WithCancel(ctx)
 	s.wg.Add(1)
@@ -81,55 +87,97 @@ func (s *sensorWifiSignal) init(ctx context.Context, n *Node) error {
 			case <-t.C:
 				v, err := s.read()
 				if err != nil {
-					return
+					s.setError(err)
+					continue
 				}
-				s.onNewState(&aioesphomeapi.SensorStateResponse{
-					Key:   s.key,
-					State: v,
-				})
+				s.publish(v)
 			}
 		}
 	}()
 	return nil
 }
 
-func (s *sensorWifiSignal) read() (float32, error) {
-	if runtime.GOOS != "linux" {
-		return 0, errors.New("please send a PR to implement wifi_signal on " + runtime.GOOS)
-	}
-	// Cheezy but avoid having to shell out anything or add another dependency.
-	// Redo if it doesn't work well in practice.
-	// Looks like this:
-	// Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE
-	//  face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22
-	//   wlan0: 0000   50.  -60.  -256        0      0      0     14      0        0
-	b, err := ioutil.ReadFile("/proc/net/wireless")
-	if err != nil {
-		return 0, err
+// republish implements republisher.
+func (s *sensorWifiSignal) republish() {
+	if v, err := s.read(); err == nil {
+		s.publish(v)
 	}
+}
+
+func (s *sensorWifiSignal) read() (float32, error) {
+	return readWifiSignal(s.iface)
+}
+
+// parseWireless returns the signal level in dBm of the interface iface, or
+// the first interface listed in /proc/net/wireless if iface is empty.
+//
+// Looks like this:
+//
+//	Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE
+//	 face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22
+//	  wlan0: 0000   50.  -60.  -256        0      0      0     14      0        0
+//
+// The level is the third value; link is a driver specific quality, not the
+// signal. The trailing columns vary across kernel versions so they are
+// ignored.
+func parseWireless(b []byte, iface string) (float32, error) {
 	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
 	if len(lines) < 3 {
 		return 0, errors.New("no wifi interface")
 	}
-	// Maybe find for wlan0?
-	items := strings.Fields(lines[2])
-	if len(items) != 11 {
+	var items []string
+	for _, l := range lines[2:] {
+		// The interface name may be glued to the status when it is long.
+		i := strings.IndexByte(l, ':')
+		if i == -1 {
+			return 0, errors.New("unexpected /proc/net/wireless format")
+		}
+		if iface == "" || strings.TrimSpace(l[:i]) == iface {
+			items = strings.Fields(l[i+1:])
+			break
+		}
+	}
+	if items == nil {
+		return 0, fmt.Errorf("wifi interface %q not found", iface)
+	}
+	if len(items) < 3 {
 		return 0, errors.New("unexpected /proc/net/wireless format")
 	}
-	v, err := strconv.ParseFloat(items[2], 32)
+	v, err := strconv.ParseFloat(strings.TrimSuffix(items[2], "."), 32)
 	if err != nil {
 		return 0, fmt.Errorf("failed to parse RSSI in /proc/net/wireless: %w", err)
 	}
-	return -float32(v), nil
+	// The kernel prints the level in dBm, which is always negative. Some
+	// drivers report it as the unsigned 8 bits value instead, e.g. 196 for -60.
+	if v >= 128 {
+		v -= 256
+	} else if v > 0 {
+		return 0, errors.New("the driver does not report the signal level in dBm")
+	}
+	return float32(v), nil
 }
 
-func (s *sensorWifiSignal) describe() proto.Message {
-	return &aioesphomeapi.ListEntitiesSensorResponse{
-		ObjectId:          s.objectID,
-		Key:               s.key,
-		Name:              s.name,
-		UniqueId:          s.uniqueID,
-		Icon:              "mdi:wifi",
-		UnitOfMeasurement: "dB",
+// parseAirport returns the signal level in dBm from the output of macOS'
+// "airport -I".
+//
+// Looks like this:
+//
+//	     agrCtlRSSI: -55
+//	     agrExtRSSI: 0
+//	    agrCtlNoise: -89
+//	    agrExtNoise: 0
+//	          state: running
+func parseAirport(b []byte) (float32, error) {
+	for _, l := range strings.Split(string(b), "\n") {
+		i := strings.IndexByte(l, ':')
+		if i == -1 || strings.TrimSpace(l[:i]) != "agrCtlRSSI" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(l[i+1:]), 32)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse RSSI in airport output: %w", err)
+		}
+		return float32(v), nil
 	}
+	return 0, errors.New("wifi is not connected")
 }
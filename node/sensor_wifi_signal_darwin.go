@@ -0,0 +1,32 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// airportPath is the macOS utility reporting the wifi connection.
+const airportPath = "/System/Library/PrivateFrameworks/Apple80211.framework/Versions/Current/Resources/airport"
+
+// readWifiSignal returns the signal level in dBm of the wifi interface iface,
+// or the default one if empty.
+func readWifiSignal(iface string) (float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	args := []string{"-I"}
+	if iface != "" {
+		args = []string{iface, "-I"}
+	}
+	/* #nosec G204 */
+	out, err := exec.CommandContext(ctx, airportPath, args...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("airport: %w", err)
+	}
+	return parseAirport(out)
+}
@@ -0,0 +1,19 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import "io/ioutil"
+
+// readWifiSignal returns the signal level in dBm of the wifi interface iface,
+// or the first one if empty.
+func readWifiSignal(iface string) (float32, error) {
+	// Cheezy but avoid having to shell out anything or add another dependency.
+	// Redo if it doesn't work well in practice.
+	b, err := ioutil.ReadFile("/proc/net/wireless")
+	if err != nil {
+		return 0, err
+	}
+	return parseWireless(b, iface)
+}
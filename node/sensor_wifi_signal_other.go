@@ -0,0 +1,19 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package node
+
+import (
+	"errors"
+	"runtime"
+)
+
+// readWifiSignal returns an error, as reading the wifi signal is not
+// implemented on this OS.
+func readWifiSignal(iface string) (float32, error) {
+	return 0, errors.New("wifi_signal is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import "testing"
+
+func TestParseWireless(t *testing.T) {
+	const header = "Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE\n" +
+		" face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22\n"
+	const two = "  wlan0: 0000   50.  -60.  -256        0      0      0     14      0        0\n" +
+		"  wlan1: 0000   30.  -80.  -256        0      0      0      2      0        0\n"
+	data := []struct {
+		in    string
+		iface string
+		want  float32
+	}{
+		{"  wlan0: 0000   50.  -60.  -256        0      0      0     14      0        0\n", "", -60},
+		// Unsigned 8 bits level.
+		{"  wlan0: 0000   70.  196.  0        0      0      0     14      0        0\n", "", -60},
+		// Older kernels without the beacon column.
+		{"  wlan0: 0000   41.  -69.  -256        0      0      0     0      0\n", "", -69},
+		// Long interface name glued to the status.
+		{"wlp0s20f3:0000   61.  -49.  -256        0      0      0      0     19        0\n", "wlp0s20f3", -49},
+		// Selected by name.
+		{two, "", -60},
+		{two, "wlan0", -60},
+		{two, "wlan1", -80},
+	}
+	for i, line := range data {
+		got, err := parseWireless([]byte(header+line.in), line.iface)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got != line.want {
+			t.Fatalf("#%d: got %v; want %v", i, got, line.want)
+		}
+	}
+	if _, err := parseWireless([]byte(header), ""); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := parseWireless([]byte(header+two), "wlan2"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseAirport(t *testing.T) {
+	const out = "     agrCtlRSSI: -55\n" +
+		"     agrExtRSSI: 0\n" +
+		"    agrCtlNoise: -89\n" +
+		"    agrExtNoise: 0\n" +
+		"          state: running\n" +
+		"        op mode: station \n" +
+		"     lastTxRate: 585\n" +
+		"        maxRate: 867\n" +
+		"lastAssocStatus: 0\n" +
+		"    802.11 auth: open\n" +
+		"      link auth: wpa2-psk\n" +
+		"          BSSID: 12:34:56:78:9a:bc\n" +
+		"           SSID: home\n" +
+		"            MCS: 9\n" +
+		"        channel: 44,80\n"
+	got, err := parseAirport([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != -55 {
+		t.Fatalf("got %v; want -55", got)
+	}
+	for i, in := range []string{"AirPort: Off\n", "     agrCtlRSSI: bad\n"} {
+		if _, err := parseAirport([]byte(in)); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
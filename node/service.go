@@ -0,0 +1,123 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadServices loads the user defined services.
+func (n *Node) loadServices() {
+	n.services = map[uint32]*userService{}
+	for i := range n.cfg.API.Services {
+		s := &userService{cfg: &n.cfg.API.Services[i]}
+		// Same as ESPHome.
+		h := fnv.New32()
+		_, _ = h.Write([]byte(s.cfg.Service))
+		s.key = h.Sum32()
+		n.services[s.key] = s
+		n.serviceList = append(n.serviceList, s)
+	}
+}
+
+// userService is a service defined in the configuration.
+type userService struct {
+	cfg *config.Service
+	key uint32
+}
+
+func (s *userService) describe() *aioesphomeapi.ListEntitiesServicesResponse {
+	out := &aioesphomeapi.ListEntitiesServicesResponse{
+		Name: s.cfg.Service,
+		Key:  s.key,
+	}
+	for _, a := range s.cfg.Args {
+		out.Args = append(out.Args, &aioesphomeapi.ListEntitiesServicesArgument{
+			Name: a.Name,
+			Type: serviceArgTypes[a.Type],
+		})
+	}
+	return out
+}
+
+// serviceArgTypes maps config.ServiceArg.Type to the native API type.
+var serviceArgTypes = map[string]aioesphomeapi.ServiceArgType{
+	"bool":   aioesphomeapi.ServiceArgType_SERVICE_ARG_TYPE_BOOL,
+	"int":    aioesphomeapi.ServiceArgType_SERVICE_ARG_TYPE_INT,
+	"float":  aioesphomeapi.ServiceArgType_SERVICE_ARG_TYPE_FLOAT,
+	"string": aioesphomeapi.ServiceArgType_SERVICE_ARG_TYPE_STRING,
+}
+
+// env returns the arguments as environment variables.
+func (s *userService) env(args []*aioesphomeapi.ExecuteServiceArgument) ([]string, error) {
+	if len(args) != len(s.cfg.Args) {
+		return nil, fmt.Errorf("service %s: expected %d args, got %d", s.cfg.Service, len(s.cfg.Args), len(args))
+	}
+	out := make([]string, len(args))
+	for i, a := range s.cfg.Args {
+		var v string
+		switch a.Type {
+		case "bool":
+			v = strconv.FormatBool(args[i].Bool_)
+		case "int":
+			x := args[i].Int_
+			if x == 0 {
+				// Clients older than API v1.3.
+				x = args[i].LegacyInt
+			}
+			v = strconv.Itoa(int(x))
+		case "float":
+			v = strconv.FormatFloat(float64(args[i].Float_), 'g', -1, 32)
+		default:
+			v = args[i].String_
+		}
+		out[i] = a.Name + "=" + v
+	}
+	return out, nil
+}
+
+// run runs the command with the arguments in its environment.
+//
+// The command is killed if ctx is canceled.
+func (s *userService) run(ctx context.Context, env []string) error {
+	/* #nosec G204 */
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", s.cfg.Command)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("service %s: %w\n%s", s.cfg.Service, err, out)
+	}
+	return nil
+}
+
+// executeService starts the service in the background.
+func (n *Node) executeService(ctx context.Context, in *aioesphomeapi.ExecuteServiceRequest) error {
+	s := n.services[in.Key]
+	if s == nil {
+		return fmt.Errorf("unknown service %x", in.Key)
+	}
+	env, err := s.env(in.Args)
+	if err != nil {
+		return err
+	}
+	log.Printf("running service %s", s.cfg.Service)
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := s.run(ctx, env); err != nil {
+			log.Print(err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestExecuteService(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /bin/sh")
+	}
+	shouldLog = testing.Verbose()
+	d, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	cfg := config.Root{
+		PeriphHome: config.PeriphHome{Name: "node"},
+		API: config.API{
+			Port:      getFreePort(t),
+			IsPresent: true,
+			Services: []config.Service{
+				{
+					Service: "write",
+					Args: []config.ServiceArg{
+						{Name: "path", Type: "string"},
+						{Name: "on", Type: "bool"},
+						{Name: "count", Type: "int"},
+						{Name: "level", Type: "float"},
+					},
+					Command: "echo \"$on $count $level\" > \"$path.tmp\" && mv \"$path.tmp\" \"$path\"",
+				},
+			},
+		},
+	}
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	c := dialTestClient(t, cfg.API.Port, "")
+	defer c.close()
+	c.send(&aioesphomeapi.ListEntitiesRequest{})
+	s, ok := c.recv().(*aioesphomeapi.ListEntitiesServicesResponse)
+	if !ok || s.Name != "write" || len(s.Args) != 4 || s.Args[3].Type != aioesphomeapi.ServiceArgType_SERVICE_ARG_TYPE_FLOAT {
+		t.Fatalf("unexpected %v", s)
+	}
+	if _, ok := c.recv().(*aioesphomeapi.ListEntitiesDoneResponse); !ok {
+		t.Fatal("expected ListEntitiesDoneResponse")
+	}
+	p := filepath.Join(d, "out")
+	c.send(&aioesphomeapi.ExecuteServiceRequest{
+		Key: s.Key,
+		Args: []*aioesphomeapi.ExecuteServiceArgument{
+			{String_: p},
+			{Bool_: true},
+			{Int_: -3},
+			{Float_: 0.5},
+		},
+	})
+	for start := time.Now(); ; {
+		b, err := ioutil.ReadFile(p)
+		if err == nil {
+			if got := string(b); got != "true -3 0.5\n" {
+				t.Fatalf("unexpected %q", got)
+			}
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecuteService_Unauthenticated(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /bin/sh")
+	}
+	shouldLog = testing.Verbose()
+	d, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	p := filepath.Join(d, "out")
+	cfg := config.Root{
+		PeriphHome: config.PeriphHome{Name: "node"},
+		API: config.API{
+			Port:      getFreePort(t),
+			IsPresent: true,
+			Password:  "secret",
+			Services: []config.Service{
+				{Service: "touch", Command: "touch \"" + p + "\""},
+			},
+		},
+	}
+	n, err := New(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	c := dialTestClient(t, cfg.API.Port, cfg.API.Password)
+	c.send(&aioesphomeapi.ListEntitiesRequest{})
+	s, ok := c.recv().(*aioesphomeapi.ListEntitiesServicesResponse)
+	if !ok || s.Name != "touch" {
+		t.Fatalf("unexpected %v", s)
+	}
+	c.close()
+
+	// A client that didn't send the password can't run it even if it knows the
+	// key.
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.API.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	c = &testClient{t: t, c: conn}
+	c.send(&aioesphomeapi.HelloRequest{ClientInfo: "test"})
+	if _, ok := c.recv().(*aioesphomeapi.HelloResponse); !ok {
+		t.Fatal("expected HelloResponse")
+	}
+	c.send(&aioesphomeapi.ExecuteServiceRequest{Key: s.Key})
+	if _, _, err = readMsg(conn); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+	// Leave the command some time to run if it was started.
+	time.Sleep(100 * time.Millisecond)
+	if _, err = os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("expected the service to not run: %v", err)
+	}
+}
+
+func TestUserService_Env(t *testing.T) {
+	s := userService{cfg: &config.Service{Service: "s", Args: []config.ServiceArg{{Name: "a", Type: "int"}}}}
+	if _, err := s.env(nil); err == nil {
+		t.Fatal("expected error")
+	}
+	// Clients older than API v1.3.
+	env, err := s.env([]*aioesphomeapi.ExecuteServiceArgument{{LegacyInt: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 1 || env[0] != "a=2" {
+		t.Fatalf("unexpected %v", env)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// stateSnapshotFile is the file in state_dir where the entities states are
+// saved on clean shutdown.
+const stateSnapshotFile = "states.json"
+
+// stateSnapshot is the serialized form of the entities states.
+type stateSnapshot struct {
+	Saved  time.Time              `json:"saved"`
+	States map[string]stateRecord `json:"states"`
+}
+
+// stateRecord is the state of one entity, keyed by its unique ID in
+// stateSnapshot.
+type stateRecord struct {
+	// Type is the full protobuf message name.
+	Type string `json:"type"`
+	// Data is the serialized protobuf message.
+	Data        []byte    `json:"data"`
+	LastChanged time.Time `json:"last_changed"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+// loadStateSnapshot loads the states saved in dir, discarding them if they
+// are older than maxAge.
+//
+// Returns nil if there is no usable snapshot.
+func loadStateSnapshot(dir string, maxAge time.Duration) (map[string]stateRecord, error) {
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(filepath.Join(dir, stateSnapshotFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	s := stateSnapshot{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if time.Since(s.Saved) > maxAge {
+		logf("ignoring states saved at %s", s.Saved)
+		return nil, nil
+	}
+	return s.States, nil
+}
+
+// decode returns the protobuf message.
+func (s *stateRecord) decode() (proto.Message, error) {
+	t, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(s.Type))
+	if err != nil {
+		return nil, err
+	}
+	msg := t.New().Interface()
+	if err := proto.Unmarshal(s.Data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// stateRecords returns the current state of the entities, by unique ID.
+//
+// Cameras are skipped, an old frame is not useful.
+func stateRecords(entities []component) (map[string]stateRecord, error) {
+	out := map[string]stateRecord{}
+	for _, e := range entities {
+		msg := e.getState()
+		if msg == nil || e.getType() == cameraComponent {
+			continue
+		}
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		changed, updated := e.getTimestamps()
+		out[e.getUniqueID()] = stateRecord{
+			Type:        string(msg.ProtoReflect().Descriptor().FullName()),
+			Data:        b,
+			LastChanged: changed,
+			LastUpdated: updated,
+		}
+	}
+	return out, nil
+}
+
+// writeStateSnapshot saves the states in dir.
+func writeStateSnapshot(dir string, states map[string]stateRecord) error {
+	s := stateSnapshot{Saved: time.Now(), States: states}
+	b, err := json.Marshal(&s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, stateSnapshotFile), b)
+}
+
+// writeFileAtomic replaces the file p with b.
+//
+// It writes to a temporary file first and flushes it to the storage before
+// renaming it over p, so a crash or a power loss leaves either the old or the
+// new content behind, never a truncated file.
+func writeFileAtomic(p string, b []byte) error {
+	tmp := p + ".tmp"
+	/* #nosec G302 G304 */
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		// Otherwise the rename may reach the SD card before the data does.
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// stateStoreFile is the file in state_store where the restorable components
+// save their state.
+const stateStoreFile = "components.json"
+
+// stateStoreDelay is the time to wait after a change before writing to disk,
+// so a burst of changes, e.g. dragging a brightness slider, results in a
+// single write to the SD card.
+var stateStoreDelay = 5 * time.Second
+
+// restorable is implemented by the components whose state is saved in
+// state_store on every change and restored on startup.
+type restorable interface {
+	// MarshalState returns the current state as JSON.
+	MarshalState() ([]byte, error)
+	// UnmarshalState applies a state returned by MarshalState, including to
+	// the hardware.
+	UnmarshalState(b []byte) error
+}
+
+// stateStore saves the states of the restorable components in a directory.
+type stateStore struct {
+	dir string
+	// writeMu serializes the writes.
+	writeMu sync.Mutex
+
+	// mu protects the fields below.
+	mu     sync.Mutex
+	states map[string]json.RawMessage
+	// dirty is set when states changed since the last write.
+	dirty bool
+	// timer writes the states to disk, it is set while a write is pending.
+	timer *time.Timer
+	// watched are the components being watched, by unique ID.
+	watched map[string]restorable
+	ctx     context.Context
+	cancel  func()
+	wg      sync.WaitGroup
+}
+
+// newStateStore returns a store saving in dir, creating it if needed.
+func newStateStore(dir string) (*stateStore, error) {
+	/* #nosec G301 */
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &stateStore{dir: dir, states: map[string]json.RawMessage{}, watched: map[string]restorable{}}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// load loads the states saved previously, if any.
+func (s *stateStore) load() error {
+	/* #nosec G304 */
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, stateStoreFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	states := map[string]json.RawMessage{}
+	if err = json.Unmarshal(b, &states); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.states = states
+	s.mu.Unlock()
+	return nil
+}
+
+// watch restores the saved state of c, if any, then saves its state on every
+// change until stop() is called.
+func (s *stateStore) watch(c component, r restorable) {
+	s.mu.Lock()
+	b, ok := s.states[c.getUniqueID()]
+	s.mu.Unlock()
+	if ok {
+		if err := r.UnmarshalState(b); err != nil {
+			log.Printf("%s: failed to restore state: %s", c.getName(), err)
+		}
+	}
+	s.follow(c, r)
+}
+
+// follow saves the state of c on every change until stop() is called, without
+// restoring it first. It is used for the components kept by Reload().
+func (s *stateStore) follow(c component, r restorable) {
+	id := c.getUniqueID()
+	s.mu.Lock()
+	s.watched[id] = r
+	ctx := s.ctx
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		c.subscribe(ctx, &stateStoreInput{s: s, id: id, r: r})
+	}()
+}
+
+// stop stops watching the components and writes the pending changes, if
+// any. watch() can be called again afterward, e.g. on reload.
+func (s *stateStore) stop() error {
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+	s.wg.Wait()
+	// The last changes may still be queued in the subscriptions.
+	s.mu.Lock()
+	watched := s.watched
+	s.watched = map[string]restorable{}
+	s.mu.Unlock()
+	for id, r := range watched {
+		if b, err := r.MarshalState(); err == nil {
+			s.changed(id, b)
+		}
+	}
+	s.mu.Lock()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mu.Unlock()
+	return s.write()
+}
+
+// changed records the new state of the component with unique ID id and
+// schedules a write.
+func (s *stateStore) changed(id string, b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if string(s.states[id]) == string(b) {
+		return
+	}
+	s.states[id] = b
+	s.dirty = true
+	if s.timer == nil {
+		s.timer = time.AfterFunc(stateStoreDelay, func() {
+			s.mu.Lock()
+			s.timer = nil
+			s.mu.Unlock()
+			if err := s.write(); err != nil {
+				log.Printf("failed to save states: %s", err)
+			}
+		})
+	}
+}
+
+// write saves the states to disk if they changed.
+func (s *stateStore) write() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(s.states)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, stateStoreFile), b)
+}
+
+// stateStoreInput implements clientConn to receive the state changes of a
+// restorable component.
+type stateStoreInput struct {
+	s  *stateStore
+	id string
+	r  restorable
+}
+
+func (i *stateStoreInput) reply(msg proto.Message) error {
+	b, err := i.r.MarshalState()
+	if err != nil {
+		// Keep watching, the next state may be fine.
+		log.Printf("failed to save state: %s", err)
+		return nil
+	}
+	i.s.changed(i.id, b)
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestStateStore(t *testing.T) {
+	shouldLog = testing.Verbose()
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := gpiotest.Pin{N: "FAKE_GPIO_RELAY"}
+	if err = gpioreg.Register(&p); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := gpioreg.Unregister(p.N); err != nil {
+			t.Error(err)
+		}
+	}()
+	y := fmt.Sprintf("periphhome:\n  name: pi\n  state_store: %s\n"+
+		"switch:\n  - platform: gpio\n    name: Relay\n    pin:\n      number: FAKE_GPIO_RELAY\n"+
+		"light:\n  - platform: fake\n    name: Lamp\n"+
+		"number:\n  - platform: template\n    name: Target\n    min_value: 0\n    max_value: 100\n", dir)
+	cfg := &config.Root{}
+	if err = cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	n, err := New(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lights are loaded before the switches.
+	if err = n.entities[1].switchCommand(&aioesphomeapi.SwitchCommandRequest{State: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err = n.entities[0].lightCommand(&aioesphomeapi.LightCommandRequest{State: true, Brightness: 0.5, Red: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err = n.entities[2].numberCommand(&aioesphomeapi.NumberCommandRequest{State: 42}); err != nil {
+		t.Fatal(err)
+	}
+	// The pending write is flushed on close.
+	if err = n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Read() != gpio.Low {
+		t.Fatal("expected the relay to be turned off on close")
+	}
+
+	if n, err = New(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if s := n.entities[1].getState().(*aioesphomeapi.SwitchStateResponse); !s.State || p.Read() != gpio.High {
+		t.Fatalf("unexpected %v", s)
+	}
+	if s := n.entities[0].getState().(*aioesphomeapi.LightStateResponse); !s.State || s.Brightness != 0.5 || s.Red != 1 {
+		t.Fatalf("unexpected %v", s)
+	}
+	if s := n.entities[2].getState().(*aioesphomeapi.NumberStateResponse); s.State != 42 {
+		t.Fatalf("unexpected %v", s)
+	}
+}
+
+func TestStateStore_Debounce(t *testing.T) {
+	shouldLog = testing.Verbose()
+	old := stateStoreDelay
+	stateStoreDelay = 10 * time.Millisecond
+	defer func() {
+		stateStoreDelay = old
+	}()
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := newStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is written until something changed.
+	if err = s.stop(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, stateStoreFile)
+	if _, err = os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("unexpected %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		s.changed("a", []byte(fmt.Sprintf(`{"state":%d}`, i)))
+	}
+	want := `{"a":{"state":9}}`
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		/* #nosec G304 */
+		if b, _ := ioutil.ReadFile(p); string(b) == want {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out")
+		}
+	}
+	s2, err := newStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if string(s2.states["a"]) != `{"state":9}` {
+		t.Fatalf("unexpected %v", s2.states)
+	}
+	if err = ioutil.WriteFile(p, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s2.load() == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestStateSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	b := &binarySensorFake{
+		componentBase: componentBase{name: "Motion", componentType: binarySensorComponent},
+	}
+	if err = n.addEntity(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	want := &aioesphomeapi.BinarySensorStateResponse{Key: b.key, State: true}
+	b.onNewState(want)
+	changed, updated := b.getTimestamps()
+	// As done by Close().
+	states, err := stateRecords(n.entities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeStateSnapshot(dir, states); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadStateSnapshot(dir, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := got[b.getUniqueID()]
+	if !ok {
+		t.Fatalf("missing state: %v", got)
+	}
+	msg, err := r.decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := componentBase{}
+	c.restoreState(msg, r.LastChanged, r.LastUpdated)
+	if !proto.Equal(want, c.getState()) {
+		t.Fatalf("%v != %v", want, c.getState())
+	}
+	if gotChanged, gotUpdated := c.getTimestamps(); !gotChanged.Equal(changed) || !gotUpdated.Equal(updated) {
+		t.Fatalf("unexpected timestamps %s %s", gotChanged, gotUpdated)
+	}
+	// A state already set is not overridden.
+	c.restoreState(&aioesphomeapi.BinarySensorStateResponse{}, time.Time{}, time.Time{})
+	if !proto.Equal(want, c.getState()) {
+		t.Fatal("state was overridden")
+	}
+
+	// Too old.
+	if got, err = loadStateSnapshot(dir, time.Nanosecond); err != nil || got != nil {
+		t.Fatal(got, err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "f.json")
+	for _, want := range []string{"first", "2nd"} {
+		if err = writeFileAtomic(p, []byte(want)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+	if _, err = os.Stat(p + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("expected the temporary file to be gone: %v", err)
+	}
+	if err = writeFileAtomic(filepath.Join(dir, "missing", "f.json"), nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"periph.io/x/home/node/config"
+)
+
+func (n *Node) loadSwitch(ctx context.Context, cfg *config.Switch) error {
+	log.Printf("loading switch %s", cfg.Platform)
+	switch cfg.Platform {
+	case "gpio":
+		if err := n.loadSwitchGPIO(ctx, cfg); err != nil {
+			return fmt.Errorf("switch(%s): %w", cfg.Name, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown platform %q", cfg.Platform)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSwitchGPIO loads a switch driving a pin, e.g. a relay.
+//
+// The switch starts off, or in its last state when state_store is set. The
+// pin level is inverted with inverted and only pulled low with
+// OUTPUT_OPEN_DRAIN. With pulse, it turns itself back off after the
+// duration.
+func (n *Node) loadSwitchGPIO(ctx context.Context, cfg *config.Switch) error {
+	p := gpioreg.ByName(cfg.Pin.Number)
+	if p == nil {
+		return fmt.Errorf("unknown pin %q", cfg.Pin.Number)
+	}
+	switch cfg.Pin.Mode {
+	case "", config.Output, config.OutputOpenDrain:
+	default:
+		return errors.New("input is not supported for switch")
+	}
+	s := &switchGPIO{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: switchComponent,
+		},
+		p:         p,
+		inverted:  cfg.Pin.Inverted,
+		openDrain: cfg.Pin.Mode == config.OutputOpenDrain,
+		pulse:     cfg.Pulse,
+	}
+	if err := s.set(false); err != nil {
+		return err
+	}
+	return n.addEntity(ctx, s)
+}
+
+type switchGPIO struct {
+	componentBase
+	p        gpio.PinIO
+	inverted bool
+	// openDrain releases the pin instead of driving it high.
+	openDrain bool
+	// pulse is the duration the switch stays on. 0 means until turned off.
+	pulse time.Duration
+
+	// mu protects the fields below.
+	mu    sync.Mutex
+	state bool
+	// timer turns the switch off at the end of the pulse.
+	timer *time.Timer
+}
+
+// Close turns the switch off, cutting a pulse short.
+func (s *switchGPIO) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+	return s.set(false)
+}
+
+func (s *switchGPIO) init(ctx context.Context, n *Node) error {
+	if err := s.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	s.onNewState(&aioesphomeapi.SwitchStateResponse{Key: s.key})
+	return nil
+}
+
+func (s *switchGPIO) switchCommand(in *aioesphomeapi.SwitchCommandRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+	if err := s.set(in.State); err != nil {
+		return err
+	}
+	s.state = in.State
+	s.onNewState(&aioesphomeapi.SwitchStateResponse{Key: s.key, State: s.state})
+	if s.state && s.pulse != 0 {
+		var t *time.Timer
+		t = time.AfterFunc(s.pulse, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			// Ignore if it was superseded by a newer command.
+			if s.timer != t {
+				return
+			}
+			s.timer = nil
+			if err := s.set(false); err != nil {
+				s.setError(err)
+				return
+			}
+			s.state = false
+			s.onNewState(&aioesphomeapi.SwitchStateResponse{Key: s.key})
+		})
+		s.timer = t
+	}
+	return nil
+}
+
+// switchState is the saved state of a switch.
+type switchState struct {
+	State bool `json:"state"`
+}
+
+// MarshalState implements restorable.
+func (s *switchGPIO) MarshalState() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Marshal(&switchState{State: s.state})
+}
+
+// UnmarshalState implements restorable.
+//
+// A pulse is not restarted, the switch stays off.
+func (s *switchGPIO) UnmarshalState(b []byte) error {
+	v := switchState{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if s.pulse != 0 {
+		return nil
+	}
+	return s.switchCommand(&aioesphomeapi.SwitchCommandRequest{Key: s.key, State: v.State})
+}
+
+// stopLocked cancels the pulse in progress, if any.
+func (s *switchGPIO) stopLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// set drives the pin, with inverted applied. In open drain mode, the pin
+// floats instead of being driven high, so the external pull-up sets the
+// level.
+func (s *switchGPIO) set(on bool) error {
+	l := gpio.Level(on != s.inverted)
+	if l == gpio.High && s.openDrain {
+		return s.p.In(gpio.Float, gpio.NoEdge)
+	}
+	return s.p.Out(l)
+}
+
+func (s *switchGPIO) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesSwitchResponse{
+		ObjectId: s.objectID,
+		Key:      s.key,
+		Name:     s.name,
+		UniqueId: s.uniqueID,
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestSwitchGPIO(t *testing.T) {
+	data := []struct {
+		inverted bool
+		on       gpio.Level
+	}{
+		{false, gpio.High},
+		{true, gpio.Low},
+	}
+	for i, l := range data {
+		p := gpiotest.Pin{N: "FAKE_GPIO_RELAY", L: l.on}
+		if err := gpioreg.Register(&p); err != nil {
+			t.Fatal(err)
+		}
+		n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+		cfg := config.Switch{
+			Platform: "gpio",
+			Name:     "Relay",
+			Pin:      config.Pin{Number: p.N, Inverted: l.inverted},
+		}
+		if err := n.loadSwitch(context.Background(), &cfg); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		s := n.entities[0]
+		if p.L == l.on {
+			t.Errorf("#%d: expected off at start", i)
+		}
+		if _, ok := s.describe().(*aioesphomeapi.ListEntitiesSwitchResponse); !ok {
+			t.Errorf("#%d: unexpected %T", i, s.describe())
+		}
+		if err := s.switchCommand(&aioesphomeapi.SwitchCommandRequest{State: true}); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if p.L != l.on {
+			t.Errorf("#%d: expected on", i)
+		}
+		if !s.getState().(*aioesphomeapi.SwitchStateResponse).State {
+			t.Errorf("#%d: expected state on", i)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("#%d: %s", i, err)
+		}
+		if p.L == l.on {
+			t.Errorf("#%d: expected off after Close", i)
+		}
+		if err := gpioreg.Unregister(p.N); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSwitchGPIO_OpenDrain(t *testing.T) {
+	data := []struct {
+		inverted bool
+		// on is true when the pin floats while the switch is on.
+		on bool
+	}{
+		{false, true},
+		{true, false},
+	}
+	for i, l := range data {
+		p := gpiotest.Pin{N: "FAKE_GPIO_RELAY", P: gpio.PullUp, L: gpio.High}
+		if err := gpioreg.Register(&p); err != nil {
+			t.Fatal(err)
+		}
+		n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+		cfg := config.Switch{
+			Platform: "gpio",
+			Name:     "Relay",
+			Pin:      config.Pin{Number: p.N, Mode: config.OutputOpenDrain, Inverted: l.inverted},
+		}
+		if err := n.loadSwitch(context.Background(), &cfg); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		s := n.entities[0]
+		// check verifies the pin floats or is pulled low, then resets it to
+		// detect the next change.
+		check := func(on bool) {
+			if f := p.P == gpio.Float; f != (on == l.on) {
+				t.Errorf("#%d: %t: unexpected float %t", i, on, f)
+			}
+			if on != l.on && p.L != gpio.Low {
+				t.Errorf("#%d: %t: expected pulled low", i, on)
+			}
+			p.P = gpio.PullUp
+			p.L = gpio.High
+		}
+		// The switch starts off.
+		check(false)
+		for _, on := range []bool{true, false} {
+			if err := s.switchCommand(&aioesphomeapi.SwitchCommandRequest{State: on}); err != nil {
+				t.Fatalf("#%d: %s", i, err)
+			}
+			check(on)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("#%d: %s", i, err)
+		}
+		if err := gpioreg.Unregister(p.N); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSwitchGPIO_Pulse(t *testing.T) {
+	p := gpiotest.Pin{N: "FAKE_GPIO_RELAY"}
+	if err := gpioreg.Register(&p); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := gpioreg.Unregister(p.N); err != nil {
+			t.Error(err)
+		}
+	}()
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.Switch{
+		Platform: "gpio",
+		Name:     "Gate",
+		Pin:      config.Pin{Number: p.N},
+		Pulse:    10 * time.Millisecond,
+	}
+	if err := n.loadSwitch(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	s := n.entities[0]
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chanConn, 10)
+	go s.subscribe(ctx, c)
+	// Initial state.
+	if (<-c).(*aioesphomeapi.SwitchStateResponse).State {
+		t.Fatal("expected off")
+	}
+	if err := s.switchCommand(&aioesphomeapi.SwitchCommandRequest{State: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !(<-c).(*aioesphomeapi.SwitchStateResponse).State {
+		t.Fatal("expected on")
+	}
+	if (<-c).(*aioesphomeapi.SwitchStateResponse).State {
+		t.Fatal("expected off after the pulse")
+	}
+	if l := p.Read(); l != gpio.Low {
+		t.Fatalf("expected the pin to be back at rest, got %s", l)
+	}
+
+	// Close cuts a pulse short.
+	cfg.Pulse = time.Hour
+	n = &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	if err := n.loadSwitch(context.Background(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	s = n.entities[0]
+	if err := s.switchCommand(&aioesphomeapi.SwitchCommandRequest{State: true}); err != nil {
+		t.Fatal(err)
+	}
+	if l := p.Read(); l != gpio.High {
+		t.Fatalf("expected the pin to be driven, got %s", l)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if l := p.Read(); l != gpio.Low {
+		t.Fatalf("expected the pin to be back at rest, got %s", l)
+	}
+	if s.(*switchGPIO).timer != nil {
+		t.Fatal("expected the pulse to be canceled")
+	}
+}
+
+// chanConn is a clientConn forwarding the replies to a channel.
+type chanConn chan proto.Message
+
+func (c chanConn) reply(msg proto.Message) error {
+	c <- msg
+	return nil
+}
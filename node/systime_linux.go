@@ -0,0 +1,38 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// setSystemTime sets the system clock.
+func setSystemTime(t time.Time) error {
+	tv := syscall.NsecToTimeval(t.UnixNano())
+	return syscall.Settimeofday(&tv)
+}
+
+// capSysTime is CAP_SYS_TIME, as defined in linux/capability.h.
+const capSysTime = 25
+
+// canSetSystemTime returns true if the process has the capability to set the
+// system clock.
+func canSetSystemTime() bool {
+	b, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(l, "CapEff:") {
+			caps, err := strconv.ParseUint(strings.TrimSpace(l[len("CapEff:"):]), 16, 64)
+			return err == nil && caps&(1<<capSysTime) != 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package node
+
+import (
+	"errors"
+	"time"
+)
+
+// setSystemTime sets the system clock.
+func setSystemTime(t time.Time) error {
+	return errors.New("setting the system time is not supported on this OS")
+}
+
+// canSetSystemTime returns true if the process has the permission to set the
+// system clock.
+func canSetSystemTime() bool {
+	return false
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"periph.io/x/home/node/config"
+)
+
+func (n *Node) loadTextSensor(ctx context.Context, cfg *config.TextSensor) error {
+	log.Printf("loading text_sensor %s", cfg.Platform)
+	switch cfg.Platform {
+	case "boot_reason":
+		if err := n.loadTextSensorBootReason(ctx, cfg); err != nil {
+			return fmt.Errorf("text_sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "boot_time":
+		if err := n.loadTextSensorBootTime(ctx, cfg); err != nil {
+			return fmt.Errorf("text_sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "config_status":
+		if err := n.loadTextSensorConfigStatus(ctx, cfg); err != nil {
+			return fmt.Errorf("text_sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "last_error":
+		if err := n.loadTextSensorLastError(ctx, cfg); err != nil {
+			return fmt.Errorf("text_sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	case "template":
+		if err := n.loadTextSensorTemplate(ctx, cfg); err != nil {
+			return fmt.Errorf("text_sensor(%s): %w", cfg.Platform, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown platform %q", cfg.Platform)
+	}
+}
+
+// loadTextSensorConfigError loads the text sensor reporting why the
+// configuration failed to load in safe mode.
+func (n *Node) loadTextSensorConfigError(ctx context.Context, cfgErr error) error {
+	t := &textSensorDiagnostic{
+		componentBase: componentBase{name: "Config Error"},
+		icon:          "mdi:alert-circle-outline",
+	}
+	if err := n.addEntity(ctx, t); err != nil {
+		return err
+	}
+	t.setValue(strings.TrimSpace(cfgErr.Error()))
+	return nil
+}
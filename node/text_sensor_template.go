@@ -0,0 +1,136 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadTextSensorTemplate loads a text sensor whose state is the output of a
+// shell command or the content of a file, e.g. the kernel version or an IP
+// address.
+func (n *Node) loadTextSensorTemplate(ctx context.Context, cfg *config.TextSensor) error {
+	if cfg.Command == "" && cfg.File == "" {
+		return errors.New("command or file is required")
+	}
+	t := &textSensorTemplate{
+		componentBase: componentBase{
+			name:          cfg.Name,
+			componentType: textSensorComponent,
+		},
+		icon:    cfg.Icon,
+		command: cfg.Command,
+		file:    cfg.File,
+		update:  cfg.UpdateInterval,
+	}
+	if t.update == 0 {
+		t.update = time.Minute
+	}
+	return n.addEntity(ctx, t)
+}
+
+type textSensorTemplate struct {
+	componentBase
+	icon    string
+	command string
+	file    string
+	update  time.Duration
+
+	wg     sync.WaitGroup
+	cancel func()
+}
+
+func (t *textSensorTemplate) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+func (t *textSensorTemplate) init(ctx context.Context, n *Node) error {
+	if err := t.componentBase.init(ctx, n); err != nil {
+		return err
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.refresh(ctx)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		tick := time.NewTicker(t.update)
+		defer tick.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				t.refresh(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// refresh reads the value and publishes it.
+func (t *textSensorTemplate) refresh(ctx context.Context) {
+	v, err := t.read(ctx)
+	if err != nil {
+		t.setError(err)
+		t.onNewState(&aioesphomeapi.TextSensorStateResponse{Key: t.key, MissingState: true})
+		return
+	}
+	// Home Assistant truncates states to 255 characters. Cut at the start of a
+	// rune, so the state stays valid UTF-8.
+	if len(v) > 255 {
+		i := 252
+		for i > 0 && !utf8.RuneStart(v[i]) {
+			i--
+		}
+		v = v[:i] + "..."
+	}
+	t.onNewState(&aioesphomeapi.TextSensorStateResponse{Key: t.key, State: v})
+}
+
+// read returns the trimmed output of the command or content of the file.
+func (t *textSensorTemplate) read(ctx context.Context) (string, error) {
+	if t.file != "" {
+		/* #nosec G304 */
+		b, err := ioutil.ReadFile(t.file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	// Do not let a stuck command block the updates.
+	ctx, cancel := context.WithTimeout(ctx, t.update)
+	defer cancel()
+	/* #nosec G204 */
+	out, err := exec.CommandContext(ctx, "/bin/sh", "-c", t.command).Output()
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", t.command, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (t *textSensorTemplate) describe() proto.Message {
+	return &aioesphomeapi.ListEntitiesTextSensorResponse{
+		ObjectId: t.objectID,
+		Key:      t.key,
+		Name:     t.name,
+		UniqueId: t.uniqueID,
+		Icon:     t.icon,
+	}
+}
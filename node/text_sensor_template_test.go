@@ -0,0 +1,72 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestTextSensorTemplate(t *testing.T) {
+	d, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	p := filepath.Join(d, "version")
+	if err = ioutil.WriteFile(p, []byte(" v1.2.3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// 401 bytes, "é" being 2 bytes starting at odd offsets.
+	long := filepath.Join(d, "long")
+	if err = ioutil.WriteFile(long, []byte("a"+strings.Repeat("é", 200)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		cfg     config.TextSensor
+		state   string
+		missing bool
+	}{
+		{config.TextSensor{File: p}, "v1.2.3", false},
+		{config.TextSensor{File: filepath.Join(d, "missing")}, "", true},
+		{config.TextSensor{File: long}, "a" + strings.Repeat("é", 125) + "...", false},
+		{config.TextSensor{Command: "echo hello; echo"}, "hello", false},
+		{config.TextSensor{Command: "exit 1"}, "", true},
+	}
+	for i, l := range data {
+		if l.cfg.Command != "" && runtime.GOOS == "windows" {
+			continue
+		}
+		n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+		l.cfg.Platform = "template"
+		l.cfg.Name = "Version"
+		if err = n.loadTextSensor(context.Background(), &l.cfg); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		s := n.entities[0].getState().(*aioesphomeapi.TextSensorStateResponse)
+		if s.State != l.state || s.MissingState != l.missing {
+			t.Fatalf("#%d: unexpected state %v", i, s)
+		}
+		if err = n.entities[0].Close(); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+	}
+}
+
+func TestTextSensorTemplate_Err(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	cfg := config.TextSensor{Platform: "template", Name: "Version"}
+	if err := n.loadTextSensor(context.Background(), &cfg); err == nil {
+		t.Fatal("expected error")
+	}
+}
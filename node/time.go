@@ -0,0 +1,63 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"periph.io/x/home/node/config"
+)
+
+// timeSource is a source of time that is authoritative over the system clock.
+type timeSource interface {
+	Close() error
+	Now() (time.Time, error)
+}
+
+func (n *Node) loadTime(ctx context.Context, cfg *config.Time) error {
+	log.Printf("loading time %s", cfg.Platform)
+	var err error
+	switch cfg.Platform {
+	case "ds3231":
+		err = n.loadTimeDS3231(ctx, cfg)
+	case "homeassistant":
+		// The system time is set upon each synchronization.
+		if err = n.loadTimeHomeAssistant(ctx, cfg); err == nil {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown platform %q", cfg.Platform)
+	}
+	if err != nil {
+		return fmt.Errorf("time(%s): %w", cfg.Platform, err)
+	}
+	if cfg.SetSystemTime {
+		now, err := n.clock.Now()
+		if err != nil {
+			return fmt.Errorf("time(%s): %w", cfg.Platform, err)
+		}
+		log.Printf("setting system time to %s", now)
+		if err = setSystemTime(now); err != nil {
+			return fmt.Errorf("time(%s): failed to set system time: %w", cfg.Platform, err)
+		}
+	}
+	return nil
+}
+
+// now returns the current time from the configured time source, falling back
+// to the system clock.
+func (n *Node) now() time.Time {
+	if n.clock != nil {
+		t, err := n.clock.Now()
+		if err == nil {
+			return t
+		}
+		log.Printf("time: %s", err)
+	}
+	return time.Now()
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/home/node/config"
+)
+
+// loadTimeDS3231 loads a DS3231 real time clock.
+//
+// The RTC is expected to be set in UTC, like hwclock does by default.
+//
+// Datasheet: https://datasheets.maximintegrated.com/en/ds/DS3231.pdf
+func (n *Node) loadTimeDS3231(ctx context.Context, cfg *config.Time) error {
+	addr := uint16(0x68)
+	if cfg.Address != 0 {
+		addr = uint16(cfg.Address)
+	}
+	b, err := i2creg.Open("")
+	if err != nil {
+		return err
+	}
+	t := &timeDS3231{bus: b, d: i2c.Dev{Bus: b, Addr: addr}}
+	// Confirm the device is present and has a valid time.
+	var status [1]byte
+	if err = t.d.Tx([]byte{0x0F}, status[:]); err != nil {
+		_ = b.Close()
+		return err
+	}
+	if status[0]&0x80 != 0 {
+		// Oscillator Stop Flag: the time is not valid, e.g. the battery died.
+		_ = b.Close()
+		return errors.New("the oscillator was stopped, the time needs to be set")
+	}
+	if _, err = t.Now(); err != nil {
+		_ = b.Close()
+		return err
+	}
+	n.clock = t
+	return nil
+}
+
+type timeDS3231 struct {
+	mu  sync.Mutex
+	bus i2c.BusCloser
+	d   i2c.Dev
+}
+
+func (t *timeDS3231) Close() error {
+	return t.bus.Close()
+}
+
+// Now reads the current time from the RTC.
+func (t *timeDS3231) Now() (time.Time, error) {
+	var r [7]byte
+	t.mu.Lock()
+	err := t.d.Tx([]byte{0x00}, r[:])
+	t.mu.Unlock()
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec := fromBCD(r[0] & 0x7F)
+	min := fromBCD(r[1] & 0x7F)
+	var hour int
+	if r[2]&0x40 != 0 {
+		// 12 hours mode.
+		hour = fromBCD(r[2]&0x1F) % 12
+		if r[2]&0x20 != 0 {
+			hour += 12
+		}
+	} else {
+		hour = fromBCD(r[2] & 0x3F)
+	}
+	day := fromBCD(r[4] & 0x3F)
+	month := fromBCD(r[5] & 0x1F)
+	year := 2000 + fromBCD(r[6])
+	if r[5]&0x80 != 0 {
+		// Century bit.
+		year += 100
+	}
+	if sec > 59 || min > 59 || hour > 23 || day < 1 || day > 31 || month < 1 || month > 12 {
+		log.Printf("ds3231: invalid registers %x", r)
+		return time.Time{}, errors.New("ds3231: invalid time")
+	}
+	return time.Date(year, time.Month(month), day, hour, min, sec, 0, time.UTC), nil
+}
+
+// fromBCD decodes a binary coded decimal byte.
+func fromBCD(b byte) int {
+	return int(b>>4)*10 + int(b&0x0F)
+}
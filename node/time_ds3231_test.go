@@ -0,0 +1,50 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2ctest"
+)
+
+func TestTimeDS3231_Now(t *testing.T) {
+	data := []struct {
+		r    []byte
+		want time.Time
+	}{
+		// 24 hours mode.
+		{
+			[]byte{0x56, 0x34, 0x23, 0x01, 0x31, 0x12, 0x21},
+			time.Date(2021, 12, 31, 23, 34, 56, 0, time.UTC),
+		},
+		// 12 hours mode, 12:05 AM.
+		{
+			[]byte{0x00, 0x05, 0x52, 0x01, 0x01, 0x01, 0x22},
+			time.Date(2022, 1, 1, 0, 5, 0, 0, time.UTC),
+		},
+		// 12 hours mode, 3:00 PM.
+		{
+			[]byte{0x00, 0x00, 0x63, 0x01, 0x01, 0x01, 0x22},
+			time.Date(2022, 1, 1, 15, 0, 0, 0, time.UTC),
+		},
+	}
+	for i, line := range data {
+		bus := &i2ctest.Playback{Ops: []i2ctest.IO{{Addr: 0x68, W: []byte{0x00}, R: line.r}}}
+		d := timeDS3231{bus: bus, d: i2c.Dev{Bus: bus, Addr: 0x68}}
+		got, err := d.Now()
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if !got.Equal(line.want) {
+			t.Errorf("#%d: %s != %s", i, line.want, got)
+		}
+		if err = d.Close(); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadTimeHomeAssistant loads a time source synchronized from the connected
+// clients, for hosts without a real time clock nor network time.
+//
+// The time is requested upon each connection and then every update_interval.
+// With set_system_time, the system clock is set when the process has the
+// permission, otherwise an offset is applied to the time reported by the
+// node.
+func (n *Node) loadTimeHomeAssistant(ctx context.Context, cfg *config.Time) error {
+	t := &timeHomeAssistant{
+		n:         n,
+		interval:  cfg.UpdateInterval,
+		setSystem: cfg.SetSystemTime,
+	}
+	if t.interval == 0 {
+		t.interval = 15 * time.Minute
+	}
+	if t.setSystem && !canSetSystemTime() {
+		log.Printf("not permitted to set the system time, keeping an offset instead")
+		t.setSystem = false
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.wg.Add(1)
+	go t.run(ctx)
+	n.clock = t
+	return nil
+}
+
+type timeHomeAssistant struct {
+	n        *Node
+	interval time.Duration
+	wg       sync.WaitGroup
+	cancel   func()
+
+	// mu protects the fields below.
+	mu        sync.Mutex
+	setSystem bool
+	// offset is the difference between the clients' time and the system
+	// clock.
+	offset time.Duration
+}
+
+func (t *timeHomeAssistant) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+// Now returns the system time corrected by the last synchronization.
+func (t *timeHomeAssistant) Now() (time.Time, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Now().Add(t.offset), nil
+}
+
+// run requests the time from the connected clients every interval.
+func (t *timeHomeAssistant) run(ctx context.Context) {
+	defer t.wg.Done()
+	tick := time.NewTicker(t.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			t.n.requestTime()
+		}
+	}
+}
+
+// update synchronizes with the time received from a client.
+func (t *timeHomeAssistant) update(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.setSystem {
+		err := setSystemTime(now)
+		if err == nil {
+			t.offset = 0
+			return
+		}
+		log.Printf("time: failed to set system time, keeping an offset instead: %s", err)
+		t.setSystem = false
+	}
+	// The resolution is one second, so ignore a smaller difference instead of
+	// jittering.
+	if d := time.Until(now); d >= time.Second || d <= -time.Second {
+		t.offset = d
+	} else {
+		t.offset = 0
+	}
+}
+
+// requestTime asks the connected clients for the current time.
+func (n *Node) requestTime() {
+	n.connsMu.Lock()
+	conns := make([]*conn, 0, len(n.conns))
+	for c := range n.conns {
+		if c.isConnected() {
+			conns = append(conns, c)
+		}
+	}
+	n.connsMu.Unlock()
+	for _, c := range conns {
+		if err := c.reply(&aioesphomeapi.GetTimeRequest{}); err != nil {
+			log.Printf("time: %s", err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestTimeHomeAssistant(t *testing.T) {
+	shouldLog = testing.Verbose()
+	port := getFreePort(t)
+	y := fmt.Sprintf("periphhome:\n  name: pi\napi:\n  port: %d\ntime:\n  - platform: homeassistant\n    update_interval: 10ms\n", port)
+	cfg := &config.Root{}
+	if err := cfg.LoadYaml([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	tc := dialTestClient(t, port, "")
+	defer tc.close()
+	// The time is requested upon connection.
+	if _, ok := tc.recv().(*aioesphomeapi.GetTimeRequest); !ok {
+		t.Fatal("expected GetTimeRequest")
+	}
+	want := time.Now().Add(time.Hour)
+	tc.send(&aioesphomeapi.GetTimeResponse{EpochSeconds: uint32(want.Unix())})
+	// The clients get the corrected time.
+	tc.send(&aioesphomeapi.GetTimeRequest{})
+	requests := 0
+	for {
+		msg := tc.recv()
+		if _, ok := msg.(*aioesphomeapi.GetTimeRequest); ok {
+			// Requested again every update_interval.
+			requests++
+			continue
+		}
+		r, ok := msg.(*aioesphomeapi.GetTimeResponse)
+		if !ok {
+			t.Fatalf("unexpected %T", msg)
+		}
+		if d := time.Unix(int64(r.EpochSeconds), 0).Sub(want); d < -2*time.Second || d > 2*time.Second {
+			t.Fatalf("unexpected %s", d)
+		}
+		break
+	}
+	for requests == 0 {
+		if _, ok := tc.recv().(*aioesphomeapi.GetTimeRequest); ok {
+			requests++
+		}
+	}
+}
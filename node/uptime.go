@@ -0,0 +1,86 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// loadSensorUptime loads a diagnostic sensor reporting the number of seconds
+// since the node started.
+func (n *Node) loadSensorUptime(ctx context.Context, cfg *config.Sensor) error {
+	if cfg.Temperature.Name != "" || cfg.Pressure.Name != "" || cfg.Humidity.Name != "" || cfg.Address != 0 {
+		return errors.New("do not use temperature / pressure / humidity / address")
+	}
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	update := cfg.UpdateInterval
+	if update == 0 {
+		update = time.Minute
+	}
+	s := &sensorDiagnostic{
+		sensorBase: sensorBase{
+			componentBase: componentBase{name: cfg.Name},
+			calibration:   cfg.CalibrateLinear,
+			icon:          "mdi:timer-outline",
+			unit:          "s",
+			deviceClass:   "duration",
+			stateClass:    aioesphomeapi.SensorStateClass_STATE_CLASS_TOTAL_INCREASING,
+		},
+	}
+	s.override(cfg.UnitOfMeasurement, cfg.AccuracyDecimals, cfg.DeviceClass, cfg.StateClass)
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	s.stop = func() {
+		cancel()
+		wg.Wait()
+	}
+	if err := n.addEntity(ctx, s); err != nil {
+		cancel()
+		return err
+	}
+	start := n.startTime
+	s.setValue(float32(time.Since(start) / time.Second))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(update)
+		defer t.Stop()
+		done := ctx.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				s.setValue(float32(time.Since(start) / time.Second))
+			}
+		}
+	}()
+	return nil
+}
+
+// loadTextSensorBootTime loads a diagnostic text sensor reporting when the
+// node started, as RFC 3339.
+func (n *Node) loadTextSensorBootTime(ctx context.Context, cfg *config.TextSensor) error {
+	if cfg.Name == "" {
+		return errors.New("name is required")
+	}
+	t := &textSensorDiagnostic{
+		componentBase: componentBase{name: cfg.Name},
+		icon:          "mdi:clock-start",
+	}
+	if err := n.addEntity(ctx, t); err != nil {
+		return err
+	}
+	t.setValue(n.startTime.Format(time.RFC3339))
+	return nil
+}
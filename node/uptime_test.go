@@ -0,0 +1,65 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestUptime(t *testing.T) {
+	shouldLog = testing.Verbose()
+	start := time.Now().Add(-time.Hour)
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}, startTime: start}
+	ctx := context.Background()
+	if err := n.loadSensor(ctx, &config.Sensor{Platform: "uptime", Name: "Uptime", UpdateInterval: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.loadTextSensor(ctx, &config.TextSensor{Platform: "boot_time", Name: "Boot Time"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := n.closeComponents(time.Time{}); err != nil {
+			t.Error(err)
+		}
+	}()
+	d := n.entities[0].describe().(*aioesphomeapi.ListEntitiesSensorResponse)
+	if d.UnitOfMeasurement != "s" || d.DeviceClass != "duration" || d.EntityCategory != aioesphomeapi.EntityCategory_ENTITY_CATEGORY_DIAGNOSTIC {
+		t.Fatalf("unexpected %v", d)
+	}
+	_, ch, _ := n.entities[0].(*sensorDiagnostic).register()
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-ch:
+			want := float32(time.Since(start) / time.Second)
+			if s := msg.(*aioesphomeapi.SensorStateResponse).State; s < want-2 || s > want {
+				t.Fatalf("got %g; want %g", s, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+		}
+	}
+	if s := stateString(n.entities[1]); s != start.Format(time.RFC3339) {
+		t.Fatal(s)
+	}
+}
+
+func TestUptime_Err(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	data := []config.Sensor{
+		{},
+		{Name: "Uptime", Address: 0x76},
+	}
+	for i := range data {
+		data[i].Platform = "uptime"
+		if err := n.loadSensor(context.Background(), &data[i]); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
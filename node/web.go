@@ -0,0 +1,224 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+// webPort returns the configured web server port.
+func (n *Node) webPort() int {
+	if p := n.cfg.WebServer.Port; p != 0 {
+		return p
+	}
+	return 80
+}
+
+// webServer starts the HTTP server.
+//
+// When a certificate is configured, it is loaded right away so a broken pair
+// is reported at startup.
+func (n *Node) webServer(ctx context.Context, port int) error {
+	log.Printf("loading web server on port %d", port)
+	var tlsCfg *tls.Config
+	if c := &n.cfg.WebServer; c.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return err
+		}
+		tlsCfg = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	ln, err := listen(ctx, "web_server", n.bind, port)
+	if err != nil {
+		return err
+	}
+	logf("listening on %s", ln.Addr())
+	n.web = &http.Server{
+		Handler:           n.webHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		TLSConfig:         tlsCfg,
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if tlsCfg != nil {
+			_ = n.web.ServeTLS(ln, "", "")
+		} else {
+			_ = n.web.Serve(ln)
+		}
+	}()
+	return nil
+}
+
+func (n *Node) webHandler() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/api/entities", n.webEntities)
+	m.HandleFunc("/api/camera/", n.webCamera)
+	if n.cfg.WebServer.History {
+		m.HandleFunc("/history/", n.webHistory)
+	}
+	return m
+}
+
+// webCamera streams a camera as MJPEG at /api/camera/<object_id>/stream.
+//
+// The token is never logged.
+func (n *Node) webCamera(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/camera/"), "/")
+	if len(parts) != 2 || parts[1] != "stream" {
+		http.NotFound(w, r)
+		return
+	}
+	var c *cameraBase
+	n.mu.RLock()
+	for _, e := range n.entities {
+		if cam, ok := e.(interface{ camera() *cameraBase }); ok && cam.camera().objectID == parts[0] {
+			c = cam.camera()
+			break
+		}
+	}
+	n.mu.RUnlock()
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if c.webToken != "" && !checkWebToken(w, requestWebToken(r), c.webToken) {
+		return
+	}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	frames := c.latestFrames(ctx, &wg)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	// Start with the current frame, if any.
+	if msg, ok := c.getState().(*aioesphomeapi.CameraImageResponse); ok {
+		if writeMJPEGFrame(w, msg.Data) != nil {
+			return
+		}
+		f.Flush()
+	}
+	done := ctx.Done()
+	for {
+		select {
+		case <-done:
+			return
+		case b := <-frames:
+			if writeMJPEGFrame(w, b) != nil {
+				return
+			}
+			f.Flush()
+		}
+	}
+}
+
+// requestWebToken returns the token passed either as a "Authorization:
+// Bearer" header or as the "token" query parameter.
+func requestWebToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// checkWebToken returns true if got matches want, otherwise it writes the
+// error response.
+func checkWebToken(w http.ResponseWriter, got, want string) bool {
+	if got == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "token required", http.StatusUnauthorized)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		http.Error(w, "invalid token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// writeMJPEGFrame writes one part of a multipart/x-mixed-replace stream.
+func writeMJPEGFrame(w io.Writer, b []byte) error {
+	if _, err := fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(b)); err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// webEntity is an entity as returned by /api/entities.
+type webEntity struct {
+	Name        string     `json:"name"`
+	UniqueID    string     `json:"unique_id"`
+	Type        string     `json:"type"`
+	State       string     `json:"state"`
+	LastChanged *time.Time `json:"last_changed,omitempty"`
+	LastUpdated *time.Time `json:"last_updated,omitempty"`
+	// LastError is the last failure reading or commanding the hardware.
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// webEntities returns the current state of all entities.
+func (n *Node) webEntities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	out := make([]webEntity, 0, len(n.entities))
+	for _, e := range n.entities {
+		d := webEntity{
+			Name:     n.friendlyName(e.getName()),
+			UniqueID: e.getUniqueID(),
+			Type:     string(e.getType()),
+			State:    stateString(e),
+		}
+		if changed, updated := e.getTimestamps(); !updated.IsZero() {
+			d.LastChanged = &changed
+			d.LastUpdated = &updated
+		}
+		if msg, t := e.getLastError(); msg != "" {
+			d.LastError = msg
+			d.LastErrorTime = &t
+		}
+		out = append(out, d)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		log.Printf("web: %s", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// recordingCamera is implemented by the cameras that can record in a
+// directory.
+type recordingCamera interface {
+	camera() *cameraBase
+	// recordDir returns the directory the frames are recorded in, if any.
+	recordDir() string
+}
+
+// historyCookie holds the camera's web_token once it was passed as a query
+// parameter, so the browser's player can fetch the segments.
+const historyCookie = "token"
+
+// webHistory serves the recordings of the cameras.
+//
+// /history/ lists the cameras with a directory whose web_token, if any, is
+// passed by the request, and /history/<object_id>/ serves the directory as-is,
+// including the index.m3u8 HLS playlist. Range requests are supported.
+func (n *Node) webHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	var cams []historyCamera
+	var c *cameraBase
+	dir := ""
+	id := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/history/"), "/", 2)[0]
+	token := requestWebToken(r)
+	n.mu.RLock()
+	for _, e := range n.entities {
+		rec, ok := e.(recordingCamera)
+		if !ok || rec.recordDir() == "" {
+			continue
+		}
+		cam := rec.camera()
+		if cam.objectID == id {
+			c = cam
+			dir = rec.recordDir()
+		}
+		// Only list the cameras the request has access to.
+		if cam.webToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cam.webToken)) != 1 {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(rec.recordDir(), hlsPlaylist))
+		cams = append(cams, historyCamera{Name: n.friendlyName(e.getName()), ObjectID: cam.objectID, Playlist: err == nil})
+	}
+	n.mu.RUnlock()
+	if id == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := historyIndex.Execute(w, cams); err != nil {
+			log.Printf("web: %s", err)
+		}
+		return
+	}
+	if c == nil {
+		http.NotFound(w, r)
+		return
+	}
+	prefix := "/history/" + id
+	if r.URL.Path == prefix {
+		http.Redirect(w, r, id+"/", http.StatusMovedPermanently)
+		return
+	}
+	if c.webToken != "" {
+		got := requestWebToken(r)
+		fromQuery := got != "" && r.Header.Get("Authorization") == ""
+		if got == "" {
+			if ck, err := r.Cookie(historyCookie); err == nil {
+				got = ck.Value
+			}
+		}
+		if !checkWebToken(w, got, c.webToken) {
+			return
+		}
+		if fromQuery {
+			http.SetCookie(w, &http.Cookie{
+				Name:     historyCookie,
+				Value:    got,
+				Path:     prefix + "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+	}
+	// The mime package doesn't know the HLS types on all OSes.
+	switch path.Ext(r.URL.Path) {
+	case ".m3u8":
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	case ".ts":
+		w.Header().Set("Content-Type", "video/mp2t")
+	}
+	// The recording in progress must not be cached.
+	w.Header().Set("Cache-Control", "no-cache")
+	http.StripPrefix(prefix, http.FileServer(http.Dir(dir))).ServeHTTP(w, r)
+}
+
+// historyCamera is a camera listed at /history/.
+type historyCamera struct {
+	Name     string
+	ObjectID string
+	// Playlist is set when the directory contains an HLS playlist.
+	Playlist bool
+}
+
+var historyIndex = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Recordings</title></head>
+<body>
+<h1>Recordings</h1>
+<ul>
+{{- range .}}
+<li><a href="{{.ObjectID}}/">{{.Name}}</a>{{if .Playlist}} (<a href="{{.ObjectID}}/index.m3u8">playlist</a>){{end}}</li>
+{{- else}}
+<li>No camera is recording.</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
@@ -0,0 +1,140 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"periph.io/x/home/node/config"
+)
+
+func TestWebHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, hlsPlaylist), []byte("#EXTM3U\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "20210304-050607.ts"), []byte("segment"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n := &Node{cfg: &config.Root{WebServer: config.WebServer{History: true}}, lookup: map[uint32]component{}}
+	c := &historyTestCamera{
+		cameraBase: cameraBase{
+			componentBase: componentBase{name: "Front Door", componentType: cameraComponent},
+			webToken:      "secret",
+		},
+		dir: dir,
+	}
+	if err = n.addEntity(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	garageCam := &historyTestCamera{
+		cameraBase: cameraBase{componentBase: componentBase{name: "Garage", componentType: cameraComponent}},
+		dir:        dir,
+	}
+	if err = n.addEntity(context.Background(), garageCam); err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(n.webHandler())
+	defer s.Close()
+	// Don't follow redirects to check them.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	get := func(path string, hdr ...string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, s.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(b)
+	}
+
+	// The cameras with a web_token are only listed with it.
+	const frontDoor = `<a href="frontdoor/">Front Door</a> (<a href="frontdoor/index.m3u8">playlist</a>)`
+	const garage = `<a href="garage/">Garage</a>`
+	resp, body := get("/history/")
+	if resp.StatusCode != http.StatusOK || strings.Contains(body, "frontdoor") || !strings.Contains(body, garage) {
+		t.Fatalf("%d: %s", resp.StatusCode, body)
+	}
+	resp, body = get("/history/?token=wrong")
+	if resp.StatusCode != http.StatusOK || strings.Contains(body, "frontdoor") {
+		t.Fatalf("%d: %s", resp.StatusCode, body)
+	}
+	for _, r := range [][]string{{"/history/?token=secret"}, {"/history/", "Authorization", "Bearer secret"}} {
+		resp, body = get(r[0], r[1:]...)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, frontDoor) || !strings.Contains(body, garage) {
+			t.Fatalf("%d: %s", resp.StatusCode, body)
+		}
+	}
+	data := []struct {
+		path string
+		want int
+	}{
+		{"/history/frontdoor", http.StatusMovedPermanently},
+		{"/history/backdoor/", http.StatusNotFound},
+		{"/history/frontdoor/index.m3u8", http.StatusUnauthorized},
+		{"/history/frontdoor/index.m3u8?token=wrong", http.StatusForbidden},
+	}
+	for i, l := range data {
+		if resp, _ := get(l.path); resp.StatusCode != l.want {
+			t.Fatalf("#%d: %d != %d", i, resp.StatusCode, l.want)
+		}
+	}
+
+	resp, body = get("/history/frontdoor/index.m3u8?token=secret")
+	if resp.StatusCode != http.StatusOK || body != "#EXTM3U\n" || resp.Header.Get("Content-Type") != "application/vnd.apple.mpegurl" {
+		t.Fatalf("%d: %s", resp.StatusCode, body)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "secret" || cookies[0].Path != "/history/frontdoor/" {
+		t.Fatalf("unexpected %v", cookies)
+	}
+	// The player fetches the segments with the cookie, possibly by range.
+	resp, body = get("/history/frontdoor/20210304-050607.ts", "Cookie", cookies[0].String(), "Range", "bytes=1-3")
+	if resp.StatusCode != http.StatusPartialContent || body != "egm" || resp.Header.Get("Content-Type") != "video/mp2t" {
+		t.Fatalf("%d: %s", resp.StatusCode, body)
+	}
+
+	// Disabled by default.
+	n.cfg.WebServer.History = false
+	w := httptest.NewRecorder()
+	n.webHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/history/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatal(w.Code)
+	}
+}
+
+type historyTestCamera struct {
+	cameraBase
+	dir string
+}
+
+func (h *historyTestCamera) recordDir() string {
+	return h.dir
+}
+
+func (h *historyTestCamera) Close() error {
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package node
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"periph.io/x/home/node/config"
+	"periph.io/x/home/thirdparty/aioesphomeapi"
+)
+
+func TestWebEntities(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	b := &binarySensorFake{
+		componentBase: componentBase{name: "Motion", componentType: binarySensorComponent},
+	}
+	if err := n.addEntity(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	changed, updated := b.getTimestamps()
+	if changed.IsZero() || !changed.Equal(updated) {
+		t.Fatalf("%s != %s", changed, updated)
+	}
+
+	// Same value: only last_updated moves.
+	time.Sleep(time.Millisecond)
+	b.onNewState(&aioesphomeapi.BinarySensorStateResponse{Key: b.key})
+	changed2, updated2 := b.getTimestamps()
+	if !changed2.Equal(changed) || !updated2.After(updated) {
+		t.Fatalf("unexpected: %s %s", changed2, updated2)
+	}
+
+	// New value: both move.
+	time.Sleep(time.Millisecond)
+	b.onNewState(&aioesphomeapi.BinarySensorStateResponse{Key: b.key, State: true})
+	changed3, updated3 := b.getTimestamps()
+	if !changed3.After(changed2) || !changed3.Equal(updated3) {
+		t.Fatalf("unexpected: %s %s", changed3, updated3)
+	}
+
+	w := httptest.NewRecorder()
+	n.webHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/entities", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+	var got []webEntity
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "Motion" || got[0].State != "ON" || got[0].LastChanged == nil || !got[0].LastChanged.Equal(changed3) {
+		t.Fatalf("unexpected: %+v", got)
+	}
+}
+
+func TestWebCamera(t *testing.T) {
+	n := &Node{cfg: &config.Root{}, lookup: map[uint32]component{}}
+	c := &webTestCamera{cameraBase{
+		componentBase: componentBase{name: "Front Door", componentType: cameraComponent},
+		webToken:      "secret",
+	}}
+	if err := n.addEntity(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(n.webHandler())
+	defer s.Close()
+	get := func(ctx context.Context, path, auth string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	data := []struct {
+		path string
+		auth string
+		want int
+	}{
+		{"/api/camera/frontdoor/stream", "", http.StatusUnauthorized},
+		{"/api/camera/frontdoor/stream?token=wrong", "", http.StatusForbidden},
+		{"/api/camera/frontdoor/stream", "Bearer wrong", http.StatusForbidden},
+		{"/api/camera/backdoor/stream?token=secret", "", http.StatusNotFound},
+		{"/api/camera/frontdoor/snapshot?token=secret", "", http.StatusNotFound},
+	}
+	for i, l := range data {
+		resp := get(context.Background(), l.path, l.auth)
+		_ = resp.Body.Close()
+		if resp.StatusCode != l.want {
+			t.Fatalf("#%d: %d != %d", i, resp.StatusCode, l.want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp := get(ctx, "/api/camera/frontdoor/stream", "Bearer secret")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.StatusCode)
+	}
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The handler registers its subscription before sending the headers.
+	c.onNewState(&aioesphomeapi.CameraImageResponse{Key: c.key, Data: []byte("jpeg"), Done: true})
+	part, err := multipart.NewReader(resp.Body, params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The part only ends at the next boundary; read what was announced.
+	l, err := strconv.Atoi(part.Header.Get("Content-Length"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(part, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "jpeg" {
+		t.Fatalf("unexpected: %q", b)
+	}
+}
+
+type webTestCamera struct {
+	cameraBase
+}
+
+func (w *webTestCamera) Close() error {
+	return nil
+}
+
+func TestWebServer_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "periphhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, k, err := GenerateSelfSignedCert([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Root{WebServer: config.WebServer{
+		TLSCert: filepath.Join(dir, "cert.pem"),
+		TLSKey:  filepath.Join(dir, "key.pem"),
+	}}
+	ctx := context.Background()
+	n := &Node{cfg: cfg, lookup: map[uint32]component{}}
+
+	// The pair is validated at startup.
+	if err := n.webServer(ctx, getFreePort(t)); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := ioutil.WriteFile(cfg.WebServer.TLSCert, c, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cfg.WebServer.TLSKey, k, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	port := getFreePort(t)
+	if err := n.webServer(ctx, port); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = n.web.Close()
+		n.wg.Wait()
+	}()
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(c)
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/api/entities", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Fatal(resp.StatusCode)
+	}
+}